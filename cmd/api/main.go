@@ -1,20 +1,80 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"fmt"
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
+	"image"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 	"urlshortener/internal/api/handlers"
 	"urlshortener/internal/api/middleware"
 	"urlshortener/internal/api/routes"
 	"urlshortener/internal/config"
+	"urlshortener/internal/domain/repositories"
+	"urlshortener/internal/pkg/bots"
 	"urlshortener/internal/pkg/database"
+	"urlshortener/internal/pkg/domains"
+	"urlshortener/internal/pkg/events"
+	"urlshortener/internal/pkg/geoip"
+	"urlshortener/internal/pkg/healthcheck"
+	"urlshortener/internal/pkg/live"
+	"urlshortener/internal/pkg/metadata"
+	"urlshortener/internal/pkg/privacy"
+	"urlshortener/internal/pkg/qr"
+	"urlshortener/internal/pkg/ratelimit"
+	"urlshortener/internal/pkg/retention"
 	"urlshortener/internal/pkg/service"
+	"urlshortener/internal/pkg/tracing"
+	"urlshortener/internal/pkg/visitors"
+	"urlshortener/internal/pkg/webhooks"
+	"urlshortener/internal/pkg/workerpool"
 	"urlshortener/pkg/logger"
 )
 
+// apiHandlers holds the handlers served by the router
+type apiHandlers struct {
+	url      *handlers.URLHandler
+	redirect *handlers.RedirectHandler
+	qr       *handlers.QRHandler
+	campaign *handlers.CampaignHandler
+	live     *handlers.LiveHandler
+	webhook  *handlers.WebhookHandler
+}
+
+// metadataQueueSize bounds the metadata fetches waiting for a worker
+const metadataQueueSize = 100
+
+// shutdownTimeout bounds how long in-flight requests may take to finish once the server is stopping
+const shutdownTimeout = 10 * time.Second
+
+// workers runs the background jobs of the process until its context is cancelled
+type workers struct {
+	ctx context.Context
+	wg  sync.WaitGroup
+}
+
+// start runs job in the background with the context of the workers
+func (w *workers) start(job func(ctx context.Context)) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		job(w.ctx)
+	}()
+}
+
+// wait waits for the background jobs to return
+func (w *workers) wait() {
+	w.wg.Wait()
+}
+
 func main() {
 	// Load configuration
 	cfg, err := loadConfiguration()
@@ -30,17 +90,79 @@ func main() {
 
 	zapLogger := logger.GetLogger()
 
+	// Stop the server and background jobs on SIGTERM or interrupt
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	background := &workers{ctx: ctx}
+
+	// Set up tracing before anything that starts spans
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Options{
+		Exporter:    cfg.TracingExporter,
+		ServiceName: cfg.TracingServiceName,
+		SampleRatio: cfg.TracingSampleRatio,
+	})
+	if err != nil {
+		zapLogger.Fatal("Failed to set up tracing", zap.Error(err))
+	}
+	defer shutdownTracing(context.Background())
+
 	// Setup database connection
 	db, err := setupDatabase(cfg)
 	if err != nil {
 		zapLogger.Fatal("Failed to connect database", zap.Error(err))
 	}
 
+	// Open the GeoIP database used for country targeting, if configured
+	countries, err := openGeoIP(cfg)
+	if err != nil {
+		zapLogger.Fatal("Failed to open GeoIP database", zap.Error(err))
+	}
+	if countries != nil {
+		defer countries.Close()
+	}
+
+	// Load the logo QR codes may embed, if configured
+	var qrLogo image.Image
+	if cfg.QRLogoPath != "" {
+		if qrLogo, err = qr.LoadLogo(cfg.QRLogoPath); err != nil {
+			zapLogger.Fatal("Failed to load QR code logo", zap.Error(err))
+		}
+	}
+
+	// Build the registry of domains short URLs are served on
+	registry, err := domains.NewRegistry(cfg.Domains)
+	if err != nil {
+		zapLogger.Fatal("Invalid domain configuration", zap.Error(err))
+	}
+
+	// Set up the anonymisation of visitors, shared by the service and the request log
+	anonymizer, err := newAnonymizer(cfg)
+	if err != nil {
+		zapLogger.Fatal("Invalid privacy configuration", zap.Error(err))
+	}
+
 	// Initialize dependencies
-	urlHandler := initializeHandlers(db)
+	apiHandlers, err := initializeHandlers(cfg, db, background, countries, registry, qrLogo, anonymizer)
+	if err != nil {
+		zapLogger.Fatal("Failed to initialize repositories", zap.Error(err))
+	}
+
+	idempotency, err := initializeIdempotency(cfg, db)
+	if err != nil {
+		zapLogger.Fatal("Failed to initialize idempotency store", zap.Error(err))
+	}
 
 	// Setup and start the server
-	startServer(cfg, urlHandler, zapLogger)
+	startServer(ctx, cfg, apiHandlers, idempotency, middleware.NewDomainScope(registry), middleware.NewLogging(anonymizer), zapLogger)
+
+	// Let background jobs finish what they are writing before closing the connection they write through
+	stop()
+	background.wait()
+	disconnectCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := db.Disconnect(disconnectCtx); err != nil {
+		zapLogger.Error("Failed to disconnect database", zap.Error(err))
+	}
 }
 
 // loadConfiguration loads the application configuration
@@ -58,26 +180,286 @@ func setupDatabase(cfg *config.Config) (*database.MongoDB, error) {
 	return database.NewMongoDB(cfg.MongoURI, cfg.MongoDB)
 }
 
-// initializeHandlers sets up the repository, service and handlers
-func initializeHandlers(db *database.MongoDB) *handlers.URLHandler {
-	urlRepo := database.NewMongoURLRepository(db)
-	urlService := service.NewURLService(urlRepo)
-	return handlers.NewURLHandler(urlService)
+// openGeoIP opens the GeoIP database, returning nil if none is configured
+func openGeoIP(cfg *config.Config) (*geoip.Reader, error) {
+	if cfg.GeoIPDatabasePath == "" {
+		return nil, nil
+	}
+	return geoip.Open(cfg.GeoIPDatabasePath)
 }
 
-// startServer configures the router and starts the HTTP server
-func startServer(cfg *config.Config, urlHandler *handlers.URLHandler, zapLogger *zap.Logger) {
+// initializeHandlers sets up the repository, service, background checks and handlers
+func initializeHandlers(cfg *config.Config, db *database.MongoDB, background *workers, countries *geoip.Reader, registry *domains.Registry, qrLogo image.Image, anonymizer *privacy.Anonymizer) (*apiHandlers, error) {
+	urlRepo, err := database.NewMongoURLRepository(db, registry.Default().Host)
+	if err != nil {
+		return nil, err
+	}
+	historyRepo, err := database.NewMongoHistoryRepository(db, registry.Default().Host)
+	if err != nil {
+		return nil, err
+	}
+	clickRepo, err := database.NewMongoClickRepository(db)
+	if err != nil {
+		return nil, err
+	}
+	visitorRepo, err := database.NewMongoVisitorSketchRepository(db)
+	if err != nil {
+		return nil, err
+	}
+	campaignRepo := database.NewMongoCampaignRepository(db)
+	webhookRepo, err := database.NewMongoWebhookRepository(db)
+	if err != nil {
+		return nil, err
+	}
+	deliveryRepo, err := database.NewMongoWebhookDeliveryRepository(db)
+	if err != nil {
+		return nil, err
+	}
+	notifier := webhooks.NewNotifier(webhookRepo, deliveryRepo)
+	sinkOpts, err := eventSinkOptions(cfg, db, background)
+	if err != nil {
+		return nil, err
+	}
+
+	hub := live.NewHub(live.Options{Buffer: cfg.LiveBuffer, MaxSubscribers: cfg.LiveMaxSubscribers})
+	opts := append(serviceOptions(cfg, background),
+		service.WithCampaigns(campaignRepo),
+		service.WithClickLog(clickRepo),
+		service.WithPrivacy(anonymizer),
+		service.WithClickStream(hub),
+		service.WithWebhooks(notifier),
+		service.WithUniqueVisitors(startVisitorTracker(cfg, background, visitorRepo)),
+	)
+	opts = append(opts, sinkOpts...)
+	urlService := service.NewURLService(urlRepo, historyRepo, opts...)
+	campaignService := service.NewCampaignService(campaignRepo, urlRepo, clickRepo)
+	webhookService := service.NewWebhookService(webhookRepo, deliveryRepo)
+	startHealthChecker(cfg, background, urlRepo)
+	startRetentionJob(cfg, background, clickRepo)
+	startWebhookDispatcher(cfg, background, webhookRepo, deliveryRepo)
+	startExpiryWatcher(background, urlRepo, notifier)
+
+	botClassifier, err := loadBotClassifier(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	redirectOpts := handlers.RedirectOptions{
+		PasswordAttempts:    ratelimit.NewLimiter(cfg.PasswordMaxAttempts, cfg.PasswordAttemptWindow),
+		InactiveFallbackURL: cfg.InactiveFallbackURL,
+		Bots:                botClassifier,
+		Anonymizer:          anonymizer,
+		PreviewAll:          cfg.PreviewAll,
+	}
+	// Avoid storing a typed nil pointer in the interface
+	if countries != nil {
+		redirectOpts.Countries = countries
+	}
+
+	return &apiHandlers{
+		url:      handlers.NewURLHandler(urlService, registry),
+		redirect: handlers.NewRedirectHandler(urlService, redirectOpts),
+		qr:       handlers.NewQRHandler(urlService, qrLogo),
+		campaign: handlers.NewCampaignHandler(campaignService),
+		live:     handlers.NewLiveHandler(urlService, hub),
+		webhook:  handlers.NewWebhookHandler(webhookService),
+	}, nil
+}
+
+// loadBotClassifier loads the user-agent rules classifying clicks as bots, using the built-in rules if none are configured
+func loadBotClassifier(cfg *config.Config) (*bots.Classifier, error) {
+	if cfg.BotRulesPath == "" {
+		return bots.NewClassifier(), nil
+	}
+	return bots.LoadClassifier(cfg.BotRulesPath)
+}
+
+// newAnonymizer sets up the anonymisation of visitors before anything about them is stored or logged
+func newAnonymizer(cfg *config.Config) (*privacy.Anonymizer, error) {
+	return privacy.NewAnonymizer(privacy.Options{
+		IPMode:       privacy.IPMode(cfg.IPAnonymisation),
+		Secret:       visitorSalt(cfg),
+		SaltRotation: cfg.VisitorSaltRotation,
+	})
+}
+
+// visitorSalt returns the secret salting the hashes identifying visitors in the click log and unique visitor counts.
+// Without a configured salt a random one is used, so the same visitor counts as unique again
+// after a restart and on every instance.
+func visitorSalt(cfg *config.Config) []byte {
+	if cfg.VisitorSalt != "" {
+		return []byte(cfg.VisitorSalt)
+	}
+	logger.GetLogger().Warn("VISITOR_SALT is not set, using a random salt for this process")
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		logger.GetLogger().Fatal("Failed to generate visitor salt", zap.Error(err))
+	}
+	return salt
+}
+
+// serviceOptions configures the optional behaviour of the URL service; metadata workers stop with the background jobs
+func serviceOptions(cfg *config.Config, background *workers) []service.Option {
+	var opts []service.Option
+	if cfg.MetadataWorkers > 0 {
+		fetcher := metadata.NewFetcher(metadata.Options{Timeout: cfg.MetadataTimeout})
+		pool := workerpool.New(cfg.MetadataWorkers, metadataQueueSize)
+		background.start(func(ctx context.Context) {
+			<-ctx.Done()
+			pool.Close()
+		})
+		opts = append(opts, service.WithMetadata(fetcher, pool))
+	}
+	return opts
+}
+
+// startHealthChecker checks the destinations of URLs in the background, if enabled
+func startHealthChecker(cfg *config.Config, background *workers, urlRepo repositories.URLRepository) {
+	if cfg.HealthCheckInterval <= 0 {
+		return
+	}
+	checker := healthcheck.NewChecker(urlRepo, healthcheck.Options{
+		Interval:    cfg.HealthCheckInterval,
+		Concurrency: cfg.HealthCheckConcurrency,
+		HostLimit:   cfg.HealthCheckHostLimit,
+	})
+	background.start(checker.Run)
+}
+
+// startRetentionJob rolls up and deletes raw clicks past retention in the background, if enabled
+func startRetentionJob(cfg *config.Config, background *workers, clickRepo repositories.ClickRepository) {
+	if cfg.ClickRetentionDays <= 0 {
+		return
+	}
+	job := retention.NewJob(clickRepo, time.Duration(cfg.ClickRetentionDays)*24*time.Hour)
+	background.start(job.Run)
+}
+
+// eventSinkOptions configures the emission of domain events to the configured sink, if any.
+// With the outbox, events are stored along with the changes they announce and relayed to the sink in the background.
+func eventSinkOptions(cfg *config.Config, db *database.MongoDB, background *workers) ([]service.Option, error) {
+	sink, err := newEventSink(cfg)
+	if err != nil || sink == nil {
+		return nil, err
+	}
+	if !cfg.EventOutbox {
+		return []service.Option{service.WithEventSink(sink)}, nil
+	}
+
+	outboxRepo, err := database.NewMongoOutboxRepository(db)
+	if err != nil {
+		return nil, err
+	}
+	opts := []service.Option{service.WithEventSink(events.NewOutboxSink(outboxRepo))}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	transactions, err := db.SupportsTransactions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if transactions {
+		opts = append(opts, service.WithTransactions(db))
+	} else {
+		logger.GetLogger().Warn("MongoDB is not a replica set, events are stored in the outbox right after the changes they announce")
+	}
+
+	relay := events.NewRelay(outboxRepo, sink)
+	background.start(relay.Run)
+	return opts, nil
+}
+
+// newEventSink creates the sink domain events are emitted to, or nil if none is configured
+func newEventSink(cfg *config.Config) (events.Sink, error) {
+	switch cfg.EventSink {
+	case "":
+		return nil, nil
+	case "stdout":
+		return events.NewStdoutSink(), nil
+	case "file":
+		sink, err := events.OpenFileSink(cfg.EventSinkPath)
+		if err != nil {
+			return nil, err
+		}
+		return sink, nil
+	case "nats":
+		client, err := events.NewNATSClient(cfg.EventSinkURL, 0)
+		if err != nil {
+			return nil, err
+		}
+		return events.NewBrokerSink(client, cfg.EventSinkSubject), nil
+	default:
+		return nil, fmt.Errorf("unknown event sink %q", cfg.EventSink)
+	}
+}
+
+// startWebhookDispatcher delivers queued webhook events in the background, if enabled
+func startWebhookDispatcher(cfg *config.Config, background *workers, webhookRepo repositories.WebhookRepository, deliveryRepo repositories.WebhookDeliveryRepository) {
+	if cfg.WebhookWorkers <= 0 {
+		return
+	}
+	dispatcher := webhooks.NewDispatcher(webhookRepo, deliveryRepo, webhooks.Options{
+		Timeout:     cfg.WebhookTimeout,
+		MaxAttempts: cfg.WebhookMaxAttempts,
+		Workers:     cfg.WebhookWorkers,
+	})
+	background.start(dispatcher.Run)
+}
+
+// startExpiryWatcher announces URLs whose active window ended in the background
+func startExpiryWatcher(background *workers, urlRepo repositories.URLRepository, notifier *webhooks.Notifier) {
+	watcher := webhooks.NewExpiryWatcher(urlRepo, notifier)
+	background.start(watcher.Run)
+}
+
+// startVisitorTracker counts unique visitors, storing them in the background
+func startVisitorTracker(cfg *config.Config, background *workers, visitorRepo repositories.VisitorSketchRepository) *visitors.Tracker {
+	tracker := visitors.NewTracker(visitorRepo, cfg.UniquesFlushInterval)
+	background.start(tracker.Run)
+	return tracker
+}
+
+// initializeIdempotency sets up the store for responses to requests with an Idempotency-Key
+func initializeIdempotency(cfg *config.Config, db *database.MongoDB) (*middleware.Idempotency, error) {
+	idempotencyRepo, err := database.NewMongoIdempotencyRepository(db)
+	if err != nil {
+		return nil, err
+	}
+	return middleware.NewIdempotency(idempotencyRepo, cfg.IdempotencyTTL), nil
+}
+
+// startServer configures the router and serves HTTP until ctx is cancelled, then lets in-flight requests finish
+func startServer(ctx context.Context, cfg *config.Config, apiHandlers *apiHandlers, idempotency *middleware.Idempotency, domainScope *middleware.DomainScope, logging *middleware.Logging, zapLogger *zap.Logger) {
 	router := mux.NewRouter()
 
-	// Add logging middleware
-	router.Use(middleware.LoggingMiddleware)
+	// Add request context, tracing, logging and metrics middleware; requests are traced before they are logged
+	// so log lines carry the trace ID
+	router.Use(middleware.RequestContextMiddleware)
+	router.Use(middleware.Tracing)
+	router.Use(logging.Middleware)
+	router.Use(middleware.Metrics)
 
 	// Setup routes
-	routes.SetupRoutes(router, urlHandler)
+	routes.SetupRoutes(router, apiHandlers.url, apiHandlers.redirect, apiHandlers.qr, apiHandlers.campaign, apiHandlers.live, apiHandlers.webhook, idempotency, domainScope)
 
 	// Start server
+	server := &http.Server{Addr: cfg.ServerAddress, Handler: router}
+	failed := make(chan error, 1)
+	go func() {
+		failed <- server.ListenAndServe()
+	}()
+
 	zapLogger.Info("Server starting", zap.String("address", cfg.ServerAddress))
-	if err := http.ListenAndServe(cfg.ServerAddress, router); err != nil {
+	select {
+	case err := <-failed:
 		zapLogger.Fatal("Server failed to start", zap.Error(err))
+	case <-ctx.Done():
+	}
+
+	zapLogger.Info("Server stopping")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		zapLogger.Error("Server failed to shut down", zap.Error(err))
 	}
 }
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"net/http"
+	"strings"
+	"time"
+	"urlshortener/internal/domain/models"
+	"urlshortener/internal/domain/repositories"
+	"urlshortener/internal/pkg/service"
+	"urlshortener/internal/pkg/validator"
+	"urlshortener/pkg/logger"
+)
+
+// CampaignHandler handles HTTP requests for campaign operations
+type CampaignHandler struct {
+	service   *service.CampaignService
+	validator *validator.URLValidator
+	logger    *zap.Logger
+}
+
+// NewCampaignHandler creates a new instance of CampaignHandler
+func NewCampaignHandler(service *service.CampaignService) *CampaignHandler {
+	return &CampaignHandler{
+		service:   service,
+		validator: validator.NewURLValidator(),
+		logger:    logger.GetLogger(),
+	}
+}
+
+// log returns the logger of the handler with the trace of r, so each line can be found from the trace
+func (h *CampaignHandler) log(r *http.Request) *zap.Logger {
+	return h.logger.With(logger.TraceFields(r.Context())...)
+}
+
+// campaignRequest represents the payload for creating or updating a campaign
+type campaignRequest struct {
+	Name     string            `json:"name"`
+	Owner    string            `json:"owner,omitempty"`
+	StartsAt *time.Time        `json:"starts_at,omitempty"`
+	EndsAt   *time.Time        `json:"ends_at,omitempty"`
+	UTM      *models.UTMParams `json:"utm,omitempty"`
+}
+
+// campaign returns the campaign described by the payload
+func (req *campaignRequest) campaign() *models.Campaign {
+	return &models.Campaign{
+		Name:     strings.TrimSpace(req.Name),
+		Owner:    req.Owner,
+		StartsAt: req.StartsAt,
+		EndsAt:   req.EndsAt,
+		UTM:      req.UTM,
+	}
+}
+
+// decodeCampaign decodes and validates a campaign payload, writing the error response if it is invalid
+func (h *CampaignHandler) decodeCampaign(w http.ResponseWriter, r *http.Request) (*models.Campaign, bool) {
+	var req campaignRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log(r).Error("failed to decode request body", zap.Error(err))
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return nil, false
+	}
+
+	campaign := req.campaign()
+	if err := h.validator.ValidateCampaign(campaign); err != nil {
+		h.log(r).Warn("campaign validation failed", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	return campaign, true
+}
+
+// CreateCampaign handles the creation of a new campaign
+func (h *CampaignHandler) CreateCampaign(w http.ResponseWriter, r *http.Request) {
+	campaign, ok := h.decodeCampaign(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.service.CreateCampaign(r.Context(), campaign); err != nil {
+		h.log(r).Error("failed to create campaign", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.log(r).Info("campaign created", zap.String("campaign_id", campaign.ID), zap.String("name", campaign.Name))
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(campaign)
+}
+
+// ListCampaigns handles listing campaigns, optionally filtered by owner
+func (h *CampaignHandler) ListCampaigns(w http.ResponseWriter, r *http.Request) {
+	campaigns, err := h.service.ListCampaigns(r.Context(), r.URL.Query().Get("owner"))
+	if err != nil {
+		h.log(r).Error("failed to list campaigns", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.log(r).Info("campaigns listed", zap.Int("count", len(campaigns)))
+
+	json.NewEncoder(w).Encode(campaigns)
+}
+
+// GetCampaign handles retrieving a campaign by its ID
+func (h *CampaignHandler) GetCampaign(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["campaignID"]
+
+	campaign, err := h.service.GetCampaign(r.Context(), id)
+	if err != nil {
+		h.writeError(w, r, "failed to get campaign", id, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(campaign)
+}
+
+// UpdateCampaign handles replacing the settings of a campaign
+func (h *CampaignHandler) UpdateCampaign(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["campaignID"]
+
+	update, ok := h.decodeCampaign(w, r)
+	if !ok {
+		return
+	}
+
+	campaign, err := h.service.UpdateCampaign(r.Context(), id, update)
+	if err != nil {
+		h.writeError(w, r, "failed to update campaign", id, err)
+		return
+	}
+
+	h.log(r).Info("campaign updated", zap.String("campaign_id", id))
+
+	json.NewEncoder(w).Encode(campaign)
+}
+
+// DeleteCampaign handles deleting a campaign, which takes its URLs out of it
+func (h *CampaignHandler) DeleteCampaign(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["campaignID"]
+
+	if err := h.service.DeleteCampaign(r.Context(), id); err != nil {
+		h.writeError(w, r, "failed to delete campaign", id, err)
+		return
+	}
+
+	h.log(r).Info("campaign deleted", zap.String("campaign_id", id))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetCampaignStats handles retrieving the click statistics aggregated across the URLs of a campaign
+func (h *CampaignHandler) GetCampaignStats(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["campaignID"]
+
+	stats, err := h.service.GetCampaignStats(r.Context(), id)
+	if err != nil {
+		h.writeError(w, r, "failed to get campaign stats", id, err)
+		return
+	}
+
+	h.log(r).Info("campaign stats retrieved", zap.String("campaign_id", id), zap.Int64("clicks", stats.Clicks))
+
+	json.NewEncoder(w).Encode(stats)
+}
+
+// writeError logs a failed campaign operation and maps its error to an HTTP response
+func (h *CampaignHandler) writeError(w http.ResponseWriter, r *http.Request, message, id string, err error) {
+	if errors.Is(err, repositories.ErrCampaignNotFound) {
+		h.log(r).Warn(message, zap.String("campaign_id", id), zap.Error(err))
+		http.Error(w, "Campaign not found", http.StatusNotFound)
+		return
+	}
+	h.log(r).Error(message, zap.String("campaign_id", id), zap.Error(err))
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
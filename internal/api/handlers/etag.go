@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"urlshortener/internal/domain/models"
+)
+
+// errInvalidETag is returned when an If-Match header does not list a version ETag
+var errInvalidETag = errors.New("invalid etag")
+
+// urlETag returns the entity tag of a URL, derived from its version
+func urlETag(url *models.URL) string {
+	return fmt.Sprintf(`"%d"`, url.Version)
+}
+
+// representationETag returns the entity tag of the representation of a URL served as body.
+// Counts, health and fetched metadata change without a new version, so the tag also covers a digest of the body;
+// the version leads it so the tag still serves If-Match.
+func representationETag(url *models.URL, body []byte) string {
+	digest := sha256.Sum256(body)
+	return fmt.Sprintf(`"%d.%x"`, url.Version, digest[:8])
+}
+
+// statsETag returns the entity tag of a URL's statistics, which also change with every access
+// and as the unique visitors counted by other instances are stored
+func statsETag(url *models.URL, visitors *models.UniqueVisitors) string {
+	if visitors == nil {
+		return fmt.Sprintf(`"%d-%d-%d"`, url.Version, url.AccessCount, url.BotAccessCount)
+	}
+	return fmt.Sprintf(`"%d-%d-%d-%d-%d-%s"`, url.Version, url.AccessCount, url.BotAccessCount, visitors.Total, visitors.Clicks, visitors.To)
+}
+
+// parseIfMatch extracts the versions listed by the If-Match header.
+// It returns nil when the header is absent or "*", meaning any version is acceptable.
+// If-Match compares strongly, so weak tags never match; errInvalidETag is returned when
+// the header is malformed or lists no tag a version could match. Representation tags match on their version only,
+// so a URL read with GET can be changed until its version changes.
+func parseIfMatch(r *http.Request) ([]int64, error) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" || header == "*" {
+		return nil, nil
+	}
+
+	var versions []int64
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		weak := strings.HasPrefix(tag, "W/")
+		tag = strings.TrimPrefix(tag, "W/")
+		if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' || strings.Contains(tag[1:len(tag)-1], `"`) {
+			return nil, errInvalidETag
+		}
+		if weak {
+			continue
+		}
+		// Tags other than versions, such as those of statistics, are never current
+		value, _, _ := strings.Cut(tag[1:len(tag)-1], ".")
+		if version, err := strconv.ParseInt(value, 10, 64); err == nil {
+			versions = append(versions, version)
+		}
+	}
+	if len(versions) == 0 {
+		return nil, errInvalidETag
+	}
+	return versions, nil
+}
+
+// matchesIfNoneMatch reports whether the If-None-Match header lists etag, using weak comparison
+func matchesIfNoneMatch(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
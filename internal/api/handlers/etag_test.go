@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseIfMatch tests parsing If-Match lists with strong comparison
+func TestParseIfMatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		versions []int64
+		err      error
+	}{
+		{name: "absent"},
+		{name: "any", header: "*"},
+		{name: "single", header: `"3"`, versions: []int64{3}},
+		{name: "list", header: `"3", "4"`, versions: []int64{3, 4}},
+		{name: "list without spaces", header: `"3","4"`, versions: []int64{3, 4}},
+		{name: "weak tag never matches", header: `W/"3"`, err: errInvalidETag},
+		{name: "weak tags skipped in list", header: `W/"3", "4"`, versions: []int64{4}},
+		{name: "statistics tag skipped", header: `"3-10-0", "5"`, versions: []int64{5}},
+		{name: "representation tag matches its version", header: `"3.0123456789abcdef"`, versions: []int64{3}},
+		{name: "unquoted", header: `3`, err: errInvalidETag},
+		{name: "malformed list", header: `"3", 4`, err: errInvalidETag},
+		{name: "empty entry", header: `"3",`, err: errInvalidETag},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("PUT", "/shorten/abc123", nil)
+			if tt.header != "" {
+				r.Header.Set("If-Match", tt.header)
+			}
+
+			versions, err := parseIfMatch(r)
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.versions, versions)
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"go.uber.org/zap"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"urlshortener/internal/domain/models"
+)
+
+// exportColumns are the columns of a CSV export, in order
+var exportColumns = []string{
+	"domain", "short_code", "original_url", "title", "folder", "tags", "labels", "notes",
+	"access_count", "created_at", "updated_at",
+}
+
+// ExportURLs handles exporting every URL matching the listing filters as CSV or, with format=json, as a JSON array.
+// Limit and offset are ignored.
+func (h *URLHandler) ExportURLs(w http.ResponseWriter, r *http.Request) {
+	filter, err := h.listFilter(r)
+	if err != nil {
+		h.log(r).Warn("export validation failed", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var write func(url *models.URL) error
+	var finish func() error
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "csv":
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="urls.csv"`)
+		write, finish = csvExporter(w)
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="urls.json"`)
+		write, finish = jsonExporter(w)
+	default:
+		http.Error(w, "format must be csv or json", http.StatusBadRequest)
+		return
+	}
+
+	count := 0
+	err = h.service.ExportURLs(r.Context(), filter, func(url *models.URL) error {
+		count++
+		return write(url)
+	})
+	if err != nil && count == 0 {
+		// Nothing has been written yet, so the failure can still be reported
+		h.log(r).Error("failed to export urls", zap.Error(err))
+		w.Header().Del("Content-Disposition")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err == nil {
+		err = finish()
+	}
+	if err != nil {
+		// The response has been streamed in part, so the error can only be logged
+		h.log(r).Error("failed to export urls", zap.Int("count", count), zap.Error(err))
+		return
+	}
+
+	h.log(r).Info("urls exported", zap.Int("count", count))
+}
+
+// csvExporter writes URLs as CSV rows after a header row
+func csvExporter(w http.ResponseWriter) (func(url *models.URL) error, func() error) {
+	writer := csv.NewWriter(w)
+	header := false
+
+	write := func(url *models.URL) error {
+		if !header {
+			header = true
+			if err := writer.Write(exportColumns); err != nil {
+				return err
+			}
+		}
+		return writer.Write([]string{
+			url.Domain,
+			url.ShortCode,
+			url.OriginalURL,
+			url.Title,
+			url.Folder,
+			strings.Join(url.Tags, ","),
+			formatLabels(url.Labels),
+			url.Notes,
+			strconv.Itoa(url.AccessCount),
+			url.CreatedAt.UTC().Format(time.RFC3339),
+			url.UpdatedAt.UTC().Format(time.RFC3339),
+		})
+	}
+	finish := func() error {
+		if !header {
+			if err := writer.Write(exportColumns); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	}
+	return write, finish
+}
+
+// jsonExporter writes URLs as the elements of a JSON array
+func jsonExporter(w http.ResponseWriter) (func(url *models.URL) error, func() error) {
+	first := true
+
+	write := func(url *models.URL) error {
+		separator := ","
+		if first {
+			separator, first = "[", false
+		}
+		if _, err := w.Write([]byte(separator)); err != nil {
+			return err
+		}
+		data, err := json.Marshal(url)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+	finish := func() error {
+		closing := "]\n"
+		if first {
+			closing = "[]\n"
+		}
+		_, err := w.Write([]byte(closing))
+		return err
+	}
+	return write, finish
+}
+
+// formatLabels renders labels as key=value pairs separated by semicolons, sorted by key
+func formatLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = key + "=" + labels[key]
+	}
+	return strings.Join(pairs, ";")
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"golang.org/x/net/websocket"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"time"
+	"urlshortener/internal/domain/models"
+	"urlshortener/internal/pkg/live"
+	"urlshortener/internal/pkg/service"
+	"urlshortener/pkg/logger"
+)
+
+const (
+	// liveHeartbeatInterval is how often an idle stream sends its counters, keeping proxies from closing it
+	liveHeartbeatInterval = 15 * time.Second
+
+	// liveWriteTimeout bounds a single write to a stream; clients that cannot take a message in time are disconnected
+	liveWriteTimeout = 10 * time.Second
+)
+
+// Types of the messages sent on a live stream
+const (
+	liveSnapshot  = "snapshot"
+	liveClick     = "click"
+	liveHeartbeat = "heartbeat"
+)
+
+// liveMessage is a message sent on a live stream. Counters are the running totals of the URL,
+// which stay exact when click events are dropped for a client that is not keeping up.
+type liveMessage struct {
+	Type     string             `json:"type"`
+	Click    *models.ClickEvent `json:"click,omitempty"`
+	Counters liveCounters       `json:"counters"`
+
+	// Dropped counts the click events the client missed so far
+	Dropped int64 `json:"dropped,omitempty"`
+}
+
+// liveCounters are the running access counts of a URL
+type liveCounters struct {
+	AccessCount    int64 `json:"access_count"`
+	BotAccessCount int64 `json:"bot_access_count"`
+}
+
+// LiveHandler streams the clicks on a short URL as they happen, over Server-Sent Events or WebSocket
+type LiveHandler struct {
+	service *service.URLService
+	hub     *live.Hub
+	logger  *zap.Logger
+}
+
+// NewLiveHandler creates a new instance of LiveHandler streaming the clicks published to hub
+func NewLiveHandler(service *service.URLService, hub *live.Hub) *LiveHandler {
+	return &LiveHandler{
+		service: service,
+		hub:     hub,
+		logger:  logger.GetLogger(),
+	}
+}
+
+// log returns the logger of the handler with the trace of r, so each line can be found from the trace
+func (h *LiveHandler) log(r *http.Request) *zap.Logger {
+	return h.logger.With(logger.TraceFields(r.Context())...)
+}
+
+// Stream handles streaming the clicks on a URL as Server-Sent Events.
+// Each message is a JSON liveMessage sent as an event named after its type.
+func (h *LiveHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	url, sub, ok := h.subscribe(w, r)
+	if !ok {
+		return
+	}
+	defer sub.Close()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Keep reverse proxies from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	err := streamLive(r.Context(), url, sub, liveHeartbeatInterval, func(msg liveMessage) error {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		rc.SetWriteDeadline(time.Now().Add(liveWriteTimeout))
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", msg.Type, data); err != nil {
+			return err
+		}
+		return rc.Flush()
+	})
+	h.log(r).Info("live stream closed", zap.String("short_code", url.ShortCode), zap.Int64("dropped", sub.Dropped()), zap.Error(err))
+}
+
+// StreamWebSocket handles streaming the clicks on a URL over a WebSocket, one JSON liveMessage per text frame.
+// Connections are accepted from pages on the same host or from clients sending no Origin.
+func (h *LiveHandler) StreamWebSocket(w http.ResponseWriter, r *http.Request) {
+	url, sub, ok := h.subscribe(w, r)
+	if !ok {
+		return
+	}
+	defer sub.Close()
+
+	server := websocket.Server{
+		Handshake: sameOrigin,
+		Handler: func(conn *websocket.Conn) {
+			ctx, cancel := context.WithCancel(r.Context())
+			defer cancel()
+
+			// Nothing is expected from the client; reading notices when it goes away
+			go func() {
+				defer cancel()
+				for {
+					var discard string
+					if err := websocket.Message.Receive(conn, &discard); err != nil {
+						return
+					}
+				}
+			}()
+
+			err := streamLive(ctx, url, sub, liveHeartbeatInterval, func(msg liveMessage) error {
+				conn.SetWriteDeadline(time.Now().Add(liveWriteTimeout))
+				return websocket.JSON.Send(conn, msg)
+			})
+			h.log(r).Info("live websocket closed", zap.String("short_code", url.ShortCode), zap.Int64("dropped", sub.Dropped()), zap.Error(err))
+		},
+	}
+	server.ServeHTTP(w, r)
+}
+
+// subscribe looks up the URL of the request and subscribes to its clicks, answering the request on failure
+func (h *LiveHandler) subscribe(w http.ResponseWriter, r *http.Request) (*models.URL, *live.Subscription, bool) {
+	shortCode := mux.Vars(r)["shortCode"]
+
+	url, err := h.service.GetStats(r.Context(), shortCode)
+	if err != nil {
+		h.log(r).Warn("failed to get url for live stream", zap.String("short_code", shortCode), zap.Error(err))
+		http.Error(w, "URL not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+
+	sub, err := h.hub.Subscribe(models.LinkRef{Domain: url.Domain, ShortCode: url.ShortCode})
+	if err != nil {
+		h.log(r).Warn("live stream refused", zap.String("short_code", shortCode), zap.Error(err))
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return nil, nil, false
+	}
+
+	h.log(r).Info("live stream opened", zap.String("short_code", shortCode))
+	return url, sub, true
+}
+
+// streamLive sends a snapshot of the counters of url, then every click received by sub and a heartbeat
+// whenever the stream has been idle for the heartbeat interval, until ctx is done or send fails
+func streamLive(ctx context.Context, url *models.URL, sub *live.Subscription, heartbeat time.Duration, send func(msg liveMessage) error) error {
+	message := func(kind string, click *models.ClickEvent) liveMessage {
+		clicks, botClicks := sub.Counts()
+		return liveMessage{
+			Type:  kind,
+			Click: click,
+			Counters: liveCounters{
+				AccessCount:    int64(url.AccessCount) + clicks,
+				BotAccessCount: int64(url.BotAccessCount) + botClicks,
+			},
+			Dropped: sub.Dropped(),
+		}
+	}
+
+	if err := send(message(liveSnapshot, nil)); err != nil {
+		return err
+	}
+
+	timer := time.NewTimer(heartbeat)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event := <-sub.Events():
+			if err := send(message(liveClick, &event)); err != nil {
+				return err
+			}
+		case <-timer.C:
+			if err := send(message(liveHeartbeat, nil)); err != nil {
+				return err
+			}
+		}
+		timer.Reset(heartbeat)
+	}
+}
+
+// sameOrigin accepts WebSocket handshakes without an Origin or from an Origin on the host of the request,
+// so other sites cannot open streams from their visitors' browsers
+func sameOrigin(config *websocket.Config, r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	parsed, err := neturl.Parse(origin)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(parsed.Host, r.Host) {
+		return errors.New("cross-origin websocket refused")
+	}
+	config.Origin = parsed
+	return nil
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/websocket"
+
+	"urlshortener/internal/domain/models"
+	"urlshortener/internal/pkg/live"
+)
+
+// TestStreamLive tests that a stream starts from the counters of the URL and sends clicks and heartbeats
+func TestStreamLive(t *testing.T) {
+	hub := live.NewHub(live.Options{})
+	link := models.LinkRef{Domain: "acme.link", ShortCode: "abc123"}
+	url := &models.URL{Domain: link.Domain, ShortCode: link.ShortCode, AccessCount: 40, BotAccessCount: 2}
+
+	sub, err := hub.Subscribe(link)
+	assert.NoError(t, err)
+	defer sub.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	messages := make(chan liveMessage, 10)
+	done := make(chan error)
+	go func() {
+		done <- streamLive(ctx, url, sub, 50*time.Millisecond, func(msg liveMessage) error {
+			messages <- msg
+			return nil
+		})
+	}()
+
+	snapshot := <-messages
+	assert.Equal(t, liveSnapshot, snapshot.Type)
+	assert.Equal(t, liveCounters{AccessCount: 40, BotAccessCount: 2}, snapshot.Counters)
+
+	hub.Publish(models.ClickEvent{LinkRef: link, Country: "NL"})
+	click := <-messages
+	assert.Equal(t, liveClick, click.Type)
+	assert.Equal(t, "NL", click.Click.Country)
+	assert.Equal(t, liveCounters{AccessCount: 41, BotAccessCount: 2}, click.Counters)
+
+	hub.Publish(models.ClickEvent{LinkRef: link, Bot: true})
+	assert.Equal(t, liveCounters{AccessCount: 41, BotAccessCount: 3}, (<-messages).Counters)
+
+	heartbeat := <-messages
+	assert.Equal(t, liveHeartbeat, heartbeat.Type)
+	assert.Nil(t, heartbeat.Click)
+
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+// TestStreamLiveSendFailure tests that a stream stops once a message cannot be sent
+func TestStreamLiveSendFailure(t *testing.T) {
+	hub := live.NewHub(live.Options{})
+	sub, _ := hub.Subscribe(models.LinkRef{ShortCode: "abc123"})
+	defer sub.Close()
+
+	gone := errors.New("client gone")
+	err := streamLive(context.Background(), &models.URL{ShortCode: "abc123"}, sub, time.Minute, func(msg liveMessage) error {
+		return gone
+	})
+	assert.ErrorIs(t, err, gone)
+}
+
+// TestSameOrigin tests that WebSocket handshakes are only accepted from the host of the request
+func TestSameOrigin(t *testing.T) {
+	r := httptest.NewRequest("GET", "http://acme.link/shorten/abc123/live/ws", nil)
+	assert.NoError(t, sameOrigin(&websocket.Config{}, r))
+
+	r.Header.Set("Origin", "https://acme.link")
+	assert.NoError(t, sameOrigin(&websocket.Config{}, r))
+
+	r.Header.Set("Origin", "https://evil.example.com")
+	assert.Error(t, sameOrigin(&websocket.Config{}, r))
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"net/url"
+	"urlshortener/internal/domain/models"
+)
+
+// buildDestination applies the passthrough and UTM settings of a short URL to the destination it resolved to.
+// extraPath is the path following the short code and query the query string of the short URL.
+func buildDestination(link *models.URL, destination, extraPath string, query url.Values) (string, error) {
+	target, err := url.Parse(destination)
+	if err != nil {
+		return "", err
+	}
+
+	if link.PathPassthrough && extraPath != "" {
+		target = target.JoinPath(extraPath)
+	}
+
+	params := target.Query()
+	changed := false
+	if utm := link.UTM; utm != nil {
+		for key, value := range map[string]string{"utm_source": utm.Source, "utm_medium": utm.Medium, "utm_campaign": utm.Campaign} {
+			if value != "" {
+				changed = setIfAbsent(params, key, []string{value}) || changed
+			}
+		}
+	}
+
+	switch link.QueryMode {
+	case models.QueryModeMerge:
+		for key, values := range query {
+			changed = setIfAbsent(params, key, values) || changed
+		}
+	case models.QueryModeOverride:
+		for key, values := range query {
+			params[key] = values
+			changed = true
+		}
+	}
+
+	// Re-encode only when parameters were added so the destination otherwise keeps its original encoding
+	if changed {
+		target.RawQuery = params.Encode()
+	}
+	return target.String(), nil
+}
+
+// setIfAbsent sets a query parameter unless it is already present, reporting whether it did
+func setIfAbsent(params url.Values, key string, values []string) bool {
+	if _, ok := params[key]; ok {
+		return false
+	}
+	params[key] = values
+	return true
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"urlshortener/internal/domain/models"
+)
+
+// TestBuildDestination tests path passthrough, the query modes and UTM injection
+func TestBuildDestination(t *testing.T) {
+	query := url.Values{"ref": {"x"}, "lang": {"de"}}
+
+	dest, err := buildDestination(&models.URL{}, "https://example.com/a?lang=en", "docs", query)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com/a?lang=en", dest)
+
+	dest, err = buildDestination(&models.URL{PathPassthrough: true, QueryMode: models.QueryModeMerge}, "https://example.com/a?lang=en", "docs/intro", query)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com/a/docs/intro?lang=en&ref=x", dest)
+
+	dest, err = buildDestination(&models.URL{QueryMode: models.QueryModeOverride}, "https://example.com/a?lang=en", "", query)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com/a?lang=de&ref=x", dest)
+
+	link := &models.URL{UTM: &models.UTMParams{Source: "newsletter", Campaign: "spring"}}
+	dest, err = buildDestination(link, "https://example.com/?utm_campaign=summer", "", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com/?utm_campaign=summer&utm_source=newsletter", dest)
+}
@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"image"
+	"image/png"
+	"net/http"
+	"strconv"
+	"urlshortener/internal/domain/models"
+	"urlshortener/internal/domain/repositories"
+	"urlshortener/internal/pkg/qr"
+	"urlshortener/internal/pkg/service"
+	"urlshortener/pkg/logger"
+)
+
+const (
+	// defaultQRSize, minQRSize and maxQRSize bound the width and height of a QR code in pixels
+	defaultQRSize = 256
+	minQRSize     = 64
+	maxQRSize     = 2048
+
+	// defaultQRMargin and maxQRMargin bound the quiet zone of a QR code in modules
+	defaultQRMargin = 4
+	maxQRMargin     = 16
+
+	// qrCacheControl lets clients and CDNs keep QR codes, which only depend on the short URL and the query
+	qrCacheControl = "public, max-age=31536000, immutable"
+
+	// qrVary names the request headers the short URL is taken from on unbranded hosts
+	qrVary = "Host, X-Forwarded-Proto"
+)
+
+// QRHandler serves QR codes of short URLs
+type QRHandler struct {
+	service *service.URLService
+	logo    image.Image
+	logoTag string
+	logger  *zap.Logger
+}
+
+// NewQRHandler creates a new instance of QRHandler; logo is embedded in codes that ask for it and may be nil
+func NewQRHandler(service *service.URLService, logo image.Image) *QRHandler {
+	h := &QRHandler{
+		service: service,
+		logo:    logo,
+		logger:  logger.GetLogger(),
+	}
+
+	// Fingerprint the logo so cached codes are invalidated when it is replaced
+	if logo != nil {
+		var buf bytes.Buffer
+		png.Encode(&buf, logo)
+		sum := sha256.Sum256(buf.Bytes())
+		h.logoTag = hex.EncodeToString(sum[:8])
+	}
+	return h
+}
+
+// log returns the logger of the handler with the trace of r, so each line can be found from the trace
+func (h *QRHandler) log(r *http.Request) *zap.Logger {
+	return h.logger.With(logger.TraceFields(r.Context())...)
+}
+
+// qrRequest holds the rendering settings of a QR code request
+type qrRequest struct {
+	format string
+	opts   qr.Options
+}
+
+// GetQRCode handles rendering the QR code of a short URL as PNG or SVG
+func (h *QRHandler) GetQRCode(w http.ResponseWriter, r *http.Request) {
+	shortCode := mux.Vars(r)["shortCode"]
+
+	req, err := h.parseRequest(r)
+	if err != nil {
+		h.log(r).Warn("qr code validation failed", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	url, err := h.service.GetStats(r.Context(), shortCode)
+	if err != nil {
+		if errors.Is(err, repositories.ErrURLNotFound) {
+			h.log(r).Warn("url not found", zap.String("short_code", shortCode), zap.Error(err))
+			http.Error(w, "URL not found", http.StatusNotFound)
+			return
+		}
+		h.log(r).Error("failed to get url", zap.String("short_code", shortCode), zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	content := shortURL(r, url)
+	etag := h.etag(content, req)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", qrCacheControl)
+	if url.Domain == "" {
+		w.Header().Set("Vary", qrVary)
+	}
+	if matchesIfNoneMatch(r, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	var body []byte
+	if req.format == "svg" {
+		w.Header().Set("Content-Type", "image/svg+xml")
+		body, err = qr.SVG(content, req.opts)
+	} else {
+		w.Header().Set("Content-Type", "image/png")
+		body, err = qr.PNG(content, req.opts)
+	}
+	if err != nil {
+		w.Header().Del("Cache-Control")
+		w.Header().Del("Vary")
+		w.Header().Del("ETag")
+		if errors.Is(err, qr.ErrSizeTooSmall) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.log(r).Error("failed to render qr code", zap.String("short_code", shortCode), zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	h.log(r).Info("qr code rendered", zap.String("short_code", shortCode), zap.String("format", req.format))
+
+	w.Write(body)
+}
+
+// parseRequest reads the rendering settings from the query string, applying defaults
+func (h *QRHandler) parseRequest(r *http.Request) (*qrRequest, error) {
+	query := r.URL.Query()
+	req := &qrRequest{
+		format: "png",
+		opts: qr.Options{
+			Size:   defaultQRSize,
+			Margin: defaultQRMargin,
+			Level:  qr.LevelMedium,
+		},
+	}
+
+	switch format := query.Get("format"); format {
+	case "", "png":
+	case "svg":
+		req.format = format
+	default:
+		return nil, errors.New("format must be png or svg")
+	}
+
+	if value := query.Get("size"); value != "" {
+		size, err := strconv.Atoi(value)
+		if err != nil || size < minQRSize || size > maxQRSize {
+			return nil, fmt.Errorf("size must be an integer between %d and %d", minQRSize, maxQRSize)
+		}
+		req.opts.Size = size
+	}
+
+	if value := query.Get("margin"); value != "" {
+		margin, err := strconv.Atoi(value)
+		if err != nil || margin < 0 || margin > maxQRMargin {
+			return nil, fmt.Errorf("margin must be an integer between 0 and %d", maxQRMargin)
+		}
+		req.opts.Margin = margin
+	}
+
+	fg, err := qr.ParseColor(valueOr(query.Get("fg"), "000000"))
+	if err != nil {
+		return nil, fmt.Errorf("fg: %w", err)
+	}
+	bg, err := qr.ParseColor(valueOr(query.Get("bg"), "ffffff"))
+	if err != nil {
+		return nil, fmt.Errorf("bg: %w", err)
+	}
+	req.opts.Foreground, req.opts.Background = fg, bg
+
+	withLogo := false
+	if value := query.Get("logo"); value != "" {
+		withLogo, err = strconv.ParseBool(value)
+		if err != nil {
+			return nil, errors.New("logo must be true or false")
+		}
+	}
+	if withLogo {
+		if h.logo == nil {
+			return nil, errors.New("no logo is configured")
+		}
+		req.opts.Logo = h.logo
+		// The logo hides modules, so default to the highest error correction
+		req.opts.Level = qr.LevelHigh
+	}
+
+	if value := query.Get("ec"); value != "" {
+		level, err := qr.ParseLevel(value)
+		if err != nil {
+			return nil, err
+		}
+		if withLogo && (level == qr.LevelLow || level == qr.LevelMedium) {
+			return nil, errors.New("a logo requires error correction level Q or H")
+		}
+		req.opts.Level = level
+	}
+
+	return req, nil
+}
+
+// etag derives the entity tag of a QR code from everything that affects its rendering
+func (h *QRHandler) etag(content string, req *qrRequest) string {
+	o := req.opts
+	key := fmt.Sprintf("%s|%s|%d|%d|%s|%v|%v|%t|%s",
+		content, req.format, o.Size, o.Margin, o.Level, o.Foreground, o.Background, o.Logo != nil, h.logoTag)
+	sum := sha256.Sum256([]byte(key))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// shortURL returns the absolute URL visitors follow for a short code.
+// URLs on branded domains are served over HTTPS; otherwise the scheme and host of the request are used.
+func shortURL(r *http.Request, url *models.URL) string {
+	if url.Domain != "" {
+		return "https://" + url.Domain + "/" + url.ShortCode
+	}
+
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + "/" + url.ShortCode
+}
+
+// valueOr returns value, or fallback if value is empty
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
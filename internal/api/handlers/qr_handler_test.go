@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+
+	"urlshortener/internal/domain/models"
+	"urlshortener/internal/pkg/service"
+)
+
+// TestQRHandler_VariesOnRequestHost tests that codes encoded from the request host are cached per host and scheme
+func TestQRHandler_VariesOnRequestHost(t *testing.T) {
+	repo := &stubURLRepository{urls: map[string]*models.URL{
+		"abc123":  {ShortCode: "abc123", OriginalURL: "https://example.com"},
+		"brand12": {ShortCode: "brand12", Domain: "go.example.com", OriginalURL: "https://example.com"},
+	}}
+	handler := NewQRHandler(service.NewURLService(repo, &stubHistoryRepository{}), nil)
+	router := mux.NewRouter()
+	router.HandleFunc("/qr/{shortCode}", handler.GetQRCode).Methods("GET")
+	get := func(shortCode, host, proto string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/qr/"+shortCode+"?format=svg", nil)
+		req.Host = host
+		if proto != "" {
+			req.Header.Set("X-Forwarded-Proto", proto)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	plain := get("abc123", "a.example.com", "")
+	assert.Equal(t, http.StatusOK, plain.Code)
+	assert.Equal(t, qrCacheControl, plain.Header().Get("Cache-Control"))
+	assert.Equal(t, "Host, X-Forwarded-Proto", plain.Header().Get("Vary"))
+	assert.NotEqual(t, plain.Header().Get("ETag"), get("abc123", "b.example.com", "").Header().Get("ETag"))
+	assert.NotEqual(t, plain.Header().Get("ETag"), get("abc123", "a.example.com", "https").Header().Get("ETag"))
+
+	branded := get("brand12", "a.example.com", "")
+	assert.Equal(t, http.StatusOK, branded.Code)
+	assert.Empty(t, branded.Header().Get("Vary"))
+	assert.Equal(t, branded.Header().Get("ETag"), get("brand12", "b.example.com", "https").Header().Get("ETag"))
+}
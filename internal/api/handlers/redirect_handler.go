@@ -0,0 +1,454 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"html/template"
+	"math"
+	"mime"
+	"net"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"time"
+	"urlshortener/internal/domain/models"
+	"urlshortener/internal/domain/repositories"
+	"urlshortener/internal/pkg/bots"
+	"urlshortener/internal/pkg/geoip"
+	"urlshortener/internal/pkg/metrics"
+	"urlshortener/internal/pkg/privacy"
+	"urlshortener/internal/pkg/ratelimit"
+	"urlshortener/internal/pkg/reqctx"
+	"urlshortener/internal/pkg/service"
+	"urlshortener/pkg/logger"
+)
+
+// passwordFormTemplate renders the form asking visitors for the password of a protected URL
+var passwordFormTemplate = template.Must(template.New("password").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Password required</title>
+</head>
+<body>
+<h1>This link is password protected</h1>
+{{if .Error}}<p role="alert">{{.Error}}</p>{{end}}
+<form method="post" action="{{.Action}}">
+<label for="password">Password</label>
+<input type="password" id="password" name="password" autocomplete="current-password" required autofocus>
+<button type="submit">Continue</button>
+</form>
+</body>
+</html>
+`))
+
+// previewTemplate renders the page showing visitors where a short URL leads before they follow it
+var previewTemplate = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{if .Title}}{{.Title}}{{else}}Link preview{{end}}</title>
+</head>
+<body>
+<h1>{{if .Title}}{{.Title}}{{else}}Where this link goes{{end}}</h1>
+{{if .Protected}}<p>This link is password protected. Its destination is shown once you enter the password.</p>
+{{else if .SingleUse}}<p>This link can be followed only once. Continuing uses it up.</p>
+{{else}}<p>This link leads to <strong>{{.Host}}</strong>:</p>
+<p><code>{{.Destination}}</code></p>
+{{if .Description}}<p>{{.Description}}</p>
+{{end}}{{end}}<dl>
+<dt>Short link</dt><dd>{{.ShortURL}}</dd>
+<dt>Created</dt><dd><time datetime="{{.CreatedAt.Format "2006-01-02T15:04:05Z07:00"}}">{{.CreatedAt.Format "2 January 2006"}}</time></dd>
+<dt>Clicks</dt><dd>{{.AccessCount}}</dd>
+</dl>
+<form method="post" action="{{.Action}}">
+<button type="submit">Continue</button>
+</form>
+</body>
+</html>
+`))
+
+// previewData holds the values rendered by previewTemplate
+type previewData struct {
+	Title       string
+	Description string
+	Protected   bool
+	SingleUse   bool
+	Host        string
+	Destination string
+	ShortURL    string
+	CreatedAt   time.Time
+	AccessCount int
+	Action      string
+}
+
+// passwordFormData holds the values rendered by passwordFormTemplate
+type passwordFormData struct {
+	Action string
+	Error  string
+}
+
+// unlockRequest represents the JSON payload for unlocking a password-protected URL
+type unlockRequest struct {
+	Password string `json:"password"`
+}
+
+// unlockResponse represents the JSON response to a successful unlock
+type unlockResponse struct {
+	OriginalURL string `json:"original_url"`
+}
+
+const (
+	// variantCookiePrefix names the cookie remembering a visitor's variant of a short code
+	variantCookiePrefix = "variant_"
+
+	// variantCookieMaxAge is how long a sticky variant assignment lasts
+	variantCookieMaxAge = 30 * 24 * 60 * 60
+)
+
+// RedirectOptions configures a RedirectHandler
+type RedirectOptions struct {
+	// PasswordAttempts limits password attempts per short code and client IP
+	PasswordAttempts *ratelimit.Limiter
+
+	// InactiveFallbackURL receives visitors of URLs outside their activation window;
+	// when empty they get an error page instead
+	InactiveFallbackURL string
+
+	// Countries resolves visitor countries for targeting rules; when nil country conditions never match
+	Countries geoip.CountryResolver
+
+	// Bots classifies visitors as bots, whose clicks are counted apart; when nil every visitor counts as a person
+	Bots *bots.Classifier
+
+	// Anonymizer anonymises client addresses written to the log; when nil they are logged as they are
+	Anonymizer *privacy.Anonymizer
+
+	// PreviewAll shows every visitor the preview page before redirecting, not only visitors of URLs in preview mode
+	PreviewAll bool
+}
+
+// RedirectHandler handles visitors following short URLs
+type RedirectHandler struct {
+	service *service.URLService
+	opts    RedirectOptions
+	logger  *zap.Logger
+}
+
+// NewRedirectHandler creates a new instance of RedirectHandler
+func NewRedirectHandler(service *service.URLService, opts RedirectOptions) *RedirectHandler {
+	return &RedirectHandler{
+		service: service,
+		opts:    opts,
+		logger:  logger.GetLogger(),
+	}
+}
+
+// log returns the logger of the handler with the trace of r, so each line can be found from the trace
+func (h *RedirectHandler) log(r *http.Request) *zap.Logger {
+	return h.logger.With(logger.TraceFields(r.Context())...)
+}
+
+// Redirect handles sending a visitor to the original URL of a short code,
+// using the redirect status of the domain the request was sent to.
+// URLs in preview mode show the preview page instead.
+func (h *RedirectHandler) Redirect(w http.ResponseWriter, r *http.Request) {
+	shortCode := mux.Vars(r)["shortCode"]
+
+	if h.opts.PreviewAll {
+		h.renderPreview(w, r, shortCode, r.URL.RequestURI())
+		return
+	}
+
+	resolution, err := h.service.ResolveURL(r.Context(), shortCode, "", h.visitor(r))
+	if errors.Is(err, service.ErrPreviewRequired) {
+		h.renderPreview(w, r, shortCode, r.URL.RequestURI())
+		return
+	}
+	if err != nil {
+		h.writeResolveError(w, r, shortCode, err)
+		return
+	}
+
+	destination, err := h.destination(r, resolution)
+	if err != nil {
+		h.writeResolveError(w, r, shortCode, err)
+		return
+	}
+
+	h.log(r).Info("short url followed", zap.String("short_code", shortCode), zap.String("destination", destination))
+	metrics.Redirects.WithLabelValues(metrics.OutcomeHit).Inc()
+
+	status := reqctx.Domain(r.Context()).RedirectStatus
+	if status == 0 {
+		status = http.StatusFound
+	}
+
+	setVariantCookie(w, resolution)
+	http.Redirect(w, r, destination, status)
+}
+
+// Preview handles showing the preview page of a short code requested with a "+" suffix
+func (h *RedirectHandler) Preview(w http.ResponseWriter, r *http.Request) {
+	action := "/" + mux.Vars(r)["shortCode"]
+	if r.URL.RawQuery != "" {
+		action += "?" + r.URL.RawQuery
+	}
+	h.renderPreview(w, r, mux.Vars(r)["shortCode"], action)
+}
+
+// renderPreview writes the preview page of a short code without counting an access.
+// Continuing posts to action, which follows the short URL.
+func (h *RedirectHandler) renderPreview(w http.ResponseWriter, r *http.Request, shortCode, action string) {
+	resolution, err := h.service.PreviewURL(r.Context(), shortCode, h.visitor(r))
+	if err != nil {
+		h.writeResolveError(w, r, shortCode, err)
+		return
+	}
+
+	url := resolution.URL
+	data := previewData{
+		Title:       url.Title,
+		Protected:   url.PasswordProtected,
+		SingleUse:   url.SingleUse,
+		ShortURL:    shortURL(r, url),
+		CreatedAt:   url.CreatedAt,
+		AccessCount: url.AccessCount,
+		Action:      action,
+	}
+	// The service leaves out the destination of links it does not reveal before they are followed
+	if resolution.Destination != "" {
+		if data.Destination, err = h.destination(r, resolution); err != nil {
+			h.writeResolveError(w, r, shortCode, err)
+			return
+		}
+		if parsed, err := neturl.Parse(data.Destination); err == nil {
+			data.Host = parsed.Hostname()
+		}
+		// Fall back to what the destination page says about itself; this would reveal
+		// the destination of hidden links, so it is only shown for open ones
+		if url.Metadata != nil {
+			if data.Title == "" {
+				data.Title = url.Metadata.Title
+			}
+			data.Description = url.Metadata.Description
+		}
+	}
+
+	h.log(r).Info("short url previewed", zap.String("short_code", shortCode))
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	previewTemplate.Execute(w, data)
+}
+
+// Unlock handles a visitor continuing from the preview page or submitting the password of a
+// protected short code, either from the HTML form or as JSON
+func (h *RedirectHandler) Unlock(w http.ResponseWriter, r *http.Request) {
+	shortCode := mux.Vars(r)["shortCode"]
+	jsonMode := isJSONRequest(r)
+
+	var password string
+	if jsonMode {
+		var req unlockRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			h.log(r).Error("failed to decode request body", zap.Error(err))
+			writeJSONError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		password = req.Password
+	} else {
+		password = r.PostFormValue("password")
+	}
+
+	// Only password attempts are limited; continuing from the preview page submits no password
+	if password != "" {
+		allowed, retryAfter := h.opts.PasswordAttempts.Allow(shortCode + "|" + clientIP(r))
+		if !allowed {
+			h.log(r).Warn("password attempts exceeded", zap.String("short_code", shortCode), zap.String("client_ip", h.opts.Anonymizer.IP(clientIP(r), time.Now())))
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			if jsonMode {
+				writeJSONError(w, "Too many password attempts", http.StatusTooManyRequests)
+				return
+			}
+			renderPasswordForm(w, r, "Too many attempts, please try again later.", http.StatusTooManyRequests)
+			return
+		}
+	}
+
+	// Posting to the short URL confirms any preview the visitor was shown
+	visitor := h.visitor(r)
+	visitor.ConfirmedPreview = true
+
+	resolution, err := h.service.ResolveURL(r.Context(), shortCode, password, visitor)
+	if err != nil {
+		h.writeResolveError(w, r, shortCode, err)
+		return
+	}
+
+	destination, err := h.destination(r, resolution)
+	if err != nil {
+		h.writeResolveError(w, r, shortCode, err)
+		return
+	}
+
+	h.log(r).Info("protected short url unlocked", zap.String("short_code", shortCode))
+	metrics.Redirects.WithLabelValues(metrics.OutcomeHit).Inc()
+
+	setVariantCookie(w, resolution)
+	if jsonMode {
+		json.NewEncoder(w).Encode(unlockResponse{OriginalURL: destination})
+		return
+	}
+	http.Redirect(w, r, destination, http.StatusSeeOther)
+}
+
+// writeResolveError maps an error from resolving a short code to a response in the client's format
+func (h *RedirectHandler) writeResolveError(w http.ResponseWriter, r *http.Request, shortCode string, err error) {
+	jsonMode := isJSONRequest(r) || !acceptsHTML(r)
+	metrics.Redirects.WithLabelValues(redirectOutcome(err)).Inc()
+
+	switch {
+	case errors.Is(err, service.ErrPasswordRequired), errors.Is(err, service.ErrInvalidPassword):
+		h.log(r).Info("short url password check failed", zap.String("short_code", shortCode), zap.Error(err))
+		message := ""
+		if errors.Is(err, service.ErrInvalidPassword) {
+			message = "Incorrect password, please try again."
+		}
+		if jsonMode {
+			writeJSONError(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		renderPasswordForm(w, r, message, http.StatusUnauthorized)
+	case errors.Is(err, service.ErrURLNotYetActive), errors.Is(err, service.ErrURLEnded):
+		h.log(r).Info("url outside its activation window", zap.String("short_code", shortCode), zap.Error(err))
+		if h.opts.InactiveFallbackURL != "" {
+			http.Redirect(w, r, h.opts.InactiveFallbackURL, http.StatusFound)
+			return
+		}
+		if errors.Is(err, service.ErrURLEnded) {
+			http.Error(w, "This link is no longer active", http.StatusGone)
+			return
+		}
+		http.Error(w, "This link is not active yet", http.StatusNotFound)
+	case errors.Is(err, service.ErrBotRefused):
+		h.log(r).Info("single-use url refused to a bot", zap.String("short_code", shortCode), zap.String("user_agent", r.UserAgent()))
+		http.Error(w, "This link can only be followed by a person", http.StatusForbidden)
+	case errors.Is(err, repositories.ErrURLConsumed):
+		h.log(r).Info("single-use url already consumed", zap.String("short_code", shortCode))
+		http.Error(w, "This link has already been used", http.StatusGone)
+	case errors.Is(err, repositories.ErrURLNotFound):
+		h.log(r).Warn("url not found", zap.String("short_code", shortCode), zap.Error(err))
+		http.Error(w, "URL not found", http.StatusNotFound)
+	default:
+		h.log(r).Error("failed to resolve url", zap.String("short_code", shortCode), zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// redirectOutcome returns the outcome counted for a short code that could not be followed because of err
+func redirectOutcome(err error) string {
+	switch {
+	case errors.Is(err, repositories.ErrURLNotFound):
+		return metrics.OutcomeMiss
+	case errors.Is(err, service.ErrURLEnded), errors.Is(err, repositories.ErrURLConsumed):
+		return metrics.OutcomeExpired
+	case errors.Is(err, service.ErrURLNotYetActive):
+		return metrics.OutcomeInactive
+	case errors.Is(err, service.ErrPasswordRequired), errors.Is(err, service.ErrInvalidPassword):
+		return metrics.OutcomeLocked
+	case errors.Is(err, service.ErrBotRefused):
+		return metrics.OutcomeRefused
+	default:
+		return metrics.OutcomeError
+	}
+}
+
+// setVariantCookie remembers the variant assigned to a visitor of a URL with sticky variants
+func setVariantCookie(w http.ResponseWriter, resolution *service.Resolution) {
+	if resolution.Variant == "" || !resolution.URL.StickyVariants {
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     variantCookiePrefix + resolution.URL.ShortCode,
+		Value:    resolution.Variant,
+		Path:     "/" + resolution.URL.ShortCode,
+		MaxAge:   variantCookieMaxAge,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// destination returns where to send the visitor, applying the passthrough and UTM settings of the URL
+func (h *RedirectHandler) destination(r *http.Request, resolution *service.Resolution) (string, error) {
+	return buildDestination(resolution.URL, resolution.Destination, mux.Vars(r)["extraPath"], r.URL.Query())
+}
+
+// renderPasswordForm writes the password form with an optional error message.
+// The form posts back to the requested URL so passed through paths and query strings are kept.
+func renderPasswordForm(w http.ResponseWriter, r *http.Request, message string, status int) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	passwordFormTemplate.Execute(w, passwordFormData{Action: r.URL.RequestURI(), Error: message})
+}
+
+// writeJSONError writes an error message as a JSON object
+func writeJSONError(w http.ResponseWriter, message string, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
+
+// isJSONRequest reports whether the request body is JSON
+func isJSONRequest(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "application/json"
+}
+
+// acceptsHTML reports whether the client accepts an HTML response, as browsers do
+func acceptsHTML(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+// visitor describes the client that sent the request
+func (h *RedirectHandler) visitor(r *http.Request) models.Visitor {
+	visitor := models.Visitor{
+		IP:             clientIP(r),
+		UserAgent:      r.UserAgent(),
+		AcceptLanguage: r.Header.Get("Accept-Language"),
+		Query:          r.URL.Query(),
+	}
+	if referrer, err := neturl.Parse(r.Referer()); err == nil {
+		visitor.Referrer = referrer.Hostname()
+	}
+	if cookie, err := r.Cookie(variantCookiePrefix + mux.Vars(r)["shortCode"]); err == nil {
+		visitor.AssignedVariant = cookie.Value
+	}
+	if h.opts.Countries != nil {
+		visitor.Country = h.opts.Countries.Country(net.ParseIP(visitor.IP))
+	}
+	if h.opts.Bots != nil {
+		visitor.Bot = h.opts.Bots.Classify(r) != ""
+	}
+	visitor.DoNotTrack = privacy.DoNotTrack(r.Header)
+	return visitor
+}
+
+// clientIP returns the IP address of the client that sent the request
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
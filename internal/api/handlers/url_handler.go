@@ -1,10 +1,20 @@
 package handlers
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"github.com/gorilla/mux"
 	"go.uber.org/zap"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"urlshortener/internal/domain/models"
+	"urlshortener/internal/domain/repositories"
+	"urlshortener/internal/pkg/domains"
+	"urlshortener/internal/pkg/reqctx"
 	"urlshortener/internal/pkg/service"
 	"urlshortener/internal/pkg/validator"
 	"urlshortener/pkg/logger"
@@ -13,94 +23,394 @@ import (
 // URLHandler handles HTTP requests for URL operations
 type URLHandler struct {
 	service   *service.URLService
+	domains   *domains.Registry
 	validator *validator.URLValidator
 	logger    *zap.Logger
 }
 
 // NewURLHandler creates a new instance of URLHandler
-func NewURLHandler(service *service.URLService) *URLHandler {
+func NewURLHandler(service *service.URLService, domains *domains.Registry) *URLHandler {
 	return &URLHandler{
 		service:   service,
+		domains:   domains,
 		validator: validator.NewURLValidator(),
 		logger:    logger.GetLogger(),
 	}
 }
 
+// log returns the logger of the handler with the trace of r, so each line can be found from the trace
+func (h *URLHandler) log(r *http.Request) *zap.Logger {
+	return h.logger.With(logger.TraceFields(r.Context())...)
+}
+
 // createURLRequest represents the payload for creating a short URL
 type createURLRequest struct {
 	URL string `json:"url"`
+
+	// Domain picks the domain of a new short URL, overriding the domain query parameter; it is ignored on update
+	Domain string `json:"domain,omitempty"`
+
+	Password  string `json:"password,omitempty"`
+	SingleUse bool   `json:"single_use,omitempty"`
+
+	ActiveFrom  *time.Time `json:"active_from,omitempty"`
+	ActiveUntil *time.Time `json:"active_until,omitempty"`
+
+	Rules []models.TargetingRule `json:"rules,omitempty"`
+
+	Variants       []models.Variant `json:"variants,omitempty"`
+	StickyVariants bool             `json:"sticky_variants,omitempty"`
+
+	QueryMode       string            `json:"query_mode,omitempty"`
+	PathPassthrough bool              `json:"path_passthrough,omitempty"`
+	UTM             *models.UTMParams `json:"utm,omitempty"`
+
+	Title   string `json:"title,omitempty"`
+	Preview bool   `json:"preview,omitempty"`
+
+	FallbackURL string `json:"fallback_url,omitempty"`
+
+	Tags   []string          `json:"tags,omitempty"`
+	Folder string            `json:"folder,omitempty"`
+	Notes  string            `json:"notes,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+
+	CampaignID string `json:"campaign_id,omitempty"`
+}
+
+// validate checks the fields of a create or update payload
+func (req *createURLRequest) validate(v *validator.URLValidator) error {
+	if err := v.ValidateURL(req.URL); err != nil {
+		return err
+	}
+	if req.Password != "" {
+		if err := v.ValidatePassword(req.Password); err != nil {
+			return err
+		}
+	}
+	if err := v.ValidateRules(req.Rules); err != nil {
+		return err
+	}
+	if err := v.ValidateVariants(req.Variants); err != nil {
+		return err
+	}
+	if err := v.ValidateQueryMode(req.QueryMode); err != nil {
+		return err
+	}
+	if err := v.ValidateUTM(req.UTM); err != nil {
+		return err
+	}
+	if err := v.ValidateFallbackURL(req.FallbackURL); err != nil {
+		return err
+	}
+	if err := v.ValidateTags(models.NormalizeTags(req.Tags)); err != nil {
+		return err
+	}
+	if err := v.ValidateFolder(req.Folder); err != nil {
+		return err
+	}
+	if err := v.ValidateNotes(req.Notes); err != nil {
+		return err
+	}
+	if err := v.ValidateLabels(req.Labels); err != nil {
+		return err
+	}
+	return v.ValidateTitle(req.Title)
+}
+
+// options returns the optional URL settings carried by the payload
+func (req *createURLRequest) options() service.URLOptions {
+	return service.URLOptions{
+		Password:    req.Password,
+		SingleUse:   req.SingleUse,
+		ActiveFrom:  req.ActiveFrom,
+		ActiveUntil: req.ActiveUntil,
+		Rules:       req.Rules,
+
+		Variants:       req.Variants,
+		StickyVariants: req.StickyVariants,
+
+		QueryMode:       req.QueryMode,
+		PathPassthrough: req.PathPassthrough,
+		UTM:             req.UTM,
+
+		Title:   req.Title,
+		Preview: req.Preview,
+
+		FallbackURL: req.FallbackURL,
+
+		Tags:   req.Tags,
+		Folder: req.Folder,
+		Notes:  req.Notes,
+		Labels: req.Labels,
+
+		CampaignID: req.CampaignID,
+	}
 }
 
 // CreateShortURL handles the creation of a new short URL
 func (h *URLHandler) CreateShortURL(w http.ResponseWriter, r *http.Request) {
 	var req createURLRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.logger.Error("failed to decoded request body", zap.Error(err))
+		h.log(r).Error("failed to decoded request body", zap.Error(err))
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	if err := h.validator.ValidateURL(req.URL); err != nil {
-		h.logger.Warn("url validation failed", zap.Error(err))
+	if err := req.validate(h.validator); err != nil {
+		h.log(r).Warn("url validation failed", zap.Error(err))
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	url, err := h.service.CreateShortURL(r.Context(), req.URL)
+	ctx := r.Context()
+	if req.Domain != "" {
+		domain, ok := h.domains.Get(req.Domain)
+		if !ok {
+			h.log(r).Warn("unknown domain", zap.String("domain", req.Domain))
+			http.Error(w, "Unknown domain", http.StatusBadRequest)
+			return
+		}
+		ctx = reqctx.WithDomain(ctx, domain)
+	}
+
+	url, err := h.service.CreateShortURL(ctx, req.URL, req.options())
 	if err != nil {
-		h.logger.Error("failed to create short url", zap.Error(err))
+		h.log(r).Error("failed to create short url", zap.Error(err))
+		if errors.Is(err, service.ErrInvalidActiveWindow) || errors.Is(err, repositories.ErrCampaignNotFound) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	h.logger.Info("short url created", zap.String("original_url", req.URL), zap.String("short_code", url.ShortCode))
+	h.log(r).Info("short url created", zap.String("original_url", req.URL), zap.String("domain", url.Domain), zap.String("short_code", url.ShortCode))
 
+	w.Header().Set("ETag", urlETag(url))
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(url)
 }
 
+// ListURLs handles listing URLs, optionally filtered by activation status, domain, tags, folder and labels
+func (h *URLHandler) ListURLs(w http.ResponseWriter, r *http.Request) {
+	filter, err := h.listFilter(r)
+	if err != nil {
+		h.log(r).Warn("list validation failed", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	urls, err := h.service.ListURLs(r.Context(), filter)
+	if err != nil {
+		h.log(r).Error("failed to list urls", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.log(r).Info("urls listed", zap.String("status", string(filter.Status)), zap.Int("count", len(urls)))
+
+	json.NewEncoder(w).Encode(urls)
+}
+
+// ListBrokenLinks handles listing URLs whose destination health checks report down,
+// filtered like ListURLs
+func (h *URLHandler) ListBrokenLinks(w http.ResponseWriter, r *http.Request) {
+	filter, err := h.listFilter(r)
+	if err != nil {
+		h.log(r).Warn("list validation failed", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	urls, err := h.service.ListBrokenURLs(r.Context(), filter)
+	if err != nil {
+		h.log(r).Error("failed to list broken urls", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.log(r).Info("broken urls listed", zap.Int("count", len(urls)))
+
+	json.NewEncoder(w).Encode(urls)
+}
+
+// EraseOwnerData handles erasing what was recorded about the visitors of every URL of an owner
+func (h *URLHandler) EraseOwnerData(w http.ResponseWriter, r *http.Request) {
+	owner := mux.Vars(r)["owner"]
+
+	erasure, err := h.service.EraseOwnerData(r.Context(), owner)
+	if err != nil {
+		h.log(r).Error("failed to erase owner data", zap.String("owner", owner), zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.log(r).Info("owner data erased", zap.String("owner", owner), zap.Int("links", erasure.Links))
+
+	json.NewEncoder(w).Encode(erasure)
+}
+
+// listFilter reads the status, domain, tag, folder, label, campaign, owner, limit and offset query parameters of a listing.
+// tag and label may be repeated, labels being given as key:value.
+func (h *URLHandler) listFilter(r *http.Request) (models.URLFilter, error) {
+	query := r.URL.Query()
+
+	status := query.Get("status")
+	if err := h.validator.ValidateStatus(status); err != nil {
+		return models.URLFilter{}, err
+	}
+
+	filter := models.URLFilter{
+		Status: models.LinkStatus(status),
+		Tags:   models.NormalizeTags(query["tag"]),
+		Folder: query.Get("folder"),
+
+		CampaignID: query.Get("campaign"),
+		Owner:      query.Get("owner"),
+	}
+	if query.Get("domain") != "" {
+		filter.Domain = reqctx.Domain(r.Context()).Host
+	}
+	for _, label := range query["label"] {
+		key, value, ok := strings.Cut(label, ":")
+		if !ok {
+			return models.URLFilter{}, errors.New("label must be given as key:value")
+		}
+		if filter.Labels == nil {
+			filter.Labels = make(map[string]string)
+		}
+		filter.Labels[key] = value
+	}
+	if err := h.validator.ValidateLabels(filter.Labels); err != nil {
+		return models.URLFilter{}, err
+	}
+	for name, target := range map[string]*int{"limit": &filter.Limit, "offset": &filter.Offset} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return models.URLFilter{}, errors.New(name + " must be a non-negative integer")
+		}
+		*target = n
+	}
+	return filter, nil
+}
+
 // GetURL handles retrieving a URL by its short code
 func (h *URLHandler) GetURL(w http.ResponseWriter, r *http.Request) {
 	shortCode := mux.Vars(r)["shortCode"]
 
 	url, err := h.service.GetURL(r.Context(), shortCode)
 	if err != nil {
-		h.logger.Warn("url not found", zap.String("short_code", shortCode), zap.Error(err))
-		http.Error(w, "URL not found", http.StatusNotFound)
+		h.log(r).Warn("url not found", zap.String("short_code", shortCode), zap.Error(err))
+		switch {
+		case errors.Is(err, service.ErrURLNotYetActive):
+			http.Error(w, "URL is not active yet", http.StatusNotFound)
+		case errors.Is(err, service.ErrURLEnded):
+			http.Error(w, "URL is no longer active", http.StatusGone)
+		case errors.Is(err, repositories.ErrURLConsumed):
+			http.Error(w, "URL has already been used", http.StatusGone)
+		default:
+			http.Error(w, "URL not found", http.StatusNotFound)
+		}
 		return
 	}
 
-	h.logger.Info("url retrieved", zap.String("short_code", shortCode), zap.String("original_url", url.OriginalURL))
+	h.log(r).Info("url retrieved", zap.String("short_code", shortCode), zap.String("original_url", url.OriginalURL))
 
-	json.NewEncoder(w).Encode(url)
+	var body bytes.Buffer
+	json.NewEncoder(&body).Encode(url)
+	etag := representationETag(url, body.Bytes())
+	w.Header().Set("ETag", etag)
+	if matchesIfNoneMatch(r, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Write(body.Bytes())
 }
 
 // UpdateURL handles updating the original URL of an existing short code
 func (h *URLHandler) UpdateURL(w http.ResponseWriter, r *http.Request) {
 	shortCode := mux.Vars(r)["shortCode"]
 
+	expectedVersions, err := parseIfMatch(r)
+	if err != nil {
+		h.log(r).Warn("invalid if-match header", zap.String("short_code", shortCode), zap.Error(err))
+		http.Error(w, "Precondition failed", http.StatusPreconditionFailed)
+		return
+	}
+
 	var req createURLRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.logger.Error("failed to decode request body", zap.Error(err))
+		h.log(r).Error("failed to decode request body", zap.Error(err))
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	if err := h.validator.ValidateURL(req.URL); err != nil {
-		h.logger.Warn("url validation failed", zap.Error(err))
+	if err := req.validate(h.validator); err != nil {
+		h.log(r).Warn("url validation failed", zap.Error(err))
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	url, err := h.service.UpdateURL(r.Context(), shortCode, req.URL)
+	url, err := h.service.UpdateURL(r.Context(), shortCode, req.URL, req.options(), expectedVersions)
 	if err != nil {
-		h.logger.Warn("failed to update url", zap.String("short_code", shortCode), zap.Error(err))
-		http.Error(w, "URL not found", http.StatusNotFound)
+		h.log(r).Warn("failed to update url", zap.String("short_code", shortCode), zap.Error(err))
+		writeWriteError(w, err)
 		return
 	}
 
-	h.logger.Info("url updated", zap.String("short_code", shortCode), zap.String("new_url", req.URL))
+	h.log(r).Info("url updated", zap.String("short_code", shortCode), zap.String("new_url", req.URL))
 
+	w.Header().Set("ETag", urlETag(url))
+	json.NewEncoder(w).Encode(url)
+}
+
+// PatchURL handles partial updates of an existing short code using JSON Merge Patch (RFC 7396)
+func (h *URLHandler) PatchURL(w http.ResponseWriter, r *http.Request) {
+	shortCode := mux.Vars(r)["shortCode"]
+
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/merge-patch+json" && mediaType != "application/json" {
+		h.log(r).Warn("unsupported patch content type", zap.String("short_code", shortCode), zap.String("content_type", mediaType))
+		http.Error(w, "Content-Type must be application/merge-patch+json", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	expectedVersions, err := parseIfMatch(r)
+	if err != nil {
+		h.log(r).Warn("invalid if-match header", zap.String("short_code", shortCode), zap.Error(err))
+		http.Error(w, "Precondition failed", http.StatusPreconditionFailed)
+		return
+	}
+
+	var doc map[string]json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&doc); err != nil || doc == nil {
+		h.log(r).Error("failed to decode request body", zap.Error(err))
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	patch, err := h.validator.ValidatePatch(doc)
+	if err != nil {
+		h.log(r).Warn("patch validation failed", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	url, err := h.service.PatchURL(r.Context(), shortCode, patch, expectedVersions)
+	if err != nil {
+		h.log(r).Warn("failed to patch url", zap.String("short_code", shortCode), zap.Error(err))
+		writeWriteError(w, err)
+		return
+	}
+
+	h.log(r).Info("url patched", zap.String("short_code", shortCode), zap.Int("fields", len(patch)))
+
+	w.Header().Set("ETag", urlETag(url))
 	json.NewEncoder(w).Encode(url)
 }
 
@@ -108,29 +418,168 @@ func (h *URLHandler) UpdateURL(w http.ResponseWriter, r *http.Request) {
 func (h *URLHandler) DeleteURL(w http.ResponseWriter, r *http.Request) {
 	shortCode := mux.Vars(r)["shortCode"]
 
-	if err := h.service.DeleteURL(r.Context(), shortCode); err != nil {
-		h.logger.Warn("failed to delete url", zap.String("short_code", shortCode), zap.Error(err))
-		http.Error(w, "URL not found", http.StatusNotFound)
+	expectedVersions, err := parseIfMatch(r)
+	if err != nil {
+		h.log(r).Warn("invalid if-match header", zap.String("short_code", shortCode), zap.Error(err))
+		http.Error(w, "Precondition failed", http.StatusPreconditionFailed)
 		return
 	}
 
-	h.logger.Info("url deleted", zap.String("short_code", shortCode))
+	if err := h.service.DeleteURL(r.Context(), shortCode, expectedVersions); err != nil {
+		h.log(r).Warn("failed to delete url", zap.String("short_code", shortCode), zap.Error(err))
+		writeWriteError(w, err)
+		return
+	}
+
+	h.log(r).Info("url deleted", zap.String("short_code", shortCode))
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// GetStats handles retrieving the statistics of a URL by its short code
+// statsResponse is the statistics of a URL: the URL with its raw counts and its estimated unique visitors
+type statsResponse struct {
+	*models.URL
+	UniqueVisitors *models.UniqueVisitors `json:"unique_visitors,omitempty"`
+}
+
+// GetStats handles retrieving the statistics of a URL by its short code.
+// The from and to parameters select the days of unique visitor statistics, formatted as YYYY-MM-DD.
 func (h *URLHandler) GetStats(w http.ResponseWriter, r *http.Request) {
 	shortCode := mux.Vars(r)["shortCode"]
 
+	from, to, err := statsRange(r)
+	if err != nil {
+		h.log(r).Warn("stats validation failed", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	url, err := h.service.GetStats(r.Context(), shortCode)
 	if err != nil {
-		h.logger.Warn("failed to get url stats", zap.String("short_code", shortCode), zap.Error(err))
+		h.log(r).Warn("failed to get url stats", zap.String("short_code", shortCode), zap.Error(err))
+		http.Error(w, "URL not found", http.StatusNotFound)
+		return
+	}
+
+	visitors, err := h.service.GetUniqueVisitors(r.Context(), url, from, to)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidStatsRange) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.log(r).Error("failed to get unique visitors", zap.String("short_code", shortCode), zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.log(r).Info("url stats retrieved", zap.String("short_code", shortCode), zap.Int("access_count", url.AccessCount))
+
+	etag := statsETag(url, visitors)
+	w.Header().Set("ETag", etag)
+	if matchesIfNoneMatch(r, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	json.NewEncoder(w).Encode(statsResponse{URL: url, UniqueVisitors: visitors})
+}
+
+// statsRange parses the optional from and to days of a statistics request
+func statsRange(r *http.Request) (from, to time.Time, err error) {
+	query := r.URL.Query()
+	if value := query.Get("from"); value != "" {
+		if from, err = time.Parse(models.DayLayout, value); err != nil {
+			return from, to, errors.New("from must be a date formatted as YYYY-MM-DD")
+		}
+	}
+	if value := query.Get("to"); value != "" {
+		if to, err = time.Parse(models.DayLayout, value); err != nil {
+			return from, to, errors.New("to must be a date formatted as YYYY-MM-DD")
+		}
+	}
+	return from, to, nil
+}
+
+// GetHistory handles retrieving the revision history of a URL by its short code
+func (h *URLHandler) GetHistory(w http.ResponseWriter, r *http.Request) {
+	shortCode := mux.Vars(r)["shortCode"]
+
+	revisions, err := h.service.GetHistory(r.Context(), shortCode)
+	if errors.Is(err, repositories.ErrURLNotFound) {
+		h.log(r).Warn("url history not found", zap.String("short_code", shortCode))
 		http.Error(w, "URL not found", http.StatusNotFound)
 		return
 	}
+	if err != nil {
+		h.log(r).Error("failed to get url history", zap.String("short_code", shortCode), zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.log(r).Info("url history retrieved", zap.String("short_code", shortCode), zap.Int("revisions", len(revisions)))
+
+	json.NewEncoder(w).Encode(revisions)
+}
 
-	h.logger.Info("url stats retrieved", zap.String("short_code", shortCode), zap.Int("access_count", url.AccessCount))
+// RollbackURL handles restoring a URL to a prior revision
+func (h *URLHandler) RollbackURL(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	shortCode := vars["shortCode"]
+	revisionID := vars["revisionID"]
 
+	url, err := h.service.RollbackURL(r.Context(), shortCode, revisionID)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositories.ErrRevisionNotFound):
+			h.log(r).Warn("revision not found", zap.String("short_code", shortCode), zap.String("revision_id", revisionID))
+			http.Error(w, "Revision not found", http.StatusNotFound)
+		case errors.Is(err, service.ErrRevisionNotRestorable), errors.Is(err, repositories.ErrVersionConflict), errors.Is(err, repositories.ErrShortCodeTaken):
+			h.log(r).Warn("failed to rollback url", zap.String("short_code", shortCode), zap.String("revision_id", revisionID), zap.Error(err))
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			h.log(r).Error("failed to rollback url", zap.String("short_code", shortCode), zap.String("revision_id", revisionID), zap.Error(err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.log(r).Info("url rolled back", zap.String("short_code", shortCode), zap.String("revision_id", revisionID))
+
+	w.Header().Set("ETag", urlETag(url))
+	json.NewEncoder(w).Encode(url)
+}
+
+// RefreshMetadata handles fetching the metadata of the destination of a URL on demand
+func (h *URLHandler) RefreshMetadata(w http.ResponseWriter, r *http.Request) {
+	shortCode := mux.Vars(r)["shortCode"]
+
+	url, err := h.service.RefreshMetadata(r.Context(), shortCode)
+	if err != nil {
+		h.log(r).Warn("failed to refresh url metadata", zap.String("short_code", shortCode), zap.Error(err))
+		if errors.Is(err, service.ErrMetadataDisabled) {
+			http.Error(w, err.Error(), http.StatusNotImplemented)
+			return
+		}
+		http.Error(w, "URL not found", http.StatusNotFound)
+		return
+	}
+
+	h.log(r).Info("url metadata refreshed", zap.String("short_code", shortCode))
+
+	w.Header().Set("ETag", urlETag(url))
 	json.NewEncoder(w).Encode(url)
 }
+
+// writeWriteError maps an error from a conditional update or delete to an HTTP response
+func writeWriteError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrPreconditionFailed), errors.Is(err, repositories.ErrVersionConflict):
+		http.Error(w, "Precondition failed", http.StatusPreconditionFailed)
+	case errors.Is(err, repositories.ErrURLNotFound):
+		http.Error(w, "URL not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrInvalidActiveWindow), errors.Is(err, service.ErrTooManyLabels), errors.Is(err, repositories.ErrCampaignNotFound):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+
+	"urlshortener/internal/domain/models"
+	"urlshortener/internal/domain/repositories"
+	"urlshortener/internal/pkg/service"
+)
+
+// stubURLRepository serves fixed URLs, implementing the reads of the URLRepository interface only
+type stubURLRepository struct {
+	repositories.URLRepository
+	urls map[string]*models.URL
+}
+
+func (s *stubURLRepository) GetURLByShortCode(ctx context.Context, shortCode string) (*models.URL, error) {
+	url, ok := s.urls[shortCode]
+	if !ok {
+		return nil, repositories.ErrURLNotFound
+	}
+	c := *url
+	return &c, nil
+}
+
+func (s *stubURLRepository) IncrementURLAccessCount(ctx context.Context, shortCode, variantID string) error {
+	return nil
+}
+
+func (s *stubURLRepository) UpdateURL(ctx context.Context, url *models.URL) error {
+	url.Version++
+	c := *url
+	s.urls[url.ShortCode] = &c
+	return nil
+}
+
+func (s *stubURLRepository) PatchURL(ctx context.Context, url *models.URL, patch models.URLPatch) error {
+	return s.UpdateURL(ctx, url)
+}
+
+func (s *stubURLRepository) UpdateURLMetadata(ctx context.Context, shortCode, originalURL string, metadata *models.Metadata) error {
+	s.urls[shortCode].Metadata = metadata
+	return nil
+}
+
+// stubHistoryRepository serves fixed revisions and discards new ones, failing every lookup with err if set
+type stubHistoryRepository struct {
+	repositories.HistoryRepository
+	revisions map[string]*models.Revision
+	err       error
+}
+
+func (s *stubHistoryRepository) CreateRevision(ctx context.Context, revision *models.Revision) error {
+	return nil
+}
+
+func (s *stubHistoryRepository) GetRevision(ctx context.Context, shortCode, revisionID string) (*models.Revision, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	revision, ok := s.revisions[revisionID]
+	if !ok {
+		return nil, repositories.ErrRevisionNotFound
+	}
+	return revision, nil
+}
+
+// stubFetcher fetches the same metadata for every destination
+type stubFetcher struct {
+	metadata *models.Metadata
+}
+
+func (f stubFetcher) Fetch(ctx context.Context, rawURL string) *models.Metadata {
+	return f.metadata
+}
+
+// serveURL sends GET /shorten/{shortCode} to a handler reading from repo
+func serveURL(repo *stubURLRepository, shortCode string) *httptest.ResponseRecorder {
+	handler := NewURLHandler(service.NewURLService(repo, nil), nil)
+	router := mux.NewRouter()
+	router.HandleFunc("/shorten/{shortCode}", handler.GetURL).Methods("GET")
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/shorten/"+shortCode, nil))
+	return rec
+}
+
+// TestURLHandler_GetURLHidesProtectedDestination tests that the destinations of a password-protected URL cannot be read
+func TestURLHandler_GetURLHidesProtectedDestination(t *testing.T) {
+	repo := &stubURLRepository{urls: map[string]*models.URL{
+		"secret": {
+			ShortCode:         "secret",
+			OriginalURL:       "https://internal.example.com/docs",
+			PasswordHash:      "$2a$10$hash",
+			PasswordProtected: true,
+			Rules:             []models.TargetingRule{{Destination: "https://internal.example.com/de", Languages: []string{"de"}}},
+			Variants:          []models.Variant{{ID: "a", Destination: "https://internal.example.com/a", Weight: 1, Clicks: 4}},
+			FallbackURL:       "https://internal.example.com/down",
+			Metadata:          &models.Metadata{Title: "Internal docs", FinalURL: "https://internal.example.com/docs/"},
+		},
+		"public": {ShortCode: "public", OriginalURL: "https://example.com"},
+	}}
+
+	rec := serveURL(repo, "secret")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "internal.example.com")
+	assert.NotContains(t, rec.Body.String(), "$2a$10$hash")
+
+	var url models.URL
+	assert.NoError(t, json.NewDecoder(strings.NewReader(rec.Body.String())).Decode(&url))
+	assert.True(t, url.PasswordProtected)
+	assert.Equal(t, []string{"de"}, url.Rules[0].Languages)
+	assert.Equal(t, 4, url.Variants[0].Clicks)
+
+	rec = serveURL(repo, "public")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"original_url":"https://example.com"`)
+}
+
+// TestURLHandler_GetURLSingleUse tests that a single-use URL is read without its destination and is gone once consumed
+func TestURLHandler_GetURLSingleUse(t *testing.T) {
+	repo := &stubURLRepository{urls: map[string]*models.URL{
+		"once12": {ShortCode: "once12", OriginalURL: "https://secret.example.com", SingleUse: true},
+		"used12": {ShortCode: "used12", OriginalURL: "https://secret.example.com", SingleUse: true, ConsumedBy: &models.Consumption{}},
+	}}
+
+	rec := serveURL(repo, "once12")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"single_use":true`)
+	assert.NotContains(t, rec.Body.String(), "secret.example.com")
+
+	rec = serveURL(repo, "used12")
+	assert.Equal(t, http.StatusGone, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "secret.example.com")
+}
+
+// TestURLHandler_WritesHideProtectedDestination tests that the responses to writes to a password-protected URL leave out its destinations
+func TestURLHandler_WritesHideProtectedDestination(t *testing.T) {
+	protected := func() *models.URL {
+		return &models.URL{
+			ShortCode:         "secret",
+			OriginalURL:       "https://internal.example.com/docs",
+			PasswordHash:      "$2a$10$hash",
+			PasswordProtected: true,
+			Labels:            map[string]string{"env": "prod"},
+		}
+	}
+	repo := &stubURLRepository{urls: map[string]*models.URL{"secret": protected()}}
+	history := &stubHistoryRepository{revisions: map[string]*models.Revision{
+		"rev1": {ID: "rev1", ShortCode: "secret", Action: models.RevisionActionUpdate, After: protected()},
+	}}
+	urlService := service.NewURLService(repo, history, service.WithMetadata(
+		stubFetcher{metadata: &models.Metadata{Title: "Internal docs", FinalURL: "https://internal.example.com/docs/"}}, nil))
+	handler := NewURLHandler(urlService, nil)
+	router := mux.NewRouter()
+	router.HandleFunc("/shorten/{shortCode}", handler.PatchURL).Methods("PATCH")
+	router.HandleFunc("/shorten/{shortCode}/history/{revisionID}/rollback", handler.RollbackURL).Methods("POST")
+	router.HandleFunc("/shorten/{shortCode}/metadata/refresh", handler.RefreshMetadata).Methods("POST")
+
+	requests := map[string]*http.Request{
+		"patch":       httptest.NewRequest(http.MethodPatch, "/shorten/secret", strings.NewReader(`{"labels":{"team":"docs"}}`)),
+		"empty patch": httptest.NewRequest(http.MethodPatch, "/shorten/secret", strings.NewReader(`{}`)),
+		"rollback":    httptest.NewRequest(http.MethodPost, "/shorten/secret/history/rev1/rollback", nil),
+		"refresh":     httptest.NewRequest(http.MethodPost, "/shorten/secret/metadata/refresh", nil),
+	}
+	for name, req := range requests {
+		t.Run(name, func(t *testing.T) {
+			req.Header.Set("Content-Type", "application/merge-patch+json")
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+			assert.Contains(t, rec.Body.String(), `"password_protected":true`)
+			assert.NotContains(t, rec.Body.String(), "internal.example.com")
+			assert.NotContains(t, rec.Body.String(), "Internal docs")
+		})
+	}
+}
+
+// TestURLHandler_GetURLETag tests that the ETag of a URL changes with what is served, not only with its version,
+// and still serves If-Match
+func TestURLHandler_GetURLETag(t *testing.T) {
+	repo := &stubURLRepository{urls: map[string]*models.URL{
+		"abc123": {ShortCode: "abc123", OriginalURL: "https://example.com", Version: 3},
+	}}
+	handler := NewURLHandler(service.NewURLService(repo, &stubHistoryRepository{}), nil)
+	router := mux.NewRouter()
+	router.HandleFunc("/shorten/{shortCode}", handler.GetURL).Methods("GET")
+	router.HandleFunc("/shorten/{shortCode}", handler.UpdateURL).Methods("PUT")
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/shorten/abc123", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	etag := get("").Header().Get("ETag")
+	assert.Equal(t, http.StatusNotModified, get(etag).Code)
+
+	// Metadata is stored without a new version
+	repo.urls["abc123"].Metadata = &models.Metadata{Title: "Example"}
+	rec := get(etag)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"title":"Example"`)
+	assert.NotEqual(t, etag, rec.Header().Get("ETag"))
+
+	req := httptest.NewRequest(http.MethodPut, "/shorten/abc123", strings.NewReader(`{"url":"https://example.org"}`))
+	req.Header.Set("If-Match", etag)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+}
+
+// TestURLHandler_RollbackURLErrors tests that only a missing revision answers 404, and failures to look it up 500
+func TestURLHandler_RollbackURLErrors(t *testing.T) {
+	repo := &stubURLRepository{urls: map[string]*models.URL{"abc123": {ShortCode: "abc123", OriginalURL: "https://example.com"}}}
+	rollback := func(history *stubHistoryRepository) int {
+		handler := NewURLHandler(service.NewURLService(repo, history), nil)
+		router := mux.NewRouter()
+		router.HandleFunc("/shorten/{shortCode}/history/{revisionID}/rollback", handler.RollbackURL).Methods("POST")
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/shorten/abc123/history/rev1/rollback", nil))
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusNotFound, rollback(&stubHistoryRepository{}))
+	assert.Equal(t, http.StatusInternalServerError, rollback(&stubHistoryRepository{err: errors.New("connection reset")}))
+}
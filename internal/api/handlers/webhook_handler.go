@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"strings"
+	"urlshortener/internal/domain/models"
+	"urlshortener/internal/domain/repositories"
+	"urlshortener/internal/pkg/service"
+	"urlshortener/internal/pkg/validator"
+	"urlshortener/pkg/logger"
+)
+
+// WebhookHandler handles HTTP requests for webhook operations
+type WebhookHandler struct {
+	service   *service.WebhookService
+	validator *validator.URLValidator
+	logger    *zap.Logger
+}
+
+// NewWebhookHandler creates a new instance of WebhookHandler
+func NewWebhookHandler(service *service.WebhookService) *WebhookHandler {
+	return &WebhookHandler{
+		service:   service,
+		validator: validator.NewURLValidator(),
+		logger:    logger.GetLogger(),
+	}
+}
+
+// log returns the logger of the handler with the trace of r, so each line can be found from the trace
+func (h *WebhookHandler) log(r *http.Request) *zap.Logger {
+	return h.logger.With(logger.TraceFields(r.Context())...)
+}
+
+// webhookRequest represents the payload for creating or updating a webhook
+type webhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Owner  string   `json:"owner,omitempty"`
+	Secret string   `json:"secret,omitempty"`
+}
+
+// webhook returns the webhook described by the payload
+func (req *webhookRequest) webhook() *models.Webhook {
+	return &models.Webhook{
+		URL:    strings.TrimSpace(req.URL),
+		Events: req.Events,
+		Owner:  req.Owner,
+		Secret: req.Secret,
+	}
+}
+
+// decodeWebhook decodes and validates a webhook payload, writing the error response if it is invalid
+func (h *WebhookHandler) decodeWebhook(w http.ResponseWriter, r *http.Request) (*models.Webhook, bool) {
+	var req webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.log(r).Error("failed to decode request body", zap.Error(err))
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return nil, false
+	}
+
+	webhook := req.webhook()
+	if err := h.validator.ValidateWebhook(webhook); err != nil {
+		h.log(r).Warn("webhook validation failed", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	return webhook, true
+}
+
+// CreateWebhook handles the creation of a new webhook. The response is the only one carrying its secret.
+func (h *WebhookHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := h.decodeWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.service.CreateWebhook(r.Context(), webhook); err != nil {
+		h.log(r).Error("failed to create webhook", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.log(r).Info("webhook created", zap.String("webhook_id", webhook.ID), zap.Strings("events", webhook.Events))
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(webhook)
+}
+
+// ListWebhooks handles listing webhooks, optionally filtered by owner
+func (h *WebhookHandler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := h.service.ListWebhooks(r.Context(), r.URL.Query().Get("owner"))
+	if err != nil {
+		h.log(r).Error("failed to list webhooks", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.log(r).Info("webhooks listed", zap.Int("count", len(webhooks)))
+
+	json.NewEncoder(w).Encode(webhooks)
+}
+
+// GetWebhook handles retrieving a webhook by its ID
+func (h *WebhookHandler) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["webhookID"]
+
+	webhook, err := h.service.GetWebhook(r.Context(), id)
+	if err != nil {
+		h.writeError(w, r, "failed to get webhook", id, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(webhook)
+}
+
+// UpdateWebhook handles replacing the settings of a webhook, keeping its secret unless a new one is given
+func (h *WebhookHandler) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["webhookID"]
+
+	update, ok := h.decodeWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	webhook, err := h.service.UpdateWebhook(r.Context(), id, update)
+	if err != nil {
+		h.writeError(w, r, "failed to update webhook", id, err)
+		return
+	}
+
+	h.log(r).Info("webhook updated", zap.String("webhook_id", id))
+
+	json.NewEncoder(w).Encode(webhook)
+}
+
+// DeleteWebhook handles deleting a webhook along with its deliveries
+func (h *WebhookHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["webhookID"]
+
+	if err := h.service.DeleteWebhook(r.Context(), id); err != nil {
+		h.writeError(w, r, "failed to delete webhook", id, err)
+		return
+	}
+
+	h.log(r).Info("webhook deleted", zap.String("webhook_id", id))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListDeliveries handles listing the deliveries of a webhook, optionally filtered by status
+// and paginated with limit and offset
+func (h *WebhookHandler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	h.listDeliveries(w, r, r.URL.Query().Get("status"))
+}
+
+// ListDeadLetters handles listing the deliveries of a webhook that ran out of attempts
+func (h *WebhookHandler) ListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	h.listDeliveries(w, r, models.DeliveryDead)
+}
+
+// listDeliveries writes the deliveries of the webhook of the request in status, or in any status if empty
+func (h *WebhookHandler) listDeliveries(w http.ResponseWriter, r *http.Request, status string) {
+	id := mux.Vars(r)["webhookID"]
+
+	filter, err := deliveryFilter(r, id, status)
+	if err != nil {
+		h.log(r).Warn("invalid delivery filter", zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	deliveries, err := h.service.ListDeliveries(r.Context(), filter)
+	if err != nil {
+		h.writeError(w, r, "failed to list webhook deliveries", id, err)
+		return
+	}
+
+	h.log(r).Info("webhook deliveries listed", zap.String("webhook_id", id), zap.Int("count", len(deliveries)))
+
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+// ReplayDelivery handles queuing a delivery to be attempted again right away
+func (h *WebhookHandler) ReplayDelivery(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["webhookID"]
+
+	delivery, err := h.service.ReplayDelivery(r.Context(), id, vars["deliveryID"])
+	if err != nil {
+		h.writeError(w, r, "failed to replay webhook delivery", id, err)
+		return
+	}
+
+	h.log(r).Info("webhook delivery replayed", zap.String("webhook_id", id), zap.String("delivery_id", delivery.ID))
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(delivery)
+}
+
+// ReplayDeadLetters handles queuing every dead-lettered delivery of a webhook to be attempted again
+func (h *WebhookHandler) ReplayDeadLetters(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["webhookID"]
+
+	replayed, err := h.service.ReplayDeadLetters(r.Context(), id)
+	if err != nil {
+		h.writeError(w, r, "failed to replay dead letters", id, err)
+		return
+	}
+
+	h.log(r).Info("webhook dead letters replayed", zap.String("webhook_id", id), zap.Int64("replayed", replayed))
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]int64{"replayed": replayed})
+}
+
+// writeError logs a failed webhook operation and maps its error to an HTTP response
+func (h *WebhookHandler) writeError(w http.ResponseWriter, r *http.Request, message, id string, err error) {
+	switch {
+	case errors.Is(err, repositories.ErrWebhookNotFound):
+		h.log(r).Warn(message, zap.String("webhook_id", id), zap.Error(err))
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+	case errors.Is(err, repositories.ErrDeliveryNotFound):
+		h.log(r).Warn(message, zap.String("webhook_id", id), zap.Error(err))
+		http.Error(w, "Delivery not found", http.StatusNotFound)
+	default:
+		h.log(r).Error(message, zap.String("webhook_id", id), zap.Error(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// deliveryFilter reads the pagination of a delivery listing from the query of r
+func deliveryFilter(r *http.Request, webhookID, status string) (models.DeliveryFilter, error) {
+	filter := models.DeliveryFilter{WebhookID: webhookID, Status: status}
+	switch status {
+	case "", models.DeliveryPending, models.DeliveryDelivered, models.DeliveryDead:
+	default:
+		return models.DeliveryFilter{}, errors.New("status must be pending, delivered or dead")
+	}
+
+	query := r.URL.Query()
+	for name, target := range map[string]*int{"limit": &filter.Limit, "offset": &filter.Offset} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return models.DeliveryFilter{}, errors.New(name + " must be a non-negative integer")
+		}
+		*target = n
+	}
+	return filter, nil
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http"
+	"urlshortener/internal/pkg/domains"
+	"urlshortener/internal/pkg/reqctx"
+)
+
+// DomainQueryParam names the domain addressed by a management API request
+const DomainQueryParam = "domain"
+
+// DomainScope scopes requests to the branded domain whose short codes they address
+type DomainScope struct {
+	registry *domains.Registry
+}
+
+// NewDomainScope creates a new instance of DomainScope
+func NewDomainScope(registry *domains.Registry) *DomainScope {
+	return &DomainScope{registry: registry}
+}
+
+// ByHost scopes requests following short URLs to the domain named by their Host header.
+// Requests for hosts that are not registered are answered with 404 Not Found.
+func (d *DomainScope) ByHost(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		domain, ok := d.registry.ForRequestHost(r.Host)
+		if !ok {
+			http.Error(w, "URL not found", http.StatusNotFound)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(reqctx.WithDomain(r.Context(), domain)))
+	})
+}
+
+// ByQuery scopes management API requests to the domain named by the domain query parameter,
+// or to the default domain if it is absent. Unknown domains are answered with 400 Bad Request.
+func (d *DomainScope) ByQuery(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		domain, ok := d.registry.Get(r.URL.Query().Get(DomainQueryParam))
+		if !ok {
+			http.Error(w, "Unknown domain", http.StatusBadRequest)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(reqctx.WithDomain(r.Context(), domain)))
+	})
+}
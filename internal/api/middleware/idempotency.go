@@ -0,0 +1,184 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+	"urlshortener/internal/domain/models"
+	"urlshortener/internal/domain/repositories"
+	"urlshortener/internal/pkg/metrics"
+	"urlshortener/internal/pkg/reqctx"
+	"urlshortener/pkg/logger"
+)
+
+const (
+	// IdempotencyKeyHeader carries the client-chosen key identifying a logical request
+	IdempotencyKeyHeader = "Idempotency-Key"
+
+	// IdempotentReplayedHeader marks responses replayed from a stored idempotency record
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	// maxIdempotencyKeyLength bounds the size of client supplied keys
+	maxIdempotencyKeyLength = 255
+)
+
+// replayedHeaders lists the response headers stored with an idempotency record
+var replayedHeaders = []string{"Content-Type", "ETag", "Location"}
+
+// Idempotency stores the first response to a request carrying an Idempotency-Key header
+// and replays it for retries of the same request by the same caller.
+type Idempotency struct {
+	repo repositories.IdempotencyRepository
+	ttl  time.Duration
+}
+
+// NewIdempotency creates a new instance of Idempotency keeping responses for ttl
+func NewIdempotency(repo repositories.IdempotencyRepository, ttl time.Duration) *Idempotency {
+	return &Idempotency{repo: repo, ttl: ttl}
+}
+
+// Middleware wraps next so that requests with an Idempotency-Key header are executed at most once
+func (i *Idempotency) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			http.Error(w, "Idempotency-Key must be at most "+strconv.Itoa(maxIdempotencyKeyLength)+" characters", http.StatusBadRequest)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		caller := reqctx.Actor(r.Context())
+		now := time.Now()
+		record := &models.IdempotencyRecord{
+			Caller:      caller,
+			Key:         key,
+			RequestHash: hashRequest(r, body),
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(i.ttl),
+		}
+
+		err = i.repo.CreateRecord(r.Context(), record)
+		if errors.Is(err, repositories.ErrIdempotencyKeyExists) {
+			i.replay(w, r, record)
+			return
+		}
+		if err != nil {
+			logger.GetLogger().Error("failed to store idempotency key", zap.String("key", key), zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		// Store the outcome even if the client has gone away, since that is when it retries
+		ctx := context.WithoutCancel(r.Context())
+		defer func() {
+			// A handler that panicked left no response to store, so free the key for a retry
+			if p := recover(); p != nil {
+				i.release(ctx, caller, key)
+				panic(p)
+			}
+		}()
+
+		recorder := &recordingResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		if recorder.status >= http.StatusInternalServerError {
+			i.release(ctx, caller, key)
+			return
+		}
+
+		record.Completed = true
+		record.StatusCode = recorder.status
+		record.Body = recorder.body.Bytes()
+		record.Header = make(map[string]string)
+		for _, name := range replayedHeaders {
+			if value := recorder.Header().Get(name); value != "" {
+				record.Header[name] = value
+			}
+		}
+		if err := i.repo.CompleteRecord(ctx, record); err != nil {
+			logger.GetLogger().Error("failed to store idempotent response", zap.String("key", key), zap.Error(err))
+		}
+	})
+}
+
+// release removes the pending record of a caller's key so the request can be retried
+func (i *Idempotency) release(ctx context.Context, caller, key string) {
+	if err := i.repo.DeleteRecord(ctx, caller, key); err != nil {
+		logger.GetLogger().Error("failed to release idempotency key", zap.String("key", key), zap.Error(err))
+	}
+}
+
+// replay answers a retried request from the record stored for its key
+func (i *Idempotency) replay(w http.ResponseWriter, r *http.Request, retry *models.IdempotencyRecord) {
+	stored, err := i.repo.GetRecord(r.Context(), retry.Caller, retry.Key)
+	if err != nil {
+		if errors.Is(err, repositories.ErrIdempotencyRecordNotFound) {
+			http.Error(w, "A request with this Idempotency-Key is being retried, try again", http.StatusConflict)
+			return
+		}
+		logger.GetLogger().Error("failed to load idempotency key", zap.String("key", retry.Key), zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if stored.RequestHash != retry.RequestHash {
+		http.Error(w, "Idempotency-Key was already used with a different request payload", http.StatusUnprocessableEntity)
+		return
+	}
+	if !stored.Completed {
+		http.Error(w, "A request with this Idempotency-Key is still in progress", http.StatusConflict)
+		return
+	}
+
+	for name, value := range stored.Header {
+		w.Header().Set(name, value)
+	}
+	metrics.IdempotentReplays.Inc()
+	w.Header().Set(IdempotentReplayedHeader, "true")
+	w.WriteHeader(stored.StatusCode)
+	w.Write(stored.Body)
+}
+
+// hashRequest fingerprints the method, path, query and body of a request
+func hashRequest(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.RequestURI()+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// recordingResponseWriter captures the status code and body while writing them through
+type recordingResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+// WriteHeader captures the status code and writes it to the response.
+func (rw *recordingResponseWriter) WriteHeader(code int) {
+	rw.status = code
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+// Write captures the body and writes it to the response.
+func (rw *recordingResponseWriter) Write(b []byte) (int, error) {
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
@@ -0,0 +1,146 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"urlshortener/internal/domain/models"
+	"urlshortener/internal/domain/repositories"
+	"urlshortener/internal/pkg/metrics"
+)
+
+// memoryIdempotencyRepository is an in-memory implementation of the IdempotencyRepository interface
+type memoryIdempotencyRepository struct {
+	mu      sync.Mutex
+	records map[string]models.IdempotencyRecord
+}
+
+func newMemoryIdempotencyRepository() *memoryIdempotencyRepository {
+	return &memoryIdempotencyRepository{records: make(map[string]models.IdempotencyRecord)}
+}
+
+func (m *memoryIdempotencyRepository) CreateRecord(ctx context.Context, record *models.IdempotencyRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.records[record.Caller+":"+record.Key]; ok {
+		return repositories.ErrIdempotencyKeyExists
+	}
+	m.records[record.Caller+":"+record.Key] = *record
+	return nil
+}
+
+func (m *memoryIdempotencyRepository) GetRecord(ctx context.Context, caller, key string) (*models.IdempotencyRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	record, ok := m.records[caller+":"+key]
+	if !ok {
+		return nil, repositories.ErrIdempotencyRecordNotFound
+	}
+	return &record, nil
+}
+
+func (m *memoryIdempotencyRepository) CompleteRecord(ctx context.Context, record *models.IdempotencyRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records[record.Caller+":"+record.Key] = *record
+	return nil
+}
+
+func (m *memoryIdempotencyRepository) DeleteRecord(ctx context.Context, caller, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.records, caller+":"+key)
+	return nil
+}
+
+// TestIdempotency_ReplaysAndRejectsMismatchedPayload tests replaying a stored response and rejecting a different payload
+func TestIdempotency_ReplaysAndRejectsMismatchedPayload(t *testing.T) {
+	calls := 0
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"short_code":"abc123"}`))
+	})
+	handler := NewIdempotency(newMemoryIdempotencyRepository(), time.Hour).Middleware(next)
+	replays := testutil.ToFloat64(metrics.IdempotentReplays)
+
+	send := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(body))
+		req.Header.Set(IdempotencyKeyHeader, "key-1")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := send(`{"url":"https://example.com"}`)
+	assert.Equal(t, http.StatusCreated, first.Code)
+
+	retry := send(`{"url":"https://example.com"}`)
+	assert.Equal(t, http.StatusCreated, retry.Code)
+	assert.Equal(t, first.Body.String(), retry.Body.String())
+	assert.Equal(t, "true", retry.Header().Get(IdempotentReplayedHeader))
+	assert.Equal(t, "application/json", retry.Header().Get("Content-Type"))
+
+	mismatch := send(`{"url":"https://example.org"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, mismatch.Code)
+
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, replays+1, testutil.ToFloat64(metrics.IdempotentReplays))
+}
+
+// TestIdempotency_ReleasesKeyOnServerError tests that a failed request can be retried with the same key
+func TestIdempotency_ReleasesKeyOnServerError(t *testing.T) {
+	calls := 0
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			http.Error(w, "boom", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+	handler := NewIdempotency(newMemoryIdempotencyRepository(), time.Hour).Middleware(next)
+
+	for _, want := range []int{http.StatusInternalServerError, http.StatusCreated} {
+		req := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(`{}`))
+		req.Header.Set(IdempotencyKeyHeader, "key-2")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, want, rec.Code)
+	}
+	assert.Equal(t, 2, calls)
+}
+
+// TestIdempotency_ReleasesKeyOnPanic tests that a request whose handler panicked can be retried with the same key
+func TestIdempotency_ReleasesKeyOnPanic(t *testing.T) {
+	calls := 0
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			panic("boom")
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+	handler := NewIdempotency(newMemoryIdempotencyRepository(), time.Hour).Middleware(next)
+
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/shorten", strings.NewReader(`{}`))
+		req.Header.Set(IdempotencyKeyHeader, "key-3")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.PanicsWithValue(t, "boom", func() { send() })
+	assert.Equal(t, http.StatusCreated, send().Code)
+	assert.Equal(t, 2, calls)
+}
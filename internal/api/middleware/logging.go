@@ -1,14 +1,28 @@
 package middleware
 
 import (
+	"bufio"
 	"go.uber.org/zap"
+	"net"
 	"net/http"
 	"time"
+	"urlshortener/internal/pkg/privacy"
+	"urlshortener/internal/pkg/reqctx"
 	"urlshortener/pkg/logger"
 )
 
-// LoggingMiddleware logs the details of each HTTP request
-func LoggingMiddleware(next http.Handler) http.Handler {
+// Logging logs the details of each HTTP request, anonymising the client address like stored visitors
+type Logging struct {
+	anonymizer *privacy.Anonymizer
+}
+
+// NewLogging creates a new instance of Logging; a nil anonymizer logs client addresses as they are
+func NewLogging(anonymizer *privacy.Anonymizer) *Logging {
+	return &Logging{anonymizer: anonymizer}
+}
+
+// Middleware logs the details of each HTTP request once it has been served
+func (l *Logging) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 
@@ -19,17 +33,30 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(wrapped, r)
 
 		// Log request details
-		logger.GetLogger().Info("http request",
+		logger.FromContext(r.Context()).Info("http request",
 			zap.String("method", r.Method),
 			zap.String("path", r.URL.Path),
 			zap.Int("status", wrapped.status),
 			zap.Duration("duration", time.Since(start)),
-			zap.String("remote_addr", r.RemoteAddr),
+			zap.String("remote_addr", l.remoteAddr(r.RemoteAddr, start)),
 			zap.String("user_agent", r.UserAgent()),
+			zap.String("request_id", reqctx.RequestID(r.Context())),
 		)
 	})
 }
 
+// remoteAddr anonymises the host of a client address, dropping its port
+func (l *Logging) remoteAddr(addr string, at time.Time) string {
+	if l.anonymizer == nil {
+		return addr
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	return l.anonymizer.IP(host, at)
+}
+
 // responseWriter captures the status code for logging
 type responseWriter struct {
 	http.ResponseWriter
@@ -46,3 +73,14 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.status = code
 	rw.ResponseWriter.WriteHeader(code)
 }
+
+// Unwrap returns the wrapped http.ResponseWriter, so http.ResponseController can flush streamed responses.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// Hijack takes over the connection for protocols such as WebSocket, which need http.Hijacker itself.
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	rw.status = http.StatusSwitchingProtocols
+	return http.NewResponseController(rw.ResponseWriter).Hijack()
+}
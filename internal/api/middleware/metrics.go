@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+	"time"
+	"urlshortener/internal/pkg/metrics"
+)
+
+// Metrics counts and times each HTTP request by the template of the route it matched,
+// such as "/shorten/{shortCode}", so short codes do not each get their own series
+func Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		wrapped := wrapResponseWriter(w)
+
+		next.ServeHTTP(wrapped, r)
+
+		route := routeTemplate(r)
+		status := strconv.Itoa(wrapped.status)
+		metrics.HTTPRequests.WithLabelValues(route, r.Method, status).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(route, r.Method, status).Observe(time.Since(start).Seconds())
+	})
+}
+
+// routeTemplate returns the path template of the route matching r, or "unmatched" if none did
+func routeTemplate(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return "unmatched"
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return "unmatched"
+	}
+	return template
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+
+	"urlshortener/internal/pkg/metrics"
+)
+
+// TestMetrics_CountsByRouteTemplate tests that requests are counted by the template of their route, not their path
+func TestMetrics_CountsByRouteTemplate(t *testing.T) {
+	router := mux.NewRouter()
+	router.Use(Metrics)
+	router.HandleFunc("/metrics-test/{shortCode}", func(w http.ResponseWriter, r *http.Request) {
+		if mux.Vars(r)["shortCode"] == "missing" {
+			http.NotFound(w, r)
+		}
+	}).Methods("GET")
+
+	route := "/metrics-test/{shortCode}"
+	found := testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(route, "GET", "200"))
+	missing := testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(route, "GET", "404"))
+	observed := observations(t, metrics.HTTPRequestDuration.WithLabelValues(route, "GET", "200"))
+
+	for _, path := range []string{"/metrics-test/abc", "/metrics-test/def", "/metrics-test/missing"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	assert.Equal(t, found+2, testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(route, "GET", "200")))
+	assert.Equal(t, missing+1, testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(route, "GET", "404")))
+	assert.Equal(t, observed+2, observations(t, metrics.HTTPRequestDuration.WithLabelValues(route, "GET", "200")))
+}
+
+// observations returns the number of values observed by a histogram
+func observations(t *testing.T, observer prometheus.Observer) uint64 {
+	var m dto.Metric
+	assert.NoError(t, observer.(prometheus.Metric).Write(&m))
+	return m.GetHistogram().GetSampleCount()
+}
@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"urlshortener/internal/pkg/reqctx"
+)
+
+const (
+	// RequestIDHeader carries the request ID in both directions
+	RequestIDHeader = "X-Request-ID"
+
+	// ActorHeader identifies the caller performing the request
+	ActorHeader = "X-Actor"
+)
+
+// RequestContextMiddleware attaches the request ID and the caller identity to the request context
+func RequestContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := strings.TrimSpace(r.Header.Get(RequestIDHeader))
+		if requestID == "" {
+			requestID = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+
+		ctx := reqctx.WithRequestID(r.Context(), requestID)
+		ctx = reqctx.WithActor(ctx, strings.TrimSpace(r.Header.Get(ActorHeader)))
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// newRequestID generates a random 128-bit hex encoded request ID
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
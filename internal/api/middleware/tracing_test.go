@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+
+	"urlshortener/internal/pkg/tracing"
+	"urlshortener/pkg/logger"
+)
+
+var (
+	spanRecorderOnce sync.Once
+	spanRecorder     *tracetest.SpanRecorder
+)
+
+// recordSpans installs a tracer provider recording every span, once for the package,
+// since tracers created before it keep delegating to the first provider installed
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	spanRecorderOnce.Do(func() {
+		_, err := tracing.Setup(context.Background(), tracing.Options{})
+		assert.NoError(t, err)
+		spanRecorder = tracetest.NewSpanRecorder()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spanRecorder)))
+	})
+	return spanRecorder
+}
+
+// TestTracing_ContinuesTrace tests that requests are traced in a span named after their route,
+// continuing the trace of a traceparent header, and that log lines carry the trace
+func TestTracing_ContinuesTrace(t *testing.T) {
+	recorder := recordSpans(t)
+
+	var logFields []string
+	router := mux.NewRouter()
+	router.Use(Tracing)
+	router.HandleFunc("/tracing-test/{shortCode}", func(w http.ResponseWriter, r *http.Request) {
+		for _, field := range logger.TraceFields(r.Context()) {
+			logFields = append(logFields, field.Key+"="+field.String)
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}).Methods("GET")
+
+	req := httptest.NewRequest(http.MethodGet, "/tracing-test/abc123", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	var span sdktrace.ReadOnlySpan
+	for _, ended := range recorder.Ended() {
+		if ended.Name() == "GET /tracing-test/{shortCode}" {
+			span = ended
+		}
+	}
+	if !assert.NotNil(t, span) {
+		return
+	}
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", span.Parent().SpanID().String())
+	assert.True(t, span.Parent().IsRemote())
+	assert.Contains(t, span.Attributes(), semconv.HTTPRoute("/tracing-test/{shortCode}"))
+	assert.Contains(t, span.Attributes(), semconv.HTTPResponseStatusCode(http.StatusInternalServerError))
+	assert.Equal(t, codes.Error, span.Status().Code)
+
+	assert.Equal(t, []string{
+		"trace_id=4bf92f3577b34da6a3ce929d0e0e4736",
+		"span_id=" + span.SpanContext().SpanID().String(),
+	}, logFields)
+}
+
+// TestTracing_StartsTrace tests that requests without a traceparent header start a new trace
+func TestTracing_StartsTrace(t *testing.T) {
+	recorder := recordSpans(t)
+
+	router := mux.NewRouter()
+	router.Use(Tracing)
+	router.HandleFunc("/tracing-new", func(w http.ResponseWriter, r *http.Request) {}).Methods("POST")
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/tracing-new", nil))
+
+	var found bool
+	for _, ended := range recorder.Ended() {
+		if ended.Name() == "POST /tracing-new" {
+			found = true
+			assert.False(t, ended.Parent().IsValid())
+			assert.Equal(t, codes.Unset, ended.Status().Code)
+		}
+	}
+	assert.True(t, found)
+	assert.Empty(t, logger.TraceFields(context.Background()))
+}
@@ -2,23 +2,114 @@ package routes
 
 import (
 	"github.com/gorilla/mux"
+	"net/http"
 	"urlshortener/internal/api/handlers"
+	"urlshortener/internal/api/middleware"
+	"urlshortener/internal/pkg/metrics"
 )
 
 // SetupRoutes initializes the API routes for URL handling
-func SetupRoutes(r *mux.Router, urlHandler *handlers.URLHandler) {
-	// Route for creating a new short URL
-	r.HandleFunc("/shorten", urlHandler.CreateShortURL).Methods("POST")
+func SetupRoutes(r *mux.Router, urlHandler *handlers.URLHandler, redirectHandler *handlers.RedirectHandler, qrHandler *handlers.QRHandler, campaignHandler *handlers.CampaignHandler, liveHandler *handlers.LiveHandler, webhookHandler *handlers.WebhookHandler, idempotency *middleware.Idempotency, domainScope *middleware.DomainScope) {
+	// Management API routes address the domain named by the domain query parameter
+	api := r.PathPrefix("/shorten").Subrouter()
+	api.Use(domainScope.ByQuery)
+
+	// Route for creating a new short URL, retried safely with an Idempotency-Key header
+	api.Handle("", idempotency.Middleware(http.HandlerFunc(urlHandler.CreateShortURL))).Methods("POST")
+
+	// Route for listing URLs, optionally filtered by activation status, tags, folder and labels
+	api.HandleFunc("", urlHandler.ListURLs).Methods("GET")
+
+	// Route for exporting every URL matching the listing filters, registered before the short code routes
+	api.HandleFunc("/export", urlHandler.ExportURLs).Methods("GET")
 
 	// Route for retrieving a URL by its short code
-	r.HandleFunc("/shorten/{shortCode}", urlHandler.GetURL).Methods("GET")
+	api.HandleFunc("/{shortCode}", urlHandler.GetURL).Methods("GET")
 
 	// Route for updating an existing short URL
-	r.HandleFunc("/shorten/{shortCode}", urlHandler.UpdateURL).Methods("PUT")
+	api.HandleFunc("/{shortCode}", urlHandler.UpdateURL).Methods("PUT")
+
+	// Route for partially updating an existing short URL
+	api.HandleFunc("/{shortCode}", urlHandler.PatchURL).Methods("PATCH")
 
 	// Route for deleting a URL by its short code
-	r.HandleFunc("/shorten/{shortCode}", urlHandler.DeleteURL).Methods("DELETE")
+	api.HandleFunc("/{shortCode}", urlHandler.DeleteURL).Methods("DELETE")
 
 	// Route for retrieving statistics for a URL by its short code
-	r.HandleFunc("/shorten/{shortCode}/stats", urlHandler.GetStats).Methods("GET")
+	api.HandleFunc("/{shortCode}/stats", urlHandler.GetStats).Methods("GET")
+
+	// Routes for streaming the clicks on a short URL as they happen, over Server-Sent Events or WebSocket
+	api.HandleFunc("/{shortCode}/live", liveHandler.Stream).Methods("GET")
+	api.HandleFunc("/{shortCode}/live/ws", liveHandler.StreamWebSocket).Methods("GET")
+
+	// Route for rendering the QR code of a short URL
+	api.HandleFunc("/{shortCode}/qr", qrHandler.GetQRCode).Methods("GET")
+
+	// Route for fetching the metadata of the destination of a URL again
+	api.HandleFunc("/{shortCode}/metadata/refresh", urlHandler.RefreshMetadata).Methods("POST")
+
+	// Route for retrieving the revision history of a URL by its short code
+	api.HandleFunc("/{shortCode}/history", urlHandler.GetHistory).Methods("GET")
+
+	// Route for rolling a URL back to a prior revision
+	api.HandleFunc("/{shortCode}/history/{revisionID}/rollback", urlHandler.RollbackURL).Methods("POST")
+
+	// Campaign routes; campaigns span every domain
+	campaigns := r.PathPrefix("/campaigns").Subrouter()
+	campaigns.HandleFunc("", campaignHandler.CreateCampaign).Methods("POST")
+	campaigns.HandleFunc("", campaignHandler.ListCampaigns).Methods("GET")
+	campaigns.HandleFunc("/{campaignID}", campaignHandler.GetCampaign).Methods("GET")
+	campaigns.HandleFunc("/{campaignID}", campaignHandler.UpdateCampaign).Methods("PUT")
+	campaigns.HandleFunc("/{campaignID}", campaignHandler.DeleteCampaign).Methods("DELETE")
+
+	// Route for the click statistics aggregated across the URLs of a campaign
+	campaigns.HandleFunc("/{campaignID}/stats", campaignHandler.GetCampaignStats).Methods("GET")
+
+	// Webhook routes; webhooks receive the events of every domain
+	webhooks := r.PathPrefix("/webhooks").Subrouter()
+	webhooks.HandleFunc("", webhookHandler.CreateWebhook).Methods("POST")
+	webhooks.HandleFunc("", webhookHandler.ListWebhooks).Methods("GET")
+	webhooks.HandleFunc("/{webhookID}", webhookHandler.GetWebhook).Methods("GET")
+	webhooks.HandleFunc("/{webhookID}", webhookHandler.UpdateWebhook).Methods("PUT")
+	webhooks.HandleFunc("/{webhookID}", webhookHandler.DeleteWebhook).Methods("DELETE")
+
+	// Routes for inspecting the deliveries of a webhook, and the dead-lettered ones alone
+	webhooks.HandleFunc("/{webhookID}/deliveries", webhookHandler.ListDeliveries).Methods("GET")
+	webhooks.HandleFunc("/{webhookID}/dead-letters", webhookHandler.ListDeadLetters).Methods("GET")
+
+	// Routes for attempting a delivery, or every dead-lettered delivery, again
+	webhooks.HandleFunc("/{webhookID}/deliveries/{deliveryID}/replay", webhookHandler.ReplayDelivery).Methods("POST")
+	webhooks.HandleFunc("/{webhookID}/dead-letters/replay", webhookHandler.ReplayDeadLetters).Methods("POST")
+
+	// Administrative routes, scoped by the domain query parameter like the management API
+	admin := r.PathPrefix("/admin").Subrouter()
+	admin.Use(domainScope.ByQuery)
+
+	// Route for listing URLs whose destination health checks report down
+	admin.HandleFunc("/broken-links", urlHandler.ListBrokenLinks).Methods("GET")
+
+	// Route for erasing the click data and visitor details recorded for every URL of an owner, on any domain
+	admin.HandleFunc("/owners/{owner}/data", urlHandler.EraseOwnerData).Methods("DELETE")
+
+	// Route for the metrics scraped by Prometheus
+	r.Handle("/metrics", metrics.Handler()).Methods("GET")
+
+	// Short URLs are followed on the domain named by the Host header.
+	// These routes are registered last so they do not shadow the API.
+	redirects := r.NewRoute().Subrouter()
+	redirects.Use(domainScope.ByHost)
+
+	// Routes for the preview page of a short URL, matched before the short code alone would swallow the "+"
+	redirects.HandleFunc("/{shortCode}+", redirectHandler.Preview).Methods("GET")
+	redirects.HandleFunc("/{shortCode}+", redirectHandler.Unlock).Methods("POST")
+
+	// Route for following a short URL; HEAD requests are answered like GET and counted as bots
+	redirects.HandleFunc("/{shortCode}", redirectHandler.Redirect).Methods("GET", "HEAD")
+
+	// Route for submitting the password of a protected short URL
+	redirects.HandleFunc("/{shortCode}", redirectHandler.Unlock).Methods("POST")
+
+	// Routes for short URLs followed by a path passed through to the destination
+	redirects.HandleFunc("/{shortCode}/{extraPath:.+}", redirectHandler.Redirect).Methods("GET", "HEAD")
+	redirects.HandleFunc("/{shortCode}/{extraPath:.+}", redirectHandler.Unlock).Methods("POST")
 }
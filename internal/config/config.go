@@ -1,8 +1,13 @@
 package config
 
 import (
+	"fmt"
 	"github.com/joho/godotenv"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+	"urlshortener/internal/domain/models"
 )
 
 // Config holds the configuration values for the application
@@ -10,6 +15,96 @@ type Config struct {
 	MongoURI      string
 	MongoDB       string
 	ServerAddress string
+
+	// IdempotencyTTL is how long responses to requests with an Idempotency-Key are kept
+	IdempotencyTTL time.Duration
+
+	// PasswordMaxAttempts is how many password attempts a client may make per link within PasswordAttemptWindow
+	PasswordMaxAttempts   int
+	PasswordAttemptWindow time.Duration
+
+	// InactiveFallbackURL receives visitors of URLs outside their activation window, if set
+	InactiveFallbackURL string
+
+	// GeoIPDatabasePath points to a MaxMind DB file used for country targeting, if set
+	GeoIPDatabasePath string
+
+	// PreviewAll shows visitors of every URL a preview page before redirecting them
+	PreviewAll bool
+
+	// MetadataWorkers is how many destination pages are fetched for metadata at once; zero disables fetching
+	MetadataWorkers int
+
+	// MetadataTimeout bounds the fetch of the metadata of a single destination
+	MetadataTimeout time.Duration
+
+	// HealthCheckInterval is how often the destination of each URL is checked; zero disables checking
+	HealthCheckInterval time.Duration
+
+	// HealthCheckConcurrency is how many destinations are checked at once
+	HealthCheckConcurrency int
+
+	// HealthCheckHostLimit checks are sent to a single host per minute at most
+	HealthCheckHostLimit int
+
+	// VisitorSalt salts the hashes identifying visitors in the click log and unique visitor counts;
+	// it should be shared by all instances
+	VisitorSalt string
+
+	// IPAnonymisation is how client addresses are anonymised before they are stored or logged:
+	// truncate, hash or none
+	IPAnonymisation string
+
+	// VisitorSaltRotation is how often the salts derived from VisitorSalt change; zero keeps VisitorSalt fixed.
+	// Visitors are counted as unique again in every period.
+	VisitorSaltRotation time.Duration
+
+	// ClickRetentionDays is how many days raw clicks are kept before they are rolled up into daily
+	// counts and deleted; zero keeps them forever
+	ClickRetentionDays int
+
+	// LiveBuffer is how many click events wait for a slow live stream client before further events are dropped,
+	// and LiveMaxSubscribers how many live streams an instance serves at once
+	LiveBuffer         int
+	LiveMaxSubscribers int
+
+	// WebhookWorkers is how many webhook deliveries an instance attempts at once; zero leaves delivery to other instances
+	WebhookWorkers int
+
+	// WebhookMaxAttempts is how many times a webhook delivery is attempted before it is dead-lettered,
+	// and WebhookTimeout bounds each attempt
+	WebhookMaxAttempts int
+	WebhookTimeout     time.Duration
+
+	// EventSink selects where the domain events of URLs are emitted: stdout, file, nats, or nowhere if empty.
+	// EventSinkPath is the file the file sink appends to, EventSinkURL the server the nats sink publishes to
+	// and EventSinkSubject the prefix of the subjects it publishes on.
+	EventSink        string
+	EventSinkPath    string
+	EventSinkURL     string
+	EventSinkSubject string
+
+	// EventOutbox routes events through an outbox in MongoDB, so none is lost while the sink is unavailable
+	EventOutbox bool
+
+	// TracingExporter selects where spans are exported: stdout, otlp, or nowhere if empty.
+	// TracingServiceName names the service in the spans and TracingSampleRatio is the share of new traces recorded.
+	TracingExporter    string
+	TracingServiceName string
+	TracingSampleRatio float64
+
+	// UniquesFlushInterval is how often the unique visitors counted by an instance are stored
+	UniquesFlushInterval time.Duration
+
+	// BotRulesPath points to a file of user-agent rules classifying clicks as bots; the built-in rules are used if empty
+	BotRulesPath string
+
+	// QRLogoPath points to a PNG or JPEG image that QR codes may embed, if set
+	QRLogoPath string
+
+	// Domains are the branded domains short URLs are served on, the first being the default.
+	// When empty, short URLs are served on any host from a single namespace.
+	Domains []models.Domain
 }
 
 // LoadConfig loads the configuration from environment variables
@@ -24,7 +119,145 @@ func LoadConfig() (*Config, error) {
 		MongoURI:      getEnv("MONGO_URI", "mongodb://localhost:27017"),
 		MongoDB:       getEnv("MONGO_DB", "urlshortener"),
 		ServerAddress: getEnv("SERVER_ADDRESS", "localhost:8080"),
+
+		InactiveFallbackURL: getEnv("INACTIVE_FALLBACK_URL", ""),
+		GeoIPDatabasePath:   getEnv("GEOIP_DB_PATH", ""),
+		QRLogoPath:          getEnv("QR_LOGO_PATH", ""),
+		BotRulesPath:        getEnv("BOT_RULES_PATH", ""),
+		VisitorSalt:         getEnv("VISITOR_SALT", ""),
+		IPAnonymisation:     getEnv("IP_ANONYMISATION", "truncate"),
+	}
+
+	idempotencyTTL, err := getEnvDuration("IDEMPOTENCY_TTL", 24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	config.IdempotencyTTL = idempotencyTTL
+
+	passwordMaxAttempts, err := getEnvInt("PASSWORD_MAX_ATTEMPTS", 5)
+	if err != nil {
+		return nil, err
 	}
+	config.PasswordMaxAttempts = passwordMaxAttempts
+
+	passwordAttemptWindow, err := getEnvDuration("PASSWORD_ATTEMPT_WINDOW", 15*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	config.PasswordAttemptWindow = passwordAttemptWindow
+
+	previewAll, err := getEnvBool("PREVIEW_ALL", false)
+	if err != nil {
+		return nil, err
+	}
+	config.PreviewAll = previewAll
+
+	metadataWorkers, err := getEnvInt("METADATA_WORKERS", 4)
+	if err != nil {
+		return nil, err
+	}
+	config.MetadataWorkers = metadataWorkers
+
+	metadataTimeout, err := getEnvDuration("METADATA_TIMEOUT", 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	config.MetadataTimeout = metadataTimeout
+
+	healthCheckInterval, err := getEnvDuration("HEALTHCHECK_INTERVAL", time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	config.HealthCheckInterval = healthCheckInterval
+
+	healthCheckConcurrency, err := getEnvInt("HEALTHCHECK_CONCURRENCY", 8)
+	if err != nil {
+		return nil, err
+	}
+	config.HealthCheckConcurrency = healthCheckConcurrency
+
+	healthCheckHostLimit, err := getEnvInt("HEALTHCHECK_HOST_LIMIT", 10)
+	if err != nil {
+		return nil, err
+	}
+	config.HealthCheckHostLimit = healthCheckHostLimit
+
+	uniquesFlushInterval, err := getEnvDuration("UNIQUES_FLUSH_INTERVAL", 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	config.UniquesFlushInterval = uniquesFlushInterval
+
+	liveBuffer, err := getEnvInt("LIVE_BUFFER", 64)
+	if err != nil {
+		return nil, err
+	}
+	config.LiveBuffer = liveBuffer
+
+	liveMaxSubscribers, err := getEnvInt("LIVE_MAX_SUBSCRIBERS", 1000)
+	if err != nil {
+		return nil, err
+	}
+	config.LiveMaxSubscribers = liveMaxSubscribers
+
+	webhookWorkers, err := getEnvInt("WEBHOOK_WORKERS", 4)
+	if err != nil {
+		return nil, err
+	}
+	config.WebhookWorkers = webhookWorkers
+
+	webhookMaxAttempts, err := getEnvInt("WEBHOOK_MAX_ATTEMPTS", 10)
+	if err != nil {
+		return nil, err
+	}
+	config.WebhookMaxAttempts = webhookMaxAttempts
+
+	webhookTimeout, err := getEnvDuration("WEBHOOK_TIMEOUT", 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	config.WebhookTimeout = webhookTimeout
+
+	config.EventSink = getEnv("EVENT_SINK", "")
+	config.EventSinkPath = getEnv("EVENT_SINK_PATH", "events.ndjson")
+	config.EventSinkURL = getEnv("EVENT_SINK_URL", "nats://localhost:4222")
+	config.EventSinkSubject = getEnv("EVENT_SINK_SUBJECT", "urlshortener")
+
+	eventOutbox, err := getEnvBool("EVENT_OUTBOX", true)
+	if err != nil {
+		return nil, err
+	}
+	config.EventOutbox = eventOutbox
+
+	config.TracingExporter = getEnv("TRACING_EXPORTER", "")
+	config.TracingServiceName = getEnv("TRACING_SERVICE_NAME", "urlshortener")
+
+	tracingSampleRatio, err := getEnvFloat("TRACING_SAMPLE_RATIO", 1)
+	if err != nil {
+		return nil, err
+	}
+	if tracingSampleRatio < 0 || tracingSampleRatio > 1 {
+		return nil, fmt.Errorf("invalid TRACING_SAMPLE_RATIO: must be between 0 and 1")
+	}
+	config.TracingSampleRatio = tracingSampleRatio
+
+	visitorSaltRotation, err := getEnvDuration("VISITOR_SALT_ROTATION", 0)
+	if err != nil {
+		return nil, err
+	}
+	config.VisitorSaltRotation = visitorSaltRotation
+
+	clickRetentionDays, err := getEnvInt("CLICK_RETENTION_DAYS", 90)
+	if err != nil {
+		return nil, err
+	}
+	config.ClickRetentionDays = clickRetentionDays
+
+	domains, err := getEnvDomains("DOMAINS")
+	if err != nil {
+		return nil, err
+	}
+	config.Domains = domains
 
 	return config, nil
 }
@@ -38,3 +271,105 @@ func getEnv(key, defaultValue string) string {
 
 	return defaultValue
 }
+
+// getEnvDuration retrieves the environment variable named by the key as a time.Duration.
+// If the variable is empty, it returns the defaultValue.
+func getEnvDuration(key string, defaultValue time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+
+	return duration, nil
+}
+
+// getEnvInt retrieves the environment variable named by the key as an int.
+// If the variable is empty, it returns the defaultValue.
+func getEnvInt(key string, defaultValue int) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+
+	return n, nil
+}
+
+// getEnvBool retrieves the environment variable named by the key as a bool.
+// If the variable is empty, it returns the defaultValue.
+func getEnvBool(key string, defaultValue bool) (bool, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %w", key, err)
+	}
+
+	return b, nil
+}
+
+// getEnvFloat retrieves the environment variable named by the key as a float64.
+// If the variable is empty, it returns the defaultValue.
+func getEnvFloat(key string, defaultValue float64) (float64, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", key, err)
+	}
+
+	return f, nil
+}
+
+// getEnvDomains retrieves the environment variable named by the key as a list of domains.
+// Domains are separated by commas, each being a host optionally followed by settings such as
+// "go.acme.com;status=301;length=7". If the variable is empty, it returns no domains.
+func getEnvDomains(key string) ([]models.Domain, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return nil, nil
+	}
+
+	var domains []models.Domain
+	for _, entry := range strings.Split(value, ",") {
+		parts := strings.Split(strings.TrimSpace(entry), ";")
+		domain := models.Domain{Host: strings.TrimSpace(parts[0])}
+		if domain.Host == "" {
+			return nil, fmt.Errorf("invalid %s: empty domain", key)
+		}
+
+		for _, setting := range parts[1:] {
+			name, raw, _ := strings.Cut(strings.TrimSpace(setting), "=")
+			n, err := strconv.Atoi(raw)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %s: %w", key, domain.Host, err)
+			}
+			switch name {
+			case "status":
+				domain.RedirectStatus = n
+			case "length":
+				domain.CodeLength = n
+			default:
+				return nil, fmt.Errorf("invalid %s: %s: unknown setting %q", key, domain.Host, name)
+			}
+		}
+		domains = append(domains, domain)
+	}
+
+	return domains, nil
+}
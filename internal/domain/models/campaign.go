@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// Campaign groups short URLs run together, such as the links of a marketing campaign
+type Campaign struct {
+	ID    string `json:"id" bson:"_id,omitempty"`
+	Name  string `json:"name" bson:"name"`
+	Owner string `json:"owner,omitempty" bson:"owner,omitempty"`
+
+	// StartsAt and EndsAt bound the period the campaign runs and its statistics cover; either may be open
+	StartsAt *time.Time `json:"starts_at,omitempty" bson:"starts_at,omitempty"`
+	EndsAt   *time.Time `json:"ends_at,omitempty" bson:"ends_at,omitempty"`
+
+	// UTM holds defaults for the UTM parameters of member URLs, applied when they are assigned
+	UTM *UTMParams `json:"utm,omitempty" bson:"utm,omitempty"`
+
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// CampaignStats aggregates the clicks on the member URLs of a campaign
+type CampaignStats struct {
+	CampaignID string `json:"campaign_id"`
+
+	// From and To bound the clicks counted, following the period of the campaign
+	From *time.Time `json:"from,omitempty"`
+	To   *time.Time `json:"to,omitempty"`
+
+	ClickSummary
+}
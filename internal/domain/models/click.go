@@ -0,0 +1,85 @@
+package models
+
+import "time"
+
+// Click records a single redirect through a short URL in the click log
+type Click struct {
+	ID        string `json:"id" bson:"_id,omitempty"`
+	ShortCode string `json:"short_code" bson:"short_code"`
+	Domain    string `json:"domain" bson:"domain"`
+	Variant   string `json:"variant,omitempty" bson:"variant,omitempty"`
+
+	// VisitorHash identifies the visitor by a salted hash of their IP address and user agent
+	VisitorHash string `json:"visitor_hash" bson:"visitor_hash"`
+
+	// Referrer is the host of the page the visitor came from, empty for direct visits
+	Referrer string `json:"referrer,omitempty" bson:"referrer,omitempty"`
+	Country  string `json:"country,omitempty" bson:"country,omitempty"`
+
+	// Bot is set for clicks classified as sent by a bot or crawler
+	Bot bool `json:"bot,omitempty" bson:"bot,omitempty"`
+
+	ClickedAt time.Time `json:"clicked_at" bson:"clicked_at"`
+}
+
+// ClickEvent describes a redirect as it happens, for live streams of a link.
+// It carries nothing identifying the visitor.
+type ClickEvent struct {
+	LinkRef
+	Variant   string    `json:"variant,omitempty"`
+	Referrer  string    `json:"referrer,omitempty"`
+	Country   string    `json:"country,omitempty"`
+	Bot       bool      `json:"bot"`
+	ClickedAt time.Time `json:"clicked_at"`
+}
+
+// LinkRef identifies a short URL across domains
+type LinkRef struct {
+	Domain    string `json:"domain" bson:"domain"`
+	ShortCode string `json:"short_code" bson:"short_code"`
+}
+
+// ClickQuery selects the clicks summarized from the click log
+type ClickQuery struct {
+	Links []LinkRef
+
+	// From and To bound the time of the clicks; either may be open
+	From *time.Time
+	To   *time.Time
+}
+
+// ClickSummary aggregates clicks from the click log.
+// Clicks by bots are only counted in BotClicks.
+type ClickSummary struct {
+	Clicks    int64 `json:"clicks"`
+	Uniques   int64 `json:"uniques"`
+	BotClicks int64 `json:"bot_clicks"`
+
+	// Links breaks the clicks down by short URL and Referrers by referring host, most clicks first
+	Links     []LinkClicks    `json:"links"`
+	Referrers []ReferrerCount `json:"referrers"`
+}
+
+// LinkClicks counts the clicks on a single short URL
+type LinkClicks struct {
+	LinkRef `bson:",inline"`
+	Clicks  int64 `json:"clicks" bson:"clicks"`
+	Uniques int64 `json:"uniques" bson:"uniques"`
+}
+
+// ClickRollup aggregates the clicks on a link during a day, kept once the raw clicks are past retention.
+// Uniques only counts the visitors of that day, since visitors cannot be matched across days any more.
+type ClickRollup struct {
+	LinkRef   `bson:",inline"`
+	Day       string          `json:"day" bson:"day"`
+	Clicks    int64           `json:"clicks" bson:"clicks"`
+	Uniques   int64           `json:"uniques" bson:"uniques"`
+	BotClicks int64           `json:"bot_clicks" bson:"bot_clicks"`
+	Referrers []ReferrerCount `json:"referrers" bson:"referrers"`
+}
+
+// ReferrerCount counts the clicks coming from a referring host; an empty referrer stands for direct visits
+type ReferrerCount struct {
+	Referrer string `json:"referrer" bson:"_id"`
+	Clicks   int64  `json:"clicks" bson:"clicks"`
+}
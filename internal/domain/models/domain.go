@@ -0,0 +1,13 @@
+package models
+
+// Domain is a host serving short URLs; each domain has its own namespace of short codes
+type Domain struct {
+	// Host is the lower-case host name, without a port; it is empty when no branded domains are configured
+	Host string `json:"host"`
+
+	// RedirectStatus is the status code visitors are redirected with
+	RedirectStatus int `json:"redirect_status"`
+
+	// CodeLength is the length of the short codes generated for the domain
+	CodeLength int `json:"code_length"`
+}
@@ -0,0 +1,15 @@
+package models
+
+// Erasure reports the data about visitors erased from the URLs of an owner
+type Erasure struct {
+	Owner string `json:"owner"`
+
+	// Links is the number of URLs whose visitor data was erased; the URLs themselves are kept
+	Links int `json:"links"`
+
+	// Clicks counts the raw clicks and daily rollups deleted, Sketches the unique visitor sketches deleted
+	// and Consumptions the single-use URLs whose consuming visitor was forgotten
+	Clicks       int64 `json:"clicks"`
+	Sketches     int64 `json:"sketches"`
+	Consumptions int64 `json:"consumptions"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// HealthStatus classifies the destination of a URL by the outcome of its recent checks
+type HealthStatus string
+
+const (
+	// HealthStatusUp destinations answered their latest checks
+	HealthStatusUp HealthStatus = "up"
+
+	// HealthStatusDown destinations failed enough consecutive checks to be considered broken
+	HealthStatusDown HealthStatus = "down"
+)
+
+// Health records the outcome of the latest check of the destination of a URL
+type Health struct {
+	Status HealthStatus `json:"status" bson:"status"`
+
+	// StatusCode is the response status, absent when no response was received
+	StatusCode int   `json:"status_code,omitempty" bson:"status_code,omitempty"`
+	LatencyMS  int64 `json:"latency_ms" bson:"latency_ms"`
+
+	// Error explains why the latest check failed, if it did
+	Error string `json:"error,omitempty" bson:"error,omitempty"`
+
+	// ConsecutiveFailures counts the failed checks since the last successful one
+	ConsecutiveFailures int       `json:"consecutive_failures" bson:"consecutive_failures"`
+	CheckedAt           time.Time `json:"checked_at" bson:"checked_at"`
+}
+
+// Down reports whether the destination is considered broken; unchecked destinations are not
+func (h *Health) Down() bool {
+	return h != nil && h.Status == HealthStatusDown
+}
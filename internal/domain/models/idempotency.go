@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// IdempotencyRecord stores the outcome of a request made with an Idempotency-Key header
+// so that retries of the same request can be answered with the original response.
+type IdempotencyRecord struct {
+	ID          string            `json:"id" bson:"_id"`
+	Caller      string            `json:"caller" bson:"caller"`
+	Key         string            `json:"key" bson:"key"`
+	RequestHash string            `json:"request_hash" bson:"request_hash"`
+	Completed   bool              `json:"completed" bson:"completed"`
+	StatusCode  int               `json:"status_code,omitempty" bson:"status_code,omitempty"`
+	Header      map[string]string `json:"header,omitempty" bson:"header,omitempty"`
+	Body        []byte            `json:"body,omitempty" bson:"body,omitempty"`
+	CreatedAt   time.Time         `json:"created_at" bson:"created_at"`
+	ExpiresAt   time.Time         `json:"expires_at" bson:"expires_at"`
+}
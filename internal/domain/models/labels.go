@@ -0,0 +1,24 @@
+package models
+
+import "strings"
+
+// MaxLabels bounds the labels of a URL
+const MaxLabels = 20
+
+// NormalizeTags trims and lowercases tags, dropping empty and repeated ones while keeping their order
+func NormalizeTags(tags []string) []string {
+	if tags == nil {
+		return nil
+	}
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Metadata describes the destination page of a URL, as fetched in the background
+type Metadata struct {
+	Title       string `json:"title,omitempty" bson:"title,omitempty"`
+	Description string `json:"description,omitempty" bson:"description,omitempty"`
+
+	// Image is the OpenGraph image of the page and Favicon its icon, both as absolute URLs
+	Image   string `json:"image,omitempty" bson:"image,omitempty"`
+	Favicon string `json:"favicon,omitempty" bson:"favicon,omitempty"`
+
+	// StatusCode and FinalURL describe the response after following redirects
+	StatusCode int    `json:"status_code,omitempty" bson:"status_code,omitempty"`
+	FinalURL   string `json:"final_url,omitempty" bson:"final_url,omitempty"`
+
+	// Error explains why the page could not be fetched or was not parsed, if so
+	Error     string    `json:"error,omitempty" bson:"error,omitempty"`
+	FetchedAt time.Time `json:"fetched_at" bson:"fetched_at"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// OutboxEvent is a domain event stored in the outbox until the relay has published it to the event sink.
+// Data holds the JSON encoding of the data of the event.
+type OutboxEvent struct {
+	ID         string    `json:"id" bson:"_id,omitempty"`
+	EventID    string    `json:"event_id" bson:"event_id"`
+	Type       string    `json:"type" bson:"type"`
+	OccurredAt time.Time `json:"occurred_at" bson:"occurred_at"`
+	Data       string    `json:"data" bson:"data"`
+
+	// Attempts and LastError describe the failed attempts to publish the event
+	Attempts  int    `json:"attempts" bson:"attempts"`
+	LastError string `json:"last_error,omitempty" bson:"last_error,omitempty"`
+
+	CreatedAt   time.Time  `json:"created_at" bson:"created_at"`
+	PublishedAt *time.Time `json:"published_at,omitempty" bson:"published_at,omitempty"`
+
+	// LockedUntil is set while a relay publishes the event, so other relays leave it alone
+	LockedUntil *time.Time `json:"-" bson:"locked_until,omitempty"`
+}
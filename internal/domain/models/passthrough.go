@@ -0,0 +1,20 @@
+package models
+
+// Query passthrough modes controlling how the query string of a short URL reaches the destination
+const (
+	// QueryModeDrop ignores the query string of the short URL
+	QueryModeDrop = "drop"
+
+	// QueryModeMerge adds parameters the destination does not already have
+	QueryModeMerge = "merge"
+
+	// QueryModeOverride adds parameters, replacing those the destination already has
+	QueryModeOverride = "override"
+)
+
+// UTMParams are campaign parameters added to the destination of a URL when it does not set them
+type UTMParams struct {
+	Source   string `json:"source,omitempty" bson:"source,omitempty"`
+	Medium   string `json:"medium,omitempty" bson:"medium,omitempty"`
+	Campaign string `json:"campaign,omitempty" bson:"campaign,omitempty"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// RevisionAction describes the kind of change recorded by a revision
+type RevisionAction string
+
+const (
+	RevisionActionCreate   RevisionAction = "create"
+	RevisionActionUpdate   RevisionAction = "update"
+	RevisionActionDelete   RevisionAction = "delete"
+	RevisionActionRollback RevisionAction = "rollback"
+)
+
+// Revision is an immutable record of a single change made to a URL
+type Revision struct {
+	ID        string         `json:"id" bson:"_id,omitempty"`
+	ShortCode string         `json:"short_code" bson:"short_code"`
+	Domain    string         `json:"domain" bson:"domain"`
+	Action    RevisionAction `json:"action" bson:"action"`
+	Actor     string         `json:"actor" bson:"actor"`
+	RequestID string         `json:"request_id,omitempty" bson:"request_id,omitempty"`
+	Before    *URL           `json:"before,omitempty" bson:"before,omitempty"`
+	After     *URL           `json:"after,omitempty" bson:"after,omitempty"`
+	CreatedAt time.Time      `json:"created_at" bson:"created_at"`
+}
@@ -0,0 +1,31 @@
+package models
+
+// Operating systems recognised by targeting rules
+const (
+	OSIOS      = "ios"
+	OSAndroid  = "android"
+	OSWindows  = "windows"
+	OSMacOS    = "macos"
+	OSLinux    = "linux"
+	OSChromeOS = "chromeos"
+)
+
+// Device classes recognised by targeting rules
+const (
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceDesktop = "desktop"
+)
+
+// TargetingRule sends visitors matching all of its conditions to Destination.
+// Within a condition any listed value matches; conditions left empty are not checked.
+type TargetingRule struct {
+	Destination string   `json:"destination" bson:"destination"`
+	OS          []string `json:"os,omitempty" bson:"os,omitempty"`
+	Devices     []string `json:"devices,omitempty" bson:"devices,omitempty"`
+	Languages   []string `json:"languages,omitempty" bson:"languages,omitempty"`
+	Countries   []string `json:"countries,omitempty" bson:"countries,omitempty"`
+
+	// Query requires each parameter to be present, with the given value unless it is empty
+	Query map[string]string `json:"query,omitempty" bson:"query,omitempty"`
+}
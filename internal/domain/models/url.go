@@ -6,7 +6,120 @@ type URL struct {
 	ID          string    `json:"id" bson:"_id,omitempty"`
 	OriginalURL string    `json:"original_url" bson:"original_url"`
 	ShortCode   string    `json:"short_code" bson:"short_code"`
+	Domain      string    `json:"domain" bson:"domain"`
 	AccessCount int       `json:"access_count" bson:"access_count"`
+	Version     int64     `json:"version" bson:"version"`
 	CreatedAt   time.Time `json:"created_at" bson:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at" bson:"updated_at"`
+
+	// Owner is the actor who created the URL; URLs created anonymously have none
+	Owner string `json:"owner,omitempty" bson:"owner,omitempty"`
+
+	// BotAccessCount counts the accesses classified as bots and crawlers, which AccessCount leaves out
+	BotAccessCount int `json:"bot_access_count" bson:"bot_access_count"`
+
+	// PasswordHash is the bcrypt hash of the password guarding the redirect, if any
+	PasswordHash      string `json:"-" bson:"password_hash,omitempty"`
+	PasswordProtected bool   `json:"password_protected" bson:"password_protected"`
+
+	// SingleUse URLs resolve exactly once; ConsumedBy records the visit that used them up
+	SingleUse  bool         `json:"single_use" bson:"single_use"`
+	ConsumedBy *Consumption `json:"consumed_by,omitempty" bson:"consumed_by,omitempty"`
+
+	// ActiveFrom and ActiveUntil bound the window in which the URL resolves; either may be open
+	ActiveFrom  *time.Time `json:"active_from,omitempty" bson:"active_from,omitempty"`
+	ActiveUntil *time.Time `json:"active_until,omitempty" bson:"active_until,omitempty"`
+
+	// Rules are evaluated in order when the URL is followed; OriginalURL is used if none match
+	Rules []TargetingRule `json:"rules,omitempty" bson:"rules,omitempty"`
+
+	// Variants split visitors not matched by a rule across weighted destinations.
+	// With StickyVariants a returning visitor keeps the variant first assigned to them.
+	Variants       []Variant `json:"variants,omitempty" bson:"variants,omitempty"`
+	StickyVariants bool      `json:"sticky_variants" bson:"sticky_variants"`
+
+	// QueryMode and PathPassthrough control whether the query string and any path after the
+	// short code are carried over to the destination; UTM parameters are added to it
+	QueryMode       string     `json:"query_mode,omitempty" bson:"query_mode,omitempty"`
+	PathPassthrough bool       `json:"path_passthrough" bson:"path_passthrough"`
+	UTM             *UTMParams `json:"utm,omitempty" bson:"utm,omitempty"`
+
+	// Title describes the URL on its preview page; with Preview set visitors see that page before being redirected
+	Title   string `json:"title,omitempty" bson:"title,omitempty"`
+	Preview bool   `json:"preview" bson:"preview"`
+
+	// Tags, Folder, Notes and Labels organise URLs for their owners; listings can be filtered by all but Notes
+	Tags   []string          `json:"tags,omitempty" bson:"tags,omitempty"`
+	Folder string            `json:"folder,omitempty" bson:"folder,omitempty"`
+	Notes  string            `json:"notes,omitempty" bson:"notes,omitempty"`
+	Labels map[string]string `json:"labels,omitempty" bson:"labels,omitempty"`
+
+	// CampaignID is the ID of the campaign the URL belongs to, if any
+	CampaignID string `json:"campaign_id,omitempty" bson:"campaign_id,omitempty"`
+
+	// FallbackURL receives visitors while health checks report OriginalURL down
+	FallbackURL string `json:"fallback_url,omitempty" bson:"fallback_url,omitempty"`
+
+	// Metadata describes the destination page; it is fetched in the background and not versioned
+	Metadata *Metadata `json:"metadata,omitempty" bson:"metadata,omitempty"`
+
+	// Health is the outcome of the latest check of OriginalURL; like Metadata it is not versioned
+	Health *Health `json:"health,omitempty" bson:"health,omitempty"`
+
+	// HealthCheckAfter puts off the next check of OriginalURL while its host has been checked too often
+	HealthCheckAfter *time.Time `json:"-" bson:"health_check_after,omitempty"`
+}
+
+// StatusAt classifies the URL by its activation window at the given time
+func (u *URL) StatusAt(now time.Time) LinkStatus {
+	if u.ActiveFrom != nil && now.Before(*u.ActiveFrom) {
+		return LinkStatusScheduled
+	}
+	if u.ActiveUntil != nil && !now.Before(*u.ActiveUntil) {
+		return LinkStatusEnded
+	}
+	return LinkStatusActive
+}
+
+// HidesDestination reports whether only visitors resolving the URL may learn where it leads:
+// those knowing its password, or the one visitor a single-use URL is meant for
+func (u *URL) HidesDestination() bool {
+	return u != nil && (u.PasswordProtected || u.SingleUse)
+}
+
+// Redacted returns the URL, or a copy without its destinations if it hides them
+func (u *URL) Redacted() *URL {
+	if !u.HidesDestination() {
+		return u
+	}
+	return u.WithoutDestinations()
+}
+
+// WithoutDestinations returns a copy of the URL without the destinations it leads to or the details fetched from them.
+// Rule conditions and variant weights and clicks are kept.
+func (u *URL) WithoutDestinations() *URL {
+	if u == nil {
+		return nil
+	}
+	c := *u
+	c.OriginalURL = ""
+	c.FallbackURL = ""
+	c.Rules = make([]TargetingRule, len(u.Rules))
+	for i, rule := range u.Rules {
+		rule.Destination = ""
+		c.Rules[i] = rule
+	}
+	c.Variants = make([]Variant, len(u.Variants))
+	for i, variant := range u.Variants {
+		variant.Destination = ""
+		c.Variants[i] = variant
+	}
+	c.Metadata = nil
+	if c.Health != nil {
+		health := *c.Health
+		// Transport errors quote the URL that was checked
+		health.Error = ""
+		c.Health = &health
+	}
+	return &c
 }
@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// LinkStatus classifies a URL by its activation window at a point in time
+type LinkStatus string
+
+const (
+	// LinkStatusScheduled URLs have an activation time in the future
+	LinkStatusScheduled LinkStatus = "scheduled"
+
+	// LinkStatusActive URLs are inside their activation window, or have none
+	LinkStatusActive LinkStatus = "active"
+
+	// LinkStatusEnded URLs have a deactivation time in the past
+	LinkStatusEnded LinkStatus = "ended"
+)
+
+// URLFilter selects the URLs returned by a listing
+type URLFilter struct {
+	// Status restricts the listing to URLs in that state at Now; empty matches every URL
+	Status LinkStatus
+	Now    time.Time
+
+	// Domain restricts the listing to URLs on that domain; empty matches every domain
+	Domain string
+
+	// Health restricts the listing to URLs whose destination is in that state; empty matches every URL
+	Health HealthStatus
+
+	// Tags restricts the listing to URLs carrying all of them, Folder to URLs in that folder
+	// and Labels to URLs with all of those label values; empty values match every URL
+	Tags   []string
+	Folder string
+	Labels map[string]string
+
+	// CampaignID restricts the listing to the members of a campaign; empty matches every URL
+	CampaignID string
+
+	// Owner restricts the listing to URLs created by that actor; empty matches every URL
+	Owner string
+
+	Limit  int
+	Offset int
+}
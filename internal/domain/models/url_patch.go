@@ -0,0 +1,6 @@
+package models
+
+// URLPatch is a partial update of the mutable fields of a URL, keyed by their JSON field name.
+// Field names are shared with the storage layer; a nil value removes the field.
+// Members of objects merged key by key, such as labels, are keyed as "field.member".
+type URLPatch map[string]interface{}
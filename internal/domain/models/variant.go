@@ -0,0 +1,9 @@
+package models
+
+// Variant is one of several weighted destinations a short URL rotates traffic across
+type Variant struct {
+	ID          string `json:"id" bson:"id"`
+	Destination string `json:"destination" bson:"destination"`
+	Weight      int    `json:"weight" bson:"weight"`
+	Clicks      int    `json:"clicks" bson:"clicks"`
+}
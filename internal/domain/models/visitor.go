@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// Visitor describes the client following a short URL
+type Visitor struct {
+	IP        string `json:"ip" bson:"ip"`
+	UserAgent string `json:"user_agent" bson:"user_agent"`
+	Country   string `json:"country,omitempty" bson:"country,omitempty"`
+
+	// AcceptLanguage, Query and AssignedVariant are only used to pick a destination and are not recorded
+	AcceptLanguage  string              `json:"-" bson:"-"`
+	Query           map[string][]string `json:"-" bson:"-"`
+	AssignedVariant string              `json:"-" bson:"-"`
+
+	// Referrer is the host of the referring page, recorded in the click log only
+	Referrer string `json:"-" bson:"-"`
+
+	// DoNotTrack is set when the visitor asked not to be tracked; nothing identifying them is then stored
+	DoNotTrack bool `json:"-" bson:"-"`
+
+	// Bot is set when the request was classified as sent by a bot or crawler rather than a person
+	Bot bool `json:"-" bson:"-"`
+
+	// ConfirmedPreview is set once the visitor chose to continue from the preview page of a URL
+	ConfirmedPreview bool `json:"-" bson:"-"`
+}
+
+// Consumption records the visitor that used up a single-use URL
+type Consumption struct {
+	Visitor    `bson:",inline"`
+	Variant    string    `json:"variant,omitempty" bson:"variant,omitempty"`
+	ConsumedAt time.Time `json:"consumed_at" bson:"consumed_at"`
+}
@@ -0,0 +1,47 @@
+package models
+
+import "time"
+
+const (
+	// DayLayout formats the period of a daily visitor sketch
+	DayLayout = "2006-01-02"
+
+	// TotalPeriod is the period of the visitor sketch covering every visit to a link
+	TotalPeriod = "total"
+)
+
+// VisitorSketch holds a HyperLogLog sketch of the visitors of a link during a period,
+// either a day formatted with DayLayout or TotalPeriod, along with the clicks of the period
+type VisitorSketch struct {
+	Domain    string `json:"domain" bson:"domain"`
+	ShortCode string `json:"short_code" bson:"short_code"`
+	Period    string `json:"period" bson:"period"`
+	Clicks    int64  `json:"clicks" bson:"clicks"`
+
+	// Sketch is the binary encoding of the sketch
+	Sketch []byte `json:"-" bson:"sketch"`
+
+	// Version is incremented by every merge, so concurrent merges can detect each other
+	Version   int64     `json:"version" bson:"version"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// UniqueVisitors reports the estimated unique visitors of a link over its lifetime and during a range of days
+type UniqueVisitors struct {
+	Total int64 `json:"total"`
+
+	// From and To are the first and last day of the range, which Clicks and Uniques cover
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Clicks  int64  `json:"clicks"`
+	Uniques int64  `json:"uniques"`
+
+	Daily []DailyVisitors `json:"daily"`
+}
+
+// DailyVisitors counts the clicks and estimated unique visitors of a link during a day
+type DailyVisitors struct {
+	Date    string `json:"date"`
+	Clicks  int64  `json:"clicks"`
+	Uniques int64  `json:"uniques"`
+}
@@ -0,0 +1,83 @@
+package models
+
+import "time"
+
+// Types of the events emitted about short URLs
+const (
+	EventLinkCreated = "link.created"
+	EventLinkUpdated = "link.updated"
+	EventLinkDeleted = "link.deleted"
+	EventLinkExpired = "link.expired"
+	EventLinkClicked = "link.clicked"
+)
+
+// EventTypes lists every type of event webhooks can subscribe to
+var EventTypes = []string{EventLinkCreated, EventLinkUpdated, EventLinkDeleted, EventLinkExpired, EventLinkClicked}
+
+// Event is something that happened to a short URL. Data is the URL for lifecycle events
+// and a ClickEvent for clicks.
+type Event struct {
+	ID         string      `json:"id"`
+	Type       string      `json:"type"`
+	OccurredAt time.Time   `json:"occurred_at"`
+	Data       interface{} `json:"data"`
+}
+
+// Webhook subscribes an HTTP endpoint to events
+type Webhook struct {
+	ID     string   `json:"id" bson:"_id,omitempty"`
+	URL    string   `json:"url" bson:"url"`
+	Events []string `json:"events" bson:"events"`
+	Owner  string   `json:"owner,omitempty" bson:"owner,omitempty"`
+
+	// Secret signs every delivery; it is only returned when the webhook is created or its secret replaced
+	Secret string `json:"secret,omitempty" bson:"secret"`
+
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// Statuses of a webhook delivery
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+// WebhookDelivery is an event queued for delivery to a webhook. Deliveries are retried with
+// exponential backoff until they succeed or run out of attempts, when they are dead-lettered.
+type WebhookDelivery struct {
+	ID        string `json:"id" bson:"_id,omitempty"`
+	WebhookID string `json:"webhook_id" bson:"webhook_id"`
+	EventID   string `json:"event_id" bson:"event_id"`
+	EventType string `json:"event_type" bson:"event_type"`
+
+	// Payload is the JSON body sent, the same on every attempt so receivers can deduplicate by event ID
+	Payload string `json:"payload" bson:"payload"`
+
+	Status        string     `json:"status" bson:"status"`
+	Attempts      int        `json:"attempts" bson:"attempts"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" bson:"next_attempt_at"`
+	LastAttemptAt *time.Time `json:"last_attempt_at,omitempty" bson:"last_attempt_at,omitempty"`
+
+	// LastStatusCode and LastError describe the outcome of the latest failed attempt
+	LastStatusCode int    `json:"last_status_code,omitempty" bson:"last_status_code,omitempty"`
+	LastError      string `json:"last_error,omitempty" bson:"last_error,omitempty"`
+
+	CreatedAt   time.Time  `json:"created_at" bson:"created_at"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty" bson:"delivered_at,omitempty"`
+
+	// LockedUntil is set while a dispatcher attempts the delivery, so other dispatchers leave it alone
+	LockedUntil *time.Time `json:"-" bson:"locked_until,omitempty"`
+}
+
+// DeliveryFilter selects the deliveries of a webhook, newest first
+type DeliveryFilter struct {
+	WebhookID string
+
+	// Status restricts the listing to deliveries in that state; empty matches every delivery
+	Status string
+
+	Limit  int
+	Offset int
+}
@@ -0,0 +1,14 @@
+package repositories
+
+import (
+	"context"
+	"urlshortener/internal/domain/models"
+)
+
+type CampaignRepository interface {
+	CreateCampaign(ctx context.Context, campaign *models.Campaign) error
+	GetCampaign(ctx context.Context, id string) (*models.Campaign, error)
+	ListCampaigns(ctx context.Context, owner string) ([]*models.Campaign, error)
+	UpdateCampaign(ctx context.Context, campaign *models.Campaign) error
+	DeleteCampaign(ctx context.Context, id string) error
+}
@@ -0,0 +1,17 @@
+package repositories
+
+import (
+	"context"
+	"time"
+	"urlshortener/internal/domain/models"
+)
+
+type ClickRepository interface {
+	RecordClick(ctx context.Context, click *models.Click) error
+	SummarizeClicks(ctx context.Context, query models.ClickQuery) (*models.ClickSummary, error)
+	FirstClickAt(ctx context.Context) (*time.Time, error)
+	ListClicks(ctx context.Context, from, to time.Time, fn func(click *models.Click) error) error
+	DeleteClicks(ctx context.Context, from, to time.Time) (int64, error)
+	SaveClickRollups(ctx context.Context, rollups []*models.ClickRollup) error
+	EraseClicks(ctx context.Context, links []models.LinkRef) (int64, error)
+}
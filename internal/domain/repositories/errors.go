@@ -0,0 +1,41 @@
+package repositories
+
+import "errors"
+
+var (
+	// ErrURLNotFound is returned when no URL exists for the requested short code
+	ErrURLNotFound = errors.New("url not found")
+
+	// ErrShortCodeTaken is returned when a URL with the same short code already exists on the domain
+	ErrShortCodeTaken = errors.New("short code already taken")
+
+	// ErrVersionConflict is returned when a URL was modified since the version the caller read
+	ErrVersionConflict = errors.New("url version conflict")
+
+	// ErrURLConsumed is returned when a single-use URL has already been followed
+	ErrURLConsumed = errors.New("url already consumed")
+
+	// ErrRevisionNotFound is returned when no revision of the short code exists with the requested ID
+	ErrRevisionNotFound = errors.New("revision not found")
+
+	// ErrCampaignNotFound is returned when no campaign exists with the requested ID
+	ErrCampaignNotFound = errors.New("campaign not found")
+
+	// ErrSketchConflict is returned when a visitor sketch kept changing while a merge into it was attempted
+	ErrSketchConflict = errors.New("visitor sketch changed concurrently")
+
+	// ErrIdempotencyKeyExists is returned when a record already exists for a caller's idempotency key
+	ErrIdempotencyKeyExists = errors.New("idempotency key already exists")
+
+	// ErrIdempotencyRecordNotFound is returned when no record exists for a caller's idempotency key
+	ErrIdempotencyRecordNotFound = errors.New("idempotency record not found")
+
+	// ErrWebhookNotFound is returned when no webhook exists with the requested ID
+	ErrWebhookNotFound = errors.New("webhook not found")
+
+	// ErrDeliveryNotFound is returned when no delivery of the webhook exists with the requested ID
+	ErrDeliveryNotFound = errors.New("webhook delivery not found")
+
+	// ErrOutboxEventNotFound is returned when no event exists in the outbox with the requested ID
+	ErrOutboxEventNotFound = errors.New("outbox event not found")
+)
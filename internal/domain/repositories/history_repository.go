@@ -0,0 +1,12 @@
+package repositories
+
+import (
+	"context"
+	"urlshortener/internal/domain/models"
+)
+
+type HistoryRepository interface {
+	CreateRevision(ctx context.Context, revision *models.Revision) error
+	ListRevisions(ctx context.Context, shortCode string) ([]*models.Revision, error)
+	GetRevision(ctx context.Context, shortCode, revisionID string) (*models.Revision, error)
+}
@@ -0,0 +1,13 @@
+package repositories
+
+import (
+	"context"
+	"urlshortener/internal/domain/models"
+)
+
+type IdempotencyRepository interface {
+	CreateRecord(ctx context.Context, record *models.IdempotencyRecord) error
+	GetRecord(ctx context.Context, caller, key string) (*models.IdempotencyRecord, error)
+	CompleteRecord(ctx context.Context, record *models.IdempotencyRecord) error
+	DeleteRecord(ctx context.Context, caller, key string) error
+}
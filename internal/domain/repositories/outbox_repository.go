@@ -0,0 +1,14 @@
+package repositories
+
+import (
+	"context"
+	"time"
+	"urlshortener/internal/domain/models"
+)
+
+type OutboxRepository interface {
+	AppendEvent(ctx context.Context, event *models.OutboxEvent) error
+	ClaimEvent(ctx context.Context, now time.Time, lease time.Duration) (*models.OutboxEvent, error)
+	MarkEventPublished(ctx context.Context, id string, at time.Time) error
+	ReleaseEvent(ctx context.Context, id string, lastError string) error
+}
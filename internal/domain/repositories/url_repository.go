@@ -2,13 +2,25 @@ package repositories
 
 import (
 	"context"
+	"time"
 	"urlshortener/internal/domain/models"
 )
 
 type URLRepository interface {
 	CreateURL(ctx context.Context, url *models.URL) error
 	GetURLByShortCode(ctx context.Context, shortCode string) (*models.URL, error)
+	ListURLs(ctx context.Context, filter models.URLFilter) ([]*models.URL, error)
 	UpdateURL(ctx context.Context, url *models.URL) error
-	DeleteURL(ctx context.Context, shortCode string) error
-	IncrementURLAccessCount(ctx context.Context, shortCode string) error
+	PatchURL(ctx context.Context, url *models.URL, patch models.URLPatch) error
+	DeleteURL(ctx context.Context, shortCode string, version int64) error
+	IncrementURLAccessCount(ctx context.Context, shortCode, variantID string) error
+	IncrementURLBotCount(ctx context.Context, shortCode string) error
+	ConsumeURL(ctx context.Context, shortCode string, consumption *models.Consumption) (*models.URL, error)
+	UpdateURLMetadata(ctx context.Context, shortCode, originalURL string, metadata *models.Metadata) error
+	ListURLsDueForCheck(ctx context.Context, checkedBefore time.Time, limit int) ([]*models.URL, error)
+	UpdateURLHealth(ctx context.Context, shortCode, originalURL string, health *models.Health) error
+	DeferURLCheck(ctx context.Context, shortCode string, until time.Time) error
+	ClearCampaign(ctx context.Context, campaignID string) error
+	EraseConsumptions(ctx context.Context, owner string) (int64, error)
+	ListURLsEndedBetween(ctx context.Context, from, to time.Time) ([]*models.URL, error)
 }
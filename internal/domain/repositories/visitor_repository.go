@@ -0,0 +1,12 @@
+package repositories
+
+import (
+	"context"
+	"urlshortener/internal/domain/models"
+)
+
+type VisitorSketchRepository interface {
+	MergeVisitorSketch(ctx context.Context, sketch *models.VisitorSketch) error
+	ListVisitorSketches(ctx context.Context, link models.LinkRef, periods []string) ([]*models.VisitorSketch, error)
+	DeleteVisitorSketches(ctx context.Context, links []models.LinkRef) (int64, error)
+}
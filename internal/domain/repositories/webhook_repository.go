@@ -0,0 +1,27 @@
+package repositories
+
+import (
+	"context"
+	"time"
+	"urlshortener/internal/domain/models"
+)
+
+type WebhookRepository interface {
+	CreateWebhook(ctx context.Context, webhook *models.Webhook) error
+	GetWebhook(ctx context.Context, id string) (*models.Webhook, error)
+	ListWebhooks(ctx context.Context, owner string) ([]*models.Webhook, error)
+	ListWebhooksForEvent(ctx context.Context, eventType string) ([]*models.Webhook, error)
+	UpdateWebhook(ctx context.Context, webhook *models.Webhook) error
+	DeleteWebhook(ctx context.Context, id string) error
+}
+
+type WebhookDeliveryRepository interface {
+	EnqueueDeliveries(ctx context.Context, deliveries []*models.WebhookDelivery) error
+	ClaimDelivery(ctx context.Context, now time.Time, lease time.Duration) (*models.WebhookDelivery, error)
+	UpdateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error
+	GetDelivery(ctx context.Context, webhookID, id string) (*models.WebhookDelivery, error)
+	ListDeliveries(ctx context.Context, filter models.DeliveryFilter) ([]*models.WebhookDelivery, error)
+	ReplayDelivery(ctx context.Context, webhookID, id string, now time.Time) error
+	ReplayDeadDeliveries(ctx context.Context, webhookID string, now time.Time) (int64, error)
+	DeleteDeliveries(ctx context.Context, webhookID string) error
+}
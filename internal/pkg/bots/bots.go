@@ -0,0 +1,112 @@
+package bots
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Reasons a request is classified as coming from a bot
+const (
+	ReasonUserAgent      = "user_agent"
+	ReasonEmptyUserAgent = "empty_user_agent"
+	ReasonHeadRequest    = "head_request"
+	ReasonPrefetch       = "prefetch"
+)
+
+// defaultRules is the ruleset used when no rules file is configured
+//
+//go:embed rules.txt
+var defaultRules string
+
+// prefetchHeaders are sent by browsers and link previewers fetching a page before, or instead of, a visit
+var prefetchHeaders = []string{"Purpose", "Sec-Purpose", "X-Purpose", "X-Moz"}
+
+// Classifier tells bots and crawlers from people following short URLs,
+// from a ruleset of user-agent patterns and the shape of the request
+type Classifier struct {
+	userAgents *regexp.Regexp
+}
+
+// NewClassifier creates a Classifier using the default ruleset
+func NewClassifier() *Classifier {
+	c, err := ParseRules(strings.NewReader(defaultRules))
+	if err != nil {
+		panic(fmt.Sprintf("bots: invalid default rules: %v", err))
+	}
+	return c
+}
+
+// LoadClassifier creates a Classifier using the ruleset in the file at path
+func LoadClassifier(path string) (*Classifier, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseRules(f)
+}
+
+// ParseRules creates a Classifier from a ruleset holding one case-insensitive regular expression per line,
+// matched against user agents. Blank lines and lines starting with # are ignored.
+func ParseRules(r io.Reader) (*Classifier, error) {
+	var patterns []string
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		pattern := strings.TrimSpace(scanner.Text())
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+		if _, err := regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		patterns = append(patterns, "(?:"+pattern+")")
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(patterns) == 0 {
+		return nil, errors.New("no rules")
+	}
+
+	// A single alternation matches every rule in one pass over the user agent
+	userAgents, err := regexp.Compile("(?i)" + strings.Join(patterns, "|"))
+	if err != nil {
+		return nil, err
+	}
+	return &Classifier{userAgents: userAgents}, nil
+}
+
+// Classify returns why r looks like it was sent by a bot, or an empty string if it looks like a person.
+// HEAD requests and prefetches are counted as bots, since nobody is sent to the destination.
+func (c *Classifier) Classify(r *http.Request) string {
+	userAgent := strings.TrimSpace(r.UserAgent())
+	switch {
+	case userAgent == "":
+		return ReasonEmptyUserAgent
+	case c.userAgents.MatchString(userAgent):
+		return ReasonUserAgent
+	case r.Method == http.MethodHead:
+		return ReasonHeadRequest
+	case isPrefetch(r):
+		return ReasonPrefetch
+	}
+	return ""
+}
+
+// isPrefetch reports whether r announces itself as a prefetch, prerender or preview
+func isPrefetch(r *http.Request) bool {
+	for _, header := range prefetchHeaders {
+		value := strings.ToLower(r.Header.Get(header))
+		if strings.Contains(value, "prefetch") || strings.Contains(value, "prerender") || strings.Contains(value, "preview") {
+			return true
+		}
+	}
+	return false
+}
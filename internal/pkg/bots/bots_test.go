@@ -0,0 +1,123 @@
+package bots
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifier_Classify(t *testing.T) {
+	classifier := NewClassifier()
+
+	tests := []struct {
+		name      string
+		method    string
+		userAgent string
+		headers   map[string]string
+		expected  string
+	}{
+		{
+			name:      "Desktop browser",
+			userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+		},
+		{
+			name:      "Phone named like a bot",
+			userAgent: "Mozilla/5.0 (Linux; Android 9; CUBOT X19) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36",
+		},
+		{
+			name:      "Slack unfurler",
+			userAgent: "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)",
+			expected:  ReasonUserAgent,
+		},
+		{
+			name:      "Twitter card fetcher",
+			userAgent: "Twitterbot/1.0",
+			expected:  ReasonUserAgent,
+		},
+		{
+			name:      "Facebook crawler",
+			userAgent: "facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)",
+			expected:  ReasonUserAgent,
+		},
+		{
+			name:      "Search engine",
+			userAgent: "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			expected:  ReasonUserAgent,
+		},
+		{
+			name:      "Command line tool",
+			userAgent: "curl/8.4.0",
+			expected:  ReasonUserAgent,
+		},
+		{
+			name:     "No user agent",
+			expected: ReasonEmptyUserAgent,
+		},
+		{
+			name:      "HEAD request",
+			method:    http.MethodHead,
+			userAgent: "Mozilla/5.0 (Macintosh; Intel Mac OS X 14_0) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Safari/605.1.15",
+			expected:  ReasonHeadRequest,
+		},
+		{
+			name:      "Browser prefetch",
+			userAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+			headers:   map[string]string{"Sec-Purpose": "prefetch;prerender"},
+			expected:  ReasonPrefetch,
+		},
+		{
+			name:      "Link preview",
+			userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko)",
+			headers:   map[string]string{"X-Purpose": "preview"},
+			expected:  ReasonPrefetch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			r := httptest.NewRequest(method, "/abc123", nil)
+			r.Header.Set("User-Agent", tt.userAgent)
+			for key, value := range tt.headers {
+				r.Header.Set(key, value)
+			}
+
+			assert.Equal(t, tt.expected, classifier.Classify(r))
+		})
+	}
+}
+
+func TestLoadClassifier(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.txt")
+	assert.NoError(t, os.WriteFile(path, []byte("# Internal tools\n\n^acme-monitor/\n"), 0o600))
+
+	classifier, err := LoadClassifier(path)
+	assert.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodGet, "/abc123", nil)
+	r.Header.Set("User-Agent", "ACME-Monitor/2.0")
+	assert.Equal(t, ReasonUserAgent, classifier.Classify(r))
+
+	// Only the loaded rules apply
+	r.Header.Set("User-Agent", "curl/8.4.0")
+	assert.Equal(t, "", classifier.Classify(r))
+
+	_, err = LoadClassifier(filepath.Join(t.TempDir(), "missing.txt"))
+	assert.Error(t, err)
+}
+
+func TestParseRulesInvalid(t *testing.T) {
+	_, err := ParseRules(strings.NewReader("slackbot\n(unclosed\n"))
+	assert.ErrorContains(t, err, "line 2")
+
+	_, err = ParseRules(strings.NewReader("# only comments\n"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,120 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"urlshortener/internal/domain/models"
+	"urlshortener/internal/domain/repositories"
+)
+
+// MongoCampaignRepository implements the CampaignRepository interface using MongoDB as the storage.
+type MongoCampaignRepository struct {
+	db         *MongoDB
+	collection *mongo.Collection
+}
+
+// NewMongoCampaignRepository creates a new instance of MongoCampaignRepository
+func NewMongoCampaignRepository(db *MongoDB) repositories.CampaignRepository {
+	return &MongoCampaignRepository{
+		db:         db,
+		collection: db.Collection("campaigns"),
+	}
+}
+
+// CreateCampaign inserts a new campaign document and sets its generated ID.
+func (r *MongoCampaignRepository) CreateCampaign(ctx context.Context, campaign *models.Campaign) error {
+	result, err := r.collection.InsertOne(ctx, campaign)
+	if err != nil {
+		return err
+	}
+	if id, ok := result.InsertedID.(primitive.ObjectID); ok {
+		campaign.ID = id.Hex()
+	}
+	return nil
+}
+
+// GetCampaign retrieves a campaign document by its ID.
+func (r *MongoCampaignRepository) GetCampaign(ctx context.Context, id string) (*models.Campaign, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, repositories.ErrCampaignNotFound
+	}
+
+	var campaign models.Campaign
+	err = r.collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&campaign)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, repositories.ErrCampaignNotFound
+		}
+		return nil, err
+	}
+	return &campaign, nil
+}
+
+// ListCampaigns retrieves the campaigns of an owner, or all campaigns if owner is empty, newest first.
+func (r *MongoCampaignRepository) ListCampaigns(ctx context.Context, owner string) ([]*models.Campaign, error) {
+	query := bson.M{}
+	if owner != "" {
+		query["owner"] = owner
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}})
+	cursor, err := r.collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	campaigns := make([]*models.Campaign, 0)
+	if err := cursor.All(ctx, &campaigns); err != nil {
+		return nil, err
+	}
+	return campaigns, nil
+}
+
+// UpdateCampaign replaces the mutable fields of an existing campaign document.
+func (r *MongoCampaignRepository) UpdateCampaign(ctx context.Context, campaign *models.Campaign) error {
+	objectID, err := primitive.ObjectIDFromHex(campaign.ID)
+	if err != nil {
+		return repositories.ErrCampaignNotFound
+	}
+
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": objectID}, bson.M{
+		"$set": bson.M{
+			"name":       campaign.Name,
+			"owner":      campaign.Owner,
+			"starts_at":  campaign.StartsAt,
+			"ends_at":    campaign.EndsAt,
+			"utm":        campaign.UTM,
+			"updated_at": campaign.UpdatedAt,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return repositories.ErrCampaignNotFound
+	}
+	return nil
+}
+
+// DeleteCampaign removes a campaign document by its ID.
+func (r *MongoCampaignRepository) DeleteCampaign(ctx context.Context, id string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return repositories.ErrCampaignNotFound
+	}
+
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": objectID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return repositories.ErrCampaignNotFound
+	}
+	return nil
+}
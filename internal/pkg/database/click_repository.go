@@ -0,0 +1,355 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"sort"
+	"time"
+	"urlshortener/internal/domain/models"
+	"urlshortener/internal/domain/repositories"
+)
+
+// maxReferrers bounds the referring hosts reported by a click summary
+const maxReferrers = 20
+
+// MongoClickRepository implements the ClickRepository interface using MongoDB as the storage.
+// Clicks are append-only until retention rolls them up into daily rollups.
+type MongoClickRepository struct {
+	db         *MongoDB
+	collection *mongo.Collection
+	rollups    *mongo.Collection
+}
+
+// NewMongoClickRepository creates a new instance of MongoClickRepository
+// and ensures the indexes serving per-link summaries and retention exist.
+func NewMongoClickRepository(db *MongoDB) (repositories.ClickRepository, error) {
+	repo := &MongoClickRepository{
+		db:         db,
+		collection: db.Collection("clicks"),
+		rollups:    db.Collection("click_rollups"),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := repo.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "domain", Value: 1}, {Key: "short_code", Value: 1}, {Key: "clicked_at", Value: 1}}},
+		{Keys: bson.D{{Key: "clicked_at", Value: 1}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = repo.rollups.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "domain", Value: 1}, {Key: "short_code", Value: 1}, {Key: "day", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+// RecordClick appends a click to the click log.
+func (r *MongoClickRepository) RecordClick(ctx context.Context, click *models.Click) error {
+	_, err := r.collection.InsertOne(ctx, click)
+	return err
+}
+
+// SummarizeClicks counts the clicks and unique visitors of the queried links in a single aggregation,
+// broken down by link and by referrer, and adds the rollups of the days past retention.
+// Clicks by bots are counted apart and left out of the breakdowns.
+func (r *MongoClickRepository) SummarizeClicks(ctx context.Context, query models.ClickQuery) (*models.ClickSummary, error) {
+	summary := &models.ClickSummary{Links: []models.LinkClicks{}, Referrers: []models.ReferrerCount{}}
+	if len(query.Links) == 0 {
+		return summary, nil
+	}
+
+	rollups, err := r.findRollups(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	links := linksFilter(query.Links)
+	match := bson.M{"$or": links}
+	clickedAt := bson.M{}
+	if query.From != nil {
+		clickedAt["$gte"] = *query.From
+	}
+	if query.To != nil {
+		clickedAt["$lt"] = *query.To
+	}
+	if len(clickedAt) > 0 {
+		match["clicked_at"] = clickedAt
+	}
+
+	// Uniques are counted by grouping on the visitor first rather than collecting visitors in a set,
+	// which keeps memory bounded for popular links.
+	// Referrers are only cut down here when no rollup will be added to them.
+	people := bson.M{"$match": bson.M{"bot": bson.M{"$ne": true}}}
+	referrers := bson.A{
+		people,
+		bson.M{"$group": bson.M{"_id": bson.M{"$ifNull": bson.A{"$referrer", ""}}, "clicks": bson.M{"$sum": 1}}},
+		bson.M{"$sort": bson.D{{Key: "clicks", Value: -1}, {Key: "_id", Value: 1}}},
+	}
+	if len(rollups) == 0 {
+		referrers = append(referrers, bson.M{"$limit": maxReferrers})
+	}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$facet", Value: bson.M{
+			"bots": bson.A{
+				bson.M{"$match": bson.M{"bot": true}},
+				bson.M{"$count": "clicks"},
+			},
+			"total": bson.A{
+				people,
+				bson.M{"$group": bson.M{"_id": "$visitor_hash", "clicks": bson.M{"$sum": 1}}},
+				bson.M{"$group": bson.M{"_id": nil, "clicks": bson.M{"$sum": "$clicks"}, "uniques": bson.M{"$sum": 1}}},
+			},
+			"links": bson.A{
+				people,
+				bson.M{"$group": bson.M{
+					"_id":    bson.M{"domain": "$domain", "short_code": "$short_code", "visitor": "$visitor_hash"},
+					"clicks": bson.M{"$sum": 1},
+				}},
+				bson.M{"$group": bson.M{
+					"_id":     bson.M{"domain": "$_id.domain", "short_code": "$_id.short_code"},
+					"clicks":  bson.M{"$sum": "$clicks"},
+					"uniques": bson.M{"$sum": 1},
+				}},
+				bson.M{"$project": bson.M{"_id": 0, "domain": "$_id.domain", "short_code": "$_id.short_code", "clicks": 1, "uniques": 1}},
+				bson.M{"$sort": bson.D{{Key: "clicks", Value: -1}, {Key: "domain", Value: 1}, {Key: "short_code", Value: 1}}},
+			},
+			"referrers": referrers,
+		}}},
+	}
+
+	cursor, err := r.collection.Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		Bots []struct {
+			Clicks int64 `bson:"clicks"`
+		} `bson:"bots"`
+		Total []struct {
+			Clicks  int64 `bson:"clicks"`
+			Uniques int64 `bson:"uniques"`
+		} `bson:"total"`
+		Links     []models.LinkClicks    `bson:"links"`
+		Referrers []models.ReferrerCount `bson:"referrers"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		addRollups(summary, rollups)
+		return summary, nil
+	}
+
+	result := results[0]
+	if len(result.Total) > 0 {
+		summary.Clicks = result.Total[0].Clicks
+		summary.Uniques = result.Total[0].Uniques
+	}
+	if len(result.Bots) > 0 {
+		summary.BotClicks = result.Bots[0].Clicks
+	}
+	if result.Links != nil {
+		summary.Links = result.Links
+	}
+	if result.Referrers != nil {
+		summary.Referrers = result.Referrers
+	}
+	addRollups(summary, rollups)
+	return summary, nil
+}
+
+// findRollups retrieves the rollups of the queried links for the days overlapping the queried period
+func (r *MongoClickRepository) findRollups(ctx context.Context, query models.ClickQuery) ([]*models.ClickRollup, error) {
+	filter := bson.M{"$or": linksFilter(query.Links)}
+	day := bson.M{}
+	if query.From != nil {
+		day["$gte"] = query.From.UTC().Format(models.DayLayout)
+	}
+	if query.To != nil {
+		day["$lte"] = query.To.Add(-time.Nanosecond).UTC().Format(models.DayLayout)
+	}
+	if len(day) > 0 {
+		filter["day"] = day
+	}
+
+	cursor, err := r.rollups.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	rollups := make([]*models.ClickRollup, 0)
+	if err := cursor.All(ctx, &rollups); err != nil {
+		return nil, err
+	}
+	return rollups, nil
+}
+
+// addRollups adds daily rollups to a summary of raw clicks. Visitors of different days cannot be matched,
+// so the uniques of each rolled up day are added up.
+func addRollups(summary *models.ClickSummary, rollups []*models.ClickRollup) {
+	if len(rollups) == 0 {
+		return
+	}
+
+	links := make(map[models.LinkRef]*models.LinkClicks, len(summary.Links))
+	for i := range summary.Links {
+		links[summary.Links[i].LinkRef] = &summary.Links[i]
+	}
+	referrers := make(map[string]int64, len(summary.Referrers))
+	for _, referrer := range summary.Referrers {
+		referrers[referrer.Referrer] += referrer.Clicks
+	}
+
+	for _, rollup := range rollups {
+		summary.Clicks += rollup.Clicks
+		summary.Uniques += rollup.Uniques
+		summary.BotClicks += rollup.BotClicks
+		for _, referrer := range rollup.Referrers {
+			referrers[referrer.Referrer] += referrer.Clicks
+		}
+
+		if rollup.Clicks == 0 {
+			continue
+		}
+		link, ok := links[rollup.LinkRef]
+		if !ok {
+			summary.Links = append(summary.Links, models.LinkClicks{LinkRef: rollup.LinkRef})
+			link = &summary.Links[len(summary.Links)-1]
+			// Appending may have moved the links, so index them again
+			for i := range summary.Links {
+				links[summary.Links[i].LinkRef] = &summary.Links[i]
+			}
+		}
+		link.Clicks += rollup.Clicks
+		link.Uniques += rollup.Uniques
+	}
+
+	sort.Slice(summary.Links, func(i, j int) bool {
+		a, b := summary.Links[i], summary.Links[j]
+		if a.Clicks != b.Clicks {
+			return a.Clicks > b.Clicks
+		}
+		if a.Domain != b.Domain {
+			return a.Domain < b.Domain
+		}
+		return a.ShortCode < b.ShortCode
+	})
+
+	summary.Referrers = make([]models.ReferrerCount, 0, len(referrers))
+	for referrer, clicks := range referrers {
+		summary.Referrers = append(summary.Referrers, models.ReferrerCount{Referrer: referrer, Clicks: clicks})
+	}
+	sort.Slice(summary.Referrers, func(i, j int) bool {
+		a, b := summary.Referrers[i], summary.Referrers[j]
+		if a.Clicks != b.Clicks {
+			return a.Clicks > b.Clicks
+		}
+		return a.Referrer < b.Referrer
+	})
+	if len(summary.Referrers) > maxReferrers {
+		summary.Referrers = summary.Referrers[:maxReferrers]
+	}
+}
+
+// FirstClickAt returns the time of the oldest raw click, or nil if there is none.
+func (r *MongoClickRepository) FirstClickAt(ctx context.Context) (*time.Time, error) {
+	var click models.Click
+	opts := options.FindOne().SetSort(bson.D{{Key: "clicked_at", Value: 1}})
+	err := r.collection.FindOne(ctx, bson.M{}, opts).Decode(&click)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &click.ClickedAt, nil
+}
+
+// ListClicks calls fn with every raw click made from from until to, stopping at the first error returned by fn.
+func (r *MongoClickRepository) ListClicks(ctx context.Context, from, to time.Time, fn func(click *models.Click) error) error {
+	cursor, err := r.collection.Find(ctx, bson.M{"clicked_at": bson.M{"$gte": from, "$lt": to}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var click models.Click
+		if err := cursor.Decode(&click); err != nil {
+			return err
+		}
+		if err := fn(&click); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// DeleteClicks deletes the raw clicks made from from until to and returns how many were deleted.
+func (r *MongoClickRepository) DeleteClicks(ctx context.Context, from, to time.Time) (int64, error) {
+	result, err := r.collection.DeleteMany(ctx, bson.M{"clicked_at": bson.M{"$gte": from, "$lt": to}})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+// SaveClickRollups stores daily rollups, replacing any previous rollup of the same link and day,
+// so rolling up a day again after an interruption gives the same result.
+func (r *MongoClickRepository) SaveClickRollups(ctx context.Context, rollups []*models.ClickRollup) error {
+	if len(rollups) == 0 {
+		return nil
+	}
+
+	writes := make([]mongo.WriteModel, len(rollups))
+	for i, rollup := range rollups {
+		writes[i] = mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"domain": rollup.Domain, "short_code": rollup.ShortCode, "day": rollup.Day}).
+			SetReplacement(rollup).
+			SetUpsert(true)
+	}
+	_, err := r.rollups.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+// EraseClicks deletes the raw clicks and rollups of links and returns how many documents were deleted.
+func (r *MongoClickRepository) EraseClicks(ctx context.Context, links []models.LinkRef) (int64, error) {
+	if len(links) == 0 {
+		return 0, nil
+	}
+
+	filter := bson.M{"$or": linksFilter(links)}
+	clicks, err := r.collection.DeleteMany(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	rollups, err := r.rollups.DeleteMany(ctx, filter)
+	if err != nil {
+		return clicks.DeletedCount, err
+	}
+	return clicks.DeletedCount + rollups.DeletedCount, nil
+}
+
+// linksFilter builds the $or clauses matching the documents of links
+func linksFilter(links []models.LinkRef) bson.A {
+	clauses := make(bson.A, len(links))
+	for i, link := range links {
+		clauses[i] = bson.M{"domain": link.Domain, "short_code": link.ShortCode}
+	}
+	return clauses
+}
@@ -0,0 +1,95 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+	"urlshortener/internal/domain/models"
+	"urlshortener/internal/domain/repositories"
+)
+
+// MongoHistoryRepository implements the HistoryRepository interface using MongoDB as the storage.
+// Revisions are append-only: the repository never updates or deletes them.
+type MongoHistoryRepository struct {
+	db         *MongoDB
+	collection *mongo.Collection
+}
+
+// NewMongoHistoryRepository creates a new instance of MongoHistoryRepository
+// and ensures the index serving the history of a short code exists.
+// Revisions recorded without a domain are assigned to defaultDomain.
+func NewMongoHistoryRepository(db *MongoDB, defaultDomain string) (repositories.HistoryRepository, error) {
+	repo := &MongoHistoryRepository{
+		db:         db,
+		collection: db.Collection("url_history"),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := backfillDomain(ctx, repo.collection, defaultDomain); err != nil {
+		return nil, err
+	}
+
+	_, err := repo.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "domain", Value: 1}, {Key: "short_code", Value: 1}, {Key: "created_at", Value: 1}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+// CreateRevision appends a new revision document to the history collection.
+func (r *MongoHistoryRepository) CreateRevision(ctx context.Context, revision *models.Revision) error {
+	result, err := r.collection.InsertOne(ctx, revision)
+	if err != nil {
+		return err
+	}
+	if id, ok := result.InsertedID.(primitive.ObjectID); ok {
+		revision.ID = id.Hex()
+	}
+	return nil
+}
+
+// ListRevisions retrieves all revisions of a short code on the domain of ctx, oldest first.
+func (r *MongoHistoryRepository) ListRevisions(ctx context.Context, shortCode string) ([]*models.Revision, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := r.collection.Find(ctx, codeFilter(ctx, shortCode), opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	revisions := make([]*models.Revision, 0)
+	if err := cursor.All(ctx, &revisions); err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+// GetRevision retrieves a single revision of a short code on the domain of ctx by its ID.
+func (r *MongoHistoryRepository) GetRevision(ctx context.Context, shortCode, revisionID string) (*models.Revision, error) {
+	id, err := primitive.ObjectIDFromHex(revisionID)
+	if err != nil {
+		return nil, repositories.ErrRevisionNotFound
+	}
+
+	filter := codeFilter(ctx, shortCode)
+	filter["_id"] = id
+
+	var revision models.Revision
+	err = r.collection.FindOne(ctx, filter).Decode(&revision)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, repositories.ErrRevisionNotFound
+		}
+		return nil, err
+	}
+	return &revision, nil
+}
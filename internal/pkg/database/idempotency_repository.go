@@ -0,0 +1,109 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strconv"
+	"time"
+	"urlshortener/internal/domain/models"
+	"urlshortener/internal/domain/repositories"
+)
+
+// MongoIdempotencyRepository implements the IdempotencyRepository interface using MongoDB as the storage.
+// Records are removed by a TTL index once their expiry time has passed.
+type MongoIdempotencyRepository struct {
+	db         *MongoDB
+	collection *mongo.Collection
+}
+
+// NewMongoIdempotencyRepository creates a new instance of MongoIdempotencyRepository
+// and ensures the TTL index on the expiry time exists.
+func NewMongoIdempotencyRepository(db *MongoDB) (repositories.IdempotencyRepository, error) {
+	repo := &MongoIdempotencyRepository{
+		db:         db,
+		collection: db.Collection("idempotency_keys"),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := repo.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+// CreateRecord inserts a pending record, failing if the caller already used the key.
+// An expired record that the TTL monitor has not removed yet is replaced.
+func (r *MongoIdempotencyRepository) CreateRecord(ctx context.Context, record *models.IdempotencyRecord) error {
+	record.ID = idempotencyID(record.Caller, record.Key)
+	_, err := r.collection.InsertOne(ctx, record)
+	if !mongo.IsDuplicateKeyError(err) {
+		return err
+	}
+
+	result, err := r.collection.ReplaceOne(ctx, bson.M{"_id": record.ID, "expires_at": bson.M{"$lte": time.Now()}}, record)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return repositories.ErrIdempotencyKeyExists
+	}
+	return nil
+}
+
+// GetRecord retrieves the unexpired record stored for a caller's key.
+func (r *MongoIdempotencyRepository) GetRecord(ctx context.Context, caller, key string) (*models.IdempotencyRecord, error) {
+	var record models.IdempotencyRecord
+	filter := bson.M{
+		"_id":        idempotencyID(caller, key),
+		"expires_at": bson.M{"$gt": time.Now()},
+	}
+	if err := r.collection.FindOne(ctx, filter).Decode(&record); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, repositories.ErrIdempotencyRecordNotFound
+		}
+		return nil, err
+	}
+	return &record, nil
+}
+
+// CompleteRecord stores the response of the request that reserved the key.
+func (r *MongoIdempotencyRepository) CompleteRecord(ctx context.Context, record *models.IdempotencyRecord) error {
+	_, err := r.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": idempotencyID(record.Caller, record.Key)},
+		bson.M{
+			"$set": bson.M{
+				"completed":   true,
+				"status_code": record.StatusCode,
+				"header":      record.Header,
+				"body":        record.Body,
+			},
+		},
+	)
+	return err
+}
+
+// DeleteRecord removes the record stored for a caller's key so the request can be retried.
+func (r *MongoIdempotencyRepository) DeleteRecord(ctx context.Context, caller, key string) error {
+	_, err := r.collection.DeleteOne(ctx, bson.M{"_id": idempotencyID(caller, key)})
+	return err
+}
+
+// idempotencyID scopes an idempotency key to the caller that sent it.
+// Both are chosen by clients, so the caller is length-prefixed to keep distinct pairs from joining alike.
+func idempotencyID(caller, key string) string {
+	sum := sha256.Sum256([]byte(strconv.Itoa(len(caller)) + ":" + caller + ":" + key))
+	return hex.EncodeToString(sum[:])
+}
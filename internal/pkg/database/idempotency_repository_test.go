@@ -0,0 +1,15 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestIdempotencyID tests that distinct caller and key pairs never share a record
+func TestIdempotencyID(t *testing.T) {
+	assert.Equal(t, idempotencyID("a", "b"), idempotencyID("a", "b"))
+	assert.NotEqual(t, idempotencyID("a:b", "c"), idempotencyID("a", "b:c"))
+	assert.NotEqual(t, idempotencyID("", "a:b"), idempotencyID("a", "b"))
+	assert.Len(t, idempotencyID("a", "b"), 64)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -20,8 +21,8 @@ func NewMongoDB(uri, dbName string) (*MongoDB, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	// Connect to the MongoDB server
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	// Connect to the MongoDB server, timing every command for the metrics
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri).SetMonitor(newCommandMonitor()))
 	if err != nil {
 		return nil, err
 	}
@@ -46,3 +47,32 @@ func (m *MongoDB) Collection(name string) *mongo.Collection {
 func (m *MongoDB) Disconnect(ctx context.Context) error {
 	return m.client.Disconnect(ctx)
 }
+
+// SupportsTransactions reports whether the server runs as a replica set or behind mongos, which
+// multi-document transactions require. A standalone server answers false.
+func (m *MongoDB) SupportsTransactions(ctx context.Context) (bool, error) {
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	if err := m.db.RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return false, err
+	}
+	return hello.SetName != "" || hello.Msg == "isdbgrid", nil
+}
+
+// WithTransaction runs fn in a transaction, committing its writes together or not at all.
+// The repositories take part in the transaction when given the context passed to fn.
+// fn may run again when the transaction fails for a transient reason, such as a write conflict.
+func (m *MongoDB) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	session, err := m.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
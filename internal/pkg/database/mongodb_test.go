@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
@@ -62,3 +63,53 @@ func TestMongoURLRepository_CreateAndGet(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, url.OriginalURL, retrieved.OriginalURL)
 }
+
+// TestMongoURLRepository_PatchLabelAfterUpdateWithoutLabels tests that a single label can be patched onto a URL
+// whose labels were removed by a full update
+func TestMongoURLRepository_PatchLabelAfterUpdateWithoutLabels(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	url := &models.URL{
+		OriginalURL: "https://example.com",
+		ShortCode:   "labels1",
+		Tags:        []string{"docs"},
+		Labels:      map[string]string{"team": "docs"},
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+	assert.NoError(t, repo.CreateURL(ctx, url))
+
+	url.Tags = nil
+	url.Labels = nil
+	assert.NoError(t, repo.UpdateURL(ctx, url))
+
+	assert.NoError(t, repo.PatchURL(ctx, url, models.URLPatch{"labels.env": "prod"}))
+
+	retrieved, err := repo.GetURLByShortCode(ctx, url.ShortCode)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"env": "prod"}, retrieved.Labels)
+	assert.Empty(t, retrieved.Tags)
+}
+
+// TestRemoveNullObjects tests that labels stored as null are removed so single labels can be patched
+func TestRemoveNullObjects(t *testing.T) {
+	repo, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	_, err := repo.collection.InsertOne(ctx, bson.M{"short_code": "nulls1", "domain": "", "original_url": "https://example.com", "labels": nil})
+	assert.NoError(t, err)
+	assert.NoError(t, removeNullObjects(ctx, repo.collection, "labels"))
+
+	url, err := repo.GetURLByShortCode(ctx, "nulls1")
+	assert.NoError(t, err)
+	assert.NoError(t, repo.PatchURL(ctx, url, models.URLPatch{"labels.env": "prod"}))
+
+	retrieved, err := repo.GetURLByShortCode(ctx, "nulls1")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"env": "prod"}, retrieved.Labels)
+}
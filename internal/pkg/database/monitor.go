@@ -0,0 +1,103 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"sync"
+	"urlshortener/internal/pkg/metrics"
+	"urlshortener/internal/pkg/tracing"
+)
+
+// tracer starts the spans of the repositories and of the commands they send
+var tracer = tracing.Tracer("urlshortener/internal/pkg/database")
+
+// commandMonitor times the commands the repositories send to MongoDB, by collection and command,
+// counts those that fail, and traces each in a span of the operation that sent it
+type commandMonitor struct {
+	mu       sync.Mutex
+	commands map[int64]startedCommand
+}
+
+// startedCommand is a command sent and not answered yet
+type startedCommand struct {
+	collection string
+	span       trace.Span
+}
+
+// newCommandMonitor creates a monitor to set on the client options
+func newCommandMonitor() *event.CommandMonitor {
+	m := &commandMonitor{commands: make(map[int64]startedCommand)}
+	return &event.CommandMonitor{
+		Started:   m.started,
+		Succeeded: m.succeeded,
+		Failed:    m.failed,
+	}
+}
+
+// started starts the span of a command and remembers its collection, which only the started event carries.
+// The statement is left out of the span, since it holds the destinations and visitors of URLs.
+func (m *commandMonitor) started(ctx context.Context, evt *event.CommandStartedEvent) {
+	collection := commandCollection(evt)
+	name := evt.CommandName
+	if collection != "" {
+		name += " " + collection
+	}
+	_, span := tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemMongoDB,
+			semconv.DBNamespace(evt.DatabaseName),
+			semconv.DBCollectionName(collection),
+			semconv.DBOperationName(evt.CommandName),
+		),
+	)
+
+	m.mu.Lock()
+	m.commands[evt.RequestID] = startedCommand{collection: collection, span: span}
+	m.mu.Unlock()
+}
+
+func (m *commandMonitor) succeeded(ctx context.Context, evt *event.CommandSucceededEvent) {
+	m.finished(evt.CommandFinishedEvent, nil)
+}
+
+func (m *commandMonitor) failed(ctx context.Context, evt *event.CommandFailedEvent) {
+	m.finished(evt.CommandFinishedEvent, errors.New(evt.Failure))
+}
+
+func (m *commandMonitor) finished(evt event.CommandFinishedEvent, err error) {
+	m.mu.Lock()
+	command, ok := m.commands[evt.RequestID]
+	delete(m.commands, evt.RequestID)
+	m.mu.Unlock()
+
+	metrics.RepositoryDuration.WithLabelValues(command.collection, evt.CommandName).Observe(evt.Duration.Seconds())
+	if err != nil {
+		metrics.RepositoryErrors.WithLabelValues(command.collection, evt.CommandName).Inc()
+	}
+
+	if !ok {
+		return
+	}
+	if err != nil {
+		command.span.RecordError(err)
+		command.span.SetStatus(codes.Error, err.Error())
+	}
+	command.span.End()
+}
+
+// commandCollection returns the collection a command operates on, or "" for commands on the database,
+// such as committing a transaction
+func commandCollection(evt *event.CommandStartedEvent) string {
+	// Cursors continue on the collection named apart from the command
+	if evt.CommandName == "getMore" {
+		collection, _ := evt.Command.Lookup("collection").StringValueOK()
+		return collection
+	}
+	collection, _ := evt.Command.Lookup(evt.CommandName).StringValueOK()
+	return collection
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+
+	"urlshortener/internal/pkg/metrics"
+)
+
+// TestCommandMonitor tests that commands are traced in spans of the operation sending them, timed and counted when they fail
+func TestCommandMonitor(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	monitor := newCommandMonitor()
+
+	ctx, parent := tracer.Start(context.Background(), "MongoURLRepository.GetURLByShortCode")
+	command, err := bson.Marshal(bson.D{{Key: "find", Value: "monitor_test"}, {Key: "filter", Value: bson.D{{Key: "short_code", Value: "abc123"}}}})
+	assert.NoError(t, err)
+	finds := observations(t, metrics.RepositoryDuration.WithLabelValues("monitor_test", "find"))
+	failures := testutil.ToFloat64(metrics.RepositoryErrors.WithLabelValues("monitor_test", "find"))
+
+	monitor.Started(ctx, &event.CommandStartedEvent{Command: command, DatabaseName: "urlshortener", CommandName: "find", RequestID: 1})
+	monitor.Started(ctx, &event.CommandStartedEvent{Command: command, DatabaseName: "urlshortener", CommandName: "find", RequestID: 2})
+	monitor.Succeeded(ctx, &event.CommandSucceededEvent{CommandFinishedEvent: event.CommandFinishedEvent{CommandName: "find", RequestID: 1, Duration: time.Millisecond}})
+	monitor.Failed(ctx, &event.CommandFailedEvent{CommandFinishedEvent: event.CommandFinishedEvent{CommandName: "find", RequestID: 2, Duration: time.Second}, Failure: "connection reset"})
+	parent.End()
+
+	assert.Equal(t, finds+2, observations(t, metrics.RepositoryDuration.WithLabelValues("monitor_test", "find")))
+	assert.Equal(t, failures+1, testutil.ToFloat64(metrics.RepositoryErrors.WithLabelValues("monitor_test", "find")))
+
+	spans := recorder.Ended()
+	if !assert.Len(t, spans, 3) {
+		return
+	}
+	for _, span := range spans[:2] {
+		assert.Equal(t, "find monitor_test", span.Name())
+		assert.Equal(t, parent.SpanContext().SpanID(), span.Parent().SpanID())
+		assert.Contains(t, span.Attributes(), semconv.DBCollectionName("monitor_test"))
+		assert.Contains(t, span.Attributes(), semconv.DBNamespace("urlshortener"))
+	}
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+	assert.Equal(t, "connection reset", spans[1].Status().Description)
+}
+
+// observations returns the number of values observed by a histogram
+func observations(t *testing.T, observer prometheus.Observer) uint64 {
+	var m dto.Metric
+	assert.NoError(t, observer.(prometheus.Metric).Write(&m))
+	return m.GetHistogram().GetSampleCount()
+}
@@ -0,0 +1,120 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+	"urlshortener/internal/domain/models"
+	"urlshortener/internal/domain/repositories"
+)
+
+// outboxRetention is how long published events stay in the outbox before the TTL index removes them
+const outboxRetention = 7 * 24 * time.Hour
+
+// MongoOutboxRepository implements the OutboxRepository interface using MongoDB as the storage.
+// Events appended within a transaction are only visible to the relay once the transaction commits.
+type MongoOutboxRepository struct {
+	db         *MongoDB
+	collection *mongo.Collection
+}
+
+// NewMongoOutboxRepository creates a new instance of MongoOutboxRepository and ensures the indexes
+// serving the relay and removing published events once past retention exist.
+func NewMongoOutboxRepository(db *MongoDB) (repositories.OutboxRepository, error) {
+	repo := &MongoOutboxRepository{
+		db:         db,
+		collection: db.Collection("event_outbox"),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := repo.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "published_at", Value: 1}, {Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}},
+		{
+			Keys:    bson.D{{Key: "published_at", Value: 1}},
+			Options: options.Index().SetName("published_at_ttl").SetExpireAfterSeconds(int32(outboxRetention.Seconds())),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+// AppendEvent inserts an unpublished event into the outbox
+func (r *MongoOutboxRepository) AppendEvent(ctx context.Context, event *models.OutboxEvent) error {
+	result, err := r.collection.InsertOne(ctx, event)
+	if err != nil {
+		return err
+	}
+	if id, ok := result.InsertedID.(primitive.ObjectID); ok {
+		event.ID = id.Hex()
+	}
+	return nil
+}
+
+// ClaimEvent atomically locks the oldest unpublished event for lease and returns it, or nil if every event
+// is published. An event whose lock expired, because its relay stopped, can be claimed again.
+func (r *MongoOutboxRepository) ClaimEvent(ctx context.Context, now time.Time, lease time.Duration) (*models.OutboxEvent, error) {
+	filter := bson.M{
+		"published_at": nil,
+		"$or": bson.A{
+			bson.M{"locked_until": bson.M{"$exists": false}},
+			bson.M{"locked_until": bson.M{"$lte": now}},
+		},
+	}
+	update := bson.M{"$set": bson.M{"locked_until": now.Add(lease)}}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var event models.OutboxEvent
+	err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&event)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// MarkEventPublished records that an event was published and releases its lock
+func (r *MongoOutboxRepository) MarkEventPublished(ctx context.Context, id string, at time.Time) error {
+	return r.updateEvent(ctx, id, bson.M{
+		"$set":   bson.M{"published_at": at},
+		"$unset": bson.M{"locked_until": "", "last_error": ""},
+	})
+}
+
+// ReleaseEvent records a failed attempt to publish an event and releases its lock, so it is claimed again
+func (r *MongoOutboxRepository) ReleaseEvent(ctx context.Context, id string, lastError string) error {
+	return r.updateEvent(ctx, id, bson.M{
+		"$set":   bson.M{"last_error": lastError},
+		"$inc":   bson.M{"attempts": 1},
+		"$unset": bson.M{"locked_until": ""},
+	})
+}
+
+// updateEvent applies update to the event with the given ID
+func (r *MongoOutboxRepository) updateEvent(ctx context.Context, id string, update bson.M) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return repositories.ErrOutboxEventNotFound
+	}
+
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": objectID}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return repositories.ErrOutboxEventNotFound
+	}
+	return nil
+}
@@ -5,8 +5,11 @@ import (
 	"errors"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
 	"urlshortener/internal/domain/models"
 	"urlshortener/internal/domain/repositories"
+	"urlshortener/internal/pkg/reqctx"
 )
 
 // MongoURLRepository implements the URLRepository interface using MongoDB as the storage.
@@ -15,60 +18,502 @@ type MongoURLRepository struct {
 	collection *mongo.Collection
 }
 
-// NewMongoURLRepository creates a new instance of MongoURLRepository
-func NewMongoURLRepository(db *MongoDB) repositories.URLRepository {
-	return &MongoURLRepository{
+// NewMongoURLRepository creates a new instance of MongoURLRepository.
+// URLs stored without a domain are assigned to defaultDomain, and the indexes keeping
+// short codes unique per domain and serving health checks and filtered listings are ensured.
+func NewMongoURLRepository(db *MongoDB, defaultDomain string) (repositories.URLRepository, error) {
+	repo := &MongoURLRepository{
 		db:         db,
 		collection: db.Collection("urls"),
 	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := backfillDomain(ctx, repo.collection, defaultDomain); err != nil {
+		return nil, err
+	}
+	if err := removeNullObjects(ctx, repo.collection, "labels", "utm"); err != nil {
+		return nil, err
+	}
+
+	_, err := repo.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "domain", Value: 1}, {Key: "short_code", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		// Serves the health checker looking for destinations due for a check
+		{Keys: bson.D{{Key: "health.checked_at", Value: 1}}},
+		// Serve listings filtered by tag, folder and label
+		{Keys: bson.D{{Key: "tags", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "folder", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "labels.$**", Value: 1}}},
+		{Keys: bson.D{{Key: "campaign_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "owner", Value: 1}, {Key: "created_at", Value: -1}}},
+		// Serves the watcher announcing URLs whose active window ended
+		{Keys: bson.D{{Key: "active_until", Value: 1}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return repo, nil
 }
 
 // CreateURL inserts a new URL document into the MongoDB collection.
+// It returns ErrShortCodeTaken if the short code is already used on the URL's domain.
 func (r *MongoURLRepository) CreateURL(ctx context.Context, url *models.URL) error {
+	ctx, span := tracer.Start(ctx, "MongoURLRepository.CreateURL")
+	defer span.End()
+
 	_, err := r.collection.InsertOne(ctx, url)
+	if mongo.IsDuplicateKeyError(err) {
+		return repositories.ErrShortCodeTaken
+	}
 	return err
 }
 
-// GetURLByShortCode retrieves a URL document by its short code.
+// GetURLByShortCode retrieves a URL document by its short code on the domain of ctx.
 func (r *MongoURLRepository) GetURLByShortCode(ctx context.Context, shortCode string) (*models.URL, error) {
+	ctx, span := tracer.Start(ctx, "MongoURLRepository.GetURLByShortCode")
+	defer span.End()
+
 	var url models.URL
-	err := r.collection.FindOne(ctx, bson.M{"short_code": shortCode}).Decode(&url)
+	err := r.collection.FindOne(ctx, codeFilter(ctx, shortCode)).Decode(&url)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
-			return nil, errors.New("url not found")
+			return nil, repositories.ErrURLNotFound
 		}
 		return nil, err
 	}
 	return &url, err
 }
 
+// ListURLs retrieves URL documents matching the filter, newest first.
+func (r *MongoURLRepository) ListURLs(ctx context.Context, filter models.URLFilter) ([]*models.URL, error) {
+	ctx, span := tracer.Start(ctx, "MongoURLRepository.ListURLs")
+	defer span.End()
+
+	query := bson.M{}
+	if filter.Domain != "" {
+		query["domain"] = filter.Domain
+	}
+	if filter.Health != "" {
+		query["health.status"] = filter.Health
+	}
+	if len(filter.Tags) > 0 {
+		query["tags"] = bson.M{"$all": filter.Tags}
+	}
+	if filter.Folder != "" {
+		query["folder"] = filter.Folder
+	}
+	if filter.CampaignID != "" {
+		query["campaign_id"] = filter.CampaignID
+	}
+	if filter.Owner != "" {
+		query["owner"] = filter.Owner
+	}
+	// Label keys are validated to be plain field names
+	for key, value := range filter.Labels {
+		query["labels."+key] = value
+	}
+	switch filter.Status {
+	case models.LinkStatusScheduled:
+		query["active_from"] = bson.M{"$gt": filter.Now}
+	case models.LinkStatusEnded:
+		query["active_until"] = bson.M{"$lte": filter.Now}
+	case models.LinkStatusActive:
+		// $not also matches documents without the field, i.e. an open-ended window
+		query["active_from"] = bson.M{"$not": bson.M{"$gt": filter.Now}}
+		query["active_until"] = bson.M{"$not": bson.M{"$lte": filter.Now}}
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64(filter.Offset)).
+		SetLimit(int64(filter.Limit))
+
+	cursor, err := r.collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	urls := make([]*models.URL, 0)
+	if err := cursor.All(ctx, &urls); err != nil {
+		return nil, err
+	}
+	return urls, nil
+}
+
 // UpdateURL modifies an existing URL document in the MongoDB collection.
+// The update only applies if the stored version still equals url.Version, which is then incremented.
+// A URL without health clears the stored health, which belongs to a previous destination, and empty tags, labels and UTM parameters are removed.
 func (r *MongoURLRepository) UpdateURL(ctx context.Context, url *models.URL) error {
-	_, err := r.collection.UpdateOne(
+	ctx, span := tracer.Start(ctx, "MongoURLRepository.UpdateURL")
+	defer span.End()
+
+	set := bson.M{
+		"original_url":       url.OriginalURL,
+		"password_hash":      url.PasswordHash,
+		"password_protected": url.PasswordProtected,
+		"single_use":         url.SingleUse,
+		"active_from":        url.ActiveFrom,
+		"active_until":       url.ActiveUntil,
+		"rules":              url.Rules,
+		"variants":           url.Variants,
+		"sticky_variants":    url.StickyVariants,
+		"query_mode":         url.QueryMode,
+		"path_passthrough":   url.PathPassthrough,
+		"title":              url.Title,
+		"preview":            url.Preview,
+		"fallback_url":       url.FallbackURL,
+		"folder":             url.Folder,
+		"notes":              url.Notes,
+		"campaign_id":        url.CampaignID,
+		"updated_at":         url.UpdatedAt,
+	}
+	unset := bson.M{}
+	// Empty tags, labels and UTM parameters are removed rather than stored as null, since patches could not set their members on null
+	if len(url.Tags) > 0 {
+		set["tags"] = url.Tags
+	} else {
+		unset["tags"] = ""
+	}
+	if len(url.Labels) > 0 {
+		set["labels"] = url.Labels
+	} else {
+		unset["labels"] = ""
+	}
+	if url.UTM != nil {
+		set["utm"] = url.UTM
+	} else {
+		unset["utm"] = ""
+	}
+	if url.Health == nil {
+		unset["health"] = ""
+	}
+	update := bson.M{
+		"$set":   set,
+		"$unset": unset,
+		"$inc":   bson.M{"version": 1},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, versionFilter(ctx, url.ShortCode, url.Version), update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return r.missOrConflict(ctx, url.ShortCode)
+	}
+
+	url.Version++
+	return nil
+}
+
+// PatchURL applies a partial update to an existing URL document with a single $set/$unset.
+// Like UpdateURL it only applies if the stored version still equals url.Version, which is then incremented.
+func (r *MongoURLRepository) PatchURL(ctx context.Context, url *models.URL, patch models.URLPatch) error {
+	ctx, span := tracer.Start(ctx, "MongoURLRepository.PatchURL")
+	defer span.End()
+
+	set := bson.M{"updated_at": url.UpdatedAt}
+	unset := bson.M{}
+	for field, value := range patch {
+		if value == nil {
+			unset[field] = ""
+			continue
+		}
+		set[field] = value
+	}
+
+	update := bson.M{
+		"$set": set,
+		"$inc": bson.M{"version": 1},
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	result, err := r.collection.UpdateOne(ctx, versionFilter(ctx, url.ShortCode, url.Version), update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return r.missOrConflict(ctx, url.ShortCode)
+	}
+
+	url.Version++
+	return nil
+}
+
+// DeleteURL removes a URL document from the MongoDB collection by its short code,
+// provided the stored version still equals version.
+func (r *MongoURLRepository) DeleteURL(ctx context.Context, shortCode string, version int64) error {
+	ctx, span := tracer.Start(ctx, "MongoURLRepository.DeleteURL")
+	defer span.End()
+
+	result, err := r.collection.DeleteOne(ctx, versionFilter(ctx, shortCode, version))
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return r.missOrConflict(ctx, shortCode)
+	}
+	return nil
+}
+
+// IncrementURLAccessCount increments the access count of a URL document by its short code,
+// together with the clicks of the variant the visitor was sent to, if any.
+func (r *MongoURLRepository) IncrementURLAccessCount(ctx context.Context, shortCode, variantID string) error {
+	ctx, span := tracer.Start(ctx, "MongoURLRepository.IncrementURLAccessCount")
+	defer span.End()
+
+	inc, arrayFilters := accessIncrement(variantID)
+
+	opts := options.Update()
+	if len(arrayFilters) > 0 {
+		opts.SetArrayFilters(options.ArrayFilters{Filters: arrayFilters})
+	}
+
+	_, err := r.collection.UpdateOne(ctx, codeFilter(ctx, shortCode), bson.M{"$inc": inc}, opts)
+	return err
+}
+
+// IncrementURLBotCount increments the count of accesses by bots of a URL document by its short code.
+func (r *MongoURLRepository) IncrementURLBotCount(ctx context.Context, shortCode string) error {
+	ctx, span := tracer.Start(ctx, "MongoURLRepository.IncrementURLBotCount")
+	defer span.End()
+
+	_, err := r.collection.UpdateOne(ctx, codeFilter(ctx, shortCode), bson.M{"$inc": bson.M{"bot_access_count": 1}})
+	return err
+}
+
+// ConsumeURL atomically marks an unconsumed single-use URL as consumed and counts the access.
+// Only one of several concurrent callers succeeds; the others get ErrURLConsumed.
+func (r *MongoURLRepository) ConsumeURL(ctx context.Context, shortCode string, consumption *models.Consumption) (*models.URL, error) {
+	ctx, span := tracer.Start(ctx, "MongoURLRepository.ConsumeURL")
+	defer span.End()
+
+	inc, arrayFilters := accessIncrement(consumption.Variant)
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	if len(arrayFilters) > 0 {
+		opts.SetArrayFilters(options.ArrayFilters{Filters: arrayFilters})
+	}
+
+	var url models.URL
+	err := r.collection.FindOneAndUpdate(
 		ctx,
-		bson.M{"short_code": url.ShortCode},
 		bson.M{
-			"$set": bson.M{
-				"original_url": url.OriginalURL,
-				"updated_at":   url.UpdatedAt,
-			},
+			"domain":      reqctx.Domain(ctx).Host,
+			"short_code":  shortCode,
+			"single_use":  true,
+			"consumed_by": bson.M{"$exists": false},
 		},
-	)
+		bson.M{
+			"$set": bson.M{"consumed_by": consumption},
+			"$inc": inc,
+		},
+		opts,
+	).Decode(&url)
+	if err == nil {
+		return &url, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+
+	count, err := r.collection.CountDocuments(ctx, codeFilter(ctx, shortCode))
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, repositories.ErrURLNotFound
+	}
+	return nil, repositories.ErrURLConsumed
+}
+
+// UpdateURLMetadata stores the metadata fetched for a URL, provided it still points at originalURL.
+// Metadata is derived from the destination, so storing it leaves the version unchanged.
+func (r *MongoURLRepository) UpdateURLMetadata(ctx context.Context, shortCode, originalURL string, metadata *models.Metadata) error {
+	ctx, span := tracer.Start(ctx, "MongoURLRepository.UpdateURLMetadata")
+	defer span.End()
+
+	filter := codeFilter(ctx, shortCode)
+	filter["original_url"] = originalURL
+
+	_, err := r.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"metadata": metadata}})
+	return err
+}
+
+// ListURLsDueForCheck retrieves URLs on every domain whose destination was last checked before
+// checkedBefore, or never, least recently checked first. Consumed single-use URLs and those whose
+// check was put off until later are skipped.
+func (r *MongoURLRepository) ListURLsDueForCheck(ctx context.Context, checkedBefore time.Time, limit int) ([]*models.URL, error) {
+	ctx, span := tracer.Start(ctx, "MongoURLRepository.ListURLsDueForCheck")
+	defer span.End()
+
+	query := bson.M{
+		// $not also matches documents without health, i.e. destinations never checked
+		"health.checked_at":  bson.M{"$not": bson.M{"$gte": checkedBefore}},
+		"health_check_after": bson.M{"$not": bson.M{"$gt": time.Now()}},
+		"consumed_by":        nil,
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "health.checked_at", Value: 1}, {Key: "_id", Value: 1}}).
+		SetLimit(int64(limit))
+
+	cursor, err := r.collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	urls := make([]*models.URL, 0)
+	if err := cursor.All(ctx, &urls); err != nil {
+		return nil, err
+	}
+	return urls, nil
+}
+
+// UpdateURLHealth stores the outcome of checking the destination of a URL, provided it still points at originalURL.
+// Like metadata, health leaves the version unchanged.
+func (r *MongoURLRepository) UpdateURLHealth(ctx context.Context, shortCode, originalURL string, health *models.Health) error {
+	ctx, span := tracer.Start(ctx, "MongoURLRepository.UpdateURLHealth")
+	defer span.End()
+
+	filter := codeFilter(ctx, shortCode)
+	filter["original_url"] = originalURL
+
+	_, err := r.collection.UpdateOne(ctx, filter, bson.M{
+		"$set":   bson.M{"health": health},
+		"$unset": bson.M{"health_check_after": ""},
+	})
+	return err
+}
+
+// DeferURLCheck keeps the destination of a URL out of the health checks due until the given time.
+// It leaves the version unchanged.
+func (r *MongoURLRepository) DeferURLCheck(ctx context.Context, shortCode string, until time.Time) error {
+	ctx, span := tracer.Start(ctx, "MongoURLRepository.DeferURLCheck")
+	defer span.End()
+
+	_, err := r.collection.UpdateOne(ctx, codeFilter(ctx, shortCode), bson.M{"$set": bson.M{"health_check_after": until}})
 	return err
 }
 
-// DeleteURL removes a URL document from the MongoDB collection by its short code.
-func (r *MongoURLRepository) DeleteURL(ctx context.Context, shortCode string) error {
-	_, err := r.collection.DeleteOne(ctx, bson.M{"short_code": shortCode})
+// ClearCampaign removes every URL, on any domain, from the campaign with the given ID.
+// It runs when the campaign is deleted and leaves the version of the URLs unchanged.
+func (r *MongoURLRepository) ClearCampaign(ctx context.Context, campaignID string) error {
+	ctx, span := tracer.Start(ctx, "MongoURLRepository.ClearCampaign")
+	defer span.End()
+
+	_, err := r.collection.UpdateMany(ctx, bson.M{"campaign_id": campaignID}, bson.M{"$unset": bson.M{"campaign_id": ""}})
 	return err
 }
 
-// IncrementURLAccessCount increments the access count of a URL document by its short code.
-func (r *MongoURLRepository) IncrementURLAccessCount(ctx context.Context, shortCode string) error {
-	_, err := r.collection.UpdateOne(
+// EraseConsumptions removes the details of the visitors that used up the single-use URLs of owner, on any domain.
+// The time of the consumption is kept, so the URLs stay used up.
+func (r *MongoURLRepository) EraseConsumptions(ctx context.Context, owner string) (int64, error) {
+	ctx, span := tracer.Start(ctx, "MongoURLRepository.EraseConsumptions")
+	defer span.End()
+
+	result, err := r.collection.UpdateMany(
+		ctx,
+		bson.M{"owner": owner, "consumed_by": bson.M{"$ne": nil}},
+		bson.M{"$unset": bson.M{"consumed_by.ip": "", "consumed_by.user_agent": "", "consumed_by.country": ""}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// ListURLsEndedBetween retrieves URLs on every domain whose active window ended in [from, to), earliest first
+func (r *MongoURLRepository) ListURLsEndedBetween(ctx context.Context, from, to time.Time) ([]*models.URL, error) {
+	ctx, span := tracer.Start(ctx, "MongoURLRepository.ListURLsEndedBetween")
+	defer span.End()
+
+	query := bson.M{"active_until": bson.M{"$gte": from, "$lt": to}}
+	opts := options.Find().SetSort(bson.D{{Key: "active_until", Value: 1}, {Key: "_id", Value: 1}})
+
+	cursor, err := r.collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	urls := make([]*models.URL, 0)
+	if err := cursor.All(ctx, &urls); err != nil {
+		return nil, err
+	}
+	return urls, nil
+}
+
+// accessIncrement builds the $inc document and array filters counting one access,
+// attributed to the variant with the given ID if it is not empty.
+func accessIncrement(variantID string) (bson.M, []interface{}) {
+	inc := bson.M{"access_count": 1}
+	if variantID == "" {
+		return inc, nil
+	}
+	inc["variants.$[variant].clicks"] = 1
+	return inc, []interface{}{bson.M{"variant.id": variantID}}
+}
+
+// codeFilter matches a short code on the domain of ctx.
+func codeFilter(ctx context.Context, shortCode string) bson.M {
+	return bson.M{"domain": reqctx.Domain(ctx).Host, "short_code": shortCode}
+}
+
+// versionFilter matches a short code on the domain of ctx at a specific version.
+// Documents written before versioning was introduced have no version field and count as version 0.
+func versionFilter(ctx context.Context, shortCode string, version int64) bson.M {
+	filter := codeFilter(ctx, shortCode)
+	if version == 0 {
+		filter["version"] = bson.M{"$in": bson.A{0, nil}}
+	} else {
+		filter["version"] = version
+	}
+	return filter
+}
+
+// backfillDomain assigns documents written before domains were introduced, or while no branded
+// domains were configured, to the default domain.
+func backfillDomain(ctx context.Context, collection *mongo.Collection, defaultDomain string) error {
+	_, err := collection.UpdateMany(
 		ctx,
-		bson.M{"short_code": shortCode},
-		bson.M{"$inc": bson.M{"access_count": 1}},
+		bson.M{"domain": bson.M{"$in": bson.A{nil, ""}}},
+		bson.M{"$set": bson.M{"domain": defaultDomain}},
 	)
 	return err
 }
+
+// removeNullObjects removes the given fields from documents storing them as null, as updates did before they removed
+// empty ones, so patches can set their members
+func removeNullObjects(ctx context.Context, collection *mongo.Collection, fields ...string) error {
+	for _, field := range fields {
+		_, err := collection.UpdateMany(
+			ctx,
+			bson.M{field: bson.M{"$type": "null"}},
+			bson.M{"$unset": bson.M{field: ""}},
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// missOrConflict explains why a versioned write matched nothing: the short code is either gone or has moved on.
+func (r *MongoURLRepository) missOrConflict(ctx context.Context, shortCode string) error {
+	count, err := r.collection.CountDocuments(ctx, codeFilter(ctx, shortCode))
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return repositories.ErrURLNotFound
+	}
+	return repositories.ErrVersionConflict
+}
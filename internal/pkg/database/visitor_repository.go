@@ -0,0 +1,128 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+	"urlshortener/internal/domain/models"
+	"urlshortener/internal/domain/repositories"
+	"urlshortener/internal/pkg/hll"
+)
+
+// maxMergeAttempts bounds the attempts to merge into a visitor sketch other instances keep changing
+const maxMergeAttempts = 5
+
+// MongoVisitorSketchRepository implements the VisitorSketchRepository interface using MongoDB as the storage.
+// Each link has a document per day and one for its lifetime.
+type MongoVisitorSketchRepository struct {
+	db         *MongoDB
+	collection *mongo.Collection
+}
+
+// NewMongoVisitorSketchRepository creates a new instance of MongoVisitorSketchRepository
+// and ensures the unique index on the link and period of a sketch exists.
+func NewMongoVisitorSketchRepository(db *MongoDB) (repositories.VisitorSketchRepository, error) {
+	repo := &MongoVisitorSketchRepository{
+		db:         db,
+		collection: db.Collection("visitor_sketches"),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := repo.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "domain", Value: 1}, {Key: "short_code", Value: 1}, {Key: "period", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+// MergeVisitorSketch merges the sketch and adds the clicks of a period into the stored sketch of the period,
+// creating it if needed. Concurrent merges are detected through the version of the stored sketch and retried.
+func (r *MongoVisitorSketchRepository) MergeVisitorSketch(ctx context.Context, sketch *models.VisitorSketch) error {
+	delta := hll.New()
+	if err := delta.UnmarshalBinary(sketch.Sketch); err != nil {
+		return err
+	}
+	filter := bson.M{"domain": sketch.Domain, "short_code": sketch.ShortCode, "period": sketch.Period}
+
+	for attempt := 0; attempt < maxMergeAttempts; attempt++ {
+		var stored models.VisitorSketch
+		err := r.collection.FindOne(ctx, filter).Decode(&stored)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			created := *sketch
+			created.Version = 1
+			created.UpdatedAt = time.Now()
+			_, err = r.collection.InsertOne(ctx, &created)
+			if mongo.IsDuplicateKeyError(err) {
+				// Another instance created the sketch first, so merge into it
+				continue
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		merged := hll.New()
+		if err := merged.UnmarshalBinary(stored.Sketch); err != nil {
+			return err
+		}
+		merged.Merge(delta)
+		data, err := merged.MarshalBinary()
+		if err != nil {
+			return err
+		}
+
+		versioned := bson.M{"domain": sketch.Domain, "short_code": sketch.ShortCode, "period": sketch.Period, "version": stored.Version}
+		update := bson.M{
+			"$set": bson.M{"sketch": data, "updated_at": time.Now()},
+			"$inc": bson.M{"clicks": sketch.Clicks, "version": 1},
+		}
+		result, err := r.collection.UpdateOne(ctx, versioned, update)
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 1 {
+			return nil
+		}
+	}
+	return repositories.ErrSketchConflict
+}
+
+// ListVisitorSketches retrieves the stored sketches of a link for the given periods.
+// Periods without a sketch are left out.
+func (r *MongoVisitorSketchRepository) ListVisitorSketches(ctx context.Context, link models.LinkRef, periods []string) ([]*models.VisitorSketch, error) {
+	query := bson.M{"domain": link.Domain, "short_code": link.ShortCode, "period": bson.M{"$in": periods}}
+	cursor, err := r.collection.Find(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	sketches := make([]*models.VisitorSketch, 0)
+	if err := cursor.All(ctx, &sketches); err != nil {
+		return nil, err
+	}
+	return sketches, nil
+}
+
+// DeleteVisitorSketches deletes every sketch of links and returns how many were deleted.
+func (r *MongoVisitorSketchRepository) DeleteVisitorSketches(ctx context.Context, links []models.LinkRef) (int64, error) {
+	if len(links) == 0 {
+		return 0, nil
+	}
+
+	result, err := r.collection.DeleteMany(ctx, bson.M{"$or": linksFilter(links)})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
@@ -0,0 +1,222 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+	"urlshortener/internal/domain/models"
+	"urlshortener/internal/domain/repositories"
+)
+
+// duplicateKeyCode is the MongoDB error code of a unique index violation
+const duplicateKeyCode = 11000
+
+// MongoWebhookDeliveryRepository implements the WebhookDeliveryRepository interface using MongoDB as the storage.
+// The collection is the durable queue of deliveries, and its dead deliveries the dead-letter list.
+type MongoWebhookDeliveryRepository struct {
+	db         *MongoDB
+	collection *mongo.Collection
+}
+
+// NewMongoWebhookDeliveryRepository creates a new instance of MongoWebhookDeliveryRepository and ensures
+// the indexes keeping events delivered once per webhook, serving the queue and listing deliveries exist.
+func NewMongoWebhookDeliveryRepository(db *MongoDB) (repositories.WebhookDeliveryRepository, error) {
+	repo := &MongoWebhookDeliveryRepository{
+		db:         db,
+		collection: db.Collection("webhook_deliveries"),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := repo.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "webhook_id", Value: 1}, {Key: "event_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}}},
+		{Keys: bson.D{{Key: "webhook_id", Value: 1}, {Key: "status", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+// EnqueueDeliveries inserts pending deliveries. Deliveries of an event already queued for the same webhook
+// are ignored, so an event emitted again, such as by several instances, is delivered once.
+func (r *MongoWebhookDeliveryRepository) EnqueueDeliveries(ctx context.Context, deliveries []*models.WebhookDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	documents := make([]interface{}, len(deliveries))
+	for i, delivery := range deliveries {
+		documents[i] = delivery
+	}
+	_, err := r.collection.InsertMany(ctx, documents, options.InsertMany().SetOrdered(false))
+	if onlyDuplicateKeys(err) {
+		return nil
+	}
+	return err
+}
+
+// onlyDuplicateKeys reports whether every error of a bulk write is a unique index violation
+func onlyDuplicateKeys(err error) bool {
+	var bulk mongo.BulkWriteException
+	if !errors.As(err, &bulk) || bulk.WriteConcernError != nil || len(bulk.WriteErrors) == 0 {
+		return false
+	}
+	for _, writeErr := range bulk.WriteErrors {
+		if writeErr.Code != duplicateKeyCode {
+			return false
+		}
+	}
+	return true
+}
+
+// ClaimDelivery atomically locks the pending delivery due the longest for lease and returns it,
+// or nil if none is due. A delivery whose lock expired, because its dispatcher stopped, can be claimed again.
+func (r *MongoWebhookDeliveryRepository) ClaimDelivery(ctx context.Context, now time.Time, lease time.Duration) (*models.WebhookDelivery, error) {
+	filter := bson.M{
+		"status":          models.DeliveryPending,
+		"next_attempt_at": bson.M{"$lte": now},
+		"$or": bson.A{
+			bson.M{"locked_until": bson.M{"$exists": false}},
+			bson.M{"locked_until": bson.M{"$lte": now}},
+		},
+	}
+	update := bson.M{"$set": bson.M{"locked_until": now.Add(lease)}}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var delivery models.WebhookDelivery
+	err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&delivery)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// UpdateDelivery stores the outcome of an attempt and releases the lock of the delivery.
+func (r *MongoWebhookDeliveryRepository) UpdateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	objectID, err := primitive.ObjectIDFromHex(delivery.ID)
+	if err != nil {
+		return repositories.ErrDeliveryNotFound
+	}
+
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": objectID}, bson.M{
+		"$set": bson.M{
+			"status":           delivery.Status,
+			"attempts":         delivery.Attempts,
+			"next_attempt_at":  delivery.NextAttemptAt,
+			"last_attempt_at":  delivery.LastAttemptAt,
+			"last_status_code": delivery.LastStatusCode,
+			"last_error":       delivery.LastError,
+			"delivered_at":     delivery.DeliveredAt,
+		},
+		"$unset": bson.M{"locked_until": ""},
+	})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return repositories.ErrDeliveryNotFound
+	}
+	return nil
+}
+
+// GetDelivery retrieves a delivery of a webhook by its ID.
+func (r *MongoWebhookDeliveryRepository) GetDelivery(ctx context.Context, webhookID, id string) (*models.WebhookDelivery, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, repositories.ErrDeliveryNotFound
+	}
+
+	var delivery models.WebhookDelivery
+	err = r.collection.FindOne(ctx, bson.M{"_id": objectID, "webhook_id": webhookID}).Decode(&delivery)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, repositories.ErrDeliveryNotFound
+		}
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+// ListDeliveries retrieves the deliveries of a webhook matching the filter, newest first.
+func (r *MongoWebhookDeliveryRepository) ListDeliveries(ctx context.Context, filter models.DeliveryFilter) ([]*models.WebhookDelivery, error) {
+	query := bson.M{"webhook_id": filter.WebhookID}
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(int64(filter.Offset)).
+		SetLimit(int64(filter.Limit))
+	cursor, err := r.collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	deliveries := make([]*models.WebhookDelivery, 0)
+	if err := cursor.All(ctx, &deliveries); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// ReplayDelivery queues a delivery of a webhook again from its first attempt, whatever its status.
+func (r *MongoWebhookDeliveryRepository) ReplayDelivery(ctx context.Context, webhookID, id string, now time.Time) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return repositories.ErrDeliveryNotFound
+	}
+
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": objectID, "webhook_id": webhookID}, replayUpdate(now))
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return repositories.ErrDeliveryNotFound
+	}
+	return nil
+}
+
+// ReplayDeadDeliveries queues every dead delivery of a webhook again and returns how many were queued.
+func (r *MongoWebhookDeliveryRepository) ReplayDeadDeliveries(ctx context.Context, webhookID string, now time.Time) (int64, error) {
+	result, err := r.collection.UpdateMany(ctx, bson.M{"webhook_id": webhookID, "status": models.DeliveryDead}, replayUpdate(now))
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// replayUpdate resets a delivery to pending with all its attempts left, due at now
+func replayUpdate(now time.Time) bson.M {
+	return bson.M{
+		"$set": bson.M{
+			"status":          models.DeliveryPending,
+			"attempts":        0,
+			"next_attempt_at": now,
+		},
+		"$unset": bson.M{"delivered_at": "", "locked_until": ""},
+	}
+}
+
+// DeleteDeliveries removes every delivery of a webhook.
+func (r *MongoWebhookDeliveryRepository) DeleteDeliveries(ctx context.Context, webhookID string) error {
+	_, err := r.collection.DeleteMany(ctx, bson.M{"webhook_id": webhookID})
+	return err
+}
@@ -0,0 +1,142 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+	"urlshortener/internal/domain/models"
+	"urlshortener/internal/domain/repositories"
+)
+
+// MongoWebhookRepository implements the WebhookRepository interface using MongoDB as the storage.
+type MongoWebhookRepository struct {
+	db         *MongoDB
+	collection *mongo.Collection
+}
+
+// NewMongoWebhookRepository creates a new instance of MongoWebhookRepository
+// and ensures the index serving the lookup of the webhooks subscribed to an event exists.
+func NewMongoWebhookRepository(db *MongoDB) (repositories.WebhookRepository, error) {
+	repo := &MongoWebhookRepository{
+		db:         db,
+		collection: db.Collection("webhooks"),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := repo.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "events", Value: 1}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+// CreateWebhook inserts a new webhook document and sets its generated ID.
+func (r *MongoWebhookRepository) CreateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	result, err := r.collection.InsertOne(ctx, webhook)
+	if err != nil {
+		return err
+	}
+	if id, ok := result.InsertedID.(primitive.ObjectID); ok {
+		webhook.ID = id.Hex()
+	}
+	return nil
+}
+
+// GetWebhook retrieves a webhook document by its ID.
+func (r *MongoWebhookRepository) GetWebhook(ctx context.Context, id string) (*models.Webhook, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, repositories.ErrWebhookNotFound
+	}
+
+	var webhook models.Webhook
+	err = r.collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&webhook)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, repositories.ErrWebhookNotFound
+		}
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+// ListWebhooks retrieves the webhooks of an owner, or all webhooks if owner is empty, newest first.
+func (r *MongoWebhookRepository) ListWebhooks(ctx context.Context, owner string) ([]*models.Webhook, error) {
+	query := bson.M{}
+	if owner != "" {
+		query["owner"] = owner
+	}
+	return r.find(ctx, query)
+}
+
+// ListWebhooksForEvent retrieves the webhooks subscribed to an event type.
+func (r *MongoWebhookRepository) ListWebhooksForEvent(ctx context.Context, eventType string) ([]*models.Webhook, error) {
+	return r.find(ctx, bson.M{"events": eventType})
+}
+
+// find retrieves the webhook documents matching query, newest first
+func (r *MongoWebhookRepository) find(ctx context.Context, query bson.M) ([]*models.Webhook, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}})
+	cursor, err := r.collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	webhooks := make([]*models.Webhook, 0)
+	if err := cursor.All(ctx, &webhooks); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// UpdateWebhook replaces the mutable fields of an existing webhook document.
+func (r *MongoWebhookRepository) UpdateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	objectID, err := primitive.ObjectIDFromHex(webhook.ID)
+	if err != nil {
+		return repositories.ErrWebhookNotFound
+	}
+
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": objectID}, bson.M{
+		"$set": bson.M{
+			"url":        webhook.URL,
+			"events":     webhook.Events,
+			"owner":      webhook.Owner,
+			"secret":     webhook.Secret,
+			"updated_at": webhook.UpdatedAt,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return repositories.ErrWebhookNotFound
+	}
+	return nil
+}
+
+// DeleteWebhook removes a webhook document by its ID.
+func (r *MongoWebhookRepository) DeleteWebhook(ctx context.Context, id string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return repositories.ErrWebhookNotFound
+	}
+
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": objectID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return repositories.ErrWebhookNotFound
+	}
+	return nil
+}
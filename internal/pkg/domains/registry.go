@@ -0,0 +1,101 @@
+package domains
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"urlshortener/internal/domain/models"
+	"urlshortener/internal/pkg/generator"
+)
+
+const (
+	// DefaultRedirectStatus is used for domains that do not set a redirect status
+	DefaultRedirectStatus = http.StatusFound
+
+	// minCodeLength and maxCodeLength bound the generated short code length of a domain
+	minCodeLength = 4
+	maxCodeLength = 32
+)
+
+// Registry holds the domains short URLs may be served on.
+// The first domain is the default for requests that do not name one.
+type Registry struct {
+	domains []models.Domain
+	byHost  map[string]models.Domain
+}
+
+// NewRegistry creates a registry of the given domains, filling in their defaults.
+// Without any domains the registry holds a single unbranded domain that accepts every host.
+func NewRegistry(domains []models.Domain) (*Registry, error) {
+	if len(domains) == 0 {
+		domains = []models.Domain{{}}
+	}
+
+	r := &Registry{byHost: make(map[string]models.Domain, len(domains))}
+	for _, domain := range domains {
+		domain.Host = strings.ToLower(strings.TrimSpace(domain.Host))
+		if domain.RedirectStatus == 0 {
+			domain.RedirectStatus = DefaultRedirectStatus
+		}
+		if domain.CodeLength == 0 {
+			domain.CodeLength = generator.DefaultLength
+		}
+
+		if domain.Host == "" && len(domains) > 1 {
+			return nil, fmt.Errorf("domain host must not be empty")
+		}
+		if _, ok := r.byHost[domain.Host]; ok {
+			return nil, fmt.Errorf("domain %q is listed twice", domain.Host)
+		}
+		switch domain.RedirectStatus {
+		case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		default:
+			return nil, fmt.Errorf("domain %q: %d is not a redirect status", domain.Host, domain.RedirectStatus)
+		}
+		if domain.CodeLength < minCodeLength || domain.CodeLength > maxCodeLength {
+			return nil, fmt.Errorf("domain %q: code length must be between %d and %d", domain.Host, minCodeLength, maxCodeLength)
+		}
+
+		r.domains = append(r.domains, domain)
+		r.byHost[domain.Host] = domain
+	}
+	return r, nil
+}
+
+// Default returns the domain used when a request does not name one
+func (r *Registry) Default() models.Domain {
+	return r.domains[0]
+}
+
+// Domains returns the registered domains, default first
+func (r *Registry) Domains() []models.Domain {
+	return append([]models.Domain(nil), r.domains...)
+}
+
+// Get returns the domain with the given host, or the default domain if host is empty
+func (r *Registry) Get(host string) (models.Domain, bool) {
+	if host == "" {
+		return r.Default(), true
+	}
+	domain, ok := r.byHost[strings.ToLower(host)]
+	return domain, ok
+}
+
+// ForRequestHost returns the domain serving a request sent to the given Host header.
+// An unbranded registry serves every host; otherwise the host must be registered.
+func (r *Registry) ForRequestHost(hostHeader string) (models.Domain, bool) {
+	if r.Default().Host == "" {
+		return r.Default(), true
+	}
+
+	host := hostHeader
+	if h, _, err := net.SplitHostPort(hostHeader); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(host, ".")
+	if host == "" {
+		return models.Domain{}, false
+	}
+	return r.Get(host)
+}
@@ -0,0 +1,60 @@
+package domains
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"urlshortener/internal/domain/models"
+)
+
+// TestRegistryDefaults tests that domains get default settings and the first one is the default
+func TestRegistryDefaults(t *testing.T) {
+	registry, err := NewRegistry([]models.Domain{
+		{Host: "Go.Acme.com", RedirectStatus: http.StatusMovedPermanently},
+		{Host: "acme.link", CodeLength: 8},
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, models.Domain{Host: "go.acme.com", RedirectStatus: http.StatusMovedPermanently, CodeLength: 6}, registry.Default())
+
+	domain, ok := registry.Get("acme.link")
+	assert.True(t, ok)
+	assert.Equal(t, models.Domain{Host: "acme.link", RedirectStatus: http.StatusFound, CodeLength: 8}, domain)
+
+	_, ok = registry.Get("example.com")
+	assert.False(t, ok)
+}
+
+// TestRegistryForRequestHost tests matching Host headers, with and without branded domains
+func TestRegistryForRequestHost(t *testing.T) {
+	registry, err := NewRegistry([]models.Domain{{Host: "go.acme.com"}, {Host: "acme.link"}})
+	assert.NoError(t, err)
+
+	domain, ok := registry.ForRequestHost("ACME.link:8080")
+	assert.True(t, ok)
+	assert.Equal(t, "acme.link", domain.Host)
+
+	_, ok = registry.ForRequestHost("localhost:8080")
+	assert.False(t, ok)
+
+	unbranded, err := NewRegistry(nil)
+	assert.NoError(t, err)
+
+	domain, ok = unbranded.ForRequestHost("localhost:8080")
+	assert.True(t, ok)
+	assert.Equal(t, "", domain.Host)
+}
+
+// TestNewRegistryRejectsInvalidDomains tests validation of duplicate hosts and invalid settings
+func TestNewRegistryRejectsInvalidDomains(t *testing.T) {
+	_, err := NewRegistry([]models.Domain{{Host: "acme.link"}, {Host: "ACME.LINK"}})
+	assert.Error(t, err)
+
+	_, err = NewRegistry([]models.Domain{{Host: "acme.link", RedirectStatus: http.StatusOK}})
+	assert.Error(t, err)
+
+	_, err = NewRegistry([]models.Domain{{Host: "acme.link", CodeLength: 2}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,234 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultNATSTimeout bounds connecting to the server and each publish
+	DefaultNATSTimeout = 5 * time.Second
+
+	// defaultNATSPort is the port of servers addressed without one
+	defaultNATSPort = "4222"
+)
+
+// natsInfo is the part of the INFO message of a NATS server the client relies on
+type natsInfo struct {
+	TLSRequired bool  `json:"tls_required"`
+	MaxPayload  int64 `json:"max_payload"`
+}
+
+// natsConnect is the CONNECT message the client introduces itself with
+type natsConnect struct {
+	Verbose   bool   `json:"verbose"`
+	Pedantic  bool   `json:"pedantic"`
+	Name      string `json:"name"`
+	Lang      string `json:"lang"`
+	Version   string `json:"version"`
+	Protocol  int    `json:"protocol"`
+	User      string `json:"user,omitempty"`
+	Pass      string `json:"pass,omitempty"`
+	AuthToken string `json:"auth_token,omitempty"`
+}
+
+// NATSClient publishes messages to a server speaking the NATS client protocol, such as NATS itself
+// or a bridge forwarding to Kafka. A publish returns once the server has processed the message,
+// which a PING sent after it and answered with a PONG confirms.
+// The client connects on first use and again after any failure.
+type NATSClient struct {
+	addr    *url.URL
+	timeout time.Duration
+
+	mu         sync.Mutex
+	conn       net.Conn
+	reader     *bufio.Reader
+	maxPayload int64
+}
+
+// NewNATSClient creates a new instance of NATSClient for the server at rawURL, such as "nats://localhost:4222".
+// Credentials may be given in the URL as user and password or as a token alone; the tls scheme requires TLS.
+// A zero timeout uses DefaultNATSTimeout.
+func NewNATSClient(rawURL string, timeout time.Duration) (*NATSClient, error) {
+	addr, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if addr.Scheme != "nats" && addr.Scheme != "tls" {
+		return nil, fmt.Errorf("unsupported NATS url scheme %q", addr.Scheme)
+	}
+	if addr.Hostname() == "" {
+		return nil, errors.New("NATS url has no host")
+	}
+	if timeout <= 0 {
+		timeout = DefaultNATSTimeout
+	}
+	return &NATSClient{addr: addr, timeout: timeout}, nil
+}
+
+// Publish publishes payload on subject and waits for the server to confirm it processed the message
+func (c *NATSClient) Publish(ctx context.Context, subject string, payload []byte) error {
+	if subject == "" || strings.ContainsAny(subject, " \t\r\n") {
+		return fmt.Errorf("invalid NATS subject %q", subject)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		if err := c.connect(ctx); err != nil {
+			return err
+		}
+	}
+	if c.maxPayload > 0 && int64(len(payload)) > c.maxPayload {
+		return fmt.Errorf("payload of %d bytes exceeds the server maximum of %d", len(payload), c.maxPayload)
+	}
+
+	c.conn.SetDeadline(c.deadline(ctx))
+	message := fmt.Sprintf("PUB %s %d\r\n%s\r\nPING\r\n", subject, len(payload), payload)
+	if _, err := c.conn.Write([]byte(message)); err != nil {
+		c.closeConn()
+		return err
+	}
+	if err := c.awaitPong(); err != nil {
+		c.closeConn()
+		return err
+	}
+	return nil
+}
+
+// Close closes the connection to the server, if any
+func (c *NATSClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closeConn()
+}
+
+// connect dials the server, upgrades to TLS when required and introduces the client.
+// The caller holds the lock.
+func (c *NATSClient) connect(ctx context.Context) error {
+	host := c.addr.Hostname()
+	port := c.addr.Port()
+	if port == "" {
+		port = defaultNATSPort
+	}
+
+	dialer := &net.Dialer{Timeout: c.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(c.deadline(ctx))
+	reader := bufio.NewReader(conn)
+
+	// The server speaks first, describing itself
+	line, err := readLine(reader)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		conn.Close()
+		return fmt.Errorf("unexpected NATS greeting %q", line)
+	}
+	var info natsInfo
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "INFO ")), &info); err != nil {
+		conn.Close()
+		return err
+	}
+
+	if info.TLSRequired || c.addr.Scheme == "tls" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return err
+		}
+		conn = tlsConn
+		reader = bufio.NewReader(conn)
+	}
+
+	hello := natsConnect{Name: "urlshortener", Lang: "go", Version: "1.0", Protocol: 1}
+	if c.addr.User != nil {
+		if pass, ok := c.addr.User.Password(); ok {
+			hello.User, hello.Pass = c.addr.User.Username(), pass
+		} else {
+			hello.AuthToken = c.addr.User.Username()
+		}
+	}
+	connect, err := json.Marshal(hello)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	c.conn, c.reader, c.maxPayload = conn, reader, info.MaxPayload
+	if _, err := fmt.Fprintf(conn, "CONNECT %s\r\nPING\r\n", connect); err != nil {
+		c.closeConn()
+		return err
+	}
+	// A PONG means the server accepted the connection; a rejected one gets -ERR instead
+	if err := c.awaitPong(); err != nil {
+		c.closeConn()
+		return err
+	}
+	return nil
+}
+
+// awaitPong reads from the server until it answers the PING sent last, answering its own PINGs on the way.
+// The caller holds the lock.
+func (c *NATSClient) awaitPong() error {
+	for {
+		line, err := readLine(c.reader)
+		if err != nil {
+			return err
+		}
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := c.conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("NATS server error: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+		// +OK and updated INFO messages need no answer
+	}
+}
+
+// closeConn closes the connection so the next publish connects again. The caller holds the lock.
+func (c *NATSClient) closeConn() error {
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn, c.reader = nil, nil
+	return err
+}
+
+// deadline returns the deadline of an exchange with the server, the earlier of the timeout and that of ctx
+func (c *NATSClient) deadline(ctx context.Context) time.Time {
+	deadline := time.Now().Add(c.timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		return ctxDeadline
+	}
+	return deadline
+}
+
+// readLine reads a protocol line without its CRLF
+func readLine(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
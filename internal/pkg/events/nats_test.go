@@ -0,0 +1,186 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"urlshortener/internal/domain/models"
+)
+
+// natsMessage is a message published to the stand-in server
+type natsMessage struct {
+	subject string
+	payload string
+}
+
+// natsStandIn is an in-process server speaking the part of the NATS client protocol used to publish
+type natsStandIn struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	connects []natsConnect
+	messages []natsMessage
+	conns    []net.Conn
+
+	// denied subjects are refused with -ERR, as a server enforcing permissions does
+	denied string
+}
+
+func newNATSStandIn(t *testing.T) *natsStandIn {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	server := &natsStandIn{listener: listener}
+	go server.serve()
+	t.Cleanup(func() { listener.Close() })
+	return server
+}
+
+func (s *natsStandIn) url() string {
+	return "nats://" + s.listener.Addr().String()
+}
+
+func (s *natsStandIn) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns = append(s.conns, conn)
+		s.mu.Unlock()
+		go s.handle(conn)
+	}
+}
+
+func (s *natsStandIn) handle(conn net.Conn) {
+	defer conn.Close()
+	fmt.Fprintf(conn, "INFO {\"server_id\":\"stand-in\",\"max_payload\":1024}\r\n")
+
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := readLine(reader)
+		if err != nil {
+			return
+		}
+		verb, args, _ := strings.Cut(line, " ")
+		switch verb {
+		case "CONNECT":
+			var connect natsConnect
+			json.Unmarshal([]byte(args), &connect)
+			s.mu.Lock()
+			s.connects = append(s.connects, connect)
+			s.mu.Unlock()
+		case "PING":
+			// Ask the client for a PING of its own first, which it must answer
+			fmt.Fprintf(conn, "PING\r\nPONG\r\n")
+		case "PONG":
+		case "PUB":
+			fields := strings.Fields(args)
+			size, _ := strconv.Atoi(fields[len(fields)-1])
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(reader, payload); err != nil {
+				return
+			}
+			if fields[0] == s.denied {
+				fmt.Fprintf(conn, "-ERR 'Permissions Violation for Publish to %s'\r\n", fields[0])
+				continue
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, natsMessage{subject: fields[0], payload: string(payload[:size])})
+			s.mu.Unlock()
+		default:
+			fmt.Fprintf(conn, "-ERR 'Unknown Protocol Operation'\r\n")
+			return
+		}
+	}
+}
+
+// dropConnections closes the connections of every client, as a restarting server does
+func (s *natsStandIn) dropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+func (s *natsStandIn) published() []natsMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]natsMessage(nil), s.messages...)
+}
+
+func TestNATSClient_Publish(t *testing.T) {
+	ctx := context.Background()
+	server := newNATSStandIn(t)
+	addr := strings.TrimPrefix(server.url(), "nats://")
+
+	client, err := NewNATSClient("nats://events:s3cret@"+addr, time.Second)
+	assert.NoError(t, err)
+	defer client.Close()
+
+	sink := NewBrokerSink(client, "urlshortener")
+	event := models.Event{ID: "evt1", Type: models.EventLinkCreated, Data: map[string]string{"short_code": "abc123"}}
+	assert.NoError(t, sink.Emit(ctx, event))
+	assert.NoError(t, client.Publish(ctx, "urlshortener.link.clicked", []byte("second")))
+
+	// Publishing returns once the server has the message
+	messages := server.published()
+	assert.Len(t, messages, 2)
+	assert.Equal(t, "urlshortener.link.created", messages[0].subject)
+	assert.Contains(t, messages[0].payload, `"short_code":"abc123"`)
+	assert.Equal(t, natsMessage{subject: "urlshortener.link.clicked", payload: "second"}, messages[1])
+
+	server.mu.Lock()
+	assert.Len(t, server.connects, 1)
+	assert.Equal(t, "events", server.connects[0].User)
+	assert.Equal(t, "s3cret", server.connects[0].Pass)
+	assert.False(t, server.connects[0].Verbose)
+	server.mu.Unlock()
+}
+
+func TestNATSClient_Errors(t *testing.T) {
+	ctx := context.Background()
+	server := newNATSStandIn(t)
+	server.denied = "forbidden"
+
+	client, err := NewNATSClient(server.url(), time.Second)
+	assert.NoError(t, err)
+	defer client.Close()
+
+	assert.ErrorContains(t, client.Publish(ctx, "forbidden", []byte("x")), "Permissions Violation")
+	assert.Error(t, client.Publish(ctx, "has space", []byte("x")))
+	assert.ErrorContains(t, client.Publish(ctx, "large", make([]byte, 2048)), "exceeds")
+
+	// The client reconnects after the server dropped it
+	server.dropConnections()
+	assert.Error(t, client.Publish(ctx, "lost", []byte("x")))
+	assert.NoError(t, client.Publish(ctx, "again", []byte("x")))
+	assert.Equal(t, []natsMessage{{subject: "again", payload: "x"}}, server.published())
+
+	_, err = NewNATSClient("kafka://localhost:9092", 0)
+	assert.Error(t, err)
+}
+
+func TestNATSClient_Unavailable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := listener.Addr().String()
+	listener.Close()
+
+	client, err := NewNATSClient("nats://"+addr, time.Second)
+	assert.NoError(t, err)
+	assert.Error(t, client.Publish(context.Background(), "subject", []byte("x")))
+}
@@ -0,0 +1,120 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	log "go.uber.org/zap"
+	"time"
+	"urlshortener/internal/domain/models"
+	"urlshortener/internal/domain/repositories"
+	"urlshortener/pkg/logger"
+)
+
+const (
+	// relayPollInterval is how long the relay sleeps when every event is published
+	relayPollInterval = time.Second
+
+	// relayMinBackoff and relayMaxBackoff bound the wait before retrying after the sink failed,
+	// which doubles after every consecutive failure
+	relayMinBackoff = time.Second
+	relayMaxBackoff = time.Minute
+
+	// relayLease is how long an event stays claimed by a relay publishing it
+	relayLease = time.Minute
+)
+
+// OutboxSink stores every event in the outbox, from where a Relay publishes it to the actual sink.
+// Given the context of a transaction, the event is stored in that transaction.
+type OutboxSink struct {
+	outbox repositories.OutboxRepository
+	now    func() time.Time
+}
+
+// NewOutboxSink creates a new instance of OutboxSink
+func NewOutboxSink(outbox repositories.OutboxRepository) *OutboxSink {
+	return &OutboxSink{outbox: outbox, now: time.Now}
+}
+
+// Emit appends event to the outbox
+func (s *OutboxSink) Emit(ctx context.Context, event models.Event) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return err
+	}
+	return s.outbox.AppendEvent(ctx, &models.OutboxEvent{
+		EventID:    event.ID,
+		Type:       event.Type,
+		OccurredAt: event.OccurredAt,
+		Data:       string(data),
+		CreatedAt:  s.now(),
+	})
+}
+
+// Relay publishes the events of the outbox to a sink, oldest first, marking each published once the sink took it.
+// While the sink fails, events stay in the outbox and the relay retries with backoff, so none is lost.
+// An event may be published twice if the relay stops between publishing and marking it; consumers
+// deduplicate on the event ID.
+type Relay struct {
+	outbox repositories.OutboxRepository
+	sink   Sink
+	now    func() time.Time
+}
+
+// NewRelay creates a new instance of Relay publishing to sink
+func NewRelay(outbox repositories.OutboxRepository, sink Sink) *Relay {
+	return &Relay{outbox: outbox, sink: sink, now: time.Now}
+}
+
+// Run publishes the events of the outbox as they are appended until ctx is cancelled
+func (r *Relay) Run(ctx context.Context) {
+	backoff := relayMinBackoff
+	for {
+		wait := relayPollInterval
+		if _, err := r.PublishPending(ctx); err != nil {
+			logger.GetLogger().Error("failed to relay outbox events", log.Error(err), log.Duration("retry_in", backoff))
+			wait = backoff
+			backoff = min(2*backoff, relayMaxBackoff)
+		} else {
+			backoff = relayMinBackoff
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// PublishPending publishes the unpublished events of the outbox until none is left or the sink fails,
+// and returns how many were published
+func (r *Relay) PublishPending(ctx context.Context) (int, error) {
+	published := 0
+	for {
+		event, err := r.outbox.ClaimEvent(ctx, r.now(), relayLease)
+		if err != nil || event == nil {
+			return published, err
+		}
+
+		if err := r.sink.Emit(ctx, outboxToEvent(event)); err != nil {
+			if releaseErr := r.outbox.ReleaseEvent(ctx, event.ID, err.Error()); releaseErr != nil {
+				logger.GetLogger().Error("failed to release outbox event", log.String("event_id", event.EventID), log.Error(releaseErr))
+			}
+			return published, err
+		}
+		if err := r.outbox.MarkEventPublished(ctx, event.ID, r.now()); err != nil {
+			return published, err
+		}
+		published++
+	}
+}
+
+// outboxToEvent restores the event stored in the outbox, its data being the JSON stored
+func outboxToEvent(event *models.OutboxEvent) models.Event {
+	return models.Event{
+		ID:         event.EventID,
+		Type:       event.Type,
+		OccurredAt: event.OccurredAt,
+		Data:       json.RawMessage(event.Data),
+	}
+}
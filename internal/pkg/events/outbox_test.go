@@ -0,0 +1,154 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"urlshortener/internal/domain/models"
+	"urlshortener/internal/domain/repositories"
+)
+
+// fakeOutbox is an in-memory OutboxRepository
+type fakeOutbox struct {
+	mu     sync.Mutex
+	events []*models.OutboxEvent
+}
+
+func (o *fakeOutbox) AppendEvent(ctx context.Context, event *models.OutboxEvent) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	stored := *event
+	stored.ID = strconv.Itoa(len(o.events) + 1)
+	o.events = append(o.events, &stored)
+	return nil
+}
+
+func (o *fakeOutbox) ClaimEvent(ctx context.Context, now time.Time, lease time.Duration) (*models.OutboxEvent, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, event := range o.events {
+		if event.PublishedAt != nil || (event.LockedUntil != nil && event.LockedUntil.After(now)) {
+			continue
+		}
+		lockedUntil := now.Add(lease)
+		event.LockedUntil = &lockedUntil
+		claimed := *event
+		return &claimed, nil
+	}
+	return nil, nil
+}
+
+func (o *fakeOutbox) MarkEventPublished(ctx context.Context, id string, at time.Time) error {
+	return o.update(id, func(event *models.OutboxEvent) {
+		event.PublishedAt = &at
+		event.LockedUntil = nil
+	})
+}
+
+func (o *fakeOutbox) ReleaseEvent(ctx context.Context, id string, lastError string) error {
+	return o.update(id, func(event *models.OutboxEvent) {
+		event.Attempts++
+		event.LastError = lastError
+		event.LockedUntil = nil
+	})
+}
+
+func (o *fakeOutbox) update(id string, fn func(event *models.OutboxEvent)) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, event := range o.events {
+		if event.ID == id {
+			fn(event)
+			return nil
+		}
+	}
+	return repositories.ErrOutboxEventNotFound
+}
+
+// flakySink records the events emitted to it, failing with err if set
+type flakySink struct {
+	events []models.Event
+	err    error
+}
+
+func (s *flakySink) Emit(ctx context.Context, event models.Event) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.events = append(s.events, event)
+	return nil
+}
+
+func TestRelay_PublishPending(t *testing.T) {
+	outbox := &fakeOutbox{}
+	sink := &flakySink{err: errors.New("broker unavailable")}
+	relay := NewRelay(outbox, sink)
+	ctx := context.Background()
+
+	occurred := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	outboxSink := NewOutboxSink(outbox)
+	for _, id := range []string{"evt1", "evt2", "evt3"} {
+		event := models.Event{ID: id, Type: models.EventLinkCreated, OccurredAt: occurred, Data: map[string]string{"short_code": id}}
+		assert.NoError(t, outboxSink.Emit(ctx, event))
+	}
+
+	// While the sink is down, events stay in the outbox
+	published, err := relay.PublishPending(ctx)
+	assert.EqualError(t, err, "broker unavailable")
+	assert.Equal(t, 0, published)
+	assert.Equal(t, 1, outbox.events[0].Attempts)
+	assert.Equal(t, "broker unavailable", outbox.events[0].LastError)
+	assert.Nil(t, outbox.events[0].LockedUntil)
+
+	// Once it recovers, they are all published in order
+	sink.err = nil
+	published, err = relay.PublishPending(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, published)
+	assert.Len(t, sink.events, 3)
+	assert.True(t, sort.SliceIsSorted(sink.events, func(i, j int) bool { return sink.events[i].ID < sink.events[j].ID }))
+	assert.Equal(t, "evt1", sink.events[0].ID)
+	assert.Equal(t, occurred, sink.events[0].OccurredAt)
+	data, err := json.Marshal(sink.events[0].Data)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"short_code":"evt1"}`, string(data))
+
+	for _, event := range outbox.events {
+		assert.NotNil(t, event.PublishedAt)
+	}
+
+	published, err = relay.PublishPending(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, published)
+}
+
+func TestRelay_SkipsClaimedEvents(t *testing.T) {
+	outbox := &fakeOutbox{}
+	sink := &flakySink{}
+	relay := NewRelay(outbox, sink)
+	ctx := context.Background()
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	relay.now = func() time.Time { return now }
+
+	assert.NoError(t, NewOutboxSink(outbox).Emit(ctx, models.Event{ID: "evt1", Type: models.EventLinkDeleted}))
+
+	// An event claimed by another relay is left to it until its lease expires
+	_, err := outbox.ClaimEvent(ctx, now, relayLease)
+	assert.NoError(t, err)
+	published, err := relay.PublishPending(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, published)
+
+	now = now.Add(relayLease + time.Second)
+	published, err = relay.PublishPending(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, published)
+}
@@ -0,0 +1,104 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"urlshortener/internal/domain/models"
+)
+
+// Sink receives the domain events of short URLs
+type Sink interface {
+	Emit(ctx context.Context, event models.Event) error
+}
+
+// WriterSink writes every event to a writer as a line of JSON (NDJSON)
+type WriterSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterSink creates a new instance of WriterSink writing to w
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+// NewStdoutSink creates a WriterSink writing to the standard output
+func NewStdoutSink() *WriterSink {
+	return NewWriterSink(os.Stdout)
+}
+
+// Emit writes event as a single line, so lines from concurrent events never interleave
+func (s *WriterSink) Emit(ctx context.Context, event models.Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(line)
+	return err
+}
+
+// FileSink appends every event to a file as a line of JSON, syncing the file before Emit returns
+type FileSink struct {
+	*WriterSink
+	file *os.File
+}
+
+// OpenFileSink opens the file at path for appending, creating it if needed
+func OpenFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{WriterSink: NewWriterSink(file), file: file}, nil
+}
+
+// Emit appends event to the file and syncs it, so an event emitted is on disk
+func (s *FileSink) Emit(ctx context.Context, event models.Event) error {
+	if err := s.WriterSink.Emit(ctx, event); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+// Close closes the file
+func (s *FileSink) Close() error {
+	return s.file.Close()
+}
+
+// Publisher publishes a message on a subject of a message broker, returning once the broker has accepted it.
+// NATSClient is one; a Kafka producer publishing to the topic named by the subject is another.
+type Publisher interface {
+	Publish(ctx context.Context, subject string, payload []byte) error
+}
+
+// BrokerSink publishes every event to a message broker on a subject named after its type,
+// such as "urlshortener.link.created" for the prefix "urlshortener"
+type BrokerSink struct {
+	publisher Publisher
+	prefix    string
+}
+
+// NewBrokerSink creates a new instance of BrokerSink publishing with publisher on subjects starting with prefix
+func NewBrokerSink(publisher Publisher, prefix string) *BrokerSink {
+	return &BrokerSink{publisher: publisher, prefix: prefix}
+}
+
+// Emit publishes event as JSON on the subject of its type
+func (s *BrokerSink) Emit(ctx context.Context, event models.Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	subject := event.Type
+	if s.prefix != "" {
+		subject = s.prefix + "." + subject
+	}
+	return s.publisher.Publish(ctx, subject, payload)
+}
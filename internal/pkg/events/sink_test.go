@@ -0,0 +1,88 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"urlshortener/internal/domain/models"
+)
+
+// recordingPublisher records the messages published with it, failing with err if set
+type recordingPublisher struct {
+	subjects []string
+	payloads [][]byte
+	err      error
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, subject string, payload []byte) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.subjects = append(p.subjects, subject)
+	p.payloads = append(p.payloads, payload)
+	return nil
+}
+
+func TestWriterSink_Emit(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewWriterSink(&buf)
+	ctx := context.Background()
+
+	assert.NoError(t, sink.Emit(ctx, models.Event{ID: "evt1", Type: models.EventLinkCreated, Data: map[string]string{"short_code": "abc123"}}))
+	assert.NoError(t, sink.Emit(ctx, models.Event{ID: "evt2", Type: models.EventLinkDeleted}))
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	assert.Len(t, lines, 2)
+	var event models.Event
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &event))
+	assert.Equal(t, "evt1", event.ID)
+	assert.Equal(t, models.EventLinkCreated, event.Type)
+	assert.Contains(t, lines[1], `"id":"evt2"`)
+}
+
+func TestFileSink_Emit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+	ctx := context.Background()
+
+	sink, err := OpenFileSink(path)
+	assert.NoError(t, err)
+	assert.NoError(t, sink.Emit(ctx, models.Event{ID: "evt1", Type: models.EventLinkCreated}))
+	assert.NoError(t, sink.Close())
+
+	// Reopening appends to the events already written
+	sink, err = OpenFileSink(path)
+	assert.NoError(t, err)
+	assert.NoError(t, sink.Emit(ctx, models.Event{ID: "evt2", Type: models.EventLinkUpdated}))
+	assert.NoError(t, sink.Close())
+
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	assert.Len(t, lines, 2)
+	assert.Contains(t, lines[0], `"id":"evt1"`)
+	assert.Contains(t, lines[1], `"id":"evt2"`)
+
+	_, err = OpenFileSink(filepath.Join(t.TempDir(), "missing", "events.ndjson"))
+	assert.Error(t, err)
+}
+
+func TestBrokerSink_Emit(t *testing.T) {
+	publisher := &recordingPublisher{}
+	ctx := context.Background()
+
+	assert.NoError(t, NewBrokerSink(publisher, "urlshortener").Emit(ctx, models.Event{ID: "evt1", Type: models.EventLinkClicked}))
+	assert.NoError(t, NewBrokerSink(publisher, "").Emit(ctx, models.Event{ID: "evt2", Type: models.EventLinkDeleted}))
+	assert.Equal(t, []string{"urlshortener.link.clicked", "link.deleted"}, publisher.subjects)
+	assert.Contains(t, string(publisher.payloads[0]), `"id":"evt1"`)
+
+	publisher.err = errors.New("broker unavailable")
+	assert.EqualError(t, NewBrokerSink(publisher, "urlshortener").Emit(ctx, models.Event{Type: models.EventLinkCreated}), "broker unavailable")
+}
@@ -5,13 +5,20 @@ import (
 )
 
 const (
-	charset    = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	codeLength = 6
+	charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+	// DefaultLength is the length of the short codes generated by GenerateShortCode
+	DefaultLength = 6
 )
 
 // GenerateShortCode creates a random short code of a specified length using the defined character set.
 func GenerateShortCode() string {
-	code := make([]byte, codeLength)
+	return GenerateShortCodeOfLength(DefaultLength)
+}
+
+// GenerateShortCodeOfLength creates a random short code of the given length using the defined character set.
+func GenerateShortCodeOfLength(length int) string {
+	code := make([]byte, length)
 	for i := range code {
 		code[i] = charset[rand.Intn(len(charset))]
 	}
@@ -21,7 +28,7 @@ func GenerateShortCode() string {
 // GenerateShortCodeWithSeed creates a random short code using a local rando generator with a specified seed.
 func GenerateShortCodeWithSeed(seed int64) string {
 	rng := rand.New(rand.NewSource(seed))
-	code := make([]byte, codeLength)
+	code := make([]byte, DefaultLength)
 	for i := range code {
 		code[i] = charset[rng.Intn(len(charset))]
 	}
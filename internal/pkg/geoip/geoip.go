@@ -0,0 +1,51 @@
+package geoip
+
+import (
+	"github.com/oschwald/maxminddb-golang"
+	"net"
+)
+
+// CountryResolver resolves the country of an IP address
+type CountryResolver interface {
+	// Country returns the ISO 3166-1 alpha-2 code of the country of ip, or an empty string if unknown
+	Country(ip net.IP) string
+}
+
+// Reader resolves countries from a local MaxMind DB file such as GeoLite2-Country or GeoIP2-City
+type Reader struct {
+	db *maxminddb.Reader
+}
+
+// countryRecord is the part of a MaxMind DB record holding the country
+type countryRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+}
+
+// Open opens the MaxMind DB file at path
+func Open(path string) (*Reader, error) {
+	db, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{db: db}, nil
+}
+
+// Country returns the ISO country code of ip, or an empty string if the database has no entry for it
+func (r *Reader) Country(ip net.IP) string {
+	if ip == nil {
+		return ""
+	}
+
+	var record countryRecord
+	if err := r.db.Lookup(ip, &record); err != nil {
+		return ""
+	}
+	return record.Country.ISOCode
+}
+
+// Close releases the database file
+func (r *Reader) Close() error {
+	return r.db.Close()
+}
@@ -0,0 +1,290 @@
+package healthcheck
+
+import (
+	"context"
+	"fmt"
+	log "go.uber.org/zap"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+	"urlshortener/internal/domain/models"
+	"urlshortener/internal/domain/repositories"
+	"urlshortener/internal/pkg/ratelimit"
+	"urlshortener/internal/pkg/reqctx"
+	"urlshortener/internal/pkg/safedial"
+	"urlshortener/pkg/logger"
+)
+
+const (
+	// DefaultInterval is how long a check result stays fresh before the destination is checked again
+	DefaultInterval = time.Hour
+
+	// DefaultTimeout bounds a single check, including redirects
+	DefaultTimeout = 10 * time.Second
+
+	// DefaultConcurrency is how many destinations are checked at once
+	DefaultConcurrency = 8
+
+	// DefaultBatchSize is how many due destinations are loaded per round
+	DefaultBatchSize = 200
+
+	// DefaultHostLimit and DefaultHostWindow bound the checks sent to a single host
+	DefaultHostLimit  = 10
+	DefaultHostWindow = time.Minute
+
+	// DefaultFailureThreshold is how many consecutive failures mark a destination down
+	DefaultFailureThreshold = 2
+
+	// pollInterval is how long the checker sleeps when no destination is due
+	pollInterval = time.Minute
+
+	// maxRedirects bounds the redirects followed to reach a destination
+	maxRedirects = 10
+)
+
+// Options configures a Checker
+type Options struct {
+	// Interval is how long a check result stays fresh; zero uses DefaultInterval
+	Interval time.Duration
+
+	// Timeout bounds a single check; zero uses DefaultTimeout
+	Timeout time.Duration
+
+	// Concurrency and BatchSize bound the work of a round; zero uses the defaults
+	Concurrency int
+	BatchSize   int
+
+	// HostLimit checks are sent to a host every HostWindow at most; zero uses the defaults.
+	// Destinations over the limit are put off for a HostWindow, so those on other hosts are checked meanwhile.
+	HostLimit  int
+	HostWindow time.Duration
+
+	// FailureThreshold consecutive failed checks mark a destination down; zero uses DefaultFailureThreshold
+	FailureThreshold int
+
+	// AllowPrivateNetworks permits checking loopback and private addresses, as tests do
+	AllowPrivateNetworks bool
+}
+
+// Checker periodically checks that the destinations of short URLs still answer
+// and records the outcome on each URL
+type Checker struct {
+	repo   repositories.URLRepository
+	client *http.Client
+	hosts  *ratelimit.Limiter
+	opts   Options
+	now    func() time.Time
+}
+
+// NewChecker creates a new instance of Checker
+func NewChecker(repo repositories.URLRepository, opts Options) *Checker {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultInterval
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DefaultConcurrency
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if opts.HostLimit <= 0 {
+		opts.HostLimit = DefaultHostLimit
+	}
+	if opts.HostWindow <= 0 {
+		opts.HostWindow = DefaultHostWindow
+	}
+	if opts.FailureThreshold <= 0 {
+		opts.FailureThreshold = DefaultFailureThreshold
+	}
+
+	transport := &http.Transport{
+		// Ignore proxy settings from the environment, which would bypass the address checks of the dialer
+		Proxy:                 nil,
+		DialContext:           safedial.NewDialer(opts.Timeout, opts.AllowPrivateNetworks).DialContext,
+		TLSHandshakeTimeout:   opts.Timeout,
+		ResponseHeaderTimeout: opts.Timeout,
+		MaxIdleConnsPerHost:   2,
+		IdleConnTimeout:       time.Minute,
+	}
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   opts.Timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return nil
+		},
+	}
+
+	return &Checker{
+		repo:   repo,
+		client: client,
+		hosts:  ratelimit.NewLimiter(opts.HostLimit, opts.HostWindow),
+		opts:   opts,
+		now:    time.Now,
+	}
+}
+
+// Run checks due destinations until ctx is cancelled.
+// Rounds follow each other while destinations are due and are spaced by pollInterval otherwise.
+func (c *Checker) Run(ctx context.Context) {
+	for {
+		checked, deferred, err := c.checkDue(ctx)
+		if err != nil {
+			logger.GetLogger().Error("failed to load urls due for a health check", log.Error(err))
+		}
+		// Every destination of a round is checked or put off, so the next round loads others
+		if err == nil && checked+deferred > 0 {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// CheckDue runs a single round, checking the destinations whose latest check is older than the interval.
+// It returns how many destinations were checked.
+func (c *Checker) CheckDue(ctx context.Context) (int, error) {
+	checked, _, err := c.checkDue(ctx)
+	return checked, err
+}
+
+// checkDue runs a single round and returns how many destinations were checked and how many put off
+func (c *Checker) checkDue(ctx context.Context) (checked, deferred int, err error) {
+	urls, err := c.repo.ListURLsDueForCheck(ctx, c.now().Add(-c.opts.Interval), c.opts.BatchSize)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	slots := make(chan struct{}, c.opts.Concurrency)
+	for _, u := range urls {
+		target, err := url.Parse(u.OriginalURL)
+		if err != nil {
+			// The destination cannot be checked, so look at it again only once a check would be due anyway
+			c.deferCheck(ctx, u, c.opts.Interval)
+			deferred++
+			continue
+		}
+		if ok, retryAfter := c.hosts.Allow(target.Hostname()); !ok {
+			c.deferCheck(ctx, u, retryAfter)
+			deferred++
+			continue
+		}
+
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return checked, deferred, ctx.Err()
+		}
+
+		wg.Add(1)
+		go func(u *models.URL) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			c.checkURL(ctx, u)
+
+			mu.Lock()
+			checked++
+			mu.Unlock()
+		}(u)
+	}
+	wg.Wait()
+
+	return checked, deferred, nil
+}
+
+// deferCheck puts off the next check of the destination of u by delay, on the domain of u
+func (c *Checker) deferCheck(ctx context.Context, u *models.URL, delay time.Duration) {
+	ctx = reqctx.WithDomain(ctx, models.Domain{Host: u.Domain})
+	if err := c.repo.DeferURLCheck(ctx, u.ShortCode, c.now().Add(delay)); err != nil {
+		logger.GetLogger().Error("failed to put off url health check",
+			log.String("short_code", u.ShortCode),
+			log.Error(err),
+		)
+	}
+}
+
+// checkURL checks the destination of u and stores the outcome on the domain of u
+func (c *Checker) checkURL(ctx context.Context, u *models.URL) {
+	health := c.Check(ctx, u.OriginalURL, u.Health)
+
+	ctx = reqctx.WithDomain(ctx, models.Domain{Host: u.Domain})
+	if err := c.repo.UpdateURLHealth(ctx, u.ShortCode, u.OriginalURL, health); err != nil {
+		logger.GetLogger().Error("failed to store url health",
+			log.String("short_code", u.ShortCode),
+			log.Error(err),
+		)
+	}
+}
+
+// Check requests rawURL and returns its health, counting failures on from previous.
+// HEAD is tried first; destinations refusing it are requested again with GET.
+// A destination fails a check when it cannot be reached, is gone (404, 410) or errors (5xx).
+func (c *Checker) Check(ctx context.Context, rawURL string, previous *models.Health) *models.Health {
+	health := &models.Health{CheckedAt: c.now()}
+
+	start := time.Now()
+	status, err := c.request(ctx, http.MethodHead, rawURL)
+	if err == nil && (status == http.StatusMethodNotAllowed || status == http.StatusNotImplemented) {
+		start = time.Now()
+		status, err = c.request(ctx, http.MethodGet, rawURL)
+	}
+	health.LatencyMS = time.Since(start).Milliseconds()
+	health.StatusCode = status
+
+	failed := err != nil || status == http.StatusNotFound || status == http.StatusGone || status >= http.StatusInternalServerError
+	switch {
+	case err != nil:
+		health.Error = err.Error()
+	case failed:
+		health.Error = http.StatusText(status)
+	}
+
+	if failed {
+		health.ConsecutiveFailures = 1
+		if previous != nil {
+			health.ConsecutiveFailures = previous.ConsecutiveFailures + 1
+		}
+	}
+	health.Status = models.HealthStatusUp
+	if health.ConsecutiveFailures >= c.opts.FailureThreshold {
+		health.Status = models.HealthStatusDown
+	}
+	return health
+}
+
+// request sends a request without a body and returns the response status
+func (c *Checker) request(ctx context.Context, method, rawURL string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; urlshortener-healthcheck/1.0)")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// Drain a little of the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+	return resp.StatusCode, nil
+}
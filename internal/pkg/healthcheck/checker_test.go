@@ -0,0 +1,182 @@
+package healthcheck
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"urlshortener/internal/domain/models"
+	"urlshortener/internal/domain/repositories"
+	"urlshortener/internal/pkg/reqctx"
+)
+
+// fakeRepository serves due URLs and records stored health and checks put off, after which URLs are no longer due;
+// other repository methods are not used by the checker
+type fakeRepository struct {
+	repositories.URLRepository
+
+	due []*models.URL
+
+	mu       sync.Mutex
+	updates  map[string]*models.Health
+	domains  map[string]string
+	deferred map[string]time.Time
+}
+
+func (r *fakeRepository) ListURLsDueForCheck(ctx context.Context, checkedBefore time.Time, limit int) ([]*models.URL, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var due []*models.URL
+	for _, u := range r.due {
+		_, updated := r.updates[u.ShortCode]
+		_, deferred := r.deferred[u.ShortCode]
+		if !updated && !deferred && len(due) < limit {
+			due = append(due, u)
+		}
+	}
+	return due, nil
+}
+
+func (r *fakeRepository) DeferURLCheck(ctx context.Context, shortCode string, until time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deferred[shortCode] = until
+	return nil
+}
+
+func (r *fakeRepository) UpdateURLHealth(ctx context.Context, shortCode, originalURL string, health *models.Health) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.updates[shortCode] = health
+	r.domains[shortCode] = reqctx.Domain(ctx).Host
+	return nil
+}
+
+// newTestServer answers /ok, rejects HEAD on /get-only and fails /gone and /error
+func newTestServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/get-only", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/gone", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusGone)
+	})
+	mux.HandleFunc("/error", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// TestCheck tests classifying responses and counting consecutive failures
+func TestCheck(t *testing.T) {
+	server := newTestServer(t)
+	checker := NewChecker(nil, Options{AllowPrivateNetworks: true})
+	ctx := context.Background()
+
+	health := checker.Check(ctx, server.URL+"/ok", nil)
+	assert.Equal(t, models.HealthStatusUp, health.Status)
+	assert.Equal(t, http.StatusOK, health.StatusCode)
+	assert.Zero(t, health.ConsecutiveFailures)
+
+	health = checker.Check(ctx, server.URL+"/get-only", nil)
+	assert.Equal(t, http.StatusOK, health.StatusCode)
+
+	// A single failure is not enough to mark the destination down
+	health = checker.Check(ctx, server.URL+"/gone", nil)
+	assert.Equal(t, models.HealthStatusUp, health.Status)
+	assert.Equal(t, 1, health.ConsecutiveFailures)
+	assert.Equal(t, "Gone", health.Error)
+
+	health = checker.Check(ctx, server.URL+"/error", health)
+	assert.Equal(t, models.HealthStatusDown, health.Status)
+	assert.Equal(t, 2, health.ConsecutiveFailures)
+
+	health = checker.Check(ctx, server.URL+"/ok", health)
+	assert.Equal(t, models.HealthStatusUp, health.Status)
+	assert.Zero(t, health.ConsecutiveFailures)
+}
+
+// TestCheckRefusesPrivateAddresses tests that destinations on internal addresses fail without being requested
+func TestCheckRefusesPrivateAddresses(t *testing.T) {
+	server := newTestServer(t)
+	checker := NewChecker(nil, Options{})
+
+	health := checker.Check(context.Background(), server.URL+"/ok", nil)
+	assert.Zero(t, health.StatusCode)
+	assert.Contains(t, health.Error, "non-public address")
+}
+
+// TestCheckDue tests that a round stores health on the domain of each URL and respects the per-host limit
+func TestCheckDue(t *testing.T) {
+	server := newTestServer(t)
+	repo := &fakeRepository{
+		due: []*models.URL{
+			{ShortCode: "a", Domain: "acme.link", OriginalURL: server.URL + "/ok"},
+			{ShortCode: "b", Domain: "go.acme.com", OriginalURL: server.URL + "/gone"},
+			{ShortCode: "c", Domain: "acme.link", OriginalURL: server.URL + "/error"},
+		},
+		updates:  make(map[string]*models.Health),
+		domains:  make(map[string]string),
+		deferred: make(map[string]time.Time),
+	}
+	checker := NewChecker(repo, Options{AllowPrivateNetworks: true, HostLimit: 2})
+	now := time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+	checker.now = func() time.Time { return now }
+
+	checked, err := checker.CheckDue(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, checked)
+
+	assert.Equal(t, http.StatusOK, repo.updates["a"].StatusCode)
+	assert.Equal(t, http.StatusGone, repo.updates["b"].StatusCode)
+	assert.Equal(t, "go.acme.com", repo.domains["b"])
+	assert.NotContains(t, repo.updates, "c")
+	assert.True(t, repo.deferred["c"].After(now))
+}
+
+// TestCheckDueDefersBusyHosts tests that destinations over the per-host limit do not keep those on other hosts waiting
+func TestCheckDueDefersBusyHosts(t *testing.T) {
+	server := newTestServer(t)
+	busy := server.URL + "/ok"
+	other := strings.Replace(server.URL, "127.0.0.1", "localhost", 1) + "/ok"
+	repo := &fakeRepository{
+		due: []*models.URL{
+			{ShortCode: "a1", OriginalURL: busy},
+			{ShortCode: "a2", OriginalURL: busy},
+			{ShortCode: "a3", OriginalURL: busy},
+			{ShortCode: "bad", OriginalURL: "http://%zz"},
+			{ShortCode: "b", OriginalURL: other},
+		},
+		updates:  make(map[string]*models.Health),
+		domains:  make(map[string]string),
+		deferred: make(map[string]time.Time),
+	}
+	checker := NewChecker(repo, Options{AllowPrivateNetworks: true, HostLimit: 1, BatchSize: 2})
+
+	// Rounds follow each other as in Run until nothing is due
+	rounds := 0
+	for ; rounds < 10; rounds++ {
+		checked, deferred, err := checker.checkDue(context.Background())
+		assert.NoError(t, err)
+		if checked+deferred == 0 {
+			break
+		}
+	}
+
+	assert.Equal(t, 3, rounds)
+	assert.Contains(t, repo.updates, "a1")
+	assert.Contains(t, repo.updates, "b")
+	assert.Len(t, repo.deferred, 3)
+}
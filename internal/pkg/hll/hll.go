@@ -0,0 +1,222 @@
+package hll
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/bits"
+	"sort"
+)
+
+const (
+	// Precision is the number of hash bits selecting a register, giving a standard error of about 0.8%
+	Precision = 14
+
+	// registers is the number of registers of a dense sketch
+	registers = 1 << Precision
+
+	// sparseLimit is how many registers a sketch tracks sparsely before switching to a dense array,
+	// around where the sparse encoding stops being smaller than the dense one
+	sparseLimit = registers / 4
+
+	// linearCountingLimit is the estimate below which linear counting is more accurate than the raw estimate
+	linearCountingLimit = 11500
+
+	// maxRank is the highest rank a register can hold
+	maxRank = 64 - Precision + 1
+
+	// registerBits is the width of a register in the dense encoding
+	registerBits = 6
+
+	encodingVersion = 1
+	formatSparse    = 0
+	formatDense     = 1
+)
+
+// ErrInvalidSketch is returned when decoding data that does not hold a sketch
+var ErrInvalidSketch = errors.New("invalid hyperloglog sketch")
+
+// Sketch estimates the number of distinct 64-bit hashes added to it with HyperLogLog.
+// Sketches with few distinct hashes are kept sparse, so they stay small in memory and once encoded.
+// Hashes must be uniformly distributed, such as the output of a cryptographic hash.
+type Sketch struct {
+	sparse map[uint16]uint8
+	dense  []uint8
+}
+
+// New creates an empty sketch
+func New() *Sketch {
+	return &Sketch{sparse: make(map[uint16]uint8)}
+}
+
+// Add records a hash
+func (s *Sketch) Add(hash uint64) {
+	index := uint16(hash >> (64 - Precision))
+	// The guard bit bounds the rank when the remaining bits are all zero
+	rank := uint8(bits.LeadingZeros64(hash<<Precision|1<<(Precision-1)) + 1)
+	s.set(index, rank)
+}
+
+// set raises a register to rank
+func (s *Sketch) set(index uint16, rank uint8) {
+	if s.dense != nil {
+		if rank > s.dense[index] {
+			s.dense[index] = rank
+		}
+		return
+	}
+
+	if rank > s.sparse[index] {
+		s.sparse[index] = rank
+		if len(s.sparse) > sparseLimit {
+			s.densify()
+		}
+	}
+}
+
+// densify switches the sketch to a dense array of registers
+func (s *Sketch) densify() {
+	s.dense = make([]uint8, registers)
+	for index, rank := range s.sparse {
+		s.dense[index] = rank
+	}
+	s.sparse = nil
+}
+
+// Merge adds the hashes recorded by other, so the sketch estimates the union of both
+func (s *Sketch) Merge(other *Sketch) {
+	if other.dense != nil {
+		for index, rank := range other.dense {
+			if rank > 0 {
+				s.set(uint16(index), rank)
+			}
+		}
+		return
+	}
+	for index, rank := range other.sparse {
+		s.set(index, rank)
+	}
+}
+
+// Count returns the estimated number of distinct hashes added
+func (s *Sketch) Count() uint64 {
+	zeros := float64(registers)
+	sum := float64(registers)
+	visit := func(rank uint8) {
+		zeros--
+		sum += math.Ldexp(1, -int(rank)) - 1
+	}
+	if s.dense != nil {
+		for _, rank := range s.dense {
+			if rank > 0 {
+				visit(rank)
+			}
+		}
+	} else {
+		for _, rank := range s.sparse {
+			visit(rank)
+		}
+	}
+
+	if zeros > 0 {
+		if estimate := registers * math.Log(registers/zeros); estimate <= linearCountingLimit {
+			return uint64(math.Round(estimate))
+		}
+	}
+	alpha := 0.7213 / (1 + 1.079/registers)
+	return uint64(math.Round(alpha * registers * registers / sum))
+}
+
+// MarshalBinary encodes the sketch. Sparse sketches are encoded as the delta-encoded indexes of their
+// registers, dense sketches as packed 6-bit registers.
+func (s *Sketch) MarshalBinary() ([]byte, error) {
+	if s.dense != nil {
+		data := make([]byte, 3, 3+registers*registerBits/8)
+		data[0], data[1], data[2] = encodingVersion, Precision, formatDense
+		var acc uint32
+		var n uint
+		for _, rank := range s.dense {
+			acc = acc<<registerBits | uint32(rank)
+			n += registerBits
+			for n >= 8 {
+				n -= 8
+				data = append(data, byte(acc>>n))
+			}
+		}
+		return data, nil
+	}
+
+	indexes := make([]int, 0, len(s.sparse))
+	for index := range s.sparse {
+		indexes = append(indexes, int(index))
+	}
+	sort.Ints(indexes)
+
+	data := []byte{encodingVersion, Precision, formatSparse}
+	data = binary.AppendUvarint(data, uint64(len(indexes)))
+	previous := 0
+	for _, index := range indexes {
+		data = binary.AppendUvarint(data, uint64(index-previous))
+		data = append(data, s.sparse[uint16(index)])
+		previous = index
+	}
+	return data, nil
+}
+
+// UnmarshalBinary decodes a sketch encoded by MarshalBinary, replacing the content of s
+func (s *Sketch) UnmarshalBinary(data []byte) error {
+	if len(data) < 3 || data[0] != encodingVersion || data[1] != Precision {
+		return ErrInvalidSketch
+	}
+	format, data := data[2], data[3:]
+
+	switch format {
+	case formatDense:
+		if len(data) != registers*registerBits/8 {
+			return ErrInvalidSketch
+		}
+		dense := make([]uint8, registers)
+		var acc uint32
+		var n uint
+		index := 0
+		for _, b := range data {
+			acc = acc<<8 | uint32(b)
+			n += 8
+			for n >= registerBits {
+				n -= registerBits
+				dense[index] = uint8(acc>>n) & (1<<registerBits - 1)
+				index++
+			}
+		}
+		s.sparse, s.dense = nil, dense
+		return nil
+
+	case formatSparse:
+		count, read := binary.Uvarint(data)
+		if read <= 0 || count > sparseLimit {
+			return ErrInvalidSketch
+		}
+		data = data[read:]
+		sparse := make(map[uint16]uint8, count)
+		index := uint64(0)
+		for i := uint64(0); i < count; i++ {
+			delta, read := binary.Uvarint(data)
+			if read <= 0 || len(data) <= read {
+				return ErrInvalidSketch
+			}
+			index += delta
+			rank := data[read]
+			if index >= registers || rank == 0 || rank > maxRank {
+				return ErrInvalidSketch
+			}
+			sparse[uint16(index)] = rank
+			data = data[read+1:]
+		}
+		if len(data) != 0 {
+			return ErrInvalidSketch
+		}
+		s.sparse, s.dense = sparse, nil
+		return nil
+	}
+	return ErrInvalidSketch
+}
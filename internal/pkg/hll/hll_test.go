@@ -0,0 +1,112 @@
+package hll
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// hash returns a well distributed 64-bit hash of i
+func hash(i uint64) uint64 {
+	// splitmix64
+	z := i + 0x9e3779b97f4a7c15
+	z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+	z = (z ^ z>>27) * 0x94d049bb133111eb
+	return z ^ z>>31
+}
+
+// sketchOf returns a sketch of the hashes of [from, to)
+func sketchOf(from, to uint64) *Sketch {
+	s := New()
+	for i := from; i < to; i++ {
+		s.Add(hash(i))
+	}
+	return s
+}
+
+func TestSketch_Count(t *testing.T) {
+	tests := []struct {
+		name     string
+		distinct uint64
+	}{
+		{name: "Empty", distinct: 0},
+		{name: "Few", distinct: 100},
+		{name: "Sparse", distinct: 3000},
+		{name: "Dense", distinct: 50000},
+		{name: "Large", distinct: 1000000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := sketchOf(0, tt.distinct)
+
+			// Adding the same hashes again leaves the estimate unchanged
+			before := s.Count()
+			for i := uint64(0); i < tt.distinct && i < 1000; i++ {
+				s.Add(hash(i))
+			}
+			assert.Equal(t, before, s.Count())
+
+			assert.InDelta(t, float64(tt.distinct), float64(before), float64(tt.distinct)*0.03+1)
+		})
+	}
+}
+
+func TestSketch_Merge(t *testing.T) {
+	// Two overlapping sets, one sparse and one dense, whose union holds 60000 hashes
+	a := sketchOf(0, 2000)
+	b := sketchOf(1000, 60000)
+
+	a.Merge(b)
+
+	assert.InDelta(t, 60000, float64(a.Count()), 60000*0.03)
+	assert.Equal(t, sketchOf(0, 60000).Count(), a.Count())
+}
+
+func TestSketch_MarshalBinary(t *testing.T) {
+	for _, distinct := range []uint64{0, 500, 100000} {
+		s := sketchOf(0, distinct)
+
+		data, err := s.MarshalBinary()
+		assert.NoError(t, err)
+
+		decoded := New()
+		assert.NoError(t, decoded.UnmarshalBinary(data))
+		assert.Equal(t, s.Count(), decoded.Count())
+
+		// Decoded sketches keep counting where the original left off
+		decoded.Add(hash(distinct))
+		s.Add(hash(distinct))
+		assert.Equal(t, s.Count(), decoded.Count())
+	}
+
+	// Small sketches encode to a few bytes per visitor, large ones to a fixed size
+	small, _ := sketchOf(0, 100).MarshalBinary()
+	assert.Less(t, len(small), 400)
+	large, _ := sketchOf(0, 1000000).MarshalBinary()
+	assert.Equal(t, 3+registers*registerBits/8, len(large))
+}
+
+func TestSketch_UnmarshalBinaryInvalid(t *testing.T) {
+	valid, err := sketchOf(0, 10).MarshalBinary()
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "Empty", data: nil},
+		{name: "Unknown version", data: append([]byte{9}, valid[1:]...)},
+		{name: "Other precision", data: append([]byte{encodingVersion, 12}, valid[2:]...)},
+		{name: "Truncated", data: valid[:len(valid)-1]},
+		{name: "Trailing data", data: append(append([]byte{}, valid...), 0)},
+		{name: "Short dense", data: []byte{encodingVersion, Precision, formatDense, 0}},
+		{name: "Unknown format", data: []byte{encodingVersion, Precision, 7}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ErrorIs(t, New().UnmarshalBinary(tt.data), ErrInvalidSketch)
+		})
+	}
+}
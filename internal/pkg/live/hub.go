@@ -0,0 +1,146 @@
+package live
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"urlshortener/internal/domain/models"
+)
+
+const (
+	// DefaultBuffer is how many click events wait for a slow subscriber before further events are dropped
+	DefaultBuffer = 64
+
+	// DefaultMaxSubscribers bounds the streams open at once on an instance
+	DefaultMaxSubscribers = 1000
+)
+
+// ErrTooManySubscribers is returned when subscribing while the hub already serves its maximum of subscribers
+var ErrTooManySubscribers = errors.New("too many live subscribers")
+
+// Options configures a Hub
+type Options struct {
+	// Buffer is how many events are queued per subscriber; zero uses DefaultBuffer
+	Buffer int
+
+	// MaxSubscribers bounds the subscribers served at once; zero uses DefaultMaxSubscribers
+	MaxSubscribers int
+}
+
+// Hub fans the clicks published by the redirect path out to the subscribers of each link, in process.
+// Publishing never blocks: a subscriber whose queue is full misses events, but its running counters
+// still count them, so a slow consumer falls behind on details and never on totals.
+type Hub struct {
+	opts Options
+
+	mu          sync.RWMutex
+	subscribers map[models.LinkRef]map[*Subscription]struct{}
+	count       int
+}
+
+// NewHub creates a new instance of Hub
+func NewHub(opts Options) *Hub {
+	if opts.Buffer <= 0 {
+		opts.Buffer = DefaultBuffer
+	}
+	if opts.MaxSubscribers <= 0 {
+		opts.MaxSubscribers = DefaultMaxSubscribers
+	}
+	return &Hub{opts: opts, subscribers: make(map[models.LinkRef]map[*Subscription]struct{})}
+}
+
+// Subscribe starts receiving the clicks on link. The subscription must be closed once done.
+func (h *Hub) Subscribe(link models.LinkRef) (*Subscription, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.count >= h.opts.MaxSubscribers {
+		return nil, ErrTooManySubscribers
+	}
+
+	s := &Subscription{hub: h, link: link, events: make(chan models.ClickEvent, h.opts.Buffer)}
+	if h.subscribers[link] == nil {
+		h.subscribers[link] = make(map[*Subscription]struct{})
+	}
+	h.subscribers[link][s] = struct{}{}
+	h.count++
+	return s, nil
+}
+
+// Publish delivers a click to the subscribers of its link without waiting for any of them
+func (h *Hub) Publish(event models.ClickEvent) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for s := range h.subscribers[event.LinkRef] {
+		s.deliver(event)
+	}
+}
+
+// unsubscribe stops delivering events to s
+func (h *Hub) unsubscribe(s *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	subscribers, ok := h.subscribers[s.link]
+	if !ok {
+		return
+	}
+	if _, ok := subscribers[s]; !ok {
+		return
+	}
+	delete(subscribers, s)
+	if len(subscribers) == 0 {
+		delete(h.subscribers, s.link)
+	}
+	h.count--
+}
+
+// Subscription receives the clicks on a link published to a Hub
+type Subscription struct {
+	hub    *Hub
+	link   models.LinkRef
+	events chan models.ClickEvent
+
+	clicks    atomic.Int64
+	botClicks atomic.Int64
+	dropped   atomic.Int64
+	closeOnce sync.Once
+}
+
+// Events returns the channel of clicks on the link
+func (s *Subscription) Events() <-chan models.ClickEvent {
+	return s.events
+}
+
+// Counts returns the clicks by people and by bots published since the subscription started, delivered or not
+func (s *Subscription) Counts() (clicks, botClicks int64) {
+	return s.clicks.Load(), s.botClicks.Load()
+}
+
+// Dropped returns how many events were dropped because the subscriber was not keeping up
+func (s *Subscription) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// Close stops the subscription. The events channel is left open, since a publisher may still hold the subscription.
+func (s *Subscription) Close() {
+	s.closeOnce.Do(func() {
+		s.hub.unsubscribe(s)
+	})
+}
+
+// deliver counts an event and queues it, dropping it if the queue is full
+func (s *Subscription) deliver(event models.ClickEvent) {
+	if event.Bot {
+		s.botClicks.Add(1)
+	} else {
+		s.clicks.Add(1)
+	}
+
+	select {
+	case s.events <- event:
+	default:
+		s.dropped.Add(1)
+	}
+}
@@ -0,0 +1,115 @@
+package live
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"urlshortener/internal/domain/models"
+)
+
+func TestHub_Publish(t *testing.T) {
+	hub := NewHub(Options{})
+	link := models.LinkRef{Domain: "acme.link", ShortCode: "abc123"}
+	other := models.LinkRef{Domain: "acme.link", ShortCode: "xyz789"}
+
+	first, err := hub.Subscribe(link)
+	assert.NoError(t, err)
+	defer first.Close()
+	second, err := hub.Subscribe(link)
+	assert.NoError(t, err)
+	defer second.Close()
+
+	hub.Publish(models.ClickEvent{LinkRef: link, Referrer: "news.example.com"})
+	hub.Publish(models.ClickEvent{LinkRef: link, Bot: true})
+	hub.Publish(models.ClickEvent{LinkRef: other})
+
+	for _, sub := range []*Subscription{first, second} {
+		assert.Equal(t, "news.example.com", (<-sub.Events()).Referrer)
+		assert.True(t, (<-sub.Events()).Bot)
+		assert.Len(t, sub.Events(), 0)
+
+		clicks, botClicks := sub.Counts()
+		assert.Equal(t, int64(1), clicks)
+		assert.Equal(t, int64(1), botClicks)
+	}
+}
+
+func TestHub_SlowSubscriber(t *testing.T) {
+	hub := NewHub(Options{Buffer: 2})
+	link := models.LinkRef{Domain: "acme.link", ShortCode: "abc123"}
+
+	slow, _ := hub.Subscribe(link)
+	defer slow.Close()
+
+	// Publishing does not wait for a subscriber that stopped reading
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 10; i++ {
+			hub.Publish(models.ClickEvent{LinkRef: link})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("publish blocked on a slow subscriber")
+	}
+
+	// Missed events are reported and still counted
+	assert.Len(t, slow.Events(), 2)
+	assert.Equal(t, int64(8), slow.Dropped())
+	clicks, _ := slow.Counts()
+	assert.Equal(t, int64(10), clicks)
+}
+
+func TestHub_Close(t *testing.T) {
+	hub := NewHub(Options{MaxSubscribers: 1})
+	link := models.LinkRef{Domain: "acme.link", ShortCode: "abc123"}
+
+	sub, err := hub.Subscribe(link)
+	assert.NoError(t, err)
+
+	_, err = hub.Subscribe(link)
+	assert.True(t, errors.Is(err, ErrTooManySubscribers))
+
+	// Closing frees the slot and stops delivery, and may be repeated
+	sub.Close()
+	sub.Close()
+	hub.Publish(models.ClickEvent{LinkRef: link})
+	assert.Len(t, sub.Events(), 0)
+
+	again, err := hub.Subscribe(link)
+	assert.NoError(t, err)
+	again.Close()
+}
+
+func TestHub_Concurrent(t *testing.T) {
+	hub := NewHub(Options{Buffer: 1000})
+	link := models.LinkRef{Domain: "acme.link", ShortCode: "abc123"}
+
+	var wg sync.WaitGroup
+	subs := make([]*Subscription, 10)
+	for i := range subs {
+		subs[i], _ = hub.Subscribe(link)
+	}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				hub.Publish(models.ClickEvent{LinkRef: link})
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, sub := range subs {
+		clicks, _ := sub.Counts()
+		assert.Equal(t, int64(500), clicks)
+		sub.Close()
+	}
+}
@@ -0,0 +1,154 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"golang.org/x/net/html/charset"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"time"
+	"urlshortener/internal/domain/models"
+	"urlshortener/internal/pkg/safedial"
+)
+
+const (
+	// DefaultTimeout bounds a whole fetch, including robots.txt and redirects
+	DefaultTimeout = 10 * time.Second
+
+	// DefaultMaxBodySize bounds the part of a page that is read
+	DefaultMaxBodySize = 1 << 20
+
+	// maxRedirects bounds the redirects followed to reach a page
+	maxRedirects = 5
+
+	// agentToken identifies the fetcher in its User-Agent header and in robots.txt groups
+	agentToken = "urlshortener"
+)
+
+// ErrDisallowedByRobots is recorded when robots.txt of the destination forbids fetching it
+var ErrDisallowedByRobots = errors.New("disallowed by robots.txt")
+
+// Options configures a Fetcher
+type Options struct {
+	// Timeout bounds a whole fetch; zero uses DefaultTimeout
+	Timeout time.Duration
+
+	// MaxBodySize bounds the bytes read from a page; zero uses DefaultMaxBodySize
+	MaxBodySize int64
+
+	// AllowPrivateNetworks permits fetching from loopback and private addresses, as tests do
+	AllowPrivateNetworks bool
+}
+
+// Fetcher retrieves metadata describing the destination pages of URLs
+type Fetcher struct {
+	client      *http.Client
+	robots      *robotsCache
+	timeout     time.Duration
+	maxBodySize int64
+	now         func() time.Time
+}
+
+// NewFetcher creates a new instance of Fetcher
+func NewFetcher(opts Options) *Fetcher {
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = DefaultMaxBodySize
+	}
+
+	transport := &http.Transport{
+		// Ignore proxy settings from the environment, which would bypass the address checks of the dialer
+		Proxy:                 nil,
+		DialContext:           safedial.NewDialer(opts.Timeout, opts.AllowPrivateNetworks).DialContext,
+		TLSHandshakeTimeout:   opts.Timeout,
+		ResponseHeaderTimeout: opts.Timeout,
+		MaxIdleConnsPerHost:   2,
+		IdleConnTimeout:       time.Minute,
+	}
+	client := &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to unsupported scheme %q", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+
+	return &Fetcher{
+		client:      client,
+		robots:      newRobotsCache(client, agentToken),
+		timeout:     opts.Timeout,
+		maxBodySize: opts.MaxBodySize,
+		now:         time.Now,
+	}
+}
+
+// Fetch retrieves the page at rawURL and extracts its metadata.
+// It never fails: problems are recorded in the Error field of the result.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) *models.Metadata {
+	ctx, cancel := context.WithTimeout(ctx, f.timeout)
+	defer cancel()
+
+	metadata := &models.Metadata{FetchedAt: f.now()}
+
+	target, err := url.Parse(rawURL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") {
+		metadata.Error = "unsupported url"
+		return metadata
+	}
+	if !f.robots.allowed(ctx, target) {
+		metadata.Error = ErrDisallowedByRobots.Error()
+		return metadata
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		metadata.Error = err.Error()
+		return metadata
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; "+agentToken+"/1.0)")
+	req.Header.Set("Accept", "text/html,application/xhtml+xml;q=0.9,*/*;q=0.1")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		metadata.Error = err.Error()
+		return metadata
+	}
+	defer resp.Body.Close()
+
+	metadata.StatusCode = resp.StatusCode
+	metadata.FinalURL = resp.Request.URL.String()
+	if resp.StatusCode >= http.StatusBadRequest {
+		metadata.Error = resp.Status
+		return metadata
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		metadata.Error = "not an html page: " + mediaType
+		return metadata
+	}
+
+	// Decode pages in other character sets than UTF-8, as declared in the header or the document
+	body, err := charset.NewReader(io.LimitReader(resp.Body, f.maxBodySize), resp.Header.Get("Content-Type"))
+	if err != nil {
+		metadata.Error = err.Error()
+		return metadata
+	}
+
+	info := parseHead(body, resp.Request.URL)
+	metadata.Title = info.title
+	metadata.Description = info.description
+	metadata.Image = info.image
+	metadata.Favicon = info.favicon
+	return metadata
+}
@@ -0,0 +1,106 @@
+package metadata
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"urlshortener/internal/pkg/safedial"
+)
+
+const page = `<!DOCTYPE html>
+<html>
+<head>
+<title>
+  Spring   Sale
+</title>
+<meta name="description" content="Everything must go">
+<meta property="og:image" content="/images/sale.png">
+<link rel="shortcut icon" href="/static/icon.png">
+</head>
+<body><title>Not this one</title></body>
+</html>`
+
+// newTestServer serves page at /sale, a redirect to it at /old and the given robots.txt
+func newTestServer(t *testing.T, robots string) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		if robots == "" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(robots))
+	})
+	mux.HandleFunc("/sale", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(page))
+	})
+	mux.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/sale", http.StatusMovedPermanently)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// TestFetch tests extracting metadata from a page reached through a redirect
+func TestFetch(t *testing.T) {
+	server := newTestServer(t, "")
+	fetcher := NewFetcher(Options{AllowPrivateNetworks: true})
+
+	metadata := fetcher.Fetch(context.Background(), server.URL+"/old")
+
+	assert.Empty(t, metadata.Error)
+	assert.Equal(t, http.StatusOK, metadata.StatusCode)
+	assert.Equal(t, server.URL+"/sale", metadata.FinalURL)
+	assert.Equal(t, "Spring Sale", metadata.Title)
+	assert.Equal(t, "Everything must go", metadata.Description)
+	assert.Equal(t, server.URL+"/images/sale.png", metadata.Image)
+	assert.Equal(t, server.URL+"/static/icon.png", metadata.Favicon)
+	assert.False(t, metadata.FetchedAt.IsZero())
+}
+
+// TestFetchRespectsRobots tests that pages disallowed for the fetcher are not requested
+func TestFetchRespectsRobots(t *testing.T) {
+	server := newTestServer(t, "User-agent: *\nAllow: /\n\nUser-agent: urlshortener\nDisallow: /sale\n")
+	fetcher := NewFetcher(Options{AllowPrivateNetworks: true})
+
+	metadata := fetcher.Fetch(context.Background(), server.URL+"/sale")
+
+	assert.Equal(t, ErrDisallowedByRobots.Error(), metadata.Error)
+	assert.Zero(t, metadata.StatusCode)
+}
+
+// TestFetchRefusesPrivateAddresses tests that the dialer refuses internal addresses by default
+func TestFetchRefusesPrivateAddresses(t *testing.T) {
+	server := newTestServer(t, "")
+	fetcher := NewFetcher(Options{})
+
+	metadata := fetcher.Fetch(context.Background(), server.URL+"/sale")
+
+	assert.Contains(t, metadata.Error, safedial.ErrForbiddenAddress.Error())
+	assert.Empty(t, metadata.Title)
+}
+
+// TestParseRobots tests group selection and longest-match evaluation of robots.txt rules
+func TestParseRobots(t *testing.T) {
+	robots := `
+User-agent: googlebot
+User-agent: *
+Disallow: /private
+Allow: /private/public
+Disallow: /*.pdf$
+`
+	rules := parseRobots(strings.NewReader(robots), agentToken)
+
+	assert.True(t, evaluateRobots(rules, "/"))
+	assert.False(t, evaluateRobots(rules, "/private/data"))
+	assert.True(t, evaluateRobots(rules, "/private/public/page"))
+	assert.False(t, evaluateRobots(rules, "/files/report.pdf"))
+	assert.True(t, evaluateRobots(rules, "/files/report.pdf?download=1"))
+}
@@ -0,0 +1,147 @@
+package metadata
+
+import (
+	"golang.org/x/net/html"
+	"io"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// maxTitleLength and maxDescriptionLength bound the stored text, in characters
+	maxTitleLength       = 300
+	maxDescriptionLength = 1000
+)
+
+// pageInfo holds what was found in the head of an HTML document
+type pageInfo struct {
+	title, description     string
+	ogTitle, ogDescription string
+	image, favicon         string
+}
+
+// parseHead reads the title, description, OpenGraph image and icon from the head of an HTML document.
+// Relative URLs are resolved against base.
+func parseHead(r io.Reader, base *url.URL) pageInfo {
+	var info pageInfo
+	tokenizer := html.NewTokenizer(r)
+	inTitle := false
+
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return info.finish(base)
+		case html.TextToken:
+			if inTitle && info.title == "" {
+				info.title = string(tokenizer.Text())
+			}
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = false
+			case "head":
+				return info.finish(base)
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttrs := tokenizer.TagName()
+			attrs := map[string]string{}
+			for hasAttrs {
+				var key, value []byte
+				key, value, hasAttrs = tokenizer.TagAttr()
+				attrs[string(key)] = string(value)
+			}
+
+			switch string(name) {
+			case "title":
+				inTitle = true
+			case "meta":
+				info.readMeta(attrs)
+			case "link":
+				if info.favicon == "" && isIconRel(attrs["rel"]) {
+					info.favicon = attrs["href"]
+				}
+			case "body":
+				// Metadata belongs in the head, so stop at the body of documents that omit </head>
+				return info.finish(base)
+			}
+		}
+	}
+}
+
+// readMeta records the description and OpenGraph properties carried by a meta tag
+func (info *pageInfo) readMeta(attrs map[string]string) {
+	content := attrs["content"]
+	switch strings.ToLower(attrs["name"]) {
+	case "description":
+		info.description = content
+	}
+	switch strings.ToLower(attrs["property"]) {
+	case "og:title":
+		info.ogTitle = content
+	case "og:description":
+		info.ogDescription = content
+	case "og:image", "og:image:url", "og:image:secure_url":
+		if info.image == "" {
+			info.image = content
+		}
+	}
+}
+
+// finish prefers the document's own title and description over the OpenGraph ones,
+// normalises whitespace and resolves URLs
+func (info pageInfo) finish(base *url.URL) pageInfo {
+	if strings.TrimSpace(info.title) == "" {
+		info.title = info.ogTitle
+	}
+	if strings.TrimSpace(info.description) == "" {
+		info.description = info.ogDescription
+	}
+	info.title = truncate(collapseSpace(info.title), maxTitleLength)
+	info.description = truncate(collapseSpace(info.description), maxDescriptionLength)
+
+	// Browsers look for /favicon.ico when a page declares no icon
+	if info.favicon == "" {
+		info.favicon = "/favicon.ico"
+	}
+	info.image = resolve(base, info.image)
+	info.favicon = resolve(base, info.favicon)
+	return info
+}
+
+// isIconRel reports whether a link rel attribute names an icon
+func isIconRel(rel string) bool {
+	for _, value := range strings.Fields(strings.ToLower(rel)) {
+		if value == "icon" || value == "apple-touch-icon" {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve makes ref absolute against base, dropping references that are not http(s) URLs
+func resolve(base *url.URL, ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return ""
+	}
+	parsed, err := base.Parse(ref)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return ""
+	}
+	return parsed.String()
+}
+
+// collapseSpace trims s and replaces runs of whitespace with single spaces
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// truncate shortens s to at most n characters
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
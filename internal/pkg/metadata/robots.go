@@ -0,0 +1,186 @@
+package metadata
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"urlshortener/internal/pkg/metrics"
+)
+
+const (
+	// robotsTTL is how long the robots.txt of a host is cached
+	robotsTTL = time.Hour
+
+	// maxRobotsSize bounds the part of a robots.txt file that is read
+	maxRobotsSize = 64 << 10
+)
+
+// robotsRule allows or disallows paths matching a pattern
+type robotsRule struct {
+	pattern string
+	match   *regexp.Regexp
+	allow   bool
+}
+
+// robotsEntry is the cached robots.txt policy of a host
+type robotsEntry struct {
+	rules   []robotsRule
+	expires time.Time
+}
+
+// robotsCache fetches and caches the robots.txt policies that apply to the fetcher
+type robotsCache struct {
+	client  *http.Client
+	agent   string
+	mu      sync.Mutex
+	entries map[string]robotsEntry
+}
+
+// newRobotsCache creates a cache applying the rules for the given user agent product token
+func newRobotsCache(client *http.Client, agent string) *robotsCache {
+	return &robotsCache{
+		client:  client,
+		agent:   strings.ToLower(agent),
+		entries: make(map[string]robotsEntry),
+	}
+}
+
+// allowed reports whether robots.txt of the host of target permits fetching it.
+// Hosts whose robots.txt is missing or cannot be read allow everything.
+func (c *robotsCache) allowed(ctx context.Context, target *url.URL) bool {
+	origin := target.Scheme + "://" + target.Host
+
+	c.mu.Lock()
+	entry, ok := c.entries[origin]
+	c.mu.Unlock()
+
+	fresh := ok && !time.Now().After(entry.expires)
+	metrics.CacheLookup("robots", fresh)
+	if !fresh {
+		entry = robotsEntry{rules: c.fetch(ctx, origin), expires: time.Now().Add(robotsTTL)}
+		c.mu.Lock()
+		c.entries[origin] = entry
+		c.mu.Unlock()
+	}
+
+	path := target.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if target.RawQuery != "" {
+		path += "?" + target.RawQuery
+	}
+	return evaluateRobots(entry.rules, path)
+}
+
+// fetch retrieves the rules of the robots.txt at origin that apply to the fetcher
+func (c *robotsCache) fetch(ctx context.Context, origin string) []robotsRule {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, origin+"/robots.txt", nil)
+	if err != nil {
+		return nil
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil
+	}
+	return parseRobots(io.LimitReader(resp.Body, maxRobotsSize), c.agent)
+}
+
+// parseRobots returns the rules of the group matching agent, falling back to the group for all agents
+func parseRobots(r io.Reader, agent string) []robotsRule {
+	var (
+		specific, wildcard []robotsRule
+		matchesAgent       bool
+		matchesWildcard    bool
+		foundSpecific      bool
+		inAgents           bool
+	)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		field, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		field = strings.ToLower(strings.TrimSpace(field))
+		value = strings.TrimSpace(value)
+
+		switch field {
+		case "user-agent":
+			// Consecutive user-agent lines share the group that follows them
+			if !inAgents {
+				matchesAgent, matchesWildcard = false, false
+				inAgents = true
+			}
+			name := strings.ToLower(value)
+			if name == "*" {
+				matchesWildcard = true
+			} else if name != "" && strings.Contains(agent, name) {
+				matchesAgent = true
+				foundSpecific = true
+			}
+		case "allow", "disallow":
+			inAgents = false
+			// An empty disallow permits everything and adds no rule
+			if value == "" {
+				continue
+			}
+			rule := robotsRule{pattern: value, match: compileRobotsPattern(value), allow: field == "allow"}
+			if matchesAgent {
+				specific = append(specific, rule)
+			}
+			if matchesWildcard {
+				wildcard = append(wildcard, rule)
+			}
+		default:
+			inAgents = false
+		}
+	}
+
+	if foundSpecific {
+		return specific
+	}
+	return wildcard
+}
+
+// evaluateRobots applies the most specific (longest) matching rule to path; allow wins ties
+func evaluateRobots(rules []robotsRule, path string) bool {
+	allowed, longest := true, -1
+	for _, rule := range rules {
+		if !rule.match.MatchString(path) {
+			continue
+		}
+		if len(rule.pattern) > longest || (len(rule.pattern) == longest && rule.allow) {
+			allowed, longest = rule.allow, len(rule.pattern)
+		}
+	}
+	return allowed
+}
+
+// compileRobotsPattern turns a robots.txt path pattern into a regular expression. '*' matches any
+// sequence of characters and a trailing '$' anchors the end of the path; patterns otherwise match as prefixes.
+func compileRobotsPattern(pattern string) *regexp.Regexp {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+
+	expr := "^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*")
+	if anchored {
+		expr += "$"
+	}
+	return regexp.MustCompile(expr)
+}
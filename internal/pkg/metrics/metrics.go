@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+)
+
+// Redirect outcomes counted by Redirects
+const (
+	OutcomeHit      = "hit"
+	OutcomeMiss     = "miss"
+	OutcomeExpired  = "expired"
+	OutcomeInactive = "inactive"
+	OutcomeLocked   = "locked"
+	OutcomeRefused  = "refused"
+	OutcomeError    = "error"
+)
+
+// Registry is the registry the metrics of the application and the statistics of the Go runtime and the process
+// are registered with and served from
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+var (
+	// HTTPRequests counts the requests served, by route template, such as "/shorten/{shortCode}"
+	HTTPRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "urlshortener_http_requests_total",
+		Help: "HTTP requests served, by route template, method and status.",
+	}, []string{"route", "method", "status"})
+
+	// HTTPRequestDuration observes how long requests took to serve
+	HTTPRequestDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "urlshortener_http_request_duration_seconds",
+		Help:    "Time taken to serve HTTP requests, by route template, method and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	// Redirects counts the short URLs followed, by outcome
+	Redirects = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "urlshortener_redirects_total",
+		Help: "Short URLs followed, by outcome: hit, miss, expired, inactive, locked, refused or error.",
+	}, []string{"outcome"})
+
+	// RepositoryDuration observes how long database operations took, by collection and command
+	RepositoryDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "urlshortener_repository_operation_duration_seconds",
+		Help:    "Time taken by database operations, by collection and operation.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"collection", "operation"})
+
+	// RepositoryErrors counts the database operations that failed
+	RepositoryErrors = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "urlshortener_repository_operation_errors_total",
+		Help: "Database operations that failed, by collection and operation.",
+	}, []string{"collection", "operation"})
+
+	// CacheRequests counts cache lookups, by cache and result, hit or miss
+	CacheRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "urlshortener_cache_requests_total",
+		Help: "Cache lookups, by cache and result: hit or miss.",
+	}, []string{"cache", "result"})
+
+	// IdempotentReplays counts the retries answered with the stored response of an Idempotency-Key
+	IdempotentReplays = factory.NewCounter(prometheus.CounterOpts{
+		Name: "urlshortener_idempotent_replays_total",
+		Help: "Requests answered with the stored response of their Idempotency-Key.",
+	})
+
+	// CodeCollisions counts the generated short codes that were already taken, each making the generator retry
+	CodeCollisions = factory.NewCounter(prometheus.CounterOpts{
+		Name: "urlshortener_short_code_collisions_total",
+		Help: "Generated short codes found already taken on their domain.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// CacheLookup counts a lookup of the named cache as a hit or a miss
+func CacheLookup(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	CacheRequests.WithLabelValues(cache, result).Inc()
+}
+
+// Handler returns a handler serving the metrics of the application
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
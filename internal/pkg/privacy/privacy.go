@@ -0,0 +1,116 @@
+package privacy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// IPMode selects how client IP addresses are anonymised before they are stored or logged
+type IPMode string
+
+const (
+	// IPModeNone keeps addresses as they are
+	IPModeNone IPMode = "none"
+
+	// IPModeTruncate zeroes the host part of addresses, keeping the /24 of IPv4 and the /48 of IPv6 addresses
+	IPModeTruncate IPMode = "truncate"
+
+	// IPModeHash replaces addresses by a hash salted with the current rotating salt
+	IPModeHash IPMode = "hash"
+)
+
+const (
+	// ipv4PrefixBits and ipv6PrefixBits are the network prefixes kept by IPModeTruncate
+	ipv4PrefixBits = 24
+	ipv6PrefixBits = 48
+
+	// hashedIPLength is the number of hex digits kept of a hashed address
+	hashedIPLength = 16
+)
+
+// Options configures an Anonymizer
+type Options struct {
+	// IPMode selects how addresses are anonymised; empty uses IPModeTruncate
+	IPMode IPMode
+
+	// Secret derives the salts of visitor and address hashes
+	Secret []byte
+
+	// SaltRotation is how often salts change, aligned on the Unix epoch so a 24 hour rotation changes
+	// at midnight UTC. Hashes from different periods cannot be linked. Zero uses Secret as a fixed salt.
+	SaltRotation time.Duration
+}
+
+// Anonymizer strips identifying details of visitors before anything about them is persisted.
+// A nil Anonymizer keeps addresses as they are and salts nothing.
+type Anonymizer struct {
+	opts Options
+}
+
+// NewAnonymizer creates a new instance of Anonymizer
+func NewAnonymizer(opts Options) (*Anonymizer, error) {
+	switch opts.IPMode {
+	case "":
+		opts.IPMode = IPModeTruncate
+	case IPModeNone, IPModeTruncate, IPModeHash:
+	default:
+		return nil, fmt.Errorf("unknown ip anonymisation mode %q", opts.IPMode)
+	}
+	if opts.SaltRotation < 0 {
+		return nil, errors.New("salt rotation must not be negative")
+	}
+	return &Anonymizer{opts: opts}, nil
+}
+
+// Salt returns the salt in effect at the given time
+func (a *Anonymizer) Salt(at time.Time) []byte {
+	if a == nil {
+		return nil
+	}
+	if a.opts.SaltRotation <= 0 {
+		return a.opts.Secret
+	}
+
+	period := make([]byte, 8)
+	binary.BigEndian.PutUint64(period, uint64(at.UnixNano()/int64(a.opts.SaltRotation)))
+	mac := hmac.New(sha256.New, a.opts.Secret)
+	mac.Write(period)
+	return mac.Sum(nil)
+}
+
+// IP anonymises a client address seen at the given time according to the configured mode.
+// Values that are not IP addresses are returned empty unless the mode keeps addresses.
+func (a *Anonymizer) IP(ip string, at time.Time) string {
+	if a == nil || a.opts.IPMode == IPModeNone || ip == "" {
+		return ip
+	}
+
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+
+	if a.opts.IPMode == IPModeHash {
+		mac := hmac.New(sha256.New, a.Salt(at))
+		mac.Write(parsed)
+		return hex.EncodeToString(mac.Sum(nil))[:hashedIPLength]
+	}
+
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(ipv4PrefixBits, 32)).String()
+	}
+	return parsed.Mask(net.CIDRMask(ipv6PrefixBits, 128)).String()
+}
+
+// DoNotTrack reports whether a request asks not to be tracked, through the DNT or Sec-GPC header
+func DoNotTrack(header http.Header) bool {
+	return strings.TrimSpace(header.Get("DNT")) == "1" || strings.TrimSpace(header.Get("Sec-GPC")) == "1"
+}
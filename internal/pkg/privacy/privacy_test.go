@@ -0,0 +1,81 @@
+package privacy
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnonymizer_IP(t *testing.T) {
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	truncate, err := NewAnonymizer(Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, "192.0.2.0", truncate.IP("192.0.2.123", now))
+	assert.Equal(t, "2001:db8:85a3::", truncate.IP("2001:db8:85a3:8d3:1319:8a2e:370:7348", now))
+	assert.Equal(t, "", truncate.IP("not-an-ip", now))
+	assert.Equal(t, "", truncate.IP("", now))
+
+	none, err := NewAnonymizer(Options{IPMode: IPModeNone})
+	assert.NoError(t, err)
+	assert.Equal(t, "192.0.2.123", none.IP("192.0.2.123", now))
+
+	hash, err := NewAnonymizer(Options{IPMode: IPModeHash, Secret: []byte("secret"), SaltRotation: 24 * time.Hour})
+	assert.NoError(t, err)
+	hashed := hash.IP("192.0.2.123", now)
+	assert.Len(t, hashed, hashedIPLength)
+	assert.NotContains(t, hashed, "192")
+	assert.Equal(t, hashed, hash.IP("192.0.2.123", now.Add(time.Hour)))
+	assert.NotEqual(t, hashed, hash.IP("192.0.2.124", now))
+
+	// Once the salt rotates the same address can no longer be linked
+	assert.NotEqual(t, hashed, hash.IP("192.0.2.123", now.Add(24*time.Hour)))
+
+	var disabled *Anonymizer
+	assert.Equal(t, "192.0.2.123", disabled.IP("192.0.2.123", now))
+	assert.Nil(t, disabled.Salt(now))
+
+	_, err = NewAnonymizer(Options{IPMode: "scramble"})
+	assert.Error(t, err)
+}
+
+func TestAnonymizer_Salt(t *testing.T) {
+	midnight := time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC)
+
+	fixed, _ := NewAnonymizer(Options{Secret: []byte("secret")})
+	assert.Equal(t, []byte("secret"), fixed.Salt(midnight))
+	assert.Equal(t, []byte("secret"), fixed.Salt(midnight.AddDate(1, 0, 0)))
+
+	daily, _ := NewAnonymizer(Options{Secret: []byte("secret"), SaltRotation: 24 * time.Hour})
+	assert.Equal(t, daily.Salt(midnight), daily.Salt(midnight.Add(23*time.Hour)))
+	assert.NotEqual(t, daily.Salt(midnight), daily.Salt(midnight.Add(-time.Nanosecond)))
+	assert.NotEqual(t, []byte("secret"), daily.Salt(midnight))
+
+	other, _ := NewAnonymizer(Options{Secret: []byte("other"), SaltRotation: 24 * time.Hour})
+	assert.NotEqual(t, daily.Salt(midnight), other.Salt(midnight))
+}
+
+func TestDoNotTrack(t *testing.T) {
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		expected bool
+	}{
+		{name: "No headers", expected: false},
+		{name: "DNT", headers: map[string]string{"DNT": "1"}, expected: true},
+		{name: "DNT unset", headers: map[string]string{"DNT": "0"}, expected: false},
+		{name: "Global Privacy Control", headers: map[string]string{"Sec-GPC": "1"}, expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			for key, value := range tt.headers {
+				header.Set(key, value)
+			}
+			assert.Equal(t, tt.expected, DoNotTrack(header))
+		})
+	}
+}
@@ -0,0 +1,263 @@
+package qr
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/skip2/go-qrcode"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	"image/png"
+	"os"
+	"strings"
+)
+
+// Level is the error correction level of a QR code; higher levels survive more damage, such as an embedded logo
+type Level string
+
+const (
+	LevelLow      Level = "L"
+	LevelMedium   Level = "M"
+	LevelQuartile Level = "Q"
+	LevelHigh     Level = "H"
+)
+
+// logoRatio is the share of the code's width an embedded logo may cover,
+// small enough for high error correction to restore the hidden modules
+const logoRatio = 0.22
+
+// ErrSizeTooSmall is returned when the requested size cannot fit one pixel per module
+var ErrSizeTooSmall = errors.New("size too small for the content")
+
+// Options controls how a QR code is rendered
+type Options struct {
+	// Size is the width and height of the image in pixels
+	Size int
+
+	// Margin is the width of the quiet zone around the code, in modules
+	Margin int
+
+	Level      Level
+	Foreground color.NRGBA
+	Background color.NRGBA
+
+	// Logo, if set, is drawn over the centre of the code
+	Logo image.Image
+}
+
+// recoveryLevels maps levels to their go-qrcode equivalents
+var recoveryLevels = map[Level]qrcode.RecoveryLevel{
+	LevelLow:      qrcode.Low,
+	LevelMedium:   qrcode.Medium,
+	LevelQuartile: qrcode.High,
+	LevelHigh:     qrcode.Highest,
+}
+
+// LoadLogo reads a PNG or JPEG image to embed in QR codes
+func LoadLogo(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	logo, _, err := image.Decode(f)
+	return logo, err
+}
+
+// ParseLevel parses an error correction level, ignoring case
+func ParseLevel(s string) (Level, error) {
+	level := Level(strings.ToUpper(s))
+	if _, ok := recoveryLevels[level]; !ok {
+		return "", fmt.Errorf("unknown error correction level %q", s)
+	}
+	return level, nil
+}
+
+// ParseColor parses a colour written as six or eight hexadecimal digits (RGB or RGBA), with an optional leading '#'
+func ParseColor(s string) (color.NRGBA, error) {
+	s = strings.TrimPrefix(s, "#")
+	var r, g, b, a uint8 = 0, 0, 0, 0xff
+
+	var err error
+	switch len(s) {
+	case 6:
+		_, err = fmt.Sscanf(s, "%02x%02x%02x", &r, &g, &b)
+	case 8:
+		_, err = fmt.Sscanf(s, "%02x%02x%02x%02x", &r, &g, &b, &a)
+	default:
+		err = errors.New("wrong length")
+	}
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("invalid colour %q", s)
+	}
+	return color.NRGBA{R: r, G: g, B: b, A: a}, nil
+}
+
+// layout is the placement of the modules of a code in an image
+type layout struct {
+	modules [][]bool
+	scale   int
+	offset  int
+}
+
+// newLayout encodes content and fits its modules, including the margin, into opts.Size pixels
+func newLayout(content string, opts Options) (*layout, error) {
+	code, err := qrcode.New(content, recoveryLevels[opts.Level])
+	if err != nil {
+		return nil, err
+	}
+	code.DisableBorder = true
+	modules := code.Bitmap()
+
+	total := len(modules) + 2*opts.Margin
+	scale := opts.Size / total
+	if scale < 1 {
+		return nil, ErrSizeTooSmall
+	}
+
+	return &layout{
+		modules: modules,
+		scale:   scale,
+		// Center the code when the size is not a multiple of the module count
+		offset: (opts.Size-total*scale)/2 + opts.Margin*scale,
+	}, nil
+}
+
+// logoBox returns the square in the centre of the image covered by a logo of the given size
+func logoBox(size int) image.Rectangle {
+	side := int(float64(size) * logoRatio)
+	corner := (size - side) / 2
+	return image.Rect(corner, corner, corner+side, corner+side)
+}
+
+// PNG renders content as a QR code in PNG format
+func PNG(content string, opts Options) ([]byte, error) {
+	l, err := newLayout(content, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, opts.Size, opts.Size))
+	fill(img, img.Bounds(), opts.Background)
+	for y, row := range l.modules {
+		for x, dark := range row {
+			if dark {
+				corner := image.Pt(l.offset+x*l.scale, l.offset+y*l.scale)
+				fill(img, image.Rectangle{Min: corner, Max: corner.Add(image.Pt(l.scale, l.scale))}, opts.Foreground)
+			}
+		}
+	}
+
+	if opts.Logo != nil {
+		box := logoBox(opts.Size)
+		fill(img, box, opts.Background)
+		drawScaled(img, box.Inset(box.Dx()/10), opts.Logo)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// SVG renders content as a QR code in SVG format
+func SVG(content string, opts Options) ([]byte, error) {
+	l, err := newLayout(content, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		opts.Size, opts.Size, opts.Size, opts.Size)
+	fmt.Fprintf(&buf, `<rect width="100%%" height="100%%" %s/>`, svgFill(opts.Background))
+
+	// Draw all dark modules as a single path of unit squares scaled into place
+	fmt.Fprintf(&buf, `<path transform="translate(%d %d) scale(%d)" %s d="`, l.offset, l.offset, l.scale, svgFill(opts.Foreground))
+	for y, row := range l.modules {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&buf, "M%d %dh1v1h-1z", x, y)
+			}
+		}
+	}
+	buf.WriteString(`"/>`)
+
+	if opts.Logo != nil {
+		logo, err := logoDataURI(opts.Logo)
+		if err != nil {
+			return nil, err
+		}
+		box := logoBox(opts.Size)
+		inner := box.Inset(box.Dx() / 10)
+		fmt.Fprintf(&buf, `<rect x="%d" y="%d" width="%d" height="%d" %s/>`, box.Min.X, box.Min.Y, box.Dx(), box.Dy(), svgFill(opts.Background))
+		fmt.Fprintf(&buf, `<image x="%d" y="%d" width="%d" height="%d" href="%s"/>`, inner.Min.X, inner.Min.Y, inner.Dx(), inner.Dy(), logo)
+	}
+
+	buf.WriteString(`</svg>`)
+	return buf.Bytes(), nil
+}
+
+// fill paints a rectangle of img in a solid colour
+func fill(img *image.RGBA, r image.Rectangle, c color.NRGBA) {
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			img.Set(x, y, c)
+		}
+	}
+}
+
+// drawScaled draws src into dst, scaled to fit r with its aspect ratio kept, blending over what is already there
+func drawScaled(dst *image.RGBA, r image.Rectangle, src image.Image) {
+	bounds := src.Bounds()
+	if bounds.Empty() || r.Empty() {
+		return
+	}
+
+	// Fit the longer side of the logo into the box and center the other
+	scale := float64(r.Dx()) / float64(max(bounds.Dx(), bounds.Dy()))
+	w, h := int(float64(bounds.Dx())*scale), int(float64(bounds.Dy())*scale)
+	origin := r.Min.Add(image.Pt((r.Dx()-w)/2, (r.Dy()-h)/2))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			sx := bounds.Min.X + int(float64(x)/scale)
+			sy := bounds.Min.Y + int(float64(y)/scale)
+			sr, sg, sb, sa := src.At(sx, sy).RGBA()
+			d := dst.RGBAAt(origin.X+x, origin.Y+y)
+
+			// Source-over compositing of premultiplied colours
+			blend := func(s uint32, d uint8) uint8 {
+				return uint8((s + uint32(d)*257*(0xffff-sa)/0xffff) >> 8)
+			}
+			dst.SetRGBA(origin.X+x, origin.Y+y, color.RGBA{
+				R: blend(sr, d.R),
+				G: blend(sg, d.G),
+				B: blend(sb, d.B),
+				A: blend(sa, d.A),
+			})
+		}
+	}
+}
+
+// svgFill returns the fill attributes painting an SVG shape in c
+func svgFill(c color.NRGBA) string {
+	attrs := fmt.Sprintf(`fill="#%02x%02x%02x"`, c.R, c.G, c.B)
+	if c.A != 0xff {
+		attrs += fmt.Sprintf(` fill-opacity="%.3f"`, float64(c.A)/0xff)
+	}
+	return attrs
+}
+
+// logoDataURI encodes a logo as a PNG data URI for embedding in an SVG
+func logoDataURI(logo image.Image) (string, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, logo); err != nil {
+		return "", err
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
@@ -0,0 +1,72 @@
+package qr
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	black = color.NRGBA{A: 0xff}
+	white = color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+)
+
+// TestPNG tests the size, margin and colours of a rendered PNG
+func TestPNG(t *testing.T) {
+	data, err := PNG("https://go.acme.com/abc123", Options{Size: 300, Margin: 4, Level: LevelMedium, Foreground: black, Background: white})
+	assert.NoError(t, err)
+
+	img, err := png.Decode(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 300, 300), img.Bounds())
+
+	// A version 2 code has 25 modules, so 33 with the margin, drawn 9 pixels each and centred
+	offset := (300-33*9)/2 + 4*9
+	assert.Equal(t, color.RGBAModel.Convert(white), color.RGBAModel.Convert(img.At(offset-1, offset-1)))
+	// The top left finder pattern starts with a dark module
+	assert.Equal(t, color.RGBAModel.Convert(black), color.RGBAModel.Convert(img.At(offset, offset)))
+}
+
+// TestSVG tests that an SVG is rendered with the requested colours and logo
+func TestSVG(t *testing.T) {
+	logo := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	data, err := SVG("https://go.acme.com/abc123", Options{Size: 256, Margin: 2, Level: LevelHigh, Foreground: color.NRGBA{R: 0x11, G: 0x22, B: 0x33, A: 0xff}, Background: white, Logo: logo})
+	assert.NoError(t, err)
+
+	svg := string(data)
+	assert.True(t, strings.HasPrefix(svg, `<svg xmlns="http://www.w3.org/2000/svg" width="256" height="256"`))
+	assert.Contains(t, svg, `fill="#112233"`)
+	assert.Contains(t, svg, `href="data:image/png;base64,`)
+}
+
+// TestSizeTooSmall tests that a size below one pixel per module is rejected
+func TestSizeTooSmall(t *testing.T) {
+	_, err := PNG("https://go.acme.com/abc123", Options{Size: 20, Margin: 4, Level: LevelMedium})
+	assert.ErrorIs(t, err, ErrSizeTooSmall)
+}
+
+// TestParseColorAndLevel tests parsing colours and error correction levels from query parameters
+func TestParseColorAndLevel(t *testing.T) {
+	c, err := ParseColor("#ff8000")
+	assert.NoError(t, err)
+	assert.Equal(t, color.NRGBA{R: 0xff, G: 0x80, A: 0xff}, c)
+
+	c, err = ParseColor("ffffff80")
+	assert.NoError(t, err)
+	assert.Equal(t, color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0x80}, c)
+
+	_, err = ParseColor("fff")
+	assert.Error(t, err)
+
+	level, err := ParseLevel("q")
+	assert.NoError(t, err)
+	assert.Equal(t, LevelQuartile, level)
+
+	_, err = ParseLevel("X")
+	assert.Error(t, err)
+}
@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter allows a fixed number of events per key within a time window
+type Limiter struct {
+	mu       sync.Mutex
+	limit    int
+	window   time.Duration
+	now      func() time.Time
+	counters map[string]*counter
+
+	// nextEviction is when expired counters are next dropped, once per window rather than on every event
+	nextEviction time.Time
+}
+
+// counter tracks the events of a single key in its current window
+type counter struct {
+	count int
+	reset time.Time
+}
+
+// NewLimiter creates a new instance of Limiter allowing limit events per key every window
+func NewLimiter(limit int, window time.Duration) *Limiter {
+	return &Limiter{
+		limit:    limit,
+		window:   window,
+		now:      time.Now,
+		counters: make(map[string]*counter),
+	}
+}
+
+// Allow records an event for key and reports whether it is within the limit.
+// When it is not, the returned duration is the time until the window resets.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if !now.Before(l.nextEviction) {
+		l.evictExpired(now)
+		l.nextEviction = now.Add(l.window)
+	}
+
+	c, ok := l.counters[key]
+	if !ok || !now.Before(c.reset) {
+		c = &counter{reset: now.Add(l.window)}
+		l.counters[key] = c
+	}
+
+	if c.count >= l.limit {
+		return false, c.reset.Sub(now)
+	}
+	c.count++
+	return true, 0
+}
+
+// evictExpired drops counters whose window has passed so the map does not grow without bound.
+// Counters live at most one window, so sweeping once per window keeps at most two windows of keys.
+func (l *Limiter) evictExpired(now time.Time) {
+	for key, c := range l.counters {
+		if !now.Before(c.reset) {
+			delete(l.counters, key)
+		}
+	}
+}
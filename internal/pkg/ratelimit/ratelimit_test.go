@@ -0,0 +1,58 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestLimiter_Allow tests that a key is limited within its window and released afterwards
+func TestLimiter_Allow(t *testing.T) {
+	now := time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+	limiter := NewLimiter(2, time.Minute)
+	limiter.now = func() time.Time { return now }
+
+	allowed, _ := limiter.Allow("abc123|192.0.2.1")
+	assert.True(t, allowed)
+	allowed, _ = limiter.Allow("abc123|192.0.2.1")
+	assert.True(t, allowed)
+
+	allowed, retryAfter := limiter.Allow("abc123|192.0.2.1")
+	assert.False(t, allowed)
+	assert.Equal(t, time.Minute, retryAfter)
+
+	// Other keys have their own budget
+	allowed, _ = limiter.Allow("abc123|192.0.2.2")
+	assert.True(t, allowed)
+
+	now = now.Add(time.Minute)
+	allowed, _ = limiter.Allow("abc123|192.0.2.1")
+	assert.True(t, allowed)
+}
+
+// TestLimiter_Eviction tests that expired counters are dropped once per window rather than on every event
+func TestLimiter_Eviction(t *testing.T) {
+	now := time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+	limiter := NewLimiter(1, time.Minute)
+	limiter.now = func() time.Time { return now }
+
+	// Sweeps are due a minute after the first event, then every minute after the previous sweep
+	limiter.Allow("a")
+	now = now.Add(10 * time.Second)
+	limiter.Allow("b")
+	now = now.Add(55 * time.Second)
+	limiter.Allow("c")
+	assert.Len(t, limiter.counters, 2)
+
+	// The counter of b has expired but is kept until the next sweep, and starts over when used
+	now = now.Add(15 * time.Second)
+	limiter.Allow("d")
+	assert.Len(t, limiter.counters, 3)
+	allowed, _ := limiter.Allow("b")
+	assert.True(t, allowed)
+
+	now = now.Add(2 * time.Minute)
+	limiter.Allow("e")
+	assert.Len(t, limiter.counters, 1)
+}
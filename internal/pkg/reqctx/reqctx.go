@@ -0,0 +1,52 @@
+package reqctx
+
+import (
+	"context"
+	"urlshortener/internal/domain/models"
+)
+
+// AnonymousActor is used when a request does not identify its caller
+const AnonymousActor = "anonymous"
+
+type contextKey int
+
+const (
+	actorKey contextKey = iota
+	requestIDKey
+	domainKey
+)
+
+// WithActor returns a copy of ctx carrying the identity of the caller
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey, actor)
+}
+
+// Actor returns the caller identity stored in ctx, or AnonymousActor if none is set
+func Actor(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey).(string); ok && actor != "" {
+		return actor
+	}
+	return AnonymousActor
+}
+
+// WithRequestID returns a copy of ctx carrying the request ID
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey, requestID)
+}
+
+// RequestID returns the request ID stored in ctx, or an empty string if none is set
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey).(string)
+	return requestID
+}
+
+// WithDomain returns a copy of ctx scoped to the domain whose short codes the request addresses
+func WithDomain(ctx context.Context, domain models.Domain) context.Context {
+	return context.WithValue(ctx, domainKey, domain)
+}
+
+// Domain returns the domain stored in ctx, or the zero Domain standing for the unbranded default if none is set
+func Domain(ctx context.Context) models.Domain {
+	domain, _ := ctx.Value(domainKey).(models.Domain)
+	return domain
+}
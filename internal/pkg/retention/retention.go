@@ -0,0 +1,157 @@
+package retention
+
+import (
+	"context"
+	log "go.uber.org/zap"
+	"sort"
+	"time"
+	"urlshortener/internal/domain/models"
+	"urlshortener/internal/domain/repositories"
+	"urlshortener/pkg/logger"
+)
+
+const (
+	// DefaultRetention is how long raw clicks are kept before they are rolled up
+	DefaultRetention = 90 * 24 * time.Hour
+
+	// runInterval is how often the job looks for days past retention
+	runInterval = time.Hour
+)
+
+// Job rolls up the raw clicks of the click log into daily rollups per link once they are past retention,
+// then deletes them. Statistics keep counting rolled up clicks, but nothing identifying visitors is kept.
+type Job struct {
+	clicks    repositories.ClickRepository
+	retention time.Duration
+	now       func() time.Time
+}
+
+// NewJob creates a new instance of Job keeping raw clicks for retention, or DefaultRetention if zero
+func NewJob(clicks repositories.ClickRepository, retention time.Duration) *Job {
+	if retention <= 0 {
+		retention = DefaultRetention
+	}
+	return &Job{clicks: clicks, retention: retention, now: time.Now}
+}
+
+// Run rolls up the clicks past retention every hour until ctx is cancelled
+func (j *Job) Run(ctx context.Context) {
+	for {
+		if _, err := j.RollUp(ctx); err != nil {
+			logger.GetLogger().Error("failed to roll up expired clicks", log.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(runInterval):
+		}
+	}
+}
+
+// RollUp rolls up and deletes the raw clicks of every whole UTC day past retention, oldest first,
+// and returns how many days were rolled up. A day interrupted before its clicks are deleted is rolled up
+// again by the next run, replacing its rollups.
+func (j *Job) RollUp(ctx context.Context) (int, error) {
+	cutoff := startOfDay(j.now().Add(-j.retention))
+
+	first, err := j.clicks.FirstClickAt(ctx)
+	if err != nil || first == nil {
+		return 0, err
+	}
+
+	days := 0
+	for day := startOfDay(*first); day.Before(cutoff); day = day.AddDate(0, 0, 1) {
+		if err := ctx.Err(); err != nil {
+			return days, err
+		}
+		if err := j.rollUpDay(ctx, day); err != nil {
+			return days, err
+		}
+		days++
+	}
+	return days, nil
+}
+
+// rollup accumulates the clicks on a link during a day
+type rollup struct {
+	clicks    int64
+	botClicks int64
+	visitors  map[string]bool
+	referrers map[string]int64
+}
+
+// rollUpDay rolls up the raw clicks of the day starting at day, then deletes them
+func (j *Job) rollUpDay(ctx context.Context, day time.Time) error {
+	next := day.AddDate(0, 0, 1)
+
+	links := make(map[models.LinkRef]*rollup)
+	err := j.clicks.ListClicks(ctx, day, next, func(click *models.Click) error {
+		link := models.LinkRef{Domain: click.Domain, ShortCode: click.ShortCode}
+		r, ok := links[link]
+		if !ok {
+			r = &rollup{visitors: make(map[string]bool), referrers: make(map[string]int64)}
+			links[link] = r
+		}
+
+		// Bots are counted apart and left out of the breakdowns, as in summaries of raw clicks
+		if click.Bot {
+			r.botClicks++
+			return nil
+		}
+		r.clicks++
+		r.visitors[click.VisitorHash] = true
+		r.referrers[click.Referrer]++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	rollups := make([]*models.ClickRollup, 0, len(links))
+	for link, r := range links {
+		rollups = append(rollups, &models.ClickRollup{
+			LinkRef:   link,
+			Day:       day.Format(models.DayLayout),
+			Clicks:    r.clicks,
+			Uniques:   int64(len(r.visitors)),
+			BotClicks: r.botClicks,
+			Referrers: referrerCounts(r.referrers),
+		})
+	}
+	if err := j.clicks.SaveClickRollups(ctx, rollups); err != nil {
+		return err
+	}
+
+	deleted, err := j.clicks.DeleteClicks(ctx, day, next)
+	if err != nil {
+		return err
+	}
+
+	logger.GetLogger().Info("rolled up expired clicks",
+		log.String("day", day.Format(models.DayLayout)),
+		log.Int("links", len(rollups)),
+		log.Int64("deleted", deleted),
+	)
+	return nil
+}
+
+// referrerCounts lists the clicks per referrer, most clicks first
+func referrerCounts(referrers map[string]int64) []models.ReferrerCount {
+	counts := make([]models.ReferrerCount, 0, len(referrers))
+	for referrer, clicks := range referrers {
+		counts = append(counts, models.ReferrerCount{Referrer: referrer, Clicks: clicks})
+	}
+	sort.Slice(counts, func(i, k int) bool {
+		if counts[i].Clicks != counts[k].Clicks {
+			return counts[i].Clicks > counts[k].Clicks
+		}
+		return counts[i].Referrer < counts[k].Referrer
+	})
+	return counts
+}
+
+// startOfDay returns the start of the UTC day of t
+func startOfDay(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
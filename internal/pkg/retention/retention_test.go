@@ -0,0 +1,153 @@
+package retention
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"urlshortener/internal/domain/models"
+)
+
+// fakeClickRepository keeps raw clicks and rollups in memory
+type fakeClickRepository struct {
+	mu      sync.Mutex
+	clicks  []*models.Click
+	rollups map[string]*models.ClickRollup
+}
+
+func newFakeClickRepository(clicks ...*models.Click) *fakeClickRepository {
+	return &fakeClickRepository{clicks: clicks, rollups: make(map[string]*models.ClickRollup)}
+}
+
+func (r *fakeClickRepository) RecordClick(ctx context.Context, click *models.Click) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.clicks = append(r.clicks, click)
+	return nil
+}
+
+func (r *fakeClickRepository) SummarizeClicks(ctx context.Context, query models.ClickQuery) (*models.ClickSummary, error) {
+	return &models.ClickSummary{}, nil
+}
+
+func (r *fakeClickRepository) FirstClickAt(ctx context.Context) (*time.Time, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var first *time.Time
+	for _, click := range r.clicks {
+		if first == nil || click.ClickedAt.Before(*first) {
+			at := click.ClickedAt
+			first = &at
+		}
+	}
+	return first, nil
+}
+
+func (r *fakeClickRepository) ListClicks(ctx context.Context, from, to time.Time, fn func(click *models.Click) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, click := range r.clicks {
+		if !click.ClickedAt.Before(from) && click.ClickedAt.Before(to) {
+			if err := fn(click); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *fakeClickRepository) DeleteClicks(ctx context.Context, from, to time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := r.clicks[:0]
+	for _, click := range r.clicks {
+		if click.ClickedAt.Before(from) || !click.ClickedAt.Before(to) {
+			kept = append(kept, click)
+		}
+	}
+	deleted := int64(len(r.clicks) - len(kept))
+	r.clicks = kept
+	return deleted, nil
+}
+
+func (r *fakeClickRepository) SaveClickRollups(ctx context.Context, rollups []*models.ClickRollup) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, rollup := range rollups {
+		r.rollups[rollup.Domain+"/"+rollup.ShortCode+"/"+rollup.Day] = rollup
+	}
+	return nil
+}
+
+func (r *fakeClickRepository) EraseClicks(ctx context.Context, links []models.LinkRef) (int64, error) {
+	return 0, nil
+}
+
+func click(shortCode, visitor, referrer string, bot bool, at time.Time) *models.Click {
+	return &models.Click{
+		Domain:      "acme.link",
+		ShortCode:   shortCode,
+		VisitorHash: visitor,
+		Referrer:    referrer,
+		Bot:         bot,
+		ClickedAt:   at,
+	}
+}
+
+func TestJob_RollUp(t *testing.T) {
+	now := time.Date(2024, 6, 10, 15, 0, 0, 0, time.UTC)
+	expired := time.Date(2024, 6, 1, 9, 0, 0, 0, time.UTC)
+	recent := time.Date(2024, 6, 9, 9, 0, 0, 0, time.UTC)
+
+	repo := newFakeClickRepository(
+		click("abc123", "v1", "news.example.com", false, expired),
+		click("abc123", "v1", "news.example.com", false, expired.Add(time.Hour)),
+		click("abc123", "v2", "", false, expired.Add(2*time.Hour)),
+		click("abc123", "", "", true, expired.Add(3*time.Hour)),
+		click("xyz789", "v3", "", false, expired.AddDate(0, 0, 1)),
+		click("abc123", "v1", "", false, recent),
+	)
+
+	job := NewJob(repo, 7*24*time.Hour)
+	job.now = func() time.Time { return now }
+
+	days, err := job.RollUp(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, days)
+
+	// Raw clicks within retention are kept as they are
+	assert.Len(t, repo.clicks, 1)
+	assert.Equal(t, recent, repo.clicks[0].ClickedAt)
+
+	assert.Len(t, repo.rollups, 2)
+	assert.Equal(t, &models.ClickRollup{
+		LinkRef:   models.LinkRef{Domain: "acme.link", ShortCode: "abc123"},
+		Day:       "2024-06-01",
+		Clicks:    3,
+		Uniques:   2,
+		BotClicks: 1,
+		Referrers: []models.ReferrerCount{{Referrer: "news.example.com", Clicks: 2}, {Referrer: "", Clicks: 1}},
+	}, repo.rollups["acme.link/abc123/2024-06-01"])
+	assert.Equal(t, int64(1), repo.rollups["acme.link/xyz789/2024-06-02"].Clicks)
+
+	// Running again finds nothing left past retention
+	days, err = job.RollUp(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, days)
+}
+
+func TestJob_RollUpEmptyLog(t *testing.T) {
+	job := NewJob(newFakeClickRepository(), 0)
+
+	days, err := job.RollUp(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, days)
+	assert.Equal(t, DefaultRetention, job.retention)
+}
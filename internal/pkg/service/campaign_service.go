@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"time"
+	"urlshortener/internal/domain/models"
+	"urlshortener/internal/domain/repositories"
+	"urlshortener/internal/pkg/reqctx"
+)
+
+// CampaignService provides methods to manage campaigns and report on their member URLs
+type CampaignService struct {
+	campaigns repositories.CampaignRepository
+	urls      repositories.URLRepository
+	clicks    repositories.ClickRepository
+	now       func() time.Time
+}
+
+// NewCampaignService creates a new instance of CampaignService
+func NewCampaignService(campaigns repositories.CampaignRepository, urls repositories.URLRepository, clicks repositories.ClickRepository) *CampaignService {
+	return &CampaignService{campaigns: campaigns, urls: urls, clicks: clicks, now: time.Now}
+}
+
+// CreateCampaign stores a new campaign, owned by the caller unless an owner is given
+func (s *CampaignService) CreateCampaign(ctx context.Context, campaign *models.Campaign) error {
+	campaign.ID = ""
+	if actor := reqctx.Actor(ctx); campaign.Owner == "" && actor != reqctx.AnonymousActor {
+		campaign.Owner = actor
+	}
+	campaign.CreatedAt = s.now()
+	campaign.UpdatedAt = campaign.CreatedAt
+	return s.campaigns.CreateCampaign(ctx, campaign)
+}
+
+// GetCampaign retrieves a campaign by its ID
+func (s *CampaignService) GetCampaign(ctx context.Context, id string) (*models.Campaign, error) {
+	return s.campaigns.GetCampaign(ctx, id)
+}
+
+// ListCampaigns retrieves the campaigns of an owner, or every campaign if owner is empty
+func (s *CampaignService) ListCampaigns(ctx context.Context, owner string) ([]*models.Campaign, error) {
+	return s.campaigns.ListCampaigns(ctx, owner)
+}
+
+// UpdateCampaign replaces the settings of an existing campaign.
+// Changed UTM defaults apply to URLs assigned afterwards; current members keep their UTM values.
+func (s *CampaignService) UpdateCampaign(ctx context.Context, id string, update *models.Campaign) (*models.Campaign, error) {
+	campaign, err := s.campaigns.GetCampaign(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	campaign.Name = update.Name
+	campaign.Owner = update.Owner
+	campaign.StartsAt = update.StartsAt
+	campaign.EndsAt = update.EndsAt
+	campaign.UTM = update.UTM
+	campaign.UpdatedAt = s.now()
+
+	if err := s.campaigns.UpdateCampaign(ctx, campaign); err != nil {
+		return nil, err
+	}
+	return campaign, nil
+}
+
+// DeleteCampaign removes a campaign and takes its member URLs out of it
+func (s *CampaignService) DeleteCampaign(ctx context.Context, id string) error {
+	if err := s.campaigns.DeleteCampaign(ctx, id); err != nil {
+		return err
+	}
+	return s.urls.ClearCampaign(ctx, id)
+}
+
+// GetCampaignStats aggregates the clicks, unique visitors and referrers of the member URLs of a campaign
+// from the click log, counting the clicks made during the period of the campaign.
+// Members without clicks are reported with zero counts.
+func (s *CampaignService) GetCampaignStats(ctx context.Context, id string) (*models.CampaignStats, error) {
+	campaign, err := s.campaigns.GetCampaign(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := s.members(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	query := models.ClickQuery{Links: members, From: campaign.StartsAt, To: campaign.EndsAt}
+	summary, err := s.clicks.SummarizeClicks(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	clicked := make(map[models.LinkRef]bool, len(summary.Links))
+	for _, link := range summary.Links {
+		clicked[link.LinkRef] = true
+	}
+	for _, member := range members {
+		if !clicked[member] {
+			summary.Links = append(summary.Links, models.LinkClicks{LinkRef: member})
+		}
+	}
+
+	return &models.CampaignStats{
+		CampaignID:   campaign.ID,
+		From:         campaign.StartsAt,
+		To:           campaign.EndsAt,
+		ClickSummary: *summary,
+	}, nil
+}
+
+// members retrieves the member URLs of a campaign on every domain, a page at a time
+func (s *CampaignService) members(ctx context.Context, id string) ([]models.LinkRef, error) {
+	var members []models.LinkRef
+	filter := models.URLFilter{CampaignID: id, Limit: maxListLimit}
+	for ; ; filter.Offset += filter.Limit {
+		urls, err := s.urls.ListURLs(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		for _, url := range urls {
+			members = append(members, models.LinkRef{Domain: url.Domain, ShortCode: url.ShortCode})
+		}
+		if len(urls) < filter.Limit {
+			return members, nil
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package service
+
+import (
+	"context"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"urlshortener/internal/domain/models"
+	"urlshortener/internal/domain/repositories"
+	"urlshortener/internal/pkg/privacy"
+)
+
+// MockCampaignRepository is a mock implementation of the CampaignRepository interface
+type MockCampaignRepository struct {
+	mock.Mock
+}
+
+// CreateCampaign stores a new campaign in the repository
+func (m *MockCampaignRepository) CreateCampaign(ctx context.Context, campaign *models.Campaign) error {
+	args := m.Called(ctx, campaign)
+	return args.Error(0)
+}
+
+// GetCampaign retrieves a campaign by its ID from the repository
+func (m *MockCampaignRepository) GetCampaign(ctx context.Context, id string) (*models.Campaign, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Campaign), args.Error(1)
+}
+
+// ListCampaigns retrieves the campaigns of an owner from the repository
+func (m *MockCampaignRepository) ListCampaigns(ctx context.Context, owner string) ([]*models.Campaign, error) {
+	args := m.Called(ctx, owner)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Campaign), args.Error(1)
+}
+
+// UpdateCampaign updates an existing campaign in the repository
+func (m *MockCampaignRepository) UpdateCampaign(ctx context.Context, campaign *models.Campaign) error {
+	args := m.Called(ctx, campaign)
+	return args.Error(0)
+}
+
+// DeleteCampaign deletes a campaign by its ID from the repository
+func (m *MockCampaignRepository) DeleteCampaign(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+// MockClickRepository is a mock implementation of the ClickRepository interface
+type MockClickRepository struct {
+	mock.Mock
+}
+
+// RecordClick appends a click to the click log
+func (m *MockClickRepository) RecordClick(ctx context.Context, click *models.Click) error {
+	args := m.Called(ctx, click)
+	return args.Error(0)
+}
+
+// SummarizeClicks aggregates clicks from the click log
+func (m *MockClickRepository) SummarizeClicks(ctx context.Context, query models.ClickQuery) (*models.ClickSummary, error) {
+	args := m.Called(ctx, query)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.ClickSummary), args.Error(1)
+}
+
+// FirstClickAt returns the time of the oldest raw click
+func (m *MockClickRepository) FirstClickAt(ctx context.Context) (*time.Time, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*time.Time), args.Error(1)
+}
+
+// ListClicks calls fn with the raw clicks made between from and to
+func (m *MockClickRepository) ListClicks(ctx context.Context, from, to time.Time, fn func(click *models.Click) error) error {
+	args := m.Called(ctx, from, to, fn)
+	return args.Error(0)
+}
+
+// DeleteClicks deletes the raw clicks made between from and to
+func (m *MockClickRepository) DeleteClicks(ctx context.Context, from, to time.Time) (int64, error) {
+	args := m.Called(ctx, from, to)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// SaveClickRollups stores daily rollups
+func (m *MockClickRepository) SaveClickRollups(ctx context.Context, rollups []*models.ClickRollup) error {
+	args := m.Called(ctx, rollups)
+	return args.Error(0)
+}
+
+// EraseClicks deletes the raw clicks and rollups of links
+func (m *MockClickRepository) EraseClicks(ctx context.Context, links []models.LinkRef) (int64, error) {
+	args := m.Called(ctx, links)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// TestCampaignService_GetCampaignStats tests that stats cover the campaign period and list members without clicks
+func TestCampaignService_GetCampaignStats(t *testing.T) {
+	mockCampaigns := new(MockCampaignRepository)
+	mockRepo := new(MockURLRepository)
+	mockClicks := new(MockClickRepository)
+	service := NewCampaignService(mockCampaigns, mockRepo, mockClicks)
+	ctx := context.Background()
+
+	startsAt := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	campaign := &models.Campaign{ID: "c1", Name: "Spring", StartsAt: &startsAt}
+	mockCampaigns.On("GetCampaign", ctx, "c1").Return(campaign, nil)
+	mockRepo.On("ListURLs", ctx, models.URLFilter{CampaignID: "c1", Limit: maxListLimit}).Return([]*models.URL{
+		{Domain: "acme.link", ShortCode: "spring"},
+		{Domain: "go.acme.com", ShortCode: "flyer"},
+	}, nil)
+
+	spring := models.LinkRef{Domain: "acme.link", ShortCode: "spring"}
+	flyer := models.LinkRef{Domain: "go.acme.com", ShortCode: "flyer"}
+	mockClicks.On("SummarizeClicks", ctx, models.ClickQuery{Links: []models.LinkRef{spring, flyer}, From: &startsAt}).Return(&models.ClickSummary{
+		Clicks:    5,
+		Uniques:   3,
+		Links:     []models.LinkClicks{{LinkRef: spring, Clicks: 5, Uniques: 3}},
+		Referrers: []models.ReferrerCount{{Referrer: "news.example.com", Clicks: 4}, {Clicks: 1}},
+	}, nil)
+
+	stats, err := service.GetCampaignStats(ctx, "c1")
+	assert.NoError(t, err)
+	assert.Equal(t, "c1", stats.CampaignID)
+	assert.Equal(t, int64(5), stats.Clicks)
+	assert.Equal(t, int64(3), stats.Uniques)
+	assert.Equal(t, []models.LinkClicks{{LinkRef: spring, Clicks: 5, Uniques: 3}, {LinkRef: flyer}}, stats.Links)
+	assert.Len(t, stats.Referrers, 2)
+
+	mockClicks.AssertExpectations(t)
+}
+
+// TestURLService_CreateShortURLInCampaign tests that assigned URLs take the UTM values they lack from the campaign
+func TestURLService_CreateShortURLInCampaign(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockHistory := new(MockHistoryRepository)
+	mockCampaigns := new(MockCampaignRepository)
+	service := NewURLService(mockRepo, mockHistory, WithCampaigns(mockCampaigns))
+	ctx := context.Background()
+
+	campaign := &models.Campaign{ID: "c1", UTM: &models.UTMParams{Source: "newsletter", Campaign: "spring"}}
+	mockCampaigns.On("GetCampaign", ctx, "c1").Return(campaign, nil)
+	mockCampaigns.On("GetCampaign", ctx, "missing").Return(nil, repositories.ErrCampaignNotFound)
+	mockRepo.On("CreateURL", ctx, mock.AnythingOfType("*models.URL")).Return(nil)
+	mockHistory.On("CreateRevision", ctx, mock.AnythingOfType("*models.Revision")).Return(nil)
+
+	opts := URLOptions{CampaignID: "c1", UTM: &models.UTMParams{Source: "flyer"}}
+	result, err := service.CreateShortURL(ctx, "https://example.com", opts)
+	assert.NoError(t, err)
+	assert.Equal(t, "c1", result.CampaignID)
+	assert.Equal(t, &models.UTMParams{Source: "flyer", Campaign: "spring"}, result.UTM)
+
+	_, err = service.CreateShortURL(ctx, "https://example.com", URLOptions{CampaignID: "missing"})
+	assert.ErrorIs(t, err, repositories.ErrCampaignNotFound)
+}
+
+// TestURLService_ResolveURLRecordsClick tests that redirects are logged with a salted visitor hash and referrer
+func TestURLService_ResolveURLRecordsClick(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockHistory := new(MockHistoryRepository)
+	mockClicks := new(MockClickRepository)
+	anonymizer, _ := privacy.NewAnonymizer(privacy.Options{Secret: []byte("salt")})
+	service := NewURLService(mockRepo, mockHistory, WithClickLog(mockClicks), WithPrivacy(anonymizer))
+	ctx := context.Background()
+
+	url := &models.URL{OriginalURL: "https://example.com", ShortCode: "abc123", Domain: "acme.link"}
+	visitor := models.Visitor{IP: "192.0.2.1", UserAgent: "test-agent", Referrer: "news.example.com"}
+	mockRepo.On("GetURLByShortCode", ctx, "abc123").Return(url, nil)
+	mockRepo.On("IncrementURLAccessCount", ctx, "abc123", "").Return(nil)
+
+	var hashes []string
+	mockClicks.On("RecordClick", ctx, mock.MatchedBy(func(click *models.Click) bool {
+		return click.ShortCode == "abc123" && click.Domain == "acme.link" && click.Referrer == "news.example.com"
+	})).Run(func(args mock.Arguments) {
+		hashes = append(hashes, args.Get(1).(*models.Click).VisitorHash)
+	}).Return(nil)
+
+	_, err := service.ResolveURL(ctx, "abc123", "", visitor)
+	assert.NoError(t, err)
+	_, err = service.ResolveURL(ctx, "abc123", "", visitor)
+	assert.NoError(t, err)
+
+	assert.Len(t, hashes, 2)
+	assert.Equal(t, hashes[0], hashes[1])
+	assert.NotContains(t, hashes[0], "192.0.2.1")
+	assert.NotEqual(t, hex.EncodeToString(visitorDigest([]byte("other"), visitor)), hashes[0])
+}
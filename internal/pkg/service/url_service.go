@@ -2,79 +2,1378 @@ package service
 
 import (
 	"context"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	log "go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"math/rand"
+	"slices"
+	"strings"
 	"time"
 	"urlshortener/internal/domain/models"
 	"urlshortener/internal/domain/repositories"
 	"urlshortener/internal/pkg/generator"
+	"urlshortener/internal/pkg/metrics"
+	"urlshortener/internal/pkg/privacy"
+	"urlshortener/internal/pkg/reqctx"
+	"urlshortener/internal/pkg/targeting"
+	"urlshortener/internal/pkg/tracing"
+	"urlshortener/pkg/logger"
 )
 
+var (
+	// ErrRevisionNotRestorable is returned when rolling back to a revision that holds no URL state
+	ErrRevisionNotRestorable = errors.New("revision cannot be restored")
+
+	// ErrPreconditionFailed is returned when the caller's expected version does not match the stored one
+	ErrPreconditionFailed = errors.New("url version does not match")
+
+	// ErrPasswordRequired is returned when resolving a password-protected URL without a password
+	ErrPasswordRequired = errors.New("password required")
+
+	// ErrInvalidPassword is returned when resolving a password-protected URL with the wrong password
+	ErrInvalidPassword = errors.New("invalid password")
+
+	// ErrURLNotYetActive is returned when resolving a URL before its activation window opens
+	ErrURLNotYetActive = errors.New("url is not active yet")
+
+	// ErrURLEnded is returned when resolving a URL after its activation window has closed
+	ErrURLEnded = errors.New("url is no longer active")
+
+	// ErrPreviewRequired is returned when resolving a URL in preview mode before the visitor confirmed the preview
+	ErrPreviewRequired = errors.New("url requires a preview")
+
+	// ErrInvalidActiveWindow is returned when a URL would be deactivated before it is activated
+	ErrInvalidActiveWindow = errors.New("active_until must be after active_from")
+
+	// ErrTooManyLabels is returned when a patch would leave a URL with more than models.MaxLabels labels
+	ErrTooManyLabels = fmt.Errorf("at most %d labels are allowed", models.MaxLabels)
+
+	// ErrMetadataDisabled is returned when refreshing metadata on a service without a metadata fetcher
+	ErrMetadataDisabled = errors.New("metadata fetching is disabled")
+
+	// ErrBotRefused is returned when a bot follows a single-use URL, which only a person may consume
+	ErrBotRefused = errors.New("single-use url refused to a bot")
+
+	// ErrInvalidStatsRange is returned when the days of a statistics range are reversed or span too long
+	ErrInvalidStatsRange = errors.New("stats range must not end before it starts or span more than 366 days")
+)
+
+const (
+	// defaultListLimit is the page size of a listing that does not specify one
+	defaultListLimit = 50
+
+	// maxListLimit caps the page size of a listing
+	maxListLimit = 100
+
+	// maxCodeAttempts bounds the short codes tried when generated ones are already taken
+	maxCodeAttempts = 5
+
+	// defaultStatsDays and maxStatsDays are the days of statistics reported by default and at most
+	defaultStatsDays = 30
+	maxStatsDays     = 366
+)
+
+// tracer starts the spans of the operations of the service
+var tracer = tracing.Tracer("urlshortener/internal/pkg/service")
+
+// URLOptions holds the optional settings of a short URL supplied on create or update
+type URLOptions struct {
+	// Password protects the redirect; on update an empty value keeps the current password
+	Password string
+
+	// SingleUse makes the URL resolve only once; on update false keeps the current setting
+	SingleUse bool
+
+	// ActiveFrom and ActiveUntil bound the activation window; on update nil keeps the current bound
+	ActiveFrom  *time.Time
+	ActiveUntil *time.Time
+
+	// Rules replaces the targeting rules; on update nil keeps the current rules and an empty slice clears them
+	Rules []models.TargetingRule
+
+	// Variants replaces the weighted destinations, like Rules; clicks are kept for variants whose ID is unchanged
+	Variants []models.Variant
+
+	// StickyVariants keeps returning visitors on their variant; on update false keeps the current setting
+	StickyVariants bool
+
+	// QueryMode, PathPassthrough and UTM configure passthrough to the destination;
+	// on update their zero values keep the current settings
+	QueryMode       string
+	PathPassthrough bool
+	UTM             *models.UTMParams
+
+	// Title and Preview configure the preview page; on update their zero values keep the current settings
+	Title   string
+	Preview bool
+
+	// FallbackURL receives visitors while the destination is down; on update an empty value keeps the current one
+	FallbackURL string
+
+	// Tags and Labels replace the current ones, Folder and Notes set them; on update nil or empty values
+	// keep the current settings and an empty slice or map clears them
+	Tags   []string
+	Folder string
+	Notes  string
+	Labels map[string]string
+
+	// CampaignID assigns the URL to a campaign, whose UTM values fill in those the URL lacks;
+	// on update an empty value keeps the current campaign
+	CampaignID string
+}
+
+// Resolution is the outcome of following a short URL
+type Resolution struct {
+	URL *models.URL
+
+	// Destination is where the visitor is sent, after evaluating targeting rules and variants
+	Destination string
+
+	// Variant is the ID of the variant the visitor was assigned to, if any
+	Variant string
+}
+
+// MetadataFetcher retrieves metadata describing the destination page of a URL
+type MetadataFetcher interface {
+	Fetch(ctx context.Context, rawURL string) *models.Metadata
+}
+
+// VisitorCounter estimates the unique visitors of links from the hashes identifying them
+type VisitorCounter interface {
+	Observe(link models.LinkRef, hash uint64, at time.Time)
+	Summarize(ctx context.Context, link models.LinkRef, from, to time.Time) (*models.UniqueVisitors, error)
+	Erase(ctx context.Context, links []models.LinkRef) (int64, error)
+}
+
+// ClickPublisher publishes redirects as they happen to live streams; Publish must not block
+type ClickPublisher interface {
+	Publish(event models.ClickEvent)
+}
+
+// EventNotifier announces the events of short URLs to their subscribers
+type EventNotifier interface {
+	Notify(ctx context.Context, event models.Event) error
+}
+
+// EventSink receives the domain events of short URLs, such as a message broker or the outbox in front of one
+type EventSink interface {
+	Emit(ctx context.Context, event models.Event) error
+}
+
+// Transactor runs fn in a transaction, committing the writes made with the context passed to fn together or not at all
+type Transactor interface {
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// TaskRunner runs tasks in the background, reporting false when a task is dropped
+type TaskRunner interface {
+	Submit(task func(ctx context.Context)) bool
+}
+
 // URLService provides methods to manage URLs
 type URLService struct {
-	repo repositories.URLRepository
+	repo     repositories.URLRepository
+	history  repositories.HistoryRepository
+	now      func() time.Time
+	intn     func(n int) int
+	metadata MetadataFetcher
+	tasks    TaskRunner
+
+	campaigns repositories.CampaignRepository
+	clicks    repositories.ClickRepository
+	visitors  VisitorCounter
+	privacy   *privacy.Anonymizer
+	live      ClickPublisher
+	events    EventNotifier
+	sink      EventSink
+	tx        Transactor
+}
+
+// Option configures optional behaviour of a URLService
+type Option func(*URLService)
+
+// WithClock sets the function the service uses to tell the current time
+func WithClock(now func() time.Time) Option {
+	return func(s *URLService) {
+		s.now = now
+	}
+}
+
+// WithRandom sets the function the service uses to draw a random number in [0, n) when picking variants
+func WithRandom(intn func(n int) int) Option {
+	return func(s *URLService) {
+		s.intn = intn
+	}
+}
+
+// WithMetadata makes the service fetch the metadata of destinations in the background using runner
+func WithMetadata(fetcher MetadataFetcher, runner TaskRunner) Option {
+	return func(s *URLService) {
+		s.metadata = fetcher
+		s.tasks = runner
+	}
+}
+
+// WithCampaigns lets URLs be assigned to the campaigns stored in campaigns
+func WithCampaigns(campaigns repositories.CampaignRepository) Option {
+	return func(s *URLService) {
+		s.campaigns = campaigns
+	}
+}
+
+// WithClickLog makes the service record every redirect in clicks
+func WithClickLog(clicks repositories.ClickRepository) Option {
+	return func(s *URLService) {
+		s.clicks = clicks
+	}
+}
+
+// WithUniqueVisitors makes the service count the unique visitors of every redirect with visitors
+func WithUniqueVisitors(visitors VisitorCounter) Option {
+	return func(s *URLService) {
+		s.visitors = visitors
+	}
+}
+
+// WithClickStream makes the service publish every redirect to live streams through publisher
+func WithClickStream(publisher ClickPublisher) Option {
+	return func(s *URLService) {
+		s.live = publisher
+	}
+}
+
+// WithWebhooks makes the service announce the lifecycle of URLs and every redirect through notifier
+func WithWebhooks(notifier EventNotifier) Option {
+	return func(s *URLService) {
+		s.events = notifier
+	}
+}
+
+// WithEventSink makes the service emit the lifecycle of URLs and every redirect to sink
+func WithEventSink(sink EventSink) Option {
+	return func(s *URLService) {
+		s.sink = sink
+	}
+}
+
+// WithTransactions makes the service store every change to a URL in a transaction of tx along with the event
+// emitted about it, so an event sink writing to the same database never misses a change nor announces a lost one
+func WithTransactions(tx Transactor) Option {
+	return func(s *URLService) {
+		s.tx = tx
+	}
+}
+
+// WithPrivacy makes the service anonymise visitors with anonymizer before storing anything about them,
+// and salt the hashes identifying visitors in the click log and unique visitor counts with its salts
+func WithPrivacy(anonymizer *privacy.Anonymizer) Option {
+	return func(s *URLService) {
+		s.privacy = anonymizer
+	}
 }
 
 // NewURLService creates a new instance of URLService
-func NewURLService(repo repositories.URLRepository) *URLService {
-	return &URLService{repo: repo}
+func NewURLService(repo repositories.URLRepository, history repositories.HistoryRepository, opts ...Option) *URLService {
+	s := &URLService{repo: repo, history: history, now: time.Now, intn: rand.Intn}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 // CreateShortURL creates a new shortened URL
-func (s *URLService) CreateShortURL(ctx context.Context, originalURL string) (*models.URL, error) {
-	shortCode := generator.GenerateShortCode()
+func (s *URLService) CreateShortURL(ctx context.Context, originalURL string, opts URLOptions) (*models.URL, error) {
+	ctx, span := startSpan(ctx, "CreateShortURL", "")
+	defer span.End()
+
+	domain := reqctx.Domain(ctx)
+	codeLength := domain.CodeLength
+	if codeLength == 0 {
+		codeLength = generator.DefaultLength
+	}
+
 	url := &models.URL{
 		OriginalURL: originalURL,
-		ShortCode:   shortCode,
+		Domain:      domain.Host,
 		AccessCount: 0,
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
+		Version:     1,
+		CreatedAt:   s.now(),
+		UpdatedAt:   s.now(),
+	}
+	if actor := reqctx.Actor(ctx); actor != reqctx.AnonymousActor {
+		url.Owner = actor
+	}
+	if err := applyOptions(url, opts); err != nil {
+		return nil, err
+	}
+	if opts.CampaignID != "" {
+		if err := s.assignCampaign(ctx, url, opts.CampaignID); err != nil {
+			return nil, err
+		}
 	}
 
-	if err := s.repo.CreateURL(ctx, url); err != nil {
+	// Generated codes may collide with existing ones on the domain, so retry with fresh codes
+	var event models.Event
+	var err error
+	for attempt := 0; attempt < maxCodeAttempts; attempt++ {
+		url.ShortCode = generator.GenerateShortCodeOfLength(codeLength)
+		event, err = s.commit(ctx, models.EventLinkCreated, url, func(ctx context.Context) error {
+			return s.repo.CreateURL(ctx, url)
+		})
+		if !errors.Is(err, repositories.ErrShortCodeTaken) {
+			break
+		}
+		metrics.CodeCollisions.Inc()
+	}
+	if err != nil {
 		return nil, err
 	}
 
+	s.recordRevision(ctx, models.RevisionActionCreate, url.ShortCode, nil, url, event)
+	s.scheduleMetadata(ctx, url)
+
 	return url, nil
 }
 
-// GetURL retrieves a URL by its short code and increments the access count
+// GetURL retrieves a URL by its short code and increments the access count.
+// URLs outside their activation window return ErrURLNotYetActive or ErrURLEnded, and consumed ones ErrURLConsumed.
+// The destinations of a password-protected or single-use URL are left out.
 func (s *URLService) GetURL(ctx context.Context, shortCode string) (*models.URL, error) {
+	ctx, span := startSpan(ctx, "GetURL", shortCode)
+	defer span.End()
+
 	url, err := s.repo.GetURLByShortCode(ctx, shortCode)
 	if err != nil {
 		return nil, err
 	}
+	if url.ConsumedBy != nil {
+		return nil, repositories.ErrURLConsumed
+	}
+	if err := s.checkActive(url); err != nil {
+		return nil, err
+	}
 
-	if err := s.repo.IncrementURLAccessCount(ctx, shortCode); err != nil {
+	if err := s.repo.IncrementURLAccessCount(ctx, shortCode, ""); err != nil {
 		log.Error(fmt.Errorf("error incrementing URL access acount: %v", err))
 	}
 
-	return url, nil
+	return url.Redacted(), nil
 }
 
-// UpdateURL updates the original URL of an existing short code.
-func (s *URLService) UpdateURL(ctx context.Context, shortCode string, newURL string) (*models.URL, error) {
+// ResolveURL retrieves a URL for redirection, checking its password if it is protected,
+// and increments the access count, or the bot access count for bots, once access is granted.
+// A single-use URL is consumed by the visitor, after which it returns ErrURLConsumed; bots get ErrBotRefused.
+// The destination is picked by the first targeting rule matching the visitor, then by the weighted
+// variants, and is the original URL otherwise, or its fallback while health checks report it down.
+func (s *URLService) ResolveURL(ctx context.Context, shortCode string, password string, visitor models.Visitor) (*Resolution, error) {
+	ctx, span := startSpan(ctx, "ResolveURL", shortCode)
+	defer span.End()
+
 	url, err := s.repo.GetURLByShortCode(ctx, shortCode)
 	if err != nil {
 		return nil, err
 	}
+	if url.ConsumedBy != nil {
+		return nil, repositories.ErrURLConsumed
+	}
+	if err := s.checkActive(url); err != nil {
+		return nil, err
+	}
+	if url.Preview && !visitor.ConfirmedPreview {
+		return nil, ErrPreviewRequired
+	}
+
+	if url.PasswordProtected {
+		if password == "" {
+			return nil, ErrPasswordRequired
+		}
+		if err := bcrypt.CompareHashAndPassword([]byte(url.PasswordHash), []byte(password)); err != nil {
+			return nil, ErrInvalidPassword
+		}
+	}
+
+	if url.SingleUse && visitor.Bot {
+		return nil, ErrBotRefused
+	}
+
+	resolution := s.pickDestination(url, visitor)
+
+	if url.SingleUse {
+		now := s.now()
+		consumption := &models.Consumption{Visitor: s.anonymize(visitor, now), Variant: resolution.Variant, ConsumedAt: now}
+		if resolution.URL, err = s.repo.ConsumeURL(ctx, shortCode, consumption); err != nil {
+			return nil, err
+		}
+	} else if visitor.Bot {
+		if err := s.repo.IncrementURLBotCount(ctx, shortCode); err != nil {
+			log.Error(fmt.Errorf("error incrementing URL bot access count: %v", err))
+		}
+	} else if err := s.repo.IncrementURLAccessCount(ctx, shortCode, resolution.Variant); err != nil {
+		log.Error(fmt.Errorf("error incrementing URL access acount: %v", err))
+	}
+	s.recordClick(ctx, url, resolution, visitor)
+	s.publishClick(ctx, url, resolution, visitor)
+	if url.SingleUse {
+		s.emit(ctx, models.EventLinkExpired, resolution.URL)
+	}
+
+	return resolution, nil
+}
+
+// recordClick counts the visitor of a redirect and appends the redirect to the click log, if configured.
+// Bots are logged but not counted as visitors, and visitors asking not to be tracked are neither.
+// Failures are logged rather than returned so they never block the redirect.
+func (s *URLService) recordClick(ctx context.Context, url *models.URL, resolution *Resolution, visitor models.Visitor) {
+	if (s.clicks == nil && s.visitors == nil) || visitor.DoNotTrack {
+		return
+	}
+
+	now := s.now()
+	digest := visitorDigest(s.privacy.Salt(now), visitor)
+	if s.visitors != nil && !visitor.Bot {
+		link := models.LinkRef{Domain: url.Domain, ShortCode: url.ShortCode}
+		s.visitors.Observe(link, binary.BigEndian.Uint64(digest), now)
+	}
+	if s.clicks == nil {
+		return
+	}
+
+	click := &models.Click{
+		ShortCode:   url.ShortCode,
+		Domain:      url.Domain,
+		Variant:     resolution.Variant,
+		VisitorHash: hex.EncodeToString(digest),
+		Referrer:    visitor.Referrer,
+		Country:     visitor.Country,
+		Bot:         visitor.Bot,
+		ClickedAt:   now,
+	}
+	if err := s.clicks.RecordClick(ctx, click); err != nil {
+		logger.FromContext(ctx).Error("failed to record click",
+			log.String("short_code", url.ShortCode),
+			log.Error(err),
+		)
+	}
+}
+
+// publishClick publishes a redirect to live streams and emits it to the event sink and webhooks, if configured.
+// The referrer and country of visitors asking not to be tracked are left out.
+func (s *URLService) publishClick(ctx context.Context, url *models.URL, resolution *Resolution, visitor models.Visitor) {
+	if s.live == nil && s.events == nil && s.sink == nil {
+		return
+	}
+
+	event := models.ClickEvent{
+		LinkRef:   models.LinkRef{Domain: url.Domain, ShortCode: url.ShortCode},
+		Variant:   resolution.Variant,
+		Bot:       visitor.Bot,
+		ClickedAt: s.now(),
+	}
+	if !visitor.DoNotTrack {
+		event.Referrer = visitor.Referrer
+		event.Country = visitor.Country
+	}
+	if s.live != nil {
+		s.live.Publish(event)
+	}
+	s.emit(ctx, models.EventLinkClicked, event)
+}
+
+// assignCampaign makes url a member of the campaign with the given ID, filling in the UTM values
+// the URL lacks with those of the campaign. It returns ErrCampaignNotFound for unknown campaigns.
+func (s *URLService) assignCampaign(ctx context.Context, url *models.URL, campaignID string) error {
+	if s.campaigns == nil {
+		return repositories.ErrCampaignNotFound
+	}
+	campaign, err := s.campaigns.GetCampaign(ctx, campaignID)
+	if err != nil {
+		return err
+	}
+
+	url.CampaignID = campaign.ID
+	if campaign.UTM != nil {
+		utm := models.UTMParams{}
+		if url.UTM != nil {
+			utm = *url.UTM
+		}
+		if utm.Source == "" {
+			utm.Source = campaign.UTM.Source
+		}
+		if utm.Medium == "" {
+			utm.Medium = campaign.UTM.Medium
+		}
+		if utm.Campaign == "" {
+			utm.Campaign = campaign.UTM.Campaign
+		}
+		url.UTM = &utm
+	}
+	return nil
+}
+
+// PreviewURL works out where a visitor following a short code would be sent, without counting an access.
+// The destination of a password-protected or single-use URL is not revealed, leaving it empty;
+// a single-use URL is only consumed once the visitor continues to ResolveURL.
+func (s *URLService) PreviewURL(ctx context.Context, shortCode string, visitor models.Visitor) (*Resolution, error) {
+	ctx, span := startSpan(ctx, "PreviewURL", shortCode)
+	defer span.End()
+
+	url, err := s.repo.GetURLByShortCode(ctx, shortCode)
+	if err != nil {
+		return nil, err
+	}
+	if url.ConsumedBy != nil {
+		return nil, repositories.ErrURLConsumed
+	}
+	if err := s.checkActive(url); err != nil {
+		return nil, err
+	}
+
+	if url.HidesDestination() {
+		return &Resolution{URL: url}, nil
+	}
+	return s.pickDestination(url, visitor), nil
+}
+
+// pickDestination decides where a visitor following url is sent
+func (s *URLService) pickDestination(url *models.URL, visitor models.Visitor) *Resolution {
+	if target, ok := targeting.Match(url.Rules, visitor); ok {
+		return &Resolution{URL: url, Destination: target}
+	}
+
+	if len(url.Variants) == 0 {
+		// Health checks cover the original URL only, so only it is replaced by the fallback
+		if url.FallbackURL != "" && url.Health.Down() {
+			return &Resolution{URL: url, Destination: url.FallbackURL}
+		}
+		return &Resolution{URL: url, Destination: url.OriginalURL}
+	}
+
+	if url.StickyVariants && visitor.AssignedVariant != "" {
+		for _, variant := range url.Variants {
+			if variant.ID == visitor.AssignedVariant {
+				return &Resolution{URL: url, Destination: variant.Destination, Variant: variant.ID}
+			}
+		}
+	}
+
+	variant := s.pickVariant(url.Variants)
+	return &Resolution{URL: url, Destination: variant.Destination, Variant: variant.ID}
+}
+
+// pickVariant draws a variant with probability proportional to its weight
+func (s *URLService) pickVariant(variants []models.Variant) models.Variant {
+	total := 0
+	for _, variant := range variants {
+		total += variant.Weight
+	}
+	if total <= 0 {
+		return variants[0]
+	}
+
+	n := s.intn(total)
+	for _, variant := range variants {
+		if n < variant.Weight {
+			return variant
+		}
+		n -= variant.Weight
+	}
+	return variants[len(variants)-1]
+}
+
+// UpdateURL updates the original URL of an existing short code, leaving the destinations of a password-protected or single-use URL out of the result.
+// If expectedVersions is not nil the update only applies when the stored version is one of them.
+func (s *URLService) UpdateURL(ctx context.Context, shortCode string, newURL string, opts URLOptions, expectedVersions []int64) (*models.URL, error) {
+	ctx, span := startSpan(ctx, "UpdateURL", shortCode)
+	defer span.End()
+
+	url, err := s.repo.GetURLByShortCode(ctx, shortCode)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkVersion(url, expectedVersions); err != nil {
+		return nil, err
+	}
+	before := *url
 
 	url.OriginalURL = newURL
-	url.UpdatedAt = time.Now()
+	url.UpdatedAt = s.now()
+	if newURL != before.OriginalURL {
+		// The health of the previous destination says nothing about the new one
+		url.Health = nil
+	}
+	if err := applyOptions(url, opts); err != nil {
+		return nil, err
+	}
+	if opts.CampaignID != "" && opts.CampaignID != before.CampaignID {
+		if err := s.assignCampaign(ctx, url, opts.CampaignID); err != nil {
+			return nil, err
+		}
+	}
 
-	if err := s.repo.UpdateURL(ctx, url); err != nil {
+	event, err := s.commit(ctx, models.EventLinkUpdated, url, func(ctx context.Context) error {
+		return s.repo.UpdateURL(ctx, url)
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	return url, nil
+	s.recordRevision(ctx, models.RevisionActionUpdate, shortCode, &before, url, event)
+	if url.OriginalURL != before.OriginalURL {
+		s.scheduleMetadata(ctx, url)
+	}
+
+	return url.Redacted(), nil
+}
+
+// PatchURL applies a validated merge patch to the mutable fields of an existing short code,
+// leaving the destinations of a password-protected or single-use URL out of the result.
+// If expectedVersions is not nil the patch only applies when the stored version is one of them.
+func (s *URLService) PatchURL(ctx context.Context, shortCode string, patch models.URLPatch, expectedVersions []int64) (*models.URL, error) {
+	ctx, span := startSpan(ctx, "PatchURL", shortCode)
+	defer span.End()
+
+	url, err := s.repo.GetURLByShortCode(ctx, shortCode)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkVersion(url, expectedVersions); err != nil {
+		return nil, err
+	}
+	if len(patch) == 0 {
+		return url.Redacted(), nil
+	}
+	if err := hashPatchedPassword(patch); err != nil {
+		return nil, err
+	}
+	if variants, ok := patch["variants"].([]models.Variant); ok {
+		patch["variants"] = carryVariantClicks(url.Variants, variants)
+	}
+	before := *url
+
+	patched, err := applyPatch(url, patch)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateWindow(patched); err != nil {
+		return nil, err
+	}
+	if len(patched.Labels) > models.MaxLabels {
+		return nil, ErrTooManyLabels
+	}
+	if patched.UTM != nil && *patched.UTM == (models.UTMParams{}) {
+		// Removing every UTM parameter removes the UTM block, which stops the injection
+		patched.UTM = nil
+		replaceMembers(patch, "utm", nil)
+	}
+	patched.UpdatedAt = s.now()
+	if campaignID, ok := patch["campaign_id"].(string); ok && campaignID != before.CampaignID {
+		if err := s.assignCampaign(ctx, patched, campaignID); err != nil {
+			return nil, err
+		}
+		// The campaign may have filled in UTM values, which are then stored with the patch
+		if patched.UTM != nil {
+			replaceMembers(patch, "utm", patched.UTM)
+		}
+	}
+	if patched.OriginalURL != before.OriginalURL {
+		// The health of the previous destination says nothing about the new one
+		patch["health"] = nil
+		patched.Health = nil
+	}
+
+	event, err := s.commit(ctx, models.EventLinkUpdated, patched, func(ctx context.Context) error {
+		return s.repo.PatchURL(ctx, patched, patch)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.recordRevision(ctx, models.RevisionActionUpdate, shortCode, &before, patched, event)
+	if patched.OriginalURL != before.OriginalURL {
+		s.scheduleMetadata(ctx, patched)
+	}
+
+	return patched.Redacted(), nil
 }
 
 // DeleteURL defines a URL by its short code
-func (s *URLService) DeleteURL(ctx context.Context, shortCode string) error {
-	return s.repo.DeleteURL(ctx, shortCode)
+// If expectedVersions is not nil the URL is only deleted when the stored version is one of them.
+func (s *URLService) DeleteURL(ctx context.Context, shortCode string, expectedVersions []int64) error {
+	ctx, span := startSpan(ctx, "DeleteURL", shortCode)
+	defer span.End()
+
+	url, err := s.repo.GetURLByShortCode(ctx, shortCode)
+	if err != nil {
+		return err
+	}
+	if err := checkVersion(url, expectedVersions); err != nil {
+		return err
+	}
+
+	event, err := s.commit(ctx, models.EventLinkDeleted, url, func(ctx context.Context) error {
+		return s.repo.DeleteURL(ctx, shortCode, url.Version)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.recordRevision(ctx, models.RevisionActionDelete, shortCode, url, nil, event)
+
+	return nil
 }
 
-// GetStats retrieves the statistics of a URL by its short code.
+// GetStats retrieves the statistics of a URL by its short code, leaving out the destinations of a password-protected or single-use URL.
 func (s *URLService) GetStats(ctx context.Context, shortCode string) (*models.URL, error) {
-	return s.repo.GetURLByShortCode(ctx, shortCode)
+	ctx, span := startSpan(ctx, "GetStats", shortCode)
+	defer span.End()
+
+	url, err := s.repo.GetURLByShortCode(ctx, shortCode)
+	if err != nil {
+		return nil, err
+	}
+	return url.Redacted(), nil
+}
+
+// GetUniqueVisitors estimates the unique visitors of url over its lifetime and for each day from from to to.
+// A zero to stands for today and a zero from for the defaultStatsDays days ending on to.
+// It returns nil when unique visitors are not counted.
+func (s *URLService) GetUniqueVisitors(ctx context.Context, url *models.URL, from, to time.Time) (*models.UniqueVisitors, error) {
+	ctx, span := startSpan(ctx, "GetUniqueVisitors", "")
+	defer span.End()
+
+	if s.visitors == nil {
+		return nil, nil
+	}
+
+	if to.IsZero() {
+		to = s.now()
+	}
+	if from.IsZero() {
+		from = to.AddDate(0, 0, 1-defaultStatsDays)
+	}
+	if to.Before(from) || to.Sub(from) >= maxStatsDays*24*time.Hour {
+		return nil, ErrInvalidStatsRange
+	}
+
+	return s.visitors.Summarize(ctx, models.LinkRef{Domain: url.Domain, ShortCode: url.ShortCode}, from, to)
+}
+
+// ListURLs retrieves URLs matching the filter, evaluating activation windows at the current time.
+// The destinations of password-protected and single-use URLs are left out.
+func (s *URLService) ListURLs(ctx context.Context, filter models.URLFilter) ([]*models.URL, error) {
+	ctx, span := startSpan(ctx, "ListURLs", "")
+	defer span.End()
+
+	filter.Now = s.now()
+	if filter.Limit <= 0 {
+		filter.Limit = defaultListLimit
+	}
+	if filter.Limit > maxListLimit {
+		filter.Limit = maxListLimit
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+
+	urls, err := s.repo.ListURLs(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	for i, url := range urls {
+		urls[i] = url.Redacted()
+	}
+	return urls, nil
+}
+
+// EraseOwnerData erases what was recorded about the visitors of every URL of owner, on any domain:
+// their clicks and rollups, unique visitor sketches and the visitors that used up single-use URLs.
+// The URLs and their access counts are kept.
+func (s *URLService) EraseOwnerData(ctx context.Context, owner string) (*models.Erasure, error) {
+	ctx, span := startSpan(ctx, "EraseOwnerData", "")
+	defer span.End()
+
+	erasure := &models.Erasure{Owner: owner}
+	filter := models.URLFilter{Owner: owner, Limit: maxListLimit}
+	for ; ; filter.Offset += filter.Limit {
+		urls, err := s.repo.ListURLs(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+
+		links := make([]models.LinkRef, len(urls))
+		for i, url := range urls {
+			links[i] = models.LinkRef{Domain: url.Domain, ShortCode: url.ShortCode}
+		}
+		erasure.Links += len(links)
+
+		if s.clicks != nil && len(links) > 0 {
+			deleted, err := s.clicks.EraseClicks(ctx, links)
+			if err != nil {
+				return nil, err
+			}
+			erasure.Clicks += deleted
+		}
+		if s.visitors != nil && len(links) > 0 {
+			deleted, err := s.visitors.Erase(ctx, links)
+			if err != nil {
+				return nil, err
+			}
+			erasure.Sketches += deleted
+		}
+
+		if len(urls) < filter.Limit {
+			break
+		}
+	}
+
+	consumptions, err := s.repo.EraseConsumptions(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+	erasure.Consumptions = consumptions
+
+	logger.FromContext(ctx).Info("erased visitor data of owner",
+		log.String("owner", owner),
+		log.Int("links", erasure.Links),
+		log.Int64("clicks", erasure.Clicks),
+		log.Int64("sketches", erasure.Sketches),
+		log.Int64("consumptions", erasure.Consumptions),
+	)
+	return erasure, nil
+}
+
+// ExportURLs calls fn with every URL matching the filter, newest first, loading them a page at a time.
+// The filter's limit and offset are ignored. It stops at the first error returned by fn.
+// The destinations of password-protected and single-use URLs are left out.
+func (s *URLService) ExportURLs(ctx context.Context, filter models.URLFilter, fn func(url *models.URL) error) error {
+	ctx, span := startSpan(ctx, "ExportURLs", "")
+	defer span.End()
+
+	filter.Now = s.now()
+	filter.Limit = maxListLimit
+	for filter.Offset = 0; ; filter.Offset += filter.Limit {
+		urls, err := s.repo.ListURLs(ctx, filter)
+		if err != nil {
+			return err
+		}
+		for _, url := range urls {
+			if err := fn(url.Redacted()); err != nil {
+				return err
+			}
+		}
+		if len(urls) < filter.Limit {
+			return nil
+		}
+	}
+}
+
+// ListBrokenURLs retrieves URLs matching the filter whose destination health checks report down.
+func (s *URLService) ListBrokenURLs(ctx context.Context, filter models.URLFilter) ([]*models.URL, error) {
+	ctx, span := startSpan(ctx, "ListBrokenURLs", "")
+	defer span.End()
+
+	filter.Health = models.HealthStatusDown
+	return s.ListURLs(ctx, filter)
+}
+
+// GetHistory retrieves every recorded revision of a short code, oldest first.
+// URLs created before revisions were recorded have none; unknown short codes return ErrURLNotFound.
+// While the URL is password-protected or single-use, and in revisions where it was, the destinations are left out.
+func (s *URLService) GetHistory(ctx context.Context, shortCode string) ([]*models.Revision, error) {
+	ctx, span := startSpan(ctx, "GetHistory", shortCode)
+	defer span.End()
+
+	revisions, err := s.history.ListRevisions(ctx, shortCode)
+	if err != nil {
+		return nil, err
+	}
+	current, err := s.repo.GetURLByShortCode(ctx, shortCode)
+	if err != nil && !(errors.Is(err, repositories.ErrURLNotFound) && len(revisions) > 0) {
+		// Deleted URLs keep their history so they can be restored
+		return nil, err
+	}
+	if len(revisions) == 0 {
+		return []*models.Revision{}, nil
+	}
+
+	redacted := make([]*models.Revision, len(revisions))
+	for i, revision := range revisions {
+		if current.HidesDestination() || revision.Before.HidesDestination() || revision.After.HidesDestination() {
+			c := *revision
+			c.Before, c.After = c.Before.WithoutDestinations(), c.After.WithoutDestinations()
+			revision = &c
+		}
+		redacted[i] = revision
+	}
+	return redacted, nil
+}
+
+// RollbackURL restores a short code to the state captured after the given revision.
+// A deleted short code is recreated from the revision snapshot.
+// The destinations of a password-protected or single-use URL are left out of the result.
+func (s *URLService) RollbackURL(ctx context.Context, shortCode, revisionID string) (*models.URL, error) {
+	ctx, span := startSpan(ctx, "RollbackURL", shortCode)
+	defer span.End()
+
+	revision, err := s.history.GetRevision(ctx, shortCode, revisionID)
+	if err != nil {
+		return nil, err
+	}
+	if revision.After == nil {
+		return nil, ErrRevisionNotRestorable
+	}
+
+	current, err := s.repo.GetURLByShortCode(ctx, shortCode)
+	if err != nil && !errors.Is(err, repositories.ErrURLNotFound) {
+		return nil, err
+	}
+	if err != nil {
+		// The short code no longer exists, so recreate it from the snapshot
+		url := *revision.After
+		url.Version++
+		url.UpdatedAt = s.now()
+		event, err := s.commit(ctx, models.EventLinkCreated, &url, func(ctx context.Context) error {
+			return s.repo.CreateURL(ctx, &url)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		s.recordRevision(ctx, models.RevisionActionRollback, shortCode, nil, &url, event)
+		s.scheduleMetadata(ctx, &url)
+
+		return url.Redacted(), nil
+	}
+
+	// Restore the mutable fields of the snapshot on top of the current identity and counters
+	restored := *revision.After
+	restored.ID = current.ID
+	restored.AccessCount = current.AccessCount
+	restored.BotAccessCount = current.BotAccessCount
+	restored.Variants = carryVariantClicks(current.Variants, restored.Variants)
+	restored.Version = current.Version
+	restored.CreatedAt = current.CreatedAt
+	restored.UpdatedAt = s.now()
+	restored.Metadata = current.Metadata
+	if restored.OriginalURL == current.OriginalURL {
+		restored.Health = current.Health
+	}
+
+	event, err := s.commit(ctx, models.EventLinkUpdated, &restored, func(ctx context.Context) error {
+		return s.repo.UpdateURL(ctx, &restored)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.recordRevision(ctx, models.RevisionActionRollback, shortCode, current, &restored, event)
+	if restored.OriginalURL != current.OriginalURL {
+		s.scheduleMetadata(ctx, &restored)
+	}
+
+	return restored.Redacted(), nil
+}
+
+// RefreshMetadata fetches the metadata of the destination of a short code now and stores it.
+// The destinations and metadata of a password-protected or single-use URL are left out of the result.
+func (s *URLService) RefreshMetadata(ctx context.Context, shortCode string) (*models.URL, error) {
+	ctx, span := startSpan(ctx, "RefreshMetadata", shortCode)
+	defer span.End()
+
+	if s.metadata == nil {
+		return nil, ErrMetadataDisabled
+	}
+	url, err := s.repo.GetURLByShortCode(ctx, shortCode)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := s.metadata.Fetch(ctx, url.OriginalURL)
+	if err := s.repo.UpdateURLMetadata(ctx, shortCode, url.OriginalURL, metadata); err != nil {
+		return nil, err
+	}
+	url.Metadata = metadata
+
+	return url.Redacted(), nil
+}
+
+// scheduleMetadata fetches and stores the metadata of the destination of url in the background.
+// The task outlives the request, so it only keeps the domain from ctx. Tasks dropped because the
+// runner is busy are logged; the metadata can then be refreshed on demand.
+func (s *URLService) scheduleMetadata(ctx context.Context, url *models.URL) {
+	if s.metadata == nil || s.tasks == nil {
+		return
+	}
+	domain := reqctx.Domain(ctx)
+	shortCode, originalURL := url.ShortCode, url.OriginalURL
+
+	submitted := s.tasks.Submit(func(ctx context.Context) {
+		ctx = reqctx.WithDomain(ctx, domain)
+		metadata := s.metadata.Fetch(ctx, originalURL)
+		// The filter on the original URL discards results for a destination that has changed meanwhile
+		if err := s.repo.UpdateURLMetadata(ctx, shortCode, originalURL, metadata); err != nil {
+			logger.FromContext(ctx).Error("failed to store url metadata",
+				log.String("short_code", shortCode),
+				log.Error(err),
+			)
+		}
+	})
+	if !submitted {
+		logger.FromContext(ctx).Warn("metadata fetch dropped, queue is full",
+			log.String("short_code", shortCode),
+		)
+	}
+}
+
+// recordRevision appends an immutable revision to the history of a short code and announces the change,
+// described by event, to webhooks. Failures are logged rather than returned since the change itself has already been applied.
+func (s *URLService) recordRevision(ctx context.Context, action models.RevisionAction, shortCode string, before, after *models.URL, event models.Event) {
+	revision := &models.Revision{
+		ShortCode: shortCode,
+		Domain:    reqctx.Domain(ctx).Host,
+		Action:    action,
+		Actor:     reqctx.Actor(ctx),
+		RequestID: reqctx.RequestID(ctx),
+		Before:    snapshot(before),
+		After:     snapshot(after),
+		CreatedAt: s.now(),
+	}
+
+	if err := s.history.CreateRevision(ctx, revision); err != nil {
+		logger.FromContext(ctx).Error("failed to record url revision",
+			log.String("short_code", shortCode),
+			log.String("action", string(action)),
+			log.Error(err),
+		)
+	}
+
+	s.notify(ctx, event)
+}
+
+// commit stores a change to url with write and emits the event of the given type announcing it to the event sink,
+// if configured, returning the event. With transactions the event is emitted in the same transaction as the change,
+// so neither is stored without the other; otherwise a failure to emit is logged, since the change is already stored.
+func (s *URLService) commit(ctx context.Context, eventType string, url *models.URL, write func(ctx context.Context) error) (models.Event, error) {
+	event := s.newEvent(eventType, url)
+	if s.sink == nil {
+		return event, write(ctx)
+	}
+	if s.tx == nil {
+		if err := write(ctx); err != nil {
+			return event, err
+		}
+		s.emitToSink(ctx, event)
+		return event, nil
+	}
+
+	// Transactions are retried on transient errors, so every attempt writes from the version read before the first,
+	// rather than from the one a failed attempt has already incremented
+	version := url.Version
+	err := s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		url.Version = version
+		if err := write(ctx); err != nil {
+			return err
+		}
+		return s.sink.Emit(ctx, event)
+	})
+	return event, err
+}
+
+// emit announces an event about a short URL that is not a stored change, such as a redirect,
+// to the event sink and webhooks, if configured.
+// Failures are logged rather than returned so they never fail the redirect announced.
+func (s *URLService) emit(ctx context.Context, eventType string, data interface{}) {
+	if s.sink == nil && s.events == nil {
+		return
+	}
+	event := s.newEvent(eventType, data)
+	s.emitToSink(ctx, event)
+	s.notify(ctx, event)
+}
+
+// emitToSink emits event to the event sink, if configured, logging failures
+func (s *URLService) emitToSink(ctx context.Context, event models.Event) {
+	if s.sink == nil {
+		return
+	}
+	if err := s.sink.Emit(ctx, event); err != nil {
+		logger.FromContext(ctx).Error("failed to emit event",
+			log.String("event", event.Type),
+			log.String("event_id", event.ID),
+			log.Error(err),
+		)
+	}
+}
+
+// notify queues event for delivery to webhooks, if configured, logging failures
+func (s *URLService) notify(ctx context.Context, event models.Event) {
+	if s.events == nil {
+		return
+	}
+	if err := s.events.Notify(ctx, event); err != nil {
+		logger.FromContext(ctx).Error("failed to queue webhook event",
+			log.String("event", event.Type),
+			log.String("event_id", event.ID),
+			log.Error(err),
+		)
+	}
+}
+
+// newEvent creates an event of the given type happening now, with a random ID
+func (s *URLService) newEvent(eventType string, data interface{}) models.Event {
+	return models.Event{ID: newEventID(), Type: eventType, OccurredAt: s.now(), Data: data}
+}
+
+// checkVersion reports ErrPreconditionFailed if expectedVersions is set and does not hold the version of url
+func checkVersion(url *models.URL, expectedVersions []int64) error {
+	if expectedVersions != nil && !slices.Contains(expectedVersions, url.Version) {
+		return ErrPreconditionFailed
+	}
+	return nil
+}
+
+// applyPatch returns a copy of url with the merge patch applied to its JSON representation
+func applyPatch(url *models.URL, patch models.URLPatch) (*models.URL, error) {
+	data, err := json.Marshal(url)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	for field, value := range patch {
+		target := doc
+		if parent, member, ok := strings.Cut(field, "."); ok {
+			// A member of an object merged key by key, created if the URL has none yet
+			object, _ := doc[parent].(map[string]interface{})
+			if object == nil {
+				object = make(map[string]interface{})
+				doc[parent] = object
+			}
+			target, field = object, member
+		}
+		if value == nil {
+			delete(target, field)
+			continue
+		}
+		target[field] = value
+	}
+
+	if data, err = json.Marshal(doc); err != nil {
+		return nil, err
+	}
+
+	var patched models.URL
+	if err := json.Unmarshal(data, &patched); err != nil {
+		return nil, err
+	}
+
+	// Fields hidden from the JSON representation do not survive the round trip
+	patched.PasswordHash = url.PasswordHash
+	if value, ok := patch["password_hash"]; ok {
+		patched.PasswordHash, _ = value.(string)
+	}
+
+	return &patched, nil
+}
+
+// replaceMembers replaces the members of field patched one by one with value for the whole field
+func replaceMembers(patch models.URLPatch, field string, value interface{}) {
+	for key := range patch {
+		if strings.HasPrefix(key, field+".") {
+			delete(patch, key)
+		}
+	}
+	patch[field] = value
+}
+
+// applyOptions sets the optional settings of a URL being created or updated
+func applyOptions(url *models.URL, opts URLOptions) error {
+	if opts.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(opts.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return err
+		}
+		url.PasswordHash = string(hash)
+		url.PasswordProtected = true
+	}
+	if opts.SingleUse {
+		url.SingleUse = true
+	}
+	if opts.ActiveFrom != nil {
+		url.ActiveFrom = opts.ActiveFrom
+	}
+	if opts.ActiveUntil != nil {
+		url.ActiveUntil = opts.ActiveUntil
+	}
+	if opts.Rules != nil {
+		url.Rules = opts.Rules
+	}
+	if opts.Variants != nil {
+		url.Variants = carryVariantClicks(url.Variants, opts.Variants)
+	}
+	if opts.StickyVariants {
+		url.StickyVariants = true
+	}
+	if opts.QueryMode != "" {
+		url.QueryMode = opts.QueryMode
+	}
+	if opts.PathPassthrough {
+		url.PathPassthrough = true
+	}
+	if opts.UTM != nil {
+		url.UTM = opts.UTM
+	}
+	if opts.Title != "" {
+		url.Title = opts.Title
+	}
+	if opts.Preview {
+		url.Preview = true
+	}
+	if opts.FallbackURL != "" {
+		url.FallbackURL = opts.FallbackURL
+	}
+	if opts.Tags != nil {
+		url.Tags = models.NormalizeTags(opts.Tags)
+	}
+	if opts.Folder != "" {
+		url.Folder = opts.Folder
+	}
+	if opts.Notes != "" {
+		url.Notes = opts.Notes
+	}
+	if opts.Labels != nil {
+		url.Labels = opts.Labels
+	}
+	return validateWindow(url)
+}
+
+// carryVariantClicks returns the replacement variants with the clicks of current variants sharing their ID
+func carryVariantClicks(current, replacement []models.Variant) []models.Variant {
+	clicks := make(map[string]int, len(current))
+	for _, variant := range current {
+		clicks[variant.ID] = variant.Clicks
+	}
+
+	variants := make([]models.Variant, len(replacement))
+	for i, variant := range replacement {
+		variant.Clicks = clicks[variant.ID]
+		variants[i] = variant
+	}
+	return variants
+}
+
+// validateWindow reports ErrInvalidActiveWindow if the URL would end before it starts
+func validateWindow(url *models.URL) error {
+	if url.ActiveFrom != nil && url.ActiveUntil != nil && !url.ActiveUntil.After(*url.ActiveFrom) {
+		return ErrInvalidActiveWindow
+	}
+	return nil
+}
+
+// checkActive reports whether the URL is inside its activation window at the current time
+func (s *URLService) checkActive(url *models.URL) error {
+	switch url.StatusAt(s.now()) {
+	case models.LinkStatusScheduled:
+		return ErrURLNotYetActive
+	case models.LinkStatusEnded:
+		return ErrURLEnded
+	}
+	return nil
+}
+
+// hashPatchedPassword replaces a plain text password in a patch with its stored hash and flag
+func hashPatchedPassword(patch models.URLPatch) error {
+	value, ok := patch["password"]
+	if !ok {
+		return nil
+	}
+	delete(patch, "password")
+
+	if value == nil {
+		patch["password_hash"] = nil
+		patch["password_protected"] = false
+		return nil
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(value.(string)), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	patch["password_hash"] = string(hash)
+	patch["password_protected"] = true
+	return nil
+}
+
+// anonymize returns the details of visitor that may be stored, with the IP address anonymised,
+// or none for visitors asking not to be tracked
+func (s *URLService) anonymize(visitor models.Visitor, at time.Time) models.Visitor {
+	if visitor.DoNotTrack {
+		return models.Visitor{}
+	}
+	return models.Visitor{
+		IP:        s.privacy.IP(visitor.IP, at),
+		UserAgent: visitor.UserAgent,
+		Country:   visitor.Country,
+	}
+}
+
+// visitorDigest identifies a visitor by a salted hash of their IP address and user agent,
+// so unique visitors can be counted without storing either
+func visitorDigest(salt []byte, visitor models.Visitor) []byte {
+	h := sha256.New()
+	h.Write(salt)
+	h.Write([]byte(visitor.IP))
+	h.Write([]byte{0})
+	h.Write([]byte(visitor.UserAgent))
+	return h.Sum(nil)[:16]
+}
+
+// snapshot returns a copy of url so later changes do not alter recorded revisions
+func snapshot(url *models.URL) *models.URL {
+	if url == nil {
+		return nil
+	}
+	c := *url
+	// Metadata and health describe the destination rather than the link and are not versioned
+	c.Metadata = nil
+	c.Health = nil
+	c.HealthCheckAfter = nil
+	return &c
+}
+
+// newEventID returns a random ID for an event, which consumers deduplicate on
+func newEventID() string {
+	id := make([]byte, 12)
+	if _, err := crand.Read(id); err != nil {
+		// Fall back on the time and a pseudo-random number rather than emitting no event
+		binary.BigEndian.PutUint64(id, uint64(time.Now().UnixNano()))
+		binary.BigEndian.PutUint32(id[8:], rand.Uint32())
+	}
+	return hex.EncodeToString(id)
+}
+
+// startSpan starts the span of an operation of the service, on the URL with the given short code if any,
+// which the caller ends. A span that is not recorded, because tracing is off or the trace is not sampled,
+// leaves ctx as it is, since it carries the same trace as ctx already does.
+func startSpan(ctx context.Context, operation, shortCode string) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{attribute.String("url.domain", reqctx.Domain(ctx).Host)}
+	if shortCode != "" {
+		attrs = append(attrs, attribute.String("url.short_code", shortCode))
+	}
+	spanCtx, span := tracer.Start(ctx, "URLService."+operation, trace.WithAttributes(attrs...))
+	if !span.IsRecording() {
+		return ctx, span
+	}
+	return spanCtx, span
 }
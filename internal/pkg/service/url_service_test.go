@@ -2,12 +2,19 @@ package service
 
 import (
 	"context"
+	"fmt"
 	"testing"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 
 	"urlshortener/internal/domain/models"
+	"urlshortener/internal/domain/repositories"
+	"urlshortener/internal/pkg/metrics"
+	"urlshortener/internal/pkg/privacy"
+	"urlshortener/internal/pkg/reqctx"
 )
 
 // MockURLRepository is a mock implementation of the URLRepository interface
@@ -30,37 +37,148 @@ func (m *MockURLRepository) GetURLByShortCode(ctx context.Context, shortCode str
 	return args.Get(0).(*models.URL), args.Error(1)
 }
 
+// ListURLs retrieves URLs matching a filter from the repository
+func (m *MockURLRepository) ListURLs(ctx context.Context, filter models.URLFilter) ([]*models.URL, error) {
+	args := m.Called(ctx, filter)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.URL), args.Error(1)
+}
+
 // UpdateURL updates an existing URL in the repository
 func (m *MockURLRepository) UpdateURL(ctx context.Context, url *models.URL) error {
 	args := m.Called(ctx, url)
 	return args.Error(0)
 }
 
+// PatchURL applies a partial update to a URL in the repository
+func (m *MockURLRepository) PatchURL(ctx context.Context, url *models.URL, patch models.URLPatch) error {
+	args := m.Called(ctx, url, patch)
+	return args.Error(0)
+}
+
 // DeleteURL deletes a URL by its short code from the repository
-func (m *MockURLRepository) DeleteURL(ctx context.Context, shortCode string) error {
-	args := m.Called(ctx, shortCode)
+func (m *MockURLRepository) DeleteURL(ctx context.Context, shortCode string, version int64) error {
+	args := m.Called(ctx, shortCode, version)
 	return args.Error(0)
 }
 
 // IncrementURLAccessCount increments the access count of a URL in the repository
-func (m *MockURLRepository) IncrementURLAccessCount(ctx context.Context, shortCode string) error {
+func (m *MockURLRepository) IncrementURLAccessCount(ctx context.Context, shortCode, variantID string) error {
+	args := m.Called(ctx, shortCode, variantID)
+	return args.Error(0)
+}
+
+// IncrementURLBotCount increments the bot access count of a URL in the repository
+func (m *MockURLRepository) IncrementURLBotCount(ctx context.Context, shortCode string) error {
 	args := m.Called(ctx, shortCode)
 	return args.Error(0)
 }
 
+// UpdateURLMetadata stores the metadata fetched for a URL in the repository
+func (m *MockURLRepository) UpdateURLMetadata(ctx context.Context, shortCode, originalURL string, metadata *models.Metadata) error {
+	args := m.Called(ctx, shortCode, originalURL, metadata)
+	return args.Error(0)
+}
+
+// ListURLsDueForCheck retrieves URLs whose destination is due for a health check from the repository
+func (m *MockURLRepository) ListURLsDueForCheck(ctx context.Context, checkedBefore time.Time, limit int) ([]*models.URL, error) {
+	args := m.Called(ctx, checkedBefore, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.URL), args.Error(1)
+}
+
+// UpdateURLHealth stores the outcome of a health check of a URL in the repository
+func (m *MockURLRepository) UpdateURLHealth(ctx context.Context, shortCode, originalURL string, health *models.Health) error {
+	args := m.Called(ctx, shortCode, originalURL, health)
+	return args.Error(0)
+}
+
+// DeferURLCheck puts off the health check of a URL in the repository
+func (m *MockURLRepository) DeferURLCheck(ctx context.Context, shortCode string, until time.Time) error {
+	args := m.Called(ctx, shortCode, until)
+	return args.Error(0)
+}
+
+// ClearCampaign removes URLs from a campaign in the repository
+func (m *MockURLRepository) ClearCampaign(ctx context.Context, campaignID string) error {
+	args := m.Called(ctx, campaignID)
+	return args.Error(0)
+}
+
+// EraseConsumptions removes the visitor details of consumed URLs from the repository
+func (m *MockURLRepository) EraseConsumptions(ctx context.Context, owner string) (int64, error) {
+	args := m.Called(ctx, owner)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// ListURLsEndedBetween retrieves the URLs whose active window ended in a period from the repository
+func (m *MockURLRepository) ListURLsEndedBetween(ctx context.Context, from, to time.Time) ([]*models.URL, error) {
+	args := m.Called(ctx, from, to)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.URL), args.Error(1)
+}
+
+// MockHistoryRepository is a mock implementation of the HistoryRepository interface
+type MockHistoryRepository struct {
+	mock.Mock
+}
+
+// CreateRevision records a new revision in the repository
+func (m *MockHistoryRepository) CreateRevision(ctx context.Context, revision *models.Revision) error {
+	args := m.Called(ctx, revision)
+	return args.Error(0)
+}
+
+// ListRevisions retrieves the revisions of a short code from the repository
+func (m *MockHistoryRepository) ListRevisions(ctx context.Context, shortCode string) ([]*models.Revision, error) {
+	args := m.Called(ctx, shortCode)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Revision), args.Error(1)
+}
+
+// GetRevision retrieves a single revision of a short code from the repository
+func (m *MockHistoryRepository) GetRevision(ctx context.Context, shortCode, revisionID string) (*models.Revision, error) {
+	args := m.Called(ctx, shortCode, revisionID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Revision), args.Error(1)
+}
+
+// ConsumeURL marks a single-use URL as consumed in the repository
+func (m *MockURLRepository) ConsumeURL(ctx context.Context, shortCode string, consumption *models.Consumption) (*models.URL, error) {
+	args := m.Called(ctx, shortCode, consumption)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.URL), args.Error(1)
+}
+
 // TestURLService_CreateShortURL tests the CreateShortURL method of the URLService
 func TestURLService_CreateShortURL(t *testing.T) {
 	mockRepo := new(MockURLRepository)
-	service := NewURLService(mockRepo)
+	mockHistory := new(MockHistoryRepository)
+	service := NewURLService(mockRepo, mockHistory)
 	ctx := context.Background()
 
 	testURL := "https://example.com"
 
 	// Set up the mock to expect a CreateURL call and return no error
 	mockRepo.On("CreateURL", ctx, mock.AnythingOfType("*models.URL")).Return(nil)
+	mockHistory.On("CreateRevision", ctx, mock.MatchedBy(func(rev *models.Revision) bool {
+		return rev.Action == models.RevisionActionCreate && rev.Before == nil && rev.After.OriginalURL == testURL
+	})).Return(nil)
 
 	// Call the CreateShortURL method
-	result, err := service.CreateShortURL(ctx, testURL)
+	result, err := service.CreateShortURL(ctx, testURL, URLOptions{})
 
 	// Assert no error and valid result
 	assert.NoError(t, err)
@@ -70,4 +188,1173 @@ func TestURLService_CreateShortURL(t *testing.T) {
 
 	// Ensure expectations were met
 	mockRepo.AssertExpectations(t)
+	mockHistory.AssertExpectations(t)
+}
+
+// TestURLService_CreateShortURLOnDomain tests that codes are generated for the domain of the context
+// and regenerated when already taken
+func TestURLService_CreateShortURLOnDomain(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockHistory := new(MockHistoryRepository)
+	service := NewURLService(mockRepo, mockHistory)
+	ctx := reqctx.WithDomain(context.Background(), models.Domain{Host: "acme.link", CodeLength: 9})
+
+	mockRepo.On("CreateURL", ctx, mock.AnythingOfType("*models.URL")).Return(repositories.ErrShortCodeTaken).Once()
+	mockRepo.On("CreateURL", ctx, mock.AnythingOfType("*models.URL")).Return(nil).Once()
+	mockHistory.On("CreateRevision", ctx, mock.MatchedBy(func(rev *models.Revision) bool {
+		return rev.Domain == "acme.link"
+	})).Return(nil)
+
+	collisions := testutil.ToFloat64(metrics.CodeCollisions)
+	result, err := service.CreateShortURL(ctx, "https://example.com", URLOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "acme.link", result.Domain)
+	assert.Len(t, result.ShortCode, 9)
+	assert.Equal(t, collisions+1, testutil.ToFloat64(metrics.CodeCollisions))
+
+	mockRepo.AssertNumberOfCalls(t, "CreateURL", 2)
+	mockHistory.AssertExpectations(t)
+}
+
+// TestURLService_UpdateURLRecordsRevision tests that UpdateURL records the previous and new state
+func TestURLService_UpdateURLRecordsRevision(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockHistory := new(MockHistoryRepository)
+	service := NewURLService(mockRepo, mockHistory)
+	ctx := reqctx.WithRequestID(reqctx.WithActor(context.Background(), "alice"), "req-1")
+
+	existing := &models.URL{OriginalURL: "https://example.com", ShortCode: "abc123"}
+
+	mockRepo.On("GetURLByShortCode", ctx, "abc123").Return(existing, nil)
+	mockRepo.On("UpdateURL", ctx, mock.AnythingOfType("*models.URL")).Return(nil)
+	mockHistory.On("CreateRevision", ctx, mock.MatchedBy(func(rev *models.Revision) bool {
+		return rev.Action == models.RevisionActionUpdate &&
+			rev.Actor == "alice" &&
+			rev.RequestID == "req-1" &&
+			rev.Before.OriginalURL == "https://example.com" &&
+			rev.After.OriginalURL == "https://example.org"
+	})).Return(nil)
+
+	result, err := service.UpdateURL(ctx, "abc123", "https://example.org", URLOptions{}, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.org", result.OriginalURL)
+	mockRepo.AssertExpectations(t)
+	mockHistory.AssertExpectations(t)
+}
+
+// TestURLService_RollbackURL tests restoring a URL to the state captured by a revision
+func TestURLService_RollbackURL(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockHistory := new(MockHistoryRepository)
+	service := NewURLService(mockRepo, mockHistory)
+	ctx := context.Background()
+
+	revision := &models.Revision{
+		ID:        "rev1",
+		ShortCode: "abc123",
+		Action:    models.RevisionActionCreate,
+		After:     &models.URL{OriginalURL: "https://example.com", ShortCode: "abc123"},
+	}
+	current := &models.URL{OriginalURL: "https://example.org", ShortCode: "abc123"}
+
+	mockHistory.On("GetRevision", ctx, "abc123", "rev1").Return(revision, nil)
+	mockRepo.On("GetURLByShortCode", ctx, "abc123").Return(current, nil)
+	mockRepo.On("UpdateURL", ctx, mock.AnythingOfType("*models.URL")).Return(nil)
+	mockHistory.On("CreateRevision", ctx, mock.MatchedBy(func(rev *models.Revision) bool {
+		return rev.Action == models.RevisionActionRollback && rev.After.OriginalURL == "https://example.com"
+	})).Return(nil)
+
+	result, err := service.RollbackURL(ctx, "abc123", "rev1")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com", result.OriginalURL)
+	mockRepo.AssertExpectations(t)
+	mockHistory.AssertExpectations(t)
+}
+
+// TestURLService_RollbackURLKeepsVariantClicks tests that a rollback keeps the clicks counted per variant since the revision
+func TestURLService_RollbackURLKeepsVariantClicks(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockHistory := new(MockHistoryRepository)
+	service := NewURLService(mockRepo, mockHistory)
+	ctx := context.Background()
+
+	revision := &models.Revision{
+		ID:        "rev1",
+		ShortCode: "abc123",
+		Action:    models.RevisionActionUpdate,
+		After: &models.URL{ShortCode: "abc123", OriginalURL: "https://example.com", Variants: []models.Variant{
+			{ID: "a", Destination: "https://a.example.com", Weight: 1, Clicks: 2},
+			{ID: "b", Destination: "https://b.example.com", Weight: 1, Clicks: 3},
+		}},
+	}
+	current := &models.URL{ShortCode: "abc123", OriginalURL: "https://example.com", AccessCount: 50, Variants: []models.Variant{
+		{ID: "a", Destination: "https://a.example.com", Weight: 3, Clicks: 30},
+	}}
+
+	mockHistory.On("GetRevision", ctx, "abc123", "rev1").Return(revision, nil)
+	mockRepo.On("GetURLByShortCode", ctx, "abc123").Return(current, nil)
+	mockRepo.On("UpdateURL", ctx, mock.MatchedBy(func(url *models.URL) bool {
+		return len(url.Variants) == 2 && url.Variants[0].Clicks == 30 && url.Variants[1].Clicks == 0
+	})).Return(nil)
+	mockHistory.On("CreateRevision", ctx, mock.AnythingOfType("*models.Revision")).Return(nil)
+
+	result, err := service.RollbackURL(ctx, "abc123", "rev1")
+
+	assert.NoError(t, err)
+	assert.Equal(t, 50, result.AccessCount)
+	assert.Equal(t, 1, result.Variants[0].Weight)
+	assert.Equal(t, 2, revision.After.Variants[0].Clicks)
+	mockRepo.AssertExpectations(t)
+}
+
+// TestURLService_RollbackURLLookupFailure tests that a failed lookup is returned rather than taken for a deleted URL
+func TestURLService_RollbackURLLookupFailure(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockHistory := new(MockHistoryRepository)
+	service := NewURLService(mockRepo, mockHistory)
+	ctx := context.Background()
+
+	revision := &models.Revision{ID: "rev1", ShortCode: "abc123", After: &models.URL{ShortCode: "abc123", OriginalURL: "https://example.com"}}
+	lookupErr := fmt.Errorf("server selection timeout")
+	mockHistory.On("GetRevision", ctx, "abc123", "rev1").Return(revision, nil)
+	mockRepo.On("GetURLByShortCode", ctx, "abc123").Return(nil, lookupErr)
+
+	_, err := service.RollbackURL(ctx, "abc123", "rev1")
+
+	assert.Equal(t, lookupErr, err)
+	mockRepo.AssertNotCalled(t, "CreateURL", mock.Anything, mock.Anything)
+	mockHistory.AssertNotCalled(t, "CreateRevision", mock.Anything, mock.Anything)
+}
+
+// TestURLService_GetHistory tests that URLs without revisions have an empty history and unknown ones none
+func TestURLService_GetHistory(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockHistory := new(MockHistoryRepository)
+	service := NewURLService(mockRepo, mockHistory)
+	ctx := context.Background()
+
+	mockHistory.On("ListRevisions", ctx, "old123").Return([]*models.Revision{}, nil)
+	mockHistory.On("ListRevisions", ctx, "nope12").Return([]*models.Revision{}, nil)
+	mockRepo.On("GetURLByShortCode", ctx, "old123").Return(&models.URL{ShortCode: "old123"}, nil)
+	mockRepo.On("GetURLByShortCode", ctx, "nope12").Return(nil, repositories.ErrURLNotFound)
+
+	revisions, err := service.GetHistory(ctx, "old123")
+	assert.NoError(t, err)
+	assert.NotNil(t, revisions)
+	assert.Empty(t, revisions)
+
+	_, err = service.GetHistory(ctx, "nope12")
+	assert.ErrorIs(t, err, repositories.ErrURLNotFound)
+}
+
+// TestURLService_GetHistoryHidesProtectedDestination tests that revisions do not reveal where a protected URL leads
+func TestURLService_GetHistoryHidesProtectedDestination(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockHistory := new(MockHistoryRepository)
+	service := NewURLService(mockRepo, mockHistory)
+	ctx := context.Background()
+
+	before := &models.URL{ShortCode: "abc123", OriginalURL: "https://internal.example.com"}
+	after := &models.URL{ShortCode: "abc123", OriginalURL: "https://internal.example.com", PasswordProtected: true}
+	mockHistory.On("ListRevisions", ctx, "abc123").Return([]*models.Revision{
+		{ID: "rev1", ShortCode: "abc123", Action: models.RevisionActionCreate, After: before},
+		{ID: "rev2", ShortCode: "abc123", Action: models.RevisionActionUpdate, Before: before, After: after},
+	}, nil)
+	mockRepo.On("GetURLByShortCode", ctx, "abc123").Return(after, nil)
+
+	revisions, err := service.GetHistory(ctx, "abc123")
+
+	assert.NoError(t, err)
+	assert.Len(t, revisions, 2)
+	for _, revision := range revisions {
+		assert.Empty(t, revision.After.OriginalURL)
+	}
+	assert.Nil(t, revisions[0].Before)
+	assert.Empty(t, revisions[1].Before.OriginalURL)
+	assert.Equal(t, "https://internal.example.com", before.OriginalURL)
+}
+
+// TestURLService_RollbackURLToDeleteRevision tests that a delete revision cannot be restored
+func TestURLService_RollbackURLToDeleteRevision(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockHistory := new(MockHistoryRepository)
+	service := NewURLService(mockRepo, mockHistory)
+	ctx := context.Background()
+
+	revision := &models.Revision{ID: "rev2", ShortCode: "abc123", Action: models.RevisionActionDelete}
+	mockHistory.On("GetRevision", ctx, "abc123", "rev2").Return(revision, nil)
+
+	_, err := service.RollbackURL(ctx, "abc123", "rev2")
+
+	assert.ErrorIs(t, err, ErrRevisionNotRestorable)
+	mockRepo.AssertExpectations(t)
+}
+
+// TestURLService_UpdateURLVersionMismatch tests that UpdateURL rejects a stale expected version
+func TestURLService_UpdateURLVersionMismatch(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockHistory := new(MockHistoryRepository)
+	service := NewURLService(mockRepo, mockHistory)
+	ctx := context.Background()
+
+	existing := &models.URL{OriginalURL: "https://example.com", ShortCode: "abc123", Version: 3}
+	mockRepo.On("GetURLByShortCode", ctx, "abc123").Return(existing, nil)
+
+	_, err := service.UpdateURL(ctx, "abc123", "https://example.org", URLOptions{}, []int64{1, 2})
+
+	assert.ErrorIs(t, err, ErrPreconditionFailed)
+	mockRepo.AssertNotCalled(t, "UpdateURL", mock.Anything, mock.Anything)
+	mockHistory.AssertNotCalled(t, "CreateRevision", mock.Anything, mock.Anything)
+}
+
+// TestURLService_DeleteURLUsesReadVersion tests that DeleteURL deletes conditionally on the version it read
+func TestURLService_DeleteURLUsesReadVersion(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockHistory := new(MockHistoryRepository)
+	service := NewURLService(mockRepo, mockHistory)
+	ctx := context.Background()
+
+	existing := &models.URL{OriginalURL: "https://example.com", ShortCode: "abc123", Version: 3}
+	mockRepo.On("GetURLByShortCode", ctx, "abc123").Return(existing, nil)
+	mockRepo.On("DeleteURL", ctx, "abc123", int64(3)).Return(nil)
+	mockHistory.On("CreateRevision", ctx, mock.AnythingOfType("*models.Revision")).Return(nil)
+
+	err := service.DeleteURL(ctx, "abc123", []int64{2, 3})
+
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+}
+
+// TestURLService_PatchURL tests applying a merge patch to an existing URL
+func TestURLService_PatchURL(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockHistory := new(MockHistoryRepository)
+	service := NewURLService(mockRepo, mockHistory)
+	ctx := context.Background()
+
+	existing := &models.URL{OriginalURL: "https://example.com", ShortCode: "abc123", AccessCount: 7, Version: 2}
+	patch := models.URLPatch{"original_url": "https://example.org"}
+
+	mockRepo.On("GetURLByShortCode", ctx, "abc123").Return(existing, nil)
+	mockRepo.On("PatchURL", ctx, mock.MatchedBy(func(url *models.URL) bool {
+		return url.OriginalURL == "https://example.org" && url.AccessCount == 7 && url.Version == 2
+	}), patch).Return(nil)
+	mockHistory.On("CreateRevision", ctx, mock.AnythingOfType("*models.Revision")).Return(nil)
+
+	result, err := service.PatchURL(ctx, "abc123", patch, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.org", result.OriginalURL)
+	assert.Equal(t, "abc123", result.ShortCode)
+	mockRepo.AssertExpectations(t)
+}
+
+// TestURLService_PatchURLLabels tests that patched labels are merged into the current ones key by key
+func TestURLService_PatchURLLabels(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockHistory := new(MockHistoryRepository)
+	service := NewURLService(mockRepo, mockHistory)
+	ctx := context.Background()
+
+	existing := &models.URL{OriginalURL: "https://example.com", ShortCode: "abc123", Labels: map[string]string{"env": "prod", "team": "growth"}}
+	patch := models.URLPatch{"labels.env": nil, "labels.channel": "print"}
+
+	mockRepo.On("GetURLByShortCode", ctx, "abc123").Return(existing, nil)
+	mockRepo.On("PatchURL", ctx, mock.AnythingOfType("*models.URL"), patch).Return(nil)
+	mockHistory.On("CreateRevision", ctx, mock.AnythingOfType("*models.Revision")).Return(nil)
+
+	result, err := service.PatchURL(ctx, "abc123", patch, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "growth", "channel": "print"}, result.Labels)
+	mockRepo.AssertExpectations(t)
+
+	// The labels once merged are bounded
+	many := models.URLPatch{}
+	for i := 0; i < models.MaxLabels; i++ {
+		many[fmt.Sprintf("labels.l%d", i)] = "x"
+	}
+	_, err = service.PatchURL(ctx, "abc123", many, nil)
+	assert.ErrorIs(t, err, ErrTooManyLabels)
+}
+
+// TestURLService_PatchURLUTM tests that patched UTM parameters are merged into the current ones,
+// and that removing them all removes the UTM block
+func TestURLService_PatchURLUTM(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockHistory := new(MockHistoryRepository)
+	service := NewURLService(mockRepo, mockHistory)
+	ctx := context.Background()
+
+	utm := &models.UTMParams{Source: "newsletter", Medium: "email", Campaign: "spring"}
+	mockRepo.On("GetURLByShortCode", ctx, "abc123").Return(&models.URL{OriginalURL: "https://example.com", ShortCode: "abc123", UTM: utm}, nil).Once()
+	mockRepo.On("GetURLByShortCode", ctx, "abc123").Return(&models.URL{OriginalURL: "https://example.com", ShortCode: "abc123", UTM: utm}, nil).Once()
+	mockRepo.On("PatchURL", ctx, mock.AnythingOfType("*models.URL"), models.URLPatch{"utm.source": "print", "utm.medium": nil}).Return(nil).Once()
+	mockRepo.On("PatchURL", ctx, mock.AnythingOfType("*models.URL"), models.URLPatch{"utm": nil}).Return(nil).Once()
+	mockHistory.On("CreateRevision", ctx, mock.AnythingOfType("*models.Revision")).Return(nil)
+
+	result, err := service.PatchURL(ctx, "abc123", models.URLPatch{"utm.source": "print", "utm.medium": nil}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, &models.UTMParams{Source: "print", Campaign: "spring"}, result.UTM)
+
+	result, err = service.PatchURL(ctx, "abc123", models.URLPatch{"utm.source": nil, "utm.medium": nil, "utm.campaign": nil}, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, result.UTM)
+	mockRepo.AssertExpectations(t)
+}
+
+// TestURLService_ResolveURLWithPassword tests that a protected URL only resolves with the right password
+func TestURLService_ResolveURLWithPassword(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockHistory := new(MockHistoryRepository)
+	service := NewURLService(mockRepo, mockHistory)
+	ctx := context.Background()
+
+	protected := &models.URL{OriginalURL: "https://example.com/internal", ShortCode: "abc123"}
+	assert.NoError(t, applyOptions(protected, URLOptions{Password: "s3cret"}))
+	assert.True(t, protected.PasswordProtected)
+	assert.NotEqual(t, "s3cret", protected.PasswordHash)
+
+	mockRepo.On("GetURLByShortCode", ctx, "abc123").Return(protected, nil)
+	mockRepo.On("IncrementURLAccessCount", ctx, "abc123", "").Return(nil).Once()
+
+	_, err := service.ResolveURL(ctx, "abc123", "", models.Visitor{})
+	assert.ErrorIs(t, err, ErrPasswordRequired)
+
+	_, err = service.ResolveURL(ctx, "abc123", "wrong", models.Visitor{})
+	assert.ErrorIs(t, err, ErrInvalidPassword)
+
+	result, err := service.ResolveURL(ctx, "abc123", "s3cret", models.Visitor{})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com/internal", result.Destination)
+
+	mockRepo.AssertExpectations(t)
+}
+
+// TestURLService_PreviewURLSingleUse tests that previewing a single-use URL neither reveals its destination nor consumes it
+func TestURLService_PreviewURLSingleUse(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockHistory := new(MockHistoryRepository)
+	service := NewURLService(mockRepo, mockHistory)
+	ctx := context.Background()
+
+	url := &models.URL{OriginalURL: "https://example.com/secret", ShortCode: "abc123", SingleUse: true,
+		Variants: []models.Variant{{ID: "a", Destination: "https://example.com/a", Weight: 1}}}
+	mockRepo.On("GetURLByShortCode", ctx, "abc123").Return(url, nil)
+
+	for i := 0; i < 2; i++ {
+		preview, err := service.PreviewURL(ctx, "abc123", models.Visitor{})
+		assert.NoError(t, err)
+		assert.Empty(t, preview.Destination)
+		assert.Empty(t, preview.Variant)
+	}
+
+	mockRepo.AssertNotCalled(t, "ConsumeURL", mock.Anything, mock.Anything, mock.Anything)
+	mockRepo.AssertNotCalled(t, "IncrementURLAccessCount", mock.Anything, mock.Anything, mock.Anything)
+}
+
+// TestURLService_ResolveURLPreview tests that URLs in preview mode resolve only once the visitor
+// confirmed the preview, and that previewing counts no access
+func TestURLService_ResolveURLPreview(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockHistory := new(MockHistoryRepository)
+	service := NewURLService(mockRepo, mockHistory)
+	ctx := context.Background()
+
+	url := &models.URL{OriginalURL: "https://example.com/report", ShortCode: "abc123", Preview: true}
+	mockRepo.On("GetURLByShortCode", ctx, "abc123").Return(url, nil)
+	mockRepo.On("IncrementURLAccessCount", ctx, "abc123", "").Return(nil).Once()
+
+	_, err := service.ResolveURL(ctx, "abc123", "", models.Visitor{})
+	assert.ErrorIs(t, err, ErrPreviewRequired)
+
+	preview, err := service.PreviewURL(ctx, "abc123", models.Visitor{})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com/report", preview.Destination)
+
+	result, err := service.ResolveURL(ctx, "abc123", "", models.Visitor{ConfirmedPreview: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com/report", result.Destination)
+
+	mockRepo.AssertExpectations(t)
+}
+
+// stubFetcher returns fixed metadata and records the URLs it fetched
+type stubFetcher struct {
+	metadata *models.Metadata
+	fetched  []string
+}
+
+func (f *stubFetcher) Fetch(ctx context.Context, rawURL string) *models.Metadata {
+	f.fetched = append(f.fetched, rawURL)
+	return f.metadata
+}
+
+// inlineRunner runs submitted tasks immediately, as if a worker had picked them up
+type inlineRunner struct{}
+
+func (inlineRunner) Submit(task func(ctx context.Context)) bool {
+	task(context.Background())
+	return true
+}
+
+// TestURLService_CreateShortURLFetchesMetadata tests that metadata is fetched after creation
+// and stored on the domain of the request
+func TestURLService_CreateShortURLFetchesMetadata(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockHistory := new(MockHistoryRepository)
+	fetcher := &stubFetcher{metadata: &models.Metadata{Title: "Example", StatusCode: 200}}
+	service := NewURLService(mockRepo, mockHistory, WithMetadata(fetcher, inlineRunner{}))
+	ctx := reqctx.WithDomain(context.Background(), models.Domain{Host: "acme.link"})
+
+	mockRepo.On("CreateURL", ctx, mock.AnythingOfType("*models.URL")).Return(nil)
+	mockHistory.On("CreateRevision", ctx, mock.AnythingOfType("*models.Revision")).Return(nil)
+	mockRepo.On("UpdateURLMetadata", mock.MatchedBy(func(ctx context.Context) bool {
+		return reqctx.Domain(ctx).Host == "acme.link"
+	}), mock.AnythingOfType("string"), "https://example.com", fetcher.metadata).Return(nil)
+
+	_, err := service.CreateShortURL(ctx, "https://example.com", URLOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"https://example.com"}, fetcher.fetched)
+
+	mockRepo.AssertExpectations(t)
+}
+
+// TestURLService_RefreshMetadata tests fetching metadata on demand and refusing when fetching is disabled
+func TestURLService_RefreshMetadata(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockHistory := new(MockHistoryRepository)
+	fetcher := &stubFetcher{metadata: &models.Metadata{Title: "Report", StatusCode: 200}}
+	service := NewURLService(mockRepo, mockHistory, WithMetadata(fetcher, inlineRunner{}))
+	ctx := context.Background()
+
+	url := &models.URL{OriginalURL: "https://example.com/report", ShortCode: "abc123"}
+	mockRepo.On("GetURLByShortCode", ctx, "abc123").Return(url, nil)
+	mockRepo.On("UpdateURLMetadata", ctx, "abc123", "https://example.com/report", fetcher.metadata).Return(nil)
+
+	result, err := service.RefreshMetadata(ctx, "abc123")
+	assert.NoError(t, err)
+	assert.Equal(t, "Report", result.Metadata.Title)
+	mockRepo.AssertExpectations(t)
+
+	_, err = NewURLService(mockRepo, mockHistory).RefreshMetadata(ctx, "abc123")
+	assert.ErrorIs(t, err, ErrMetadataDisabled)
+}
+
+// TestURLService_ResolveURLFallback tests that visitors are sent to the fallback while the destination is down
+func TestURLService_ResolveURLFallback(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockHistory := new(MockHistoryRepository)
+	service := NewURLService(mockRepo, mockHistory)
+	ctx := context.Background()
+
+	url := &models.URL{
+		OriginalURL: "https://example.com/report",
+		ShortCode:   "abc123",
+		FallbackURL: "https://example.com/archive",
+		Health:      &models.Health{Status: models.HealthStatusUp, ConsecutiveFailures: 1},
+	}
+	mockRepo.On("GetURLByShortCode", ctx, "abc123").Return(url, nil)
+	mockRepo.On("IncrementURLAccessCount", ctx, "abc123", "").Return(nil)
+
+	result, err := service.ResolveURL(ctx, "abc123", "", models.Visitor{})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com/report", result.Destination)
+
+	url.Health = &models.Health{Status: models.HealthStatusDown, ConsecutiveFailures: 2}
+	result, err = service.ResolveURL(ctx, "abc123", "", models.Visitor{})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com/archive", result.Destination)
+}
+
+// TestURLService_UpdateURLClearsHealth tests that changing the destination discards the health of the previous one
+func TestURLService_UpdateURLClearsHealth(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockHistory := new(MockHistoryRepository)
+	service := NewURLService(mockRepo, mockHistory)
+	ctx := context.Background()
+
+	url := &models.URL{
+		OriginalURL: "https://example.com/old",
+		ShortCode:   "abc123",
+		Version:     1,
+		Health:      &models.Health{Status: models.HealthStatusDown},
+	}
+	mockRepo.On("GetURLByShortCode", ctx, "abc123").Return(url, nil)
+	mockRepo.On("UpdateURL", ctx, mock.MatchedBy(func(u *models.URL) bool {
+		return u.OriginalURL == "https://example.com/new" && u.Health == nil
+	})).Return(nil)
+	mockHistory.On("CreateRevision", ctx, mock.AnythingOfType("*models.Revision")).Return(nil)
+
+	_, err := service.UpdateURL(ctx, "abc123", "https://example.com/new", URLOptions{}, nil)
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+}
+
+// TestURLService_ExportURLs tests that exports page through every URL matching the filter
+func TestURLService_ExportURLs(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockHistory := new(MockHistoryRepository)
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	service := NewURLService(mockRepo, mockHistory, WithClock(func() time.Time { return now }))
+	ctx := context.Background()
+
+	page := make([]*models.URL, maxListLimit)
+	for i := range page {
+		page[i] = &models.URL{ShortCode: "code"}
+	}
+	last := []*models.URL{{ShortCode: "last"}}
+
+	filter := models.URLFilter{Tags: []string{"spring"}, Now: now, Limit: maxListLimit}
+	mockRepo.On("ListURLs", ctx, filter).Return(page, nil).Once()
+	filter.Offset = maxListLimit
+	mockRepo.On("ListURLs", ctx, filter).Return(last, nil).Once()
+
+	var exported []string
+	err := service.ExportURLs(ctx, models.URLFilter{Tags: []string{"spring"}, Limit: 5, Offset: 10}, func(url *models.URL) error {
+		exported = append(exported, url.ShortCode)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Len(t, exported, maxListLimit+1)
+	assert.Equal(t, "last", exported[maxListLimit])
+	mockRepo.AssertExpectations(t)
+}
+
+// TestURLService_ResolveSingleUseURL tests that a single-use URL is consumed by the first visitor only
+func TestURLService_ResolveSingleUseURL(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockHistory := new(MockHistoryRepository)
+	service := NewURLService(mockRepo, mockHistory)
+	ctx := context.Background()
+
+	visitor := models.Visitor{IP: "192.0.2.1", UserAgent: "test-agent"}
+	fresh := &models.URL{OriginalURL: "https://example.com/reset", ShortCode: "once01", SingleUse: true}
+	consumed := &models.URL{
+		OriginalURL: "https://example.com/reset",
+		ShortCode:   "once01",
+		SingleUse:   true,
+		ConsumedBy:  &models.Consumption{Visitor: visitor},
+	}
+
+	mockRepo.On("GetURLByShortCode", ctx, "once01").Return(fresh, nil).Once()
+	mockRepo.On("ConsumeURL", ctx, "once01", mock.MatchedBy(func(c *models.Consumption) bool {
+		return c.IP == "192.0.2.1" && c.UserAgent == "test-agent" && !c.ConsumedAt.IsZero()
+	})).Return(consumed, nil).Once()
+
+	result, err := service.ResolveURL(ctx, "once01", "", visitor)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com/reset", result.Destination)
+
+	mockRepo.On("GetURLByShortCode", ctx, "once01").Return(consumed, nil).Once()
+
+	_, err = service.ResolveURL(ctx, "once01", "", visitor)
+	assert.ErrorIs(t, err, repositories.ErrURLConsumed)
+
+	mockRepo.AssertExpectations(t)
+	mockRepo.AssertNotCalled(t, "IncrementURLAccessCount", mock.Anything, mock.Anything, mock.Anything)
+}
+
+// TestURLService_ResolveURLActivationWindow tests that a URL only resolves inside its activation window
+func TestURLService_ResolveURLActivationWindow(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockHistory := new(MockHistoryRepository)
+	now := time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+	service := NewURLService(mockRepo, mockHistory, WithClock(func() time.Time { return now }))
+	ctx := context.Background()
+
+	launch := now.Add(time.Hour)
+	end := now.Add(2 * time.Hour)
+	campaign := &models.URL{OriginalURL: "https://example.com/launch", ShortCode: "launch", ActiveFrom: &launch, ActiveUntil: &end}
+
+	mockRepo.On("GetURLByShortCode", ctx, "launch").Return(campaign, nil)
+	mockRepo.On("IncrementURLAccessCount", ctx, "launch", "").Return(nil).Once()
+
+	_, err := service.ResolveURL(ctx, "launch", "", models.Visitor{})
+	assert.ErrorIs(t, err, ErrURLNotYetActive)
+
+	now = launch
+	result, err := service.ResolveURL(ctx, "launch", "", models.Visitor{})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com/launch", result.Destination)
+
+	now = end
+	_, err = service.ResolveURL(ctx, "launch", "", models.Visitor{})
+	assert.ErrorIs(t, err, ErrURLEnded)
+
+	mockRepo.AssertExpectations(t)
+}
+
+// TestURLService_CreateShortURLInvalidWindow tests that a window ending before it starts is rejected
+func TestURLService_CreateShortURLInvalidWindow(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockHistory := new(MockHistoryRepository)
+	service := NewURLService(mockRepo, mockHistory)
+	ctx := context.Background()
+
+	from := time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+	until := from.Add(-time.Hour)
+
+	_, err := service.CreateShortURL(ctx, "https://example.com", URLOptions{ActiveFrom: &from, ActiveUntil: &until})
+
+	assert.ErrorIs(t, err, ErrInvalidActiveWindow)
+	mockRepo.AssertNotCalled(t, "CreateURL", mock.Anything, mock.Anything)
+}
+
+// TestURLService_ListURLsUsesClock tests that listings are evaluated at the service clock with a bounded page size
+func TestURLService_ListURLsUsesClock(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockHistory := new(MockHistoryRepository)
+	now := time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+	service := NewURLService(mockRepo, mockHistory, WithClock(func() time.Time { return now }))
+	ctx := context.Background()
+
+	expected := models.URLFilter{Status: models.LinkStatusScheduled, Now: now, Limit: maxListLimit}
+	mockRepo.On("ListURLs", ctx, expected).Return([]*models.URL{}, nil)
+
+	_, err := service.ListURLs(ctx, models.URLFilter{Status: models.LinkStatusScheduled, Limit: 1000})
+
+	assert.NoError(t, err)
+	mockRepo.AssertExpectations(t)
+}
+
+// TestURLService_ResolveURLTargetingRules tests that matching rules override the original URL
+func TestURLService_ResolveURLTargetingRules(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockHistory := new(MockHistoryRepository)
+	service := NewURLService(mockRepo, mockHistory)
+	ctx := context.Background()
+
+	app := &models.URL{
+		OriginalURL: "https://example.com/app",
+		ShortCode:   "app",
+		Rules: []models.TargetingRule{
+			{Destination: "https://apps.apple.com/app/id1", OS: []string{models.OSIOS}},
+		},
+	}
+	mockRepo.On("GetURLByShortCode", ctx, "app").Return(app, nil)
+	mockRepo.On("IncrementURLAccessCount", ctx, "app", "").Return(nil)
+
+	result, err := service.ResolveURL(ctx, "app", "", models.Visitor{UserAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X)"})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://apps.apple.com/app/id1", result.Destination)
+
+	result, err = service.ResolveURL(ctx, "app", "", models.Visitor{UserAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64)"})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com/app", result.Destination)
+}
+
+// TestURLService_ResolveURLVariants tests weighted variant selection, sticky assignment and click attribution
+func TestURLService_ResolveURLVariants(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockHistory := new(MockHistoryRepository)
+	draw := 0
+	service := NewURLService(mockRepo, mockHistory, WithRandom(func(n int) int { return draw }))
+	ctx := context.Background()
+
+	landing := &models.URL{
+		OriginalURL:    "https://example.com/landing",
+		ShortCode:      "abtest",
+		StickyVariants: true,
+		Variants: []models.Variant{
+			{ID: "a", Destination: "https://example.com/landing-a", Weight: 70},
+			{ID: "b", Destination: "https://example.com/landing-b", Weight: 30},
+		},
+	}
+	mockRepo.On("GetURLByShortCode", ctx, "abtest").Return(landing, nil)
+	mockRepo.On("IncrementURLAccessCount", ctx, "abtest", "a").Return(nil).Once()
+	mockRepo.On("IncrementURLAccessCount", ctx, "abtest", "b").Return(nil).Twice()
+
+	draw = 69
+	result, err := service.ResolveURL(ctx, "abtest", "", models.Visitor{})
+	assert.NoError(t, err)
+	assert.Equal(t, "a", result.Variant)
+	assert.Equal(t, "https://example.com/landing-a", result.Destination)
+
+	draw = 70
+	result, err = service.ResolveURL(ctx, "abtest", "", models.Visitor{})
+	assert.NoError(t, err)
+	assert.Equal(t, "b", result.Variant)
+
+	// A returning visitor keeps their assignment whatever the draw
+	draw = 0
+	result, err = service.ResolveURL(ctx, "abtest", "", models.Visitor{AssignedVariant: "b"})
+	assert.NoError(t, err)
+	assert.Equal(t, "b", result.Variant)
+
+	mockRepo.AssertExpectations(t)
+}
+
+// TestCarryVariantClicks tests that replacing variants keeps the clicks of unchanged IDs
+func TestCarryVariantClicks(t *testing.T) {
+	current := []models.Variant{{ID: "a", Clicks: 12}, {ID: "b", Clicks: 5}}
+	replacement := []models.Variant{{ID: "a", Weight: 50}, {ID: "c", Weight: 50, Clicks: 99}}
+
+	variants := carryVariantClicks(current, replacement)
+
+	assert.Equal(t, 12, variants[0].Clicks)
+	assert.Equal(t, 0, variants[1].Clicks)
+}
+
+// MockVisitorCounter is a mock implementation of the VisitorCounter interface
+type MockVisitorCounter struct {
+	mock.Mock
+}
+
+// Observe counts a visitor of a link
+func (m *MockVisitorCounter) Observe(link models.LinkRef, hash uint64, at time.Time) {
+	m.Called(link, hash, at)
+}
+
+// Summarize estimates the unique visitors of a link
+func (m *MockVisitorCounter) Summarize(ctx context.Context, link models.LinkRef, from, to time.Time) (*models.UniqueVisitors, error) {
+	args := m.Called(ctx, link, from, to)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.UniqueVisitors), args.Error(1)
+}
+
+func (m *MockVisitorCounter) Erase(ctx context.Context, links []models.LinkRef) (int64, error) {
+	args := m.Called(ctx, links)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// TestURLService_UniqueVisitors tests that redirects are counted by a salted visitor hash and summarized over a range of days
+func TestURLService_UniqueVisitors(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockHistory := new(MockHistoryRepository)
+	mockVisitors := new(MockVisitorCounter)
+	now := time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC)
+	anonymizer, _ := privacy.NewAnonymizer(privacy.Options{Secret: []byte("salt")})
+	service := NewURLService(mockRepo, mockHistory,
+		WithClock(func() time.Time { return now }),
+		WithUniqueVisitors(mockVisitors),
+		WithPrivacy(anonymizer),
+	)
+	ctx := context.Background()
+
+	url := &models.URL{OriginalURL: "https://example.com", ShortCode: "abc123", Domain: "acme.link"}
+	link := models.LinkRef{Domain: "acme.link", ShortCode: "abc123"}
+	mockRepo.On("GetURLByShortCode", ctx, "abc123").Return(url, nil)
+	mockRepo.On("IncrementURLAccessCount", ctx, "abc123", "").Return(nil)
+
+	var hashes []uint64
+	mockVisitors.On("Observe", link, mock.Anything, now).Run(func(args mock.Arguments) {
+		hashes = append(hashes, args.Get(1).(uint64))
+	})
+
+	for _, ip := range []string{"192.0.2.1", "192.0.2.1", "192.0.2.2"} {
+		_, err := service.ResolveURL(ctx, "abc123", "", models.Visitor{IP: ip, UserAgent: "test-agent"})
+		assert.NoError(t, err)
+	}
+	assert.Len(t, hashes, 3)
+	assert.Equal(t, hashes[0], hashes[1])
+	assert.NotEqual(t, hashes[0], hashes[2])
+
+	// The range defaults to the 30 days ending today
+	summary := &models.UniqueVisitors{Total: 2, Uniques: 2, Clicks: 3}
+	mockVisitors.On("Summarize", ctx, link, now.AddDate(0, 0, -29), now).Return(summary, nil)
+	visitors, err := service.GetUniqueVisitors(ctx, url, time.Time{}, time.Time{})
+	assert.NoError(t, err)
+	assert.Equal(t, summary, visitors)
+
+	_, err = service.GetUniqueVisitors(ctx, url, now, now.AddDate(0, 0, -1))
+	assert.ErrorIs(t, err, ErrInvalidStatsRange)
+	_, err = service.GetUniqueVisitors(ctx, url, now.AddDate(-2, 0, 0), now)
+	assert.ErrorIs(t, err, ErrInvalidStatsRange)
+
+	// Without a counter no unique visitors are reported
+	visitors, err = NewURLService(mockRepo, mockHistory).GetUniqueVisitors(ctx, url, time.Time{}, time.Time{})
+	assert.NoError(t, err)
+	assert.Nil(t, visitors)
+}
+
+// TestURLService_ResolveURLBots tests that clicks by bots are counted apart and never consume single-use URLs
+func TestURLService_ResolveURLBots(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockHistory := new(MockHistoryRepository)
+	mockClicks := new(MockClickRepository)
+	mockVisitors := new(MockVisitorCounter)
+	service := NewURLService(mockRepo, mockHistory, WithClickLog(mockClicks), WithUniqueVisitors(mockVisitors))
+	ctx := context.Background()
+	bot := models.Visitor{IP: "192.0.2.1", UserAgent: "Slackbot-LinkExpanding 1.0", Bot: true}
+
+	url := &models.URL{OriginalURL: "https://example.com", ShortCode: "abc123", Domain: "acme.link"}
+	mockRepo.On("GetURLByShortCode", ctx, "abc123").Return(url, nil)
+	mockRepo.On("IncrementURLBotCount", ctx, "abc123").Return(nil).Once()
+	mockClicks.On("RecordClick", ctx, mock.MatchedBy(func(click *models.Click) bool { return click.Bot })).Return(nil).Once()
+
+	resolution, err := service.ResolveURL(ctx, "abc123", "", bot)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com", resolution.Destination)
+	mockRepo.AssertNotCalled(t, "IncrementURLAccessCount", mock.Anything, mock.Anything, mock.Anything)
+	mockVisitors.AssertNotCalled(t, "Observe", mock.Anything, mock.Anything, mock.Anything)
+
+	singleUse := &models.URL{OriginalURL: "https://example.com", ShortCode: "once", SingleUse: true}
+	mockRepo.On("GetURLByShortCode", ctx, "once").Return(singleUse, nil)
+
+	_, err = service.ResolveURL(ctx, "once", "", bot)
+	assert.ErrorIs(t, err, ErrBotRefused)
+	mockRepo.AssertNotCalled(t, "ConsumeURL", mock.Anything, mock.Anything, mock.Anything)
+	mockRepo.AssertExpectations(t)
+	mockClicks.AssertExpectations(t)
+}
+
+// TestURLService_ResolveURLPrivacy tests that consumptions store anonymised addresses
+// and that visitors asking not to be tracked are counted without being recorded
+func TestURLService_ResolveURLPrivacy(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockHistory := new(MockHistoryRepository)
+	mockClicks := new(MockClickRepository)
+	mockVisitors := new(MockVisitorCounter)
+	anonymizer, _ := privacy.NewAnonymizer(privacy.Options{Secret: []byte("salt")})
+	service := NewURLService(mockRepo, mockHistory, WithClickLog(mockClicks), WithUniqueVisitors(mockVisitors), WithPrivacy(anonymizer))
+	ctx := context.Background()
+
+	visitor := models.Visitor{IP: "192.0.2.123", UserAgent: "test-agent", Country: "NL"}
+	singleUse := &models.URL{OriginalURL: "https://example.com/reset", ShortCode: "once01", SingleUse: true}
+	mockRepo.On("GetURLByShortCode", ctx, "once01").Return(singleUse, nil)
+	mockRepo.On("ConsumeURL", ctx, "once01", mock.MatchedBy(func(c *models.Consumption) bool {
+		return c.IP == "192.0.2.0" && c.UserAgent == "test-agent" && c.Country == "NL"
+	})).Return(singleUse, nil).Once()
+	mockClicks.On("RecordClick", ctx, mock.AnythingOfType("*models.Click")).Return(nil).Once()
+	mockVisitors.On("Observe", mock.Anything, mock.Anything, mock.Anything).Return().Once()
+
+	_, err := service.ResolveURL(ctx, "once01", "", visitor)
+	assert.NoError(t, err)
+
+	// A visitor asking not to be tracked still counts as an access, but nothing about them is stored
+	untracked := visitor
+	untracked.DoNotTrack = true
+	url := &models.URL{OriginalURL: "https://example.com", ShortCode: "abc123", Domain: "acme.link"}
+	mockRepo.On("GetURLByShortCode", ctx, "abc123").Return(url, nil)
+	mockRepo.On("IncrementURLAccessCount", ctx, "abc123", "").Return(nil).Once()
+
+	resolution, err := service.ResolveURL(ctx, "abc123", "", untracked)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com", resolution.Destination)
+
+	mockRepo.On("ConsumeURL", ctx, "once01", mock.MatchedBy(func(c *models.Consumption) bool {
+		return c.IP == "" && c.UserAgent == "" && c.Country == "" && !c.ConsumedAt.IsZero()
+	})).Return(singleUse, nil).Once()
+
+	_, err = service.ResolveURL(ctx, "once01", "", untracked)
+	assert.NoError(t, err)
+
+	mockRepo.AssertExpectations(t)
+	mockClicks.AssertExpectations(t)
+	mockVisitors.AssertExpectations(t)
+}
+
+// TestURLService_CreateShortURLOwner tests that URLs are owned by the actor creating them, unless anonymous
+func TestURLService_CreateShortURLOwner(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockHistory := new(MockHistoryRepository)
+	service := NewURLService(mockRepo, mockHistory)
+
+	mockRepo.On("CreateURL", mock.Anything, mock.AnythingOfType("*models.URL")).Return(nil)
+	mockHistory.On("CreateRevision", mock.Anything, mock.AnythingOfType("*models.Revision")).Return(nil)
+
+	result, err := service.CreateShortURL(reqctx.WithActor(context.Background(), "alice"), "https://example.com", URLOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", result.Owner)
+
+	result, err = service.CreateShortURL(context.Background(), "https://example.com", URLOptions{})
+	assert.NoError(t, err)
+	assert.Empty(t, result.Owner)
+}
+
+// TestURLService_EraseOwnerData tests that the visitor data of every URL of an owner is erased, a page at a time
+func TestURLService_EraseOwnerData(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockHistory := new(MockHistoryRepository)
+	mockClicks := new(MockClickRepository)
+	mockVisitors := new(MockVisitorCounter)
+	service := NewURLService(mockRepo, mockHistory, WithClickLog(mockClicks), WithUniqueVisitors(mockVisitors))
+	ctx := context.Background()
+
+	page := make([]*models.URL, maxListLimit)
+	links := make([]models.LinkRef, maxListLimit)
+	for i := range page {
+		page[i] = &models.URL{Domain: "acme.link", ShortCode: fmt.Sprintf("code%d", i)}
+		links[i] = models.LinkRef{Domain: "acme.link", ShortCode: page[i].ShortCode}
+	}
+	last := []*models.URL{{Domain: "go.acme.com", ShortCode: "flyer"}}
+	flyer := []models.LinkRef{{Domain: "go.acme.com", ShortCode: "flyer"}}
+
+	mockRepo.On("ListURLs", ctx, models.URLFilter{Owner: "alice", Limit: maxListLimit}).Return(page, nil)
+	mockRepo.On("ListURLs", ctx, models.URLFilter{Owner: "alice", Limit: maxListLimit, Offset: maxListLimit}).Return(last, nil)
+	mockClicks.On("EraseClicks", ctx, links).Return(int64(40), nil)
+	mockClicks.On("EraseClicks", ctx, flyer).Return(int64(2), nil)
+	mockVisitors.On("Erase", ctx, links).Return(int64(6), nil)
+	mockVisitors.On("Erase", ctx, flyer).Return(int64(1), nil)
+	mockRepo.On("EraseConsumptions", ctx, "alice").Return(int64(1), nil)
+
+	erasure, err := service.EraseOwnerData(ctx, "alice")
+	assert.NoError(t, err)
+	assert.Equal(t, &models.Erasure{Owner: "alice", Links: maxListLimit + 1, Clicks: 42, Sketches: 7, Consumptions: 1}, erasure)
+
+	mockRepo.AssertExpectations(t)
+	mockClicks.AssertExpectations(t)
+	mockVisitors.AssertExpectations(t)
+}
+
+// MockClickPublisher is a mock implementation of the ClickPublisher interface
+type MockClickPublisher struct {
+	mock.Mock
+}
+
+func (m *MockClickPublisher) Publish(event models.ClickEvent) {
+	m.Called(event)
+}
+
+// TestURLService_ResolveURLPublishesClick tests that redirects are published to live streams,
+// without the referrer and country of visitors asking not to be tracked
+func TestURLService_ResolveURLPublishesClick(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockHistory := new(MockHistoryRepository)
+	mockLive := new(MockClickPublisher)
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	service := NewURLService(mockRepo, mockHistory, WithClickStream(mockLive), WithClock(func() time.Time { return now }))
+	ctx := context.Background()
+
+	url := &models.URL{OriginalURL: "https://example.com", ShortCode: "abc123", Domain: "acme.link"}
+	link := models.LinkRef{Domain: "acme.link", ShortCode: "abc123"}
+	mockRepo.On("GetURLByShortCode", ctx, "abc123").Return(url, nil)
+	mockRepo.On("IncrementURLAccessCount", ctx, "abc123", "").Return(nil)
+	mockLive.On("Publish", models.ClickEvent{LinkRef: link, Referrer: "news.example.com", Country: "NL", ClickedAt: now}).Return().Once()
+	mockLive.On("Publish", models.ClickEvent{LinkRef: link, ClickedAt: now}).Return().Once()
+
+	visitor := models.Visitor{IP: "192.0.2.1", Referrer: "news.example.com", Country: "NL"}
+	_, err := service.ResolveURL(ctx, "abc123", "", visitor)
+	assert.NoError(t, err)
+
+	visitor.DoNotTrack = true
+	_, err = service.ResolveURL(ctx, "abc123", "", visitor)
+	assert.NoError(t, err)
+
+	mockLive.AssertExpectations(t)
+}
+
+// MockEventNotifier is a mock implementation of the EventNotifier interface
+type MockEventNotifier struct {
+	mock.Mock
+}
+
+func (m *MockEventNotifier) Notify(ctx context.Context, event models.Event) error {
+	args := m.Called(ctx, event)
+	return args.Error(0)
+}
+
+// MockEventSink is a mock implementation of the EventSink interface
+type MockEventSink struct {
+	mock.Mock
+}
+
+func (m *MockEventSink) Emit(ctx context.Context, event models.Event) error {
+	args := m.Called(ctx, event)
+	return args.Error(0)
+}
+
+// txKey marks the context of a transaction run by fakeTransactor
+type txKey struct{}
+
+// fakeTransactor runs functions in a marked context, counting the transactions aborted
+type fakeTransactor struct {
+	aborted int
+}
+
+func (t *fakeTransactor) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	err := fn(context.WithValue(ctx, txKey{}, true))
+	if err != nil {
+		t.aborted++
+	}
+	return err
+}
+
+// retryingTransactor runs functions twice in a marked context, as a transaction retried after a transient error
+type retryingTransactor struct{}
+
+func (retryingTransactor) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	ctx = context.WithValue(ctx, txKey{}, true)
+	if err := fn(ctx); err != nil {
+		return err
+	}
+	return fn(ctx)
+}
+
+// inTransaction matches the context of a transaction
+var inTransaction = mock.MatchedBy(func(ctx context.Context) bool {
+	return ctx.Value(txKey{}) != nil
+})
+
+// eventOfType matches an event of the given type announced at the given time
+func eventOfType(eventType string, at time.Time) interface{} {
+	return mock.MatchedBy(func(event models.Event) bool {
+		return event.Type == eventType && event.OccurredAt.Equal(at) && len(event.ID) == 24
+	})
+}
+
+// TestURLService_EmitsLifecycleEvents tests that creating, updating and deleting a URL is announced to webhooks,
+// and that a failing notifier does not fail the change
+func TestURLService_EmitsLifecycleEvents(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockHistory := new(MockHistoryRepository)
+	mockEvents := new(MockEventNotifier)
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	service := NewURLService(mockRepo, mockHistory, WithWebhooks(mockEvents), WithClock(func() time.Time { return now }))
+	ctx := context.Background()
+
+	mockRepo.On("CreateURL", ctx, mock.AnythingOfType("*models.URL")).Return(nil)
+	mockHistory.On("CreateRevision", ctx, mock.AnythingOfType("*models.Revision")).Return(nil)
+	mockEvents.On("Notify", ctx, eventOfType(models.EventLinkCreated, now)).Return(fmt.Errorf("queue unavailable")).Once()
+
+	created, err := service.CreateShortURL(ctx, "https://example.com", URLOptions{})
+	assert.NoError(t, err)
+
+	existing := &models.URL{OriginalURL: "https://example.com", ShortCode: "abc123", Version: 1}
+	mockRepo.On("GetURLByShortCode", ctx, "abc123").Return(existing, nil)
+	mockRepo.On("UpdateURL", ctx, mock.AnythingOfType("*models.URL")).Return(nil)
+	mockRepo.On("DeleteURL", ctx, "abc123", int64(1)).Return(nil)
+	mockEvents.On("Notify", ctx, mock.MatchedBy(func(event models.Event) bool {
+		return event.Type == models.EventLinkUpdated && event.Data.(*models.URL).OriginalURL == "https://example.org"
+	})).Return(nil).Once()
+	mockEvents.On("Notify", ctx, mock.MatchedBy(func(event models.Event) bool {
+		return event.Type == models.EventLinkDeleted && event.Data.(*models.URL).ShortCode == "abc123"
+	})).Return(nil).Once()
+
+	_, err = service.UpdateURL(ctx, "abc123", "https://example.org", URLOptions{}, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, service.DeleteURL(ctx, "abc123", nil))
+
+	mockEvents.AssertExpectations(t)
+	assert.NotEqual(t, mockEvents.Calls[0].Arguments[1].(models.Event).ID, mockEvents.Calls[1].Arguments[1].(models.Event).ID)
+	assert.Equal(t, created, mockEvents.Calls[0].Arguments[1].(models.Event).Data)
+}
+
+// TestURLService_EmitsClickEvents tests that redirects are announced to webhooks,
+// and that consuming a single-use URL also announces its expiry
+func TestURLService_EmitsClickEvents(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockHistory := new(MockHistoryRepository)
+	mockEvents := new(MockEventNotifier)
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	service := NewURLService(mockRepo, mockHistory, WithWebhooks(mockEvents), WithClock(func() time.Time { return now }))
+	ctx := context.Background()
+
+	url := &models.URL{OriginalURL: "https://example.com", ShortCode: "once", Domain: "acme.link", SingleUse: true}
+	consumed := *url
+	consumed.ConsumedBy = &models.Consumption{ConsumedAt: now}
+	mockRepo.On("GetURLByShortCode", ctx, "once").Return(url, nil)
+	mockRepo.On("ConsumeURL", ctx, "once", mock.AnythingOfType("*models.Consumption")).Return(&consumed, nil)
+	mockEvents.On("Notify", ctx, mock.MatchedBy(func(event models.Event) bool {
+		click, ok := event.Data.(models.ClickEvent)
+		return event.Type == models.EventLinkClicked && ok && click.ShortCode == "once" && click.Referrer == "news.example.com"
+	})).Return(nil).Once()
+	mockEvents.On("Notify", ctx, mock.MatchedBy(func(event models.Event) bool {
+		return event.Type == models.EventLinkExpired && event.Data.(*models.URL).ConsumedBy != nil
+	})).Return(nil).Once()
+
+	_, err := service.ResolveURL(ctx, "once", "", models.Visitor{IP: "192.0.2.1", Referrer: "news.example.com"})
+	assert.NoError(t, err)
+
+	mockEvents.AssertExpectations(t)
+}
+
+// TestURLService_EmitsToSinkInTransaction tests that with transactions, a change and its event are stored together
+// and an event that cannot be emitted fails the change
+func TestURLService_EmitsToSinkInTransaction(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockHistory := new(MockHistoryRepository)
+	mockSink := new(MockEventSink)
+	tx := &fakeTransactor{}
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	service := NewURLService(mockRepo, mockHistory, WithEventSink(mockSink), WithTransactions(tx), WithClock(func() time.Time { return now }))
+	ctx := context.Background()
+
+	mockRepo.On("CreateURL", inTransaction, mock.AnythingOfType("*models.URL")).Return(nil)
+	mockHistory.On("CreateRevision", ctx, mock.AnythingOfType("*models.Revision")).Return(nil)
+	mockSink.On("Emit", inTransaction, eventOfType(models.EventLinkCreated, now)).Return(nil).Once()
+
+	_, err := service.CreateShortURL(ctx, "https://example.com", URLOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, tx.aborted)
+
+	existing := &models.URL{OriginalURL: "https://example.com", ShortCode: "abc123", Version: 1}
+	mockRepo.On("GetURLByShortCode", ctx, "abc123").Return(existing, nil)
+	mockRepo.On("DeleteURL", inTransaction, "abc123", int64(1)).Return(nil)
+	mockSink.On("Emit", inTransaction, eventOfType(models.EventLinkDeleted, now)).Return(fmt.Errorf("outbox unavailable")).Once()
+
+	assert.EqualError(t, service.DeleteURL(ctx, "abc123", nil), "outbox unavailable")
+	assert.Equal(t, 1, tx.aborted)
+
+	mockSink.AssertExpectations(t)
+	mockHistory.AssertNumberOfCalls(t, "CreateRevision", 1)
+}
+
+// TestURLService_RetriedTransactionKeepsVersion tests that a retried transaction writes from the version read before it,
+// not the one incremented by the attempt that failed
+func TestURLService_RetriedTransactionKeepsVersion(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockHistory := new(MockHistoryRepository)
+	mockSink := new(MockEventSink)
+	service := NewURLService(mockRepo, mockHistory, WithEventSink(mockSink), WithTransactions(retryingTransactor{}))
+	ctx := context.Background()
+
+	var written []int64
+	bump := func(args mock.Arguments) {
+		url := args.Get(1).(*models.URL)
+		written = append(written, url.Version)
+		url.Version++
+	}
+	mockRepo.On("GetURLByShortCode", ctx, "abc123").Return(&models.URL{OriginalURL: "https://example.com", ShortCode: "abc123", Version: 3}, nil).Once()
+	mockRepo.On("GetURLByShortCode", ctx, "abc123").Return(&models.URL{OriginalURL: "https://example.com", ShortCode: "abc123", Version: 3}, nil).Once()
+	mockRepo.On("UpdateURL", inTransaction, mock.AnythingOfType("*models.URL")).Run(bump).Return(nil)
+	mockRepo.On("PatchURL", inTransaction, mock.AnythingOfType("*models.URL"), mock.Anything).Run(bump).Return(nil)
+	mockHistory.On("CreateRevision", ctx, mock.AnythingOfType("*models.Revision")).Return(nil)
+	mockSink.On("Emit", inTransaction, mock.Anything).Return(nil)
+
+	updated, err := service.UpdateURL(ctx, "abc123", "https://example.org", URLOptions{}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{3, 3}, written)
+	assert.Equal(t, int64(4), updated.Version)
+
+	written = nil
+	patched, err := service.PatchURL(ctx, "abc123", models.URLPatch{"notes": "moved"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{3, 3}, written)
+	assert.Equal(t, int64(4), patched.Version)
+}
+
+// TestURLService_EmitsToSink tests that without transactions, changes and redirects are emitted after the fact
+// and a failing sink does not fail them
+func TestURLService_EmitsToSink(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockHistory := new(MockHistoryRepository)
+	mockSink := new(MockEventSink)
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	service := NewURLService(mockRepo, mockHistory, WithEventSink(mockSink), WithClock(func() time.Time { return now }))
+	ctx := context.Background()
+
+	existing := &models.URL{OriginalURL: "https://example.com", ShortCode: "abc123", Version: 1}
+	mockRepo.On("GetURLByShortCode", ctx, "abc123").Return(existing, nil)
+	mockRepo.On("UpdateURL", ctx, mock.AnythingOfType("*models.URL")).Return(nil)
+	mockRepo.On("IncrementURLAccessCount", ctx, "abc123", "").Return(nil)
+	mockHistory.On("CreateRevision", ctx, mock.AnythingOfType("*models.Revision")).Return(nil)
+	mockSink.On("Emit", ctx, eventOfType(models.EventLinkUpdated, now)).Return(fmt.Errorf("broker unavailable")).Once()
+	mockSink.On("Emit", ctx, mock.MatchedBy(func(event models.Event) bool {
+		click, ok := event.Data.(models.ClickEvent)
+		return event.Type == models.EventLinkClicked && ok && click.ShortCode == "abc123"
+	})).Return(nil).Once()
+
+	_, err := service.UpdateURL(ctx, "abc123", "https://example.org", URLOptions{}, nil)
+	assert.NoError(t, err)
+
+	_, err = service.ResolveURL(ctx, "abc123", "", models.Visitor{IP: "192.0.2.1"})
+	assert.NoError(t, err)
+
+	mockSink.AssertExpectations(t)
 }
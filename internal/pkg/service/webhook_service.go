@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+	"urlshortener/internal/domain/models"
+	"urlshortener/internal/domain/repositories"
+	"urlshortener/internal/pkg/reqctx"
+)
+
+// webhookSecretBytes is the size of the secrets generated for webhooks created without one
+const webhookSecretBytes = 32
+
+// WebhookService provides methods to manage webhooks and inspect and replay their deliveries
+type WebhookService struct {
+	webhooks   repositories.WebhookRepository
+	deliveries repositories.WebhookDeliveryRepository
+	now        func() time.Time
+}
+
+// NewWebhookService creates a new instance of WebhookService
+func NewWebhookService(webhooks repositories.WebhookRepository, deliveries repositories.WebhookDeliveryRepository) *WebhookService {
+	return &WebhookService{webhooks: webhooks, deliveries: deliveries, now: time.Now}
+}
+
+// CreateWebhook stores a new webhook, owned by the caller unless an owner is given.
+// A secret is generated if none is given; the returned webhook is the only one carrying it.
+func (s *WebhookService) CreateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	webhook.ID = ""
+	if actor := reqctx.Actor(ctx); webhook.Owner == "" && actor != reqctx.AnonymousActor {
+		webhook.Owner = actor
+	}
+	if webhook.Secret == "" {
+		secret, err := newWebhookSecret()
+		if err != nil {
+			return err
+		}
+		webhook.Secret = secret
+	}
+	webhook.CreatedAt = s.now()
+	webhook.UpdatedAt = webhook.CreatedAt
+	return s.webhooks.CreateWebhook(ctx, webhook)
+}
+
+// GetWebhook retrieves a webhook by its ID, without its secret
+func (s *WebhookService) GetWebhook(ctx context.Context, id string) (*models.Webhook, error) {
+	webhook, err := s.webhooks.GetWebhook(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	webhook.Secret = ""
+	return webhook, nil
+}
+
+// ListWebhooks retrieves the webhooks of an owner, or every webhook if owner is empty, without their secrets
+func (s *WebhookService) ListWebhooks(ctx context.Context, owner string) ([]*models.Webhook, error) {
+	webhooks, err := s.webhooks.ListWebhooks(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+	for _, webhook := range webhooks {
+		webhook.Secret = ""
+	}
+	return webhooks, nil
+}
+
+// UpdateWebhook replaces the settings of an existing webhook. The secret is kept unless a new one is given,
+// in which case the returned webhook carries it; deliveries still queued are signed with the new secret.
+func (s *WebhookService) UpdateWebhook(ctx context.Context, id string, update *models.Webhook) (*models.Webhook, error) {
+	webhook, err := s.webhooks.GetWebhook(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	webhook.URL = update.URL
+	webhook.Events = update.Events
+	webhook.Owner = update.Owner
+	if update.Secret != "" {
+		webhook.Secret = update.Secret
+	}
+	webhook.UpdatedAt = s.now()
+
+	if err := s.webhooks.UpdateWebhook(ctx, webhook); err != nil {
+		return nil, err
+	}
+	if update.Secret == "" {
+		webhook.Secret = ""
+	}
+	return webhook, nil
+}
+
+// DeleteWebhook removes a webhook along with its deliveries
+func (s *WebhookService) DeleteWebhook(ctx context.Context, id string) error {
+	if err := s.webhooks.DeleteWebhook(ctx, id); err != nil {
+		return err
+	}
+	return s.deliveries.DeleteDeliveries(ctx, id)
+}
+
+// ListDeliveries retrieves the deliveries of a webhook matching filter, newest first
+func (s *WebhookService) ListDeliveries(ctx context.Context, filter models.DeliveryFilter) ([]*models.WebhookDelivery, error) {
+	if _, err := s.webhooks.GetWebhook(ctx, filter.WebhookID); err != nil {
+		return nil, err
+	}
+
+	if filter.Limit <= 0 {
+		filter.Limit = defaultListLimit
+	}
+	if filter.Limit > maxListLimit {
+		filter.Limit = maxListLimit
+	}
+	return s.deliveries.ListDeliveries(ctx, filter)
+}
+
+// ReplayDelivery queues a delivery of a webhook to be attempted again right away with a fresh set of attempts,
+// whatever its outcome so far
+func (s *WebhookService) ReplayDelivery(ctx context.Context, webhookID, id string) (*models.WebhookDelivery, error) {
+	if err := s.deliveries.ReplayDelivery(ctx, webhookID, id, s.now()); err != nil {
+		return nil, err
+	}
+	return s.deliveries.GetDelivery(ctx, webhookID, id)
+}
+
+// ReplayDeadLetters queues every dead-lettered delivery of a webhook to be attempted again right away
+// and returns how many were queued
+func (s *WebhookService) ReplayDeadLetters(ctx context.Context, webhookID string) (int64, error) {
+	if _, err := s.webhooks.GetWebhook(ctx, webhookID); err != nil {
+		return 0, err
+	}
+	return s.deliveries.ReplayDeadDeliveries(ctx, webhookID, s.now())
+}
+
+// newWebhookSecret generates a random secret for signing deliveries
+func newWebhookSecret() (string, error) {
+	secret := make([]byte, webhookSecretBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
@@ -0,0 +1,214 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"urlshortener/internal/domain/models"
+	"urlshortener/internal/domain/repositories"
+	"urlshortener/internal/pkg/reqctx"
+)
+
+// MockWebhookRepository is a mock implementation of the WebhookRepository interface
+type MockWebhookRepository struct {
+	mock.Mock
+}
+
+func (m *MockWebhookRepository) CreateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	args := m.Called(ctx, webhook)
+	return args.Error(0)
+}
+
+func (m *MockWebhookRepository) GetWebhook(ctx context.Context, id string) (*models.Webhook, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	// Return a copy, as the repository does, so callers cannot change the stored webhook
+	webhook := *args.Get(0).(*models.Webhook)
+	return &webhook, args.Error(1)
+}
+
+func (m *MockWebhookRepository) ListWebhooks(ctx context.Context, owner string) ([]*models.Webhook, error) {
+	args := m.Called(ctx, owner)
+	return args.Get(0).([]*models.Webhook), args.Error(1)
+}
+
+func (m *MockWebhookRepository) ListWebhooksForEvent(ctx context.Context, eventType string) ([]*models.Webhook, error) {
+	args := m.Called(ctx, eventType)
+	return args.Get(0).([]*models.Webhook), args.Error(1)
+}
+
+func (m *MockWebhookRepository) UpdateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	args := m.Called(ctx, webhook)
+	return args.Error(0)
+}
+
+func (m *MockWebhookRepository) DeleteWebhook(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+// MockWebhookDeliveryRepository is a mock implementation of the WebhookDeliveryRepository interface
+type MockWebhookDeliveryRepository struct {
+	mock.Mock
+}
+
+func (m *MockWebhookDeliveryRepository) EnqueueDeliveries(ctx context.Context, deliveries []*models.WebhookDelivery) error {
+	args := m.Called(ctx, deliveries)
+	return args.Error(0)
+}
+
+func (m *MockWebhookDeliveryRepository) ClaimDelivery(ctx context.Context, now time.Time, lease time.Duration) (*models.WebhookDelivery, error) {
+	args := m.Called(ctx, now, lease)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.WebhookDelivery), args.Error(1)
+}
+
+func (m *MockWebhookDeliveryRepository) UpdateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	args := m.Called(ctx, delivery)
+	return args.Error(0)
+}
+
+func (m *MockWebhookDeliveryRepository) GetDelivery(ctx context.Context, webhookID, id string) (*models.WebhookDelivery, error) {
+	args := m.Called(ctx, webhookID, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.WebhookDelivery), args.Error(1)
+}
+
+func (m *MockWebhookDeliveryRepository) ListDeliveries(ctx context.Context, filter models.DeliveryFilter) ([]*models.WebhookDelivery, error) {
+	args := m.Called(ctx, filter)
+	return args.Get(0).([]*models.WebhookDelivery), args.Error(1)
+}
+
+func (m *MockWebhookDeliveryRepository) ReplayDelivery(ctx context.Context, webhookID, id string, now time.Time) error {
+	args := m.Called(ctx, webhookID, id, now)
+	return args.Error(0)
+}
+
+func (m *MockWebhookDeliveryRepository) ReplayDeadDeliveries(ctx context.Context, webhookID string, now time.Time) (int64, error) {
+	args := m.Called(ctx, webhookID, now)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockWebhookDeliveryRepository) DeleteDeliveries(ctx context.Context, webhookID string) error {
+	args := m.Called(ctx, webhookID)
+	return args.Error(0)
+}
+
+// TestWebhookService_CreateWebhook tests that webhooks are owned by the caller and get a secret unless given one
+func TestWebhookService_CreateWebhook(t *testing.T) {
+	mockWebhooks := new(MockWebhookRepository)
+	service := NewWebhookService(mockWebhooks, new(MockWebhookDeliveryRepository))
+	ctx := reqctx.WithActor(context.Background(), "alice")
+
+	mockWebhooks.On("CreateWebhook", mock.Anything, mock.AnythingOfType("*models.Webhook")).Return(nil)
+
+	webhook := &models.Webhook{URL: "https://hooks.example.com", Events: []string{models.EventLinkCreated}}
+	assert.NoError(t, service.CreateWebhook(ctx, webhook))
+	assert.Equal(t, "alice", webhook.Owner)
+	assert.Regexp(t, `^[0-9a-f]{64}$`, webhook.Secret)
+
+	given := &models.Webhook{URL: "https://hooks.example.com", Owner: "bob", Secret: "0123456789abcdef"}
+	assert.NoError(t, service.CreateWebhook(context.Background(), given))
+	assert.Equal(t, "bob", given.Owner)
+	assert.Equal(t, "0123456789abcdef", given.Secret)
+}
+
+// TestWebhookService_SecretNotReturned tests that the secret of a webhook is only returned when it is replaced
+func TestWebhookService_SecretNotReturned(t *testing.T) {
+	mockWebhooks := new(MockWebhookRepository)
+	service := NewWebhookService(mockWebhooks, new(MockWebhookDeliveryRepository))
+	ctx := context.Background()
+
+	stored := &models.Webhook{ID: "wh1", URL: "https://hooks.example.com", Secret: "0123456789abcdef"}
+	mockWebhooks.On("GetWebhook", ctx, "wh1").Return(stored, nil)
+	mockWebhooks.On("ListWebhooks", ctx, "").Return([]*models.Webhook{{ID: "wh1", Secret: "0123456789abcdef"}}, nil)
+
+	webhook, err := service.GetWebhook(ctx, "wh1")
+	assert.NoError(t, err)
+	assert.Empty(t, webhook.Secret)
+
+	webhooks, err := service.ListWebhooks(ctx, "")
+	assert.NoError(t, err)
+	assert.Empty(t, webhooks[0].Secret)
+
+	// Updating without a secret keeps the stored one
+	mockWebhooks.On("UpdateWebhook", ctx, mock.MatchedBy(func(webhook *models.Webhook) bool {
+		return webhook.Secret == "0123456789abcdef" && webhook.URL == "https://hooks.example.org"
+	})).Return(nil).Once()
+	updated, err := service.UpdateWebhook(ctx, "wh1", &models.Webhook{URL: "https://hooks.example.org", Events: []string{models.EventLinkClicked}})
+	assert.NoError(t, err)
+	assert.Empty(t, updated.Secret)
+	assert.Equal(t, []string{models.EventLinkClicked}, updated.Events)
+
+	mockWebhooks.On("UpdateWebhook", ctx, mock.MatchedBy(func(webhook *models.Webhook) bool {
+		return webhook.Secret == "fedcba9876543210"
+	})).Return(nil).Once()
+	updated, err = service.UpdateWebhook(ctx, "wh1", &models.Webhook{URL: "https://hooks.example.org", Secret: "fedcba9876543210"})
+	assert.NoError(t, err)
+	assert.Equal(t, "fedcba9876543210", updated.Secret)
+
+	mockWebhooks.AssertExpectations(t)
+}
+
+// TestWebhookService_DeleteWebhook tests that deleting a webhook deletes its deliveries
+func TestWebhookService_DeleteWebhook(t *testing.T) {
+	mockWebhooks := new(MockWebhookRepository)
+	mockDeliveries := new(MockWebhookDeliveryRepository)
+	service := NewWebhookService(mockWebhooks, mockDeliveries)
+	ctx := context.Background()
+
+	mockWebhooks.On("DeleteWebhook", ctx, "missing").Return(repositories.ErrWebhookNotFound)
+	mockWebhooks.On("DeleteWebhook", ctx, "wh1").Return(nil)
+	mockDeliveries.On("DeleteDeliveries", ctx, "wh1").Return(nil)
+
+	assert.ErrorIs(t, service.DeleteWebhook(ctx, "missing"), repositories.ErrWebhookNotFound)
+	assert.NoError(t, service.DeleteWebhook(ctx, "wh1"))
+
+	mockDeliveries.AssertExpectations(t)
+	mockDeliveries.AssertNotCalled(t, "DeleteDeliveries", ctx, "missing")
+}
+
+// TestWebhookService_Deliveries tests listing deliveries with a bounded page size and replaying them
+func TestWebhookService_Deliveries(t *testing.T) {
+	mockWebhooks := new(MockWebhookRepository)
+	mockDeliveries := new(MockWebhookDeliveryRepository)
+	service := NewWebhookService(mockWebhooks, mockDeliveries)
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	service.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	mockWebhooks.On("GetWebhook", ctx, "wh1").Return(&models.Webhook{ID: "wh1"}, nil)
+	mockWebhooks.On("GetWebhook", ctx, "missing").Return(nil, repositories.ErrWebhookNotFound)
+
+	dead := models.DeliveryFilter{WebhookID: "wh1", Status: models.DeliveryDead, Limit: maxListLimit}
+	mockDeliveries.On("ListDeliveries", ctx, dead).Return([]*models.WebhookDelivery{{ID: "d1"}}, nil)
+	deliveries, err := service.ListDeliveries(ctx, models.DeliveryFilter{WebhookID: "wh1", Status: models.DeliveryDead, Limit: 1000})
+	assert.NoError(t, err)
+	assert.Len(t, deliveries, 1)
+
+	_, err = service.ListDeliveries(ctx, models.DeliveryFilter{WebhookID: "missing"})
+	assert.ErrorIs(t, err, repositories.ErrWebhookNotFound)
+
+	mockDeliveries.On("ReplayDelivery", ctx, "wh1", "d1", now).Return(nil)
+	mockDeliveries.On("GetDelivery", ctx, "wh1", "d1").Return(&models.WebhookDelivery{ID: "d1", Status: models.DeliveryPending}, nil)
+	delivery, err := service.ReplayDelivery(ctx, "wh1", "d1")
+	assert.NoError(t, err)
+	assert.Equal(t, models.DeliveryPending, delivery.Status)
+
+	mockDeliveries.On("ReplayDeadDeliveries", ctx, "wh1", now).Return(int64(3), nil)
+	replayed, err := service.ReplayDeadLetters(ctx, "wh1")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), replayed)
+
+	mockDeliveries.AssertExpectations(t)
+}
@@ -0,0 +1,139 @@
+package targeting
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"urlshortener/internal/domain/models"
+)
+
+// Match returns the destination of the first rule matching the visitor
+func Match(rules []models.TargetingRule, visitor models.Visitor) (string, bool) {
+	if len(rules) == 0 {
+		return "", false
+	}
+
+	// Only work out the visitor's attributes once for all rules
+	attrs := visitorAttributes{
+		os:       DetectOS(visitor.UserAgent),
+		device:   DetectDevice(visitor.UserAgent),
+		language: PreferredLanguage(visitor.AcceptLanguage),
+		country:  strings.ToUpper(visitor.Country),
+		query:    visitor.Query,
+	}
+
+	for _, rule := range rules {
+		if attrs.matches(rule) {
+			return rule.Destination, true
+		}
+	}
+	return "", false
+}
+
+// visitorAttributes holds the visitor properties that rules are matched against
+type visitorAttributes struct {
+	os       string
+	device   string
+	language string
+	country  string
+	query    map[string][]string
+}
+
+// matches reports whether every condition set on the rule holds for the visitor
+func (a visitorAttributes) matches(rule models.TargetingRule) bool {
+	if len(rule.OS) > 0 && !containsFold(rule.OS, a.os) {
+		return false
+	}
+	if len(rule.Devices) > 0 && !containsFold(rule.Devices, a.device) {
+		return false
+	}
+	if len(rule.Languages) > 0 && !matchesLanguage(rule.Languages, a.language) {
+		return false
+	}
+	if len(rule.Countries) > 0 && !containsFold(rule.Countries, a.country) {
+		return false
+	}
+	for key, want := range rule.Query {
+		values, ok := a.query[key]
+		if !ok {
+			return false
+		}
+		if want != "" && !contains(values, want) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesLanguage reports whether a language tag matches any of the wanted tags.
+// A wanted primary tag such as "en" also matches regional variants such as "en-GB".
+func matchesLanguage(wanted []string, language string) bool {
+	if language == "" {
+		return false
+	}
+	for _, w := range wanted {
+		if strings.EqualFold(w, language) || strings.HasPrefix(strings.ToLower(language), strings.ToLower(w)+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+// PreferredLanguage returns the language tag with the highest quality in an Accept-Language header
+func PreferredLanguage(header string) string {
+	type weighted struct {
+		tag     string
+		quality float64
+	}
+
+	var languages []weighted
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		tag := strings.TrimSpace(fields[0])
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		quality := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					quality = q
+				}
+			}
+		}
+		if quality > 0 {
+			languages = append(languages, weighted{tag: tag, quality: quality})
+		}
+	}
+	if len(languages) == 0 {
+		return ""
+	}
+
+	// Keep the header order among languages of equal quality
+	sort.SliceStable(languages, func(i, j int) bool {
+		return languages[i].quality > languages[j].quality
+	})
+	return languages[0].tag
+}
+
+// containsFold reports whether value is in values, ignoring case
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// contains reports whether value is in values
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
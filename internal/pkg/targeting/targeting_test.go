@@ -0,0 +1,74 @@
+package targeting
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"urlshortener/internal/domain/models"
+)
+
+const (
+	iPhoneUA   = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1"
+	androidUA  = "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36"
+	macUA      = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Safari/605.1.15"
+	chromeOSUA = "Mozilla/5.0 (X11; CrOS x86_64 14541.0.0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+	outlookUA  = "Microsoft Office/16.0 (Windows NT 10.0; Microsoft Outlook 16.0.17126; Pro)"
+	windowsUA  = "Mozilla/5.0 (Windows NT 10.0; Win64; x64; Microsoft) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+)
+
+// TestDetectOSAndDevice tests classifying common user agents
+func TestDetectOSAndDevice(t *testing.T) {
+	assert.Equal(t, models.OSIOS, DetectOS(iPhoneUA))
+	assert.Equal(t, models.DeviceMobile, DetectDevice(iPhoneUA))
+
+	assert.Equal(t, models.OSAndroid, DetectOS(androidUA))
+	assert.Equal(t, models.DeviceMobile, DetectDevice(androidUA))
+
+	assert.Equal(t, models.OSMacOS, DetectOS(macUA))
+	assert.Equal(t, models.DeviceDesktop, DetectDevice(macUA))
+
+	assert.Equal(t, models.OSChromeOS, DetectOS(chromeOSUA))
+	assert.Equal(t, models.DeviceDesktop, DetectDevice(chromeOSUA))
+
+	// "Microsoft" contains "cros" but names no ChromeOS device
+	assert.Equal(t, models.OSWindows, DetectOS(outlookUA))
+	assert.Equal(t, models.OSWindows, DetectOS(windowsUA))
+}
+
+// TestPreferredLanguage tests picking the highest quality language from an Accept-Language header
+func TestPreferredLanguage(t *testing.T) {
+	assert.Equal(t, "de-CH", PreferredLanguage("fr;q=0.5, de-CH, en;q=0.9"))
+	assert.Equal(t, "en", PreferredLanguage("en, fr"))
+	assert.Equal(t, "", PreferredLanguage("*, fr;q=0"))
+}
+
+// TestMatch tests that the first matching rule wins and that all of its conditions must hold
+func TestMatch(t *testing.T) {
+	rules := []models.TargetingRule{
+		{Destination: "https://apps.apple.com/app/id1", OS: []string{models.OSIOS}},
+		{Destination: "https://play.google.com/store/apps/details?id=app", OS: []string{models.OSAndroid}},
+		{Destination: "https://example.com/de", Languages: []string{"de"}, Countries: []string{"DE", "AT"}},
+		{Destination: "https://example.com/partner", Query: map[string]string{"ref": "partner"}},
+	}
+
+	dest, ok := Match(rules, models.Visitor{UserAgent: iPhoneUA})
+	assert.True(t, ok)
+	assert.Equal(t, "https://apps.apple.com/app/id1", dest)
+
+	dest, ok = Match(rules, models.Visitor{UserAgent: androidUA})
+	assert.True(t, ok)
+	assert.Equal(t, "https://play.google.com/store/apps/details?id=app", dest)
+
+	dest, ok = Match(rules, models.Visitor{UserAgent: macUA, AcceptLanguage: "de-AT,de;q=0.9", Country: "at"})
+	assert.True(t, ok)
+	assert.Equal(t, "https://example.com/de", dest)
+
+	// Language alone is not enough when the rule also requires a country
+	_, ok = Match(rules, models.Visitor{UserAgent: macUA, AcceptLanguage: "de-DE", Country: "CH"})
+	assert.False(t, ok)
+
+	dest, ok = Match(rules, models.Visitor{UserAgent: macUA, Query: map[string][]string{"ref": {"partner"}}})
+	assert.True(t, ok)
+	assert.Equal(t, "https://example.com/partner", dest)
+}
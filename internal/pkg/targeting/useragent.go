@@ -0,0 +1,46 @@
+package targeting
+
+import (
+	"strings"
+	"urlshortener/internal/domain/models"
+)
+
+// DetectOS returns the operating system named by a User-Agent header, or an empty string if unknown
+func DetectOS(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+
+	switch {
+	// iOS user agents also claim to be "like Mac OS X", so they are checked first
+	case strings.Contains(ua, "iphone"), strings.Contains(ua, "ipad"), strings.Contains(ua, "ipod"):
+		return models.OSIOS
+	// Android user agents also mention Linux
+	case strings.Contains(ua, "android"):
+		return models.OSAndroid
+	// The ChromeOS token is matched as sent, since "cros" also occurs in "Microsoft"
+	case strings.Contains(userAgent, "CrOS "):
+		return models.OSChromeOS
+	case strings.Contains(ua, "windows"):
+		return models.OSWindows
+	case strings.Contains(ua, "macintosh"), strings.Contains(ua, "mac os x"):
+		return models.OSMacOS
+	case strings.Contains(ua, "linux"):
+		return models.OSLinux
+	}
+	return ""
+}
+
+// DetectDevice returns the device class named by a User-Agent header, defaulting to desktop
+func DetectDevice(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+
+	switch {
+	case strings.Contains(ua, "ipad"), strings.Contains(ua, "tablet"):
+		return models.DeviceTablet
+	// Android tablets omit the "Mobile" token that Android phones send
+	case strings.Contains(ua, "android") && !strings.Contains(ua, "mobile"):
+		return models.DeviceTablet
+	case strings.Contains(ua, "mobi"), strings.Contains(ua, "iphone"), strings.Contains(ua, "ipod"):
+		return models.DeviceMobile
+	}
+	return models.DeviceDesktop
+}
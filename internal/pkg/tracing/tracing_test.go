@@ -0,0 +1,37 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestSetup(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := Setup(ctx, Options{Exporter: "jaeger"})
+	assert.EqualError(t, err, `unknown tracing exporter "jaeger"`)
+
+	// Without an exporter, the trace context of callers is still propagated
+	shutdown, err := Setup(ctx, Options{})
+	assert.NoError(t, err)
+	assert.NoError(t, shutdown(ctx))
+
+	header := http.Header{}
+	header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	spanContext := trace.SpanContextFromContext(Extract(ctx, propagation.HeaderCarrier(header)))
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spanContext.TraceID().String())
+	assert.True(t, spanContext.IsSampled())
+
+	_, span := Tracer("test").Start(Extract(ctx, propagation.HeaderCarrier(header)), "noop")
+	assert.Equal(t, spanContext.TraceID(), span.SpanContext().TraceID())
+	span.End()
+
+	shutdown, err = Setup(ctx, Options{Exporter: ExporterStdout, ServiceName: "urlshortener", SampleRatio: 1})
+	assert.NoError(t, err)
+	assert.NoError(t, shutdown(ctx))
+}
@@ -1,9 +1,71 @@
 package validator
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/url"
+	"regexp"
+	"sort"
 	"strings"
+	"time"
+	"unicode/utf8"
+	"urlshortener/internal/domain/models"
+)
+
+const (
+	minPasswordLength = 4
+	maxPasswordLength = 72
+
+	// maxRules bounds the targeting rules evaluated on every redirect
+	maxRules = 50
+
+	// maxVariants bounds the destinations a URL rotates across
+	maxVariants = 10
+
+	// maxUTMLength bounds each stored UTM parameter
+	maxUTMLength = 100
+
+	// maxTitleLength bounds the title shown on the preview page of a URL
+	maxTitleLength = 200
+
+	// maxTags and maxTagLength bound the tags of a URL
+	maxTags      = 20
+	maxTagLength = 50
+
+	// maxFolderLength and maxNotesLength bound the folder and notes of a URL, in characters
+	maxFolderLength = 100
+	maxNotesLength  = 2000
+
+	// maxLabels and maxLabelValueLength bound the labels of a URL
+	maxLabels           = models.MaxLabels
+	maxLabelValueLength = 256
+
+	// maxCampaignNameLength and maxOwnerLength bound the name and owner of a campaign, in characters
+	maxCampaignNameLength = 100
+	maxOwnerLength        = 100
+
+	// minSecretLength and maxSecretLength bound the secret signing the deliveries of a webhook
+	minSecretLength = 16
+	maxSecretLength = 256
+)
+
+// Formats accepted by the language and country conditions of targeting rules
+var (
+	languageTagPattern = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+	countryCodePattern = regexp.MustCompile(`^[A-Za-z]{2}$`)
+)
+
+// labelKeyPattern restricts label keys to names that can be stored and queried as document fields
+var labelKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// variantIDPattern restricts variant IDs to values that are safe to store in a cookie
+var variantIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// Values accepted by the OS and device conditions of targeting rules
+var (
+	validOS      = []string{models.OSIOS, models.OSAndroid, models.OSWindows, models.OSMacOS, models.OSLinux, models.OSChromeOS}
+	validDevices = []string{models.DeviceMobile, models.DeviceTablet, models.DeviceDesktop}
 )
 
 // ValidationError represents an error for a specific field with a message
@@ -43,6 +105,636 @@ func (v *URLValidator) ValidateURL(urlStr string) error {
 	return nil
 }
 
+// ValidatePassword validates a password protecting a short URL
+func (v *URLValidator) ValidatePassword(password string) error {
+	if len(password) < minPasswordLength {
+		return newValidationError("password", fmt.Sprintf("Password must be at least %d characters", minPasswordLength))
+	}
+	// bcrypt only considers the first 72 bytes of a password
+	if len(password) > maxPasswordLength {
+		return newValidationError("password", fmt.Sprintf("Password must be at most %d bytes", maxPasswordLength))
+	}
+	return nil
+}
+
+// ValidateRules validates an ordered list of targeting rules
+func (v *URLValidator) ValidateRules(rules []models.TargetingRule) error {
+	if len(rules) > maxRules {
+		return newValidationError("rules", fmt.Sprintf("At most %d rules are allowed", maxRules))
+	}
+
+	for i, rule := range rules {
+		field := fmt.Sprintf("rules[%d]", i)
+
+		if err := v.ValidateURL(rule.Destination); err != nil {
+			var validationErr *ValidationError
+			if errors.As(err, &validationErr) {
+				return newValidationError(field+".destination", validationErr.Message)
+			}
+			return err
+		}
+
+		if len(rule.OS) == 0 && len(rule.Devices) == 0 && len(rule.Languages) == 0 && len(rule.Countries) == 0 && len(rule.Query) == 0 {
+			return newValidationError(field, "Rule must have at least one condition")
+		}
+		for _, os := range rule.OS {
+			if !containsFold(validOS, os) {
+				return newValidationError(field+".os", "OS must be one of "+strings.Join(validOS, ", "))
+			}
+		}
+		for _, device := range rule.Devices {
+			if !containsFold(validDevices, device) {
+				return newValidationError(field+".devices", "Device must be one of "+strings.Join(validDevices, ", "))
+			}
+		}
+		for _, language := range rule.Languages {
+			if !languageTagPattern.MatchString(language) {
+				return newValidationError(field+".languages", "Language must be a tag such as en or en-GB")
+			}
+		}
+		for _, country := range rule.Countries {
+			if !countryCodePattern.MatchString(country) {
+				return newValidationError(field+".countries", "Country must be an ISO 3166-1 alpha-2 code")
+			}
+		}
+		for key := range rule.Query {
+			if strings.TrimSpace(key) == "" {
+				return newValidationError(field+".query", "Query parameter names cannot be empty")
+			}
+		}
+	}
+
+	return nil
+}
+
+// ValidateVariants validates the weighted destinations of a URL
+func (v *URLValidator) ValidateVariants(variants []models.Variant) error {
+	if len(variants) > maxVariants {
+		return newValidationError("variants", fmt.Sprintf("At most %d variants are allowed", maxVariants))
+	}
+
+	seen := make(map[string]bool, len(variants))
+	for i, variant := range variants {
+		field := fmt.Sprintf("variants[%d]", i)
+
+		if !variantIDPattern.MatchString(variant.ID) {
+			return newValidationError(field+".id", "ID must be 1 to 32 letters, digits, dashes or underscores")
+		}
+		if seen[variant.ID] {
+			return newValidationError(field+".id", "ID must be unique")
+		}
+		seen[variant.ID] = true
+
+		if err := v.ValidateURL(variant.Destination); err != nil {
+			var validationErr *ValidationError
+			if errors.As(err, &validationErr) {
+				return newValidationError(field+".destination", validationErr.Message)
+			}
+			return err
+		}
+		if variant.Weight <= 0 {
+			return newValidationError(field+".weight", "Weight must be a positive integer")
+		}
+	}
+
+	return nil
+}
+
+// ValidateQueryMode validates how the query string of a short URL reaches the destination
+func (v *URLValidator) ValidateQueryMode(mode string) error {
+	switch mode {
+	case "", models.QueryModeDrop, models.QueryModeMerge, models.QueryModeOverride:
+		return nil
+	}
+	return newValidationError("query_mode", "Query mode must be one of drop, merge or override")
+}
+
+// ValidateUTM validates the UTM parameters added to the destination of a URL
+func (v *URLValidator) ValidateUTM(utm *models.UTMParams) error {
+	if utm == nil {
+		return nil
+	}
+	for field, value := range map[string]string{"utm.source": utm.Source, "utm.medium": utm.Medium, "utm.campaign": utm.Campaign} {
+		if len(value) > maxUTMLength {
+			return newValidationError(field, fmt.Sprintf("Must be at most %d characters", maxUTMLength))
+		}
+	}
+	return nil
+}
+
+// ValidateTitle validates the title shown on the preview page of a URL
+func (v *URLValidator) ValidateTitle(title string) error {
+	if utf8.RuneCountInString(title) > maxTitleLength {
+		return newValidationError("title", fmt.Sprintf("Title must be at most %d characters", maxTitleLength))
+	}
+	return nil
+}
+
+// ValidateFallbackURL validates the URL receiving visitors while the destination is down; empty means none
+func (v *URLValidator) ValidateFallbackURL(fallbackURL string) error {
+	if fallbackURL == "" {
+		return nil
+	}
+	if err := v.ValidateURL(fallbackURL); err != nil {
+		var validationErr *ValidationError
+		if errors.As(err, &validationErr) {
+			return newValidationError("fallback_url", validationErr.Message)
+		}
+		return err
+	}
+	return nil
+}
+
+// ValidateTags validates normalized tags
+func (v *URLValidator) ValidateTags(tags []string) error {
+	if len(tags) > maxTags {
+		return newValidationError("tags", fmt.Sprintf("At most %d tags are allowed", maxTags))
+	}
+	for _, tag := range tags {
+		if utf8.RuneCountInString(tag) > maxTagLength {
+			return newValidationError("tags", fmt.Sprintf("Tags must be at most %d characters", maxTagLength))
+		}
+		if strings.Contains(tag, ",") {
+			return newValidationError("tags", "Tags cannot contain commas")
+		}
+	}
+	return nil
+}
+
+// ValidateFolder validates the folder a URL is filed in
+func (v *URLValidator) ValidateFolder(folder string) error {
+	if utf8.RuneCountInString(folder) > maxFolderLength {
+		return newValidationError("folder", fmt.Sprintf("Folder must be at most %d characters", maxFolderLength))
+	}
+	return nil
+}
+
+// ValidateNotes validates the free-form notes kept on a URL
+func (v *URLValidator) ValidateNotes(notes string) error {
+	if utf8.RuneCountInString(notes) > maxNotesLength {
+		return newValidationError("notes", fmt.Sprintf("Notes must be at most %d characters", maxNotesLength))
+	}
+	return nil
+}
+
+// ValidateLabels validates the key/value labels of a URL
+func (v *URLValidator) ValidateLabels(labels map[string]string) error {
+	if len(labels) > maxLabels {
+		return newValidationError("labels", fmt.Sprintf("At most %d labels are allowed", maxLabels))
+	}
+	for key, value := range labels {
+		if !labelKeyPattern.MatchString(key) {
+			return newValidationError("labels", "Label keys must be 1 to 64 letters, digits, '_' or '-'")
+		}
+		if utf8.RuneCountInString(value) > maxLabelValueLength {
+			return newValidationError("labels."+key, fmt.Sprintf("Must be at most %d characters", maxLabelValueLength))
+		}
+	}
+	return nil
+}
+
+// ValidateCampaign validates the settings of a campaign being created or updated
+func (v *URLValidator) ValidateCampaign(campaign *models.Campaign) error {
+	name := strings.TrimSpace(campaign.Name)
+	if name == "" {
+		return newValidationError("name", "Name cannot be empty")
+	}
+	if utf8.RuneCountInString(name) > maxCampaignNameLength {
+		return newValidationError("name", fmt.Sprintf("Name must be at most %d characters", maxCampaignNameLength))
+	}
+	if utf8.RuneCountInString(campaign.Owner) > maxOwnerLength {
+		return newValidationError("owner", fmt.Sprintf("Owner must be at most %d characters", maxOwnerLength))
+	}
+	if campaign.StartsAt != nil && campaign.EndsAt != nil && !campaign.EndsAt.After(*campaign.StartsAt) {
+		return newValidationError("ends_at", "ends_at must be after starts_at")
+	}
+	return v.ValidateUTM(campaign.UTM)
+}
+
+// ValidateWebhook validates the settings of a webhook being created or updated
+func (v *URLValidator) ValidateWebhook(webhook *models.Webhook) error {
+	if err := v.ValidateURL(webhook.URL); err != nil {
+		return err
+	}
+	if len(webhook.Events) == 0 {
+		return newValidationError("events", "At least one event is required")
+	}
+	for _, event := range webhook.Events {
+		if !isEventType(event) {
+			return newValidationError("events", fmt.Sprintf("Must be one of %s", strings.Join(models.EventTypes, ", ")))
+		}
+	}
+	if webhook.Secret != "" && (len(webhook.Secret) < minSecretLength || len(webhook.Secret) > maxSecretLength) {
+		return newValidationError("secret", fmt.Sprintf("Secret must be between %d and %d characters", minSecretLength, maxSecretLength))
+	}
+	if utf8.RuneCountInString(webhook.Owner) > maxOwnerLength {
+		return newValidationError("owner", fmt.Sprintf("Owner must be at most %d characters", maxOwnerLength))
+	}
+	return nil
+}
+
+// patchFieldFunc decodes and validates a single field of a merge patch.
+// raw is nil when the patch removes the field.
+type patchFieldFunc func(v *URLValidator, raw json.RawMessage) (interface{}, error)
+
+// patchableFields lists the mutable URL fields that may appear in a merge patch
+var patchableFields = map[string]patchFieldFunc{
+	"original_url": (*URLValidator).patchOriginalURL,
+	"password":     (*URLValidator).patchPassword,
+	"single_use":   patchBoolField("single_use"),
+	"active_from":  patchTimeField("active_from"),
+	"active_until": patchTimeField("active_until"),
+	"rules":        (*URLValidator).patchRules,
+	"variants":     (*URLValidator).patchVariants,
+
+	"sticky_variants":  patchBoolField("sticky_variants"),
+	"query_mode":       (*URLValidator).patchQueryMode,
+	"path_passthrough": patchBoolField("path_passthrough"),
+	"utm":              (*URLValidator).patchUTM,
+	"title":            (*URLValidator).patchTitle,
+	"preview":          patchBoolField("preview"),
+	"fallback_url":     (*URLValidator).patchFallbackURL,
+	"tags":             (*URLValidator).patchTags,
+	"folder":           (*URLValidator).patchFolder,
+	"notes":            (*URLValidator).patchNotes,
+	"labels":           (*URLValidator).patchLabels,
+	"campaign_id":      (*URLValidator).patchCampaignID,
+}
+
+// readOnlyFields lists URL fields that are managed by the service and cannot be patched
+var readOnlyFields = map[string]bool{
+	"id":                 true,
+	"short_code":         true,
+	"domain":             true,
+	"owner":              true,
+	"access_count":       true,
+	"bot_access_count":   true,
+	"version":            true,
+	"password_protected": true,
+	"consumed_by":        true,
+	"metadata":           true,
+	"health":             true,
+	"created_at":         true,
+	"updated_at":         true,
+}
+
+// ValidatePatch validates a JSON Merge Patch document field by field and converts it to a URLPatch
+func (v *URLValidator) ValidatePatch(doc map[string]json.RawMessage) (models.URLPatch, error) {
+	fields := make([]string, 0, len(doc))
+	for field := range doc {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	patch := make(models.URLPatch, len(doc))
+	for _, field := range fields {
+		decode, ok := patchableFields[field]
+		if !ok {
+			if readOnlyFields[field] {
+				return nil, newValidationError(field, "field is read-only")
+			}
+			return nil, newValidationError(field, "unknown field")
+		}
+
+		raw := doc[field]
+		if isJSONNull(raw) {
+			raw = nil
+		}
+
+		value, err := decode(v, raw)
+		if err != nil {
+			return nil, err
+		}
+		// Objects merged key by key patch each of their members
+		if members, ok := value.(models.URLPatch); ok {
+			for member, value := range members {
+				patch[field+"."+member] = value
+			}
+			continue
+		}
+		patch[field] = value
+	}
+
+	return patch, nil
+}
+
+// patchOriginalURL validates a replacement destination URL, which cannot be removed
+func (v *URLValidator) patchOriginalURL(raw json.RawMessage) (interface{}, error) {
+	if raw == nil {
+		return nil, newValidationError("original_url", "field cannot be removed")
+	}
+
+	var urlStr string
+	if err := json.Unmarshal(raw, &urlStr); err != nil {
+		return nil, newValidationError("original_url", "must be a string")
+	}
+	if err := v.ValidateURL(urlStr); err != nil {
+		var validationErr *ValidationError
+		if errors.As(err, &validationErr) {
+			return nil, newValidationError("original_url", validationErr.Message)
+		}
+		return nil, err
+	}
+	return urlStr, nil
+}
+
+// patchPassword validates a replacement password; removing it lifts the protection
+func (v *URLValidator) patchPassword(raw json.RawMessage) (interface{}, error) {
+	if raw == nil {
+		return nil, nil
+	}
+
+	var password string
+	if err := json.Unmarshal(raw, &password); err != nil {
+		return nil, newValidationError("password", "must be a string")
+	}
+	if err := v.ValidatePassword(password); err != nil {
+		return nil, err
+	}
+	return password, nil
+}
+
+// patchBoolField returns a patchFieldFunc for an optional boolean field; removing it resets it to false
+func patchBoolField(field string) patchFieldFunc {
+	return func(v *URLValidator, raw json.RawMessage) (interface{}, error) {
+		if raw == nil {
+			return nil, nil
+		}
+
+		var value bool
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, newValidationError(field, "must be a boolean")
+		}
+		return value, nil
+	}
+}
+
+// patchTimeField returns a patchFieldFunc for an optional RFC 3339 timestamp field
+func patchTimeField(field string) patchFieldFunc {
+	return func(v *URLValidator, raw json.RawMessage) (interface{}, error) {
+		if raw == nil {
+			return nil, nil
+		}
+
+		var t time.Time
+		if err := json.Unmarshal(raw, &t); err != nil {
+			return nil, newValidationError(field, "must be an RFC 3339 timestamp")
+		}
+		return t, nil
+	}
+}
+
+// ValidateStatus validates a link status used to filter listings
+func (v *URLValidator) ValidateStatus(status string) error {
+	switch models.LinkStatus(status) {
+	case "", models.LinkStatusScheduled, models.LinkStatusActive, models.LinkStatusEnded:
+		return nil
+	}
+	return newValidationError("status", "Status must be one of scheduled, active or ended")
+}
+
+// patchRules validates replacement targeting rules; removing them sends everyone to the original URL
+func (v *URLValidator) patchRules(raw json.RawMessage) (interface{}, error) {
+	if raw == nil {
+		return nil, nil
+	}
+
+	var rules []models.TargetingRule
+	if err := json.Unmarshal(raw, &rules); err != nil {
+		return nil, newValidationError("rules", "must be an array of rules")
+	}
+	if err := v.ValidateRules(rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// patchVariants validates replacement variants; removing them sends everyone to the original URL
+func (v *URLValidator) patchVariants(raw json.RawMessage) (interface{}, error) {
+	if raw == nil {
+		return nil, nil
+	}
+
+	var variants []models.Variant
+	if err := json.Unmarshal(raw, &variants); err != nil {
+		return nil, newValidationError("variants", "must be an array of variants")
+	}
+	if err := v.ValidateVariants(variants); err != nil {
+		return nil, err
+	}
+	return variants, nil
+}
+
+// patchQueryMode validates the query passthrough mode; removing it drops the query string
+func (v *URLValidator) patchQueryMode(raw json.RawMessage) (interface{}, error) {
+	if raw == nil {
+		return nil, nil
+	}
+
+	var mode string
+	if err := json.Unmarshal(raw, &mode); err != nil {
+		return nil, newValidationError("query_mode", "must be a string")
+	}
+	if err := v.ValidateQueryMode(mode); err != nil {
+		return nil, err
+	}
+	return mode, nil
+}
+
+// patchUTM validates UTM parameters merged into the current ones member by member, where a null or empty value
+// removes the parameter; removing them all stops the injection
+func (v *URLValidator) patchUTM(raw json.RawMessage) (interface{}, error) {
+	if raw == nil {
+		return nil, nil
+	}
+
+	var members map[string]*string
+	if err := json.Unmarshal(raw, &members); err != nil || members == nil {
+		return nil, newValidationError("utm", "must be an object")
+	}
+
+	var utm models.UTMParams
+	patch := make(models.URLPatch, len(members))
+	for member, value := range members {
+		var param *string
+		switch member {
+		case "source":
+			param = &utm.Source
+		case "medium":
+			param = &utm.Medium
+		case "campaign":
+			param = &utm.Campaign
+		default:
+			return nil, newValidationError("utm."+member, "unknown field")
+		}
+		if value == nil || *value == "" {
+			patch[member] = nil
+			continue
+		}
+		*param = *value
+		patch[member] = *value
+	}
+	if err := v.ValidateUTM(&utm); err != nil {
+		return nil, err
+	}
+	return patch, nil
+}
+
+// patchTitle validates a replacement title; removing it leaves the preview page untitled
+func (v *URLValidator) patchTitle(raw json.RawMessage) (interface{}, error) {
+	if raw == nil {
+		return nil, nil
+	}
+
+	var title string
+	if err := json.Unmarshal(raw, &title); err != nil {
+		return nil, newValidationError("title", "must be a string")
+	}
+	if err := v.ValidateTitle(title); err != nil {
+		return nil, err
+	}
+	return title, nil
+}
+
+// patchFallbackURL validates a replacement fallback URL; removing it sends visitors to the destination even when down
+func (v *URLValidator) patchFallbackURL(raw json.RawMessage) (interface{}, error) {
+	if raw == nil {
+		return nil, nil
+	}
+
+	var fallbackURL string
+	if err := json.Unmarshal(raw, &fallbackURL); err != nil {
+		return nil, newValidationError("fallback_url", "must be a string")
+	}
+	if fallbackURL == "" {
+		return nil, newValidationError("fallback_url", "URL cannot be empty")
+	}
+	if err := v.ValidateFallbackURL(fallbackURL); err != nil {
+		return nil, err
+	}
+	return fallbackURL, nil
+}
+
+// patchTags validates replacement tags, which are normalized; removing them untags the URL
+func (v *URLValidator) patchTags(raw json.RawMessage) (interface{}, error) {
+	if raw == nil {
+		return nil, nil
+	}
+
+	var tags []string
+	if err := json.Unmarshal(raw, &tags); err != nil {
+		return nil, newValidationError("tags", "must be an array of strings")
+	}
+	tags = models.NormalizeTags(tags)
+	if err := v.ValidateTags(tags); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// patchFolder validates a replacement folder; removing it takes the URL out of its folder
+func (v *URLValidator) patchFolder(raw json.RawMessage) (interface{}, error) {
+	if raw == nil {
+		return nil, nil
+	}
+
+	var folder string
+	if err := json.Unmarshal(raw, &folder); err != nil {
+		return nil, newValidationError("folder", "must be a string")
+	}
+	if err := v.ValidateFolder(folder); err != nil {
+		return nil, err
+	}
+	return folder, nil
+}
+
+// patchNotes validates replacement notes; removing them clears the notes
+func (v *URLValidator) patchNotes(raw json.RawMessage) (interface{}, error) {
+	if raw == nil {
+		return nil, nil
+	}
+
+	var notes string
+	if err := json.Unmarshal(raw, &notes); err != nil {
+		return nil, newValidationError("notes", "must be a string")
+	}
+	if err := v.ValidateNotes(notes); err != nil {
+		return nil, err
+	}
+	return notes, nil
+}
+
+// patchLabels validates labels merged into the current ones key by key, where a null value removes the label;
+// removing labels altogether clears them
+func (v *URLValidator) patchLabels(raw json.RawMessage) (interface{}, error) {
+	if raw == nil {
+		return nil, nil
+	}
+
+	var members map[string]*string
+	if err := json.Unmarshal(raw, &members); err != nil || members == nil {
+		return nil, newValidationError("labels", "must be an object of strings")
+	}
+
+	labels := make(map[string]string, len(members))
+	patch := make(models.URLPatch, len(members))
+	for key, value := range members {
+		if value == nil {
+			patch[key] = nil
+			labels[key] = ""
+			continue
+		}
+		patch[key] = *value
+		labels[key] = *value
+	}
+	// Keys are checked here, since they become field names; the number of labels once merged is checked on the URL
+	if err := v.ValidateLabels(labels); err != nil {
+		return nil, err
+	}
+	return patch, nil
+}
+
+// patchCampaignID validates the campaign a URL is assigned to; removing it takes the URL out of its campaign
+func (v *URLValidator) patchCampaignID(raw json.RawMessage) (interface{}, error) {
+	if raw == nil {
+		return nil, nil
+	}
+
+	var campaignID string
+	if err := json.Unmarshal(raw, &campaignID); err != nil {
+		return nil, newValidationError("campaign_id", "must be a string")
+	}
+	if campaignID == "" {
+		return nil, newValidationError("campaign_id", "Campaign ID cannot be empty")
+	}
+	return campaignID, nil
+}
+
+// containsFold reports whether value is in values, ignoring case
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// isEventType reports whether event is a type of event webhooks can subscribe to
+func isEventType(event string) bool {
+	for _, eventType := range models.EventTypes {
+		if event == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// isJSONNull reports whether raw is the JSON null literal
+func isJSONNull(raw json.RawMessage) bool {
+	return strings.TrimSpace(string(raw)) == "null"
+}
+
 // newValidationError creates a new ValidationError
 func newValidationError(field, message string) error {
 	return &ValidationError{
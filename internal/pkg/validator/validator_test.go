@@ -0,0 +1,47 @@
+package validator
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"urlshortener/internal/domain/models"
+)
+
+// TestValidatePatchLabels tests that a labels object patches each label rather than replacing them all
+func TestValidatePatchLabels(t *testing.T) {
+	v := NewURLValidator()
+
+	patch, err := v.ValidatePatch(map[string]json.RawMessage{"labels": json.RawMessage(`{"env":null,"channel":"print"}`)})
+	assert.NoError(t, err)
+	assert.Equal(t, models.URLPatch{"labels.env": nil, "labels.channel": "print"}, patch)
+
+	patch, err = v.ValidatePatch(map[string]json.RawMessage{"labels": json.RawMessage(`null`)})
+	assert.NoError(t, err)
+	assert.Equal(t, models.URLPatch{"labels": nil}, patch)
+
+	_, err = v.ValidatePatch(map[string]json.RawMessage{"labels": json.RawMessage(`{"a.b":"x"}`)})
+	assert.Error(t, err)
+	_, err = v.ValidatePatch(map[string]json.RawMessage{"labels": json.RawMessage(`["env"]`)})
+	assert.Error(t, err)
+}
+
+// TestValidatePatchUTM tests that a utm object patches each parameter rather than replacing them all
+func TestValidatePatchUTM(t *testing.T) {
+	v := NewURLValidator()
+
+	patch, err := v.ValidatePatch(map[string]json.RawMessage{"utm": json.RawMessage(`{"source":"newsletter","medium":null}`)})
+	assert.NoError(t, err)
+	assert.Equal(t, models.URLPatch{"utm.source": "newsletter", "utm.medium": nil}, patch)
+
+	patch, err = v.ValidatePatch(map[string]json.RawMessage{"utm": json.RawMessage(`null`)})
+	assert.NoError(t, err)
+	assert.Equal(t, models.URLPatch{"utm": nil}, patch)
+
+	_, err = v.ValidatePatch(map[string]json.RawMessage{"utm": json.RawMessage(`{"term":"x"}`)})
+	assert.Error(t, err)
+	_, err = v.ValidatePatch(map[string]json.RawMessage{"utm": json.RawMessage(`{"source":"` + strings.Repeat("x", maxUTMLength+1) + `"}`)})
+	assert.Error(t, err)
+}
@@ -0,0 +1,225 @@
+package visitors
+
+import (
+	"context"
+	log "go.uber.org/zap"
+	"sync"
+	"time"
+	"urlshortener/internal/domain/models"
+	"urlshortener/internal/domain/repositories"
+	"urlshortener/internal/pkg/hll"
+	"urlshortener/pkg/logger"
+)
+
+// DefaultFlushInterval is how often observed visitors are merged into storage
+const DefaultFlushInterval = 10 * time.Second
+
+// bucket identifies the sketch of a link for a period
+type bucket struct {
+	link   models.LinkRef
+	period string
+}
+
+// pending holds the visitors observed in a bucket since the last flush
+type pending struct {
+	sketch *hll.Sketch
+	clicks int64
+}
+
+// Tracker estimates the unique visitors of links with HyperLogLog sketches, one per link and day plus
+// one per link for its lifetime. Visitors are counted in memory and merged into storage every flush interval,
+// so any number of instances can count the visitors of the same links.
+type Tracker struct {
+	repo     repositories.VisitorSketchRepository
+	interval time.Duration
+
+	mu      sync.Mutex
+	pending map[bucket]*pending
+}
+
+// NewTracker creates a new instance of Tracker flushing to repo every interval, or every DefaultFlushInterval if zero
+func NewTracker(repo repositories.VisitorSketchRepository, interval time.Duration) *Tracker {
+	if interval <= 0 {
+		interval = DefaultFlushInterval
+	}
+	return &Tracker{
+		repo:     repo,
+		interval: interval,
+		pending:  make(map[bucket]*pending),
+	}
+}
+
+// Observe counts a click on link at the given time by the visitor identified by hash
+func (t *Tracker) Observe(link models.LinkRef, hash uint64, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, period := range []string{at.UTC().Format(models.DayLayout), models.TotalPeriod} {
+		b := bucket{link: link, period: period}
+		p, ok := t.pending[b]
+		if !ok {
+			p = &pending{sketch: hll.New()}
+			t.pending[b] = p
+		}
+		p.sketch.Add(hash)
+		p.clicks++
+	}
+}
+
+// Run flushes observed visitors every flush interval until ctx is cancelled, then flushes a last time
+func (t *Tracker) Run(ctx context.Context) {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			t.Flush(context.Background())
+			return
+		case <-ticker.C:
+			t.Flush(ctx)
+		}
+	}
+}
+
+// Flush merges the visitors observed since the last flush into storage.
+// Buckets that fail to merge are kept and retried by the next flush.
+func (t *Tracker) Flush(ctx context.Context) {
+	t.mu.Lock()
+	buckets := t.pending
+	t.pending = make(map[bucket]*pending)
+	t.mu.Unlock()
+
+	for b, p := range buckets {
+		if err := t.merge(ctx, b, p); err != nil {
+			logger.GetLogger().Error("failed to store visitor sketch",
+				log.String("short_code", b.link.ShortCode),
+				log.String("period", b.period),
+				log.Error(err),
+			)
+			t.restore(b, p)
+		}
+	}
+}
+
+// merge merges the visitors pending in a bucket into its stored sketch
+func (t *Tracker) merge(ctx context.Context, b bucket, p *pending) error {
+	data, err := p.sketch.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return t.repo.MergeVisitorSketch(ctx, &models.VisitorSketch{
+		Domain:    b.link.Domain,
+		ShortCode: b.link.ShortCode,
+		Period:    b.period,
+		Clicks:    p.clicks,
+		Sketch:    data,
+	})
+}
+
+// restore puts back the visitors of a bucket that failed to flush
+func (t *Tracker) restore(b bucket, p *pending) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if current, ok := t.pending[b]; ok {
+		current.sketch.Merge(p.sketch)
+		current.clicks += p.clicks
+		return
+	}
+	t.pending[b] = p
+}
+
+// Erase drops the pending visitors of links and deletes their stored sketches,
+// returning how many sketches were deleted
+func (t *Tracker) Erase(ctx context.Context, links []models.LinkRef) (int64, error) {
+	erased := make(map[models.LinkRef]bool, len(links))
+	for _, link := range links {
+		erased[link] = true
+	}
+
+	t.mu.Lock()
+	for b := range t.pending {
+		if erased[b.link] {
+			delete(t.pending, b)
+		}
+	}
+	t.mu.Unlock()
+
+	return t.repo.DeleteVisitorSketches(ctx, links)
+}
+
+// Summarize estimates the unique visitors of link over its lifetime and for each day from from to to, inclusive.
+// Visitors observed by this instance but not flushed yet are included.
+func (t *Tracker) Summarize(ctx context.Context, link models.LinkRef, from, to time.Time) (*models.UniqueVisitors, error) {
+	from, to = day(from), day(to)
+	if to.Before(from) {
+		to = from
+	}
+	days := make([]string, 0)
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		days = append(days, d.Format(models.DayLayout))
+	}
+
+	stored, err := t.repo.ListVisitorSketches(ctx, link, append(days, models.TotalPeriod))
+	if err != nil {
+		return nil, err
+	}
+
+	periods := make(map[string]*pending, len(stored))
+	for _, s := range stored {
+		sketch := hll.New()
+		if err := sketch.UnmarshalBinary(s.Sketch); err != nil {
+			return nil, err
+		}
+		periods[s.Period] = &pending{sketch: sketch, clicks: s.Clicks}
+	}
+
+	t.mu.Lock()
+	for b, p := range t.pending {
+		if b.link != link {
+			continue
+		}
+		if period, ok := periods[b.period]; ok {
+			period.sketch.Merge(p.sketch)
+			period.clicks += p.clicks
+		} else {
+			sketch := hll.New()
+			sketch.Merge(p.sketch)
+			periods[b.period] = &pending{sketch: sketch, clicks: p.clicks}
+		}
+	}
+	t.mu.Unlock()
+
+	visitors := &models.UniqueVisitors{
+		From:  days[0],
+		To:    days[len(days)-1],
+		Daily: make([]models.DailyVisitors, len(days)),
+	}
+	if total, ok := periods[models.TotalPeriod]; ok {
+		visitors.Total = int64(total.sketch.Count())
+	}
+
+	// Unique visitors over the range come from the union of the daily sketches,
+	// since a visitor returning on several days is counted once
+	inRange := hll.New()
+	for i, date := range days {
+		visitors.Daily[i].Date = date
+		p, ok := periods[date]
+		if !ok {
+			continue
+		}
+		visitors.Daily[i].Clicks = p.clicks
+		visitors.Daily[i].Uniques = int64(p.sketch.Count())
+		visitors.Clicks += p.clicks
+		inRange.Merge(p.sketch)
+	}
+	visitors.Uniques = int64(inRange.Count())
+
+	return visitors, nil
+}
+
+// day returns the start of the UTC day of t
+func day(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
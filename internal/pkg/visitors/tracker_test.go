@@ -0,0 +1,175 @@
+package visitors
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"urlshortener/internal/domain/models"
+	"urlshortener/internal/pkg/hll"
+)
+
+// fakeRepository stores visitor sketches in memory, merging them like the database does
+type fakeRepository struct {
+	mu       sync.Mutex
+	sketches map[string]*models.VisitorSketch
+	fail     bool
+}
+
+func newFakeRepository() *fakeRepository {
+	return &fakeRepository{sketches: make(map[string]*models.VisitorSketch)}
+}
+
+func (r *fakeRepository) MergeVisitorSketch(ctx context.Context, sketch *models.VisitorSketch) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.fail {
+		return errors.New("storage unavailable")
+	}
+
+	key := sketch.Domain + "/" + sketch.ShortCode + "/" + sketch.Period
+	stored, ok := r.sketches[key]
+	if !ok {
+		created := *sketch
+		r.sketches[key] = &created
+		return nil
+	}
+
+	merged, delta := hll.New(), hll.New()
+	merged.UnmarshalBinary(stored.Sketch)
+	delta.UnmarshalBinary(sketch.Sketch)
+	merged.Merge(delta)
+	stored.Sketch, _ = merged.MarshalBinary()
+	stored.Clicks += sketch.Clicks
+	return nil
+}
+
+func (r *fakeRepository) ListVisitorSketches(ctx context.Context, link models.LinkRef, periods []string) ([]*models.VisitorSketch, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var sketches []*models.VisitorSketch
+	for _, period := range periods {
+		if sketch, ok := r.sketches[link.Domain+"/"+link.ShortCode+"/"+period]; ok {
+			sketches = append(sketches, sketch)
+		}
+	}
+	return sketches, nil
+}
+
+func (r *fakeRepository) DeleteVisitorSketches(ctx context.Context, links []models.LinkRef) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var deleted int64
+	for key, sketch := range r.sketches {
+		for _, link := range links {
+			if sketch.Domain == link.Domain && sketch.ShortCode == link.ShortCode {
+				delete(r.sketches, key)
+				deleted++
+			}
+		}
+	}
+	return deleted, nil
+}
+
+// visitor returns a well distributed hash identifying visitor i
+func visitor(i uint64) uint64 {
+	return i * 0x9e3779b97f4a7c15
+}
+
+func TestTracker_Summarize(t *testing.T) {
+	repo := newFakeRepository()
+	link := models.LinkRef{Domain: "acme.link", ShortCode: "abc123"}
+	day1 := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	day2 := day1.AddDate(0, 0, 1)
+
+	// Two instances count visitors of the same link; visitor 2 comes back on the second day
+	first := NewTracker(repo, time.Minute)
+	first.Observe(link, visitor(1), day1)
+	first.Observe(link, visitor(1), day1)
+	first.Observe(link, visitor(2), day1)
+	first.Flush(context.Background())
+
+	second := NewTracker(repo, time.Minute)
+	second.Observe(link, visitor(2), day2)
+	second.Observe(link, visitor(3), day2)
+	second.Observe(models.LinkRef{Domain: "acme.link", ShortCode: "other"}, visitor(4), day2)
+
+	// Visitors not flushed yet are reported by the instance that observed them
+	visitors, err := second.Summarize(context.Background(), link, day1, day2)
+	assert.NoError(t, err)
+	assert.Equal(t, &models.UniqueVisitors{
+		Total:   3,
+		From:    "2024-03-01",
+		To:      "2024-03-02",
+		Clicks:  5,
+		Uniques: 3,
+		Daily: []models.DailyVisitors{
+			{Date: "2024-03-01", Clicks: 3, Uniques: 2},
+			{Date: "2024-03-02", Clicks: 2, Uniques: 2},
+		},
+	}, visitors)
+
+	second.Flush(context.Background())
+	visitors, err = first.Summarize(context.Background(), link, day2, day2)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), visitors.Total)
+	assert.Equal(t, int64(2), visitors.Uniques)
+	assert.Len(t, visitors.Daily, 1)
+}
+
+func TestTracker_FlushRetriesFailedBuckets(t *testing.T) {
+	repo := newFakeRepository()
+	link := models.LinkRef{Domain: "acme.link", ShortCode: "abc123"}
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	tracker := NewTracker(repo, time.Minute)
+	tracker.Observe(link, visitor(1), now)
+
+	repo.fail = true
+	tracker.Flush(context.Background())
+	assert.Empty(t, repo.sketches)
+
+	tracker.Observe(link, visitor(2), now)
+	repo.fail = false
+	tracker.Flush(context.Background())
+
+	// Summarizing from another tracker only sees what was stored
+	visitors, err := NewTracker(repo, time.Minute).Summarize(context.Background(), link, now, now)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), visitors.Total)
+	assert.Equal(t, int64(2), visitors.Clicks)
+}
+
+func TestTracker_Erase(t *testing.T) {
+	repo := newFakeRepository()
+	erased := models.LinkRef{Domain: "acme.link", ShortCode: "abc123"}
+	kept := models.LinkRef{Domain: "acme.link", ShortCode: "xyz789"}
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	tracker := NewTracker(repo, 0)
+	tracker.Observe(erased, visitor(1), now)
+	tracker.Observe(kept, visitor(1), now)
+	tracker.Flush(context.Background())
+	tracker.Observe(erased, visitor(2), now)
+
+	deleted, err := tracker.Erase(context.Background(), []models.LinkRef{erased})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), deleted)
+
+	// Visitors observed before the erasure but not flushed yet are dropped too
+	tracker.Flush(context.Background())
+	visitors, err := tracker.Summarize(context.Background(), erased, now, now)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), visitors.Total)
+	assert.Equal(t, int64(0), visitors.Clicks)
+
+	visitors, err = tracker.Summarize(context.Background(), kept, now, now)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), visitors.Total)
+}
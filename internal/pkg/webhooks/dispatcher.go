@@ -0,0 +1,256 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	log "go.uber.org/zap"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"urlshortener/internal/domain/models"
+	"urlshortener/internal/domain/repositories"
+	"urlshortener/internal/pkg/safedial"
+	"urlshortener/pkg/logger"
+)
+
+const (
+	// DefaultTimeout bounds a single delivery attempt
+	DefaultTimeout = 10 * time.Second
+
+	// DefaultMaxAttempts is how many times a delivery is attempted before it is dead-lettered
+	DefaultMaxAttempts = 10
+
+	// DefaultBaseBackoff and DefaultMaxBackoff bound the wait before retrying a failed delivery,
+	// which doubles after every attempt
+	DefaultBaseBackoff = 30 * time.Second
+	DefaultMaxBackoff  = 6 * time.Hour
+
+	// DefaultWorkers is how many deliveries are attempted at once
+	DefaultWorkers = 4
+
+	// pollInterval is how long a worker sleeps when no delivery is due
+	pollInterval = 5 * time.Second
+
+	// maxResponseBody bounds the response body read before the connection is reused
+	maxResponseBody = 64 << 10
+
+	// userAgent identifies deliveries to receivers
+	userAgent = "urlshortener-webhooks/1.0"
+)
+
+// Options configures a Dispatcher
+type Options struct {
+	// Timeout bounds a single attempt; zero uses DefaultTimeout
+	Timeout time.Duration
+
+	// MaxAttempts is how many attempts are made before a delivery is dead-lettered; zero uses DefaultMaxAttempts
+	MaxAttempts int
+
+	// BaseBackoff and MaxBackoff bound the wait between attempts; zero uses the defaults
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+
+	// Workers is how many deliveries are attempted at once; zero uses DefaultWorkers
+	Workers int
+
+	// AllowPrivateNetworks permits delivering to loopback and private addresses, as tests do
+	AllowPrivateNetworks bool
+}
+
+// Dispatcher delivers the queued events to webhooks, signing every request with the secret of the webhook.
+// Failed deliveries are retried with exponential backoff and dead-lettered once out of attempts.
+// Any number of dispatchers can share the queue.
+type Dispatcher struct {
+	webhooks   repositories.WebhookRepository
+	deliveries repositories.WebhookDeliveryRepository
+	client     *http.Client
+	opts       Options
+	now        func() time.Time
+}
+
+// NewDispatcher creates a new instance of Dispatcher
+func NewDispatcher(webhooks repositories.WebhookRepository, deliveries repositories.WebhookDeliveryRepository, opts Options) *Dispatcher {
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DefaultMaxAttempts
+	}
+	if opts.BaseBackoff <= 0 {
+		opts.BaseBackoff = DefaultBaseBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = DefaultMaxBackoff
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = DefaultWorkers
+	}
+
+	transport := &http.Transport{
+		// Ignore proxy settings from the environment, which would bypass the address checks of the dialer
+		Proxy:                 nil,
+		DialContext:           safedial.NewDialer(opts.Timeout, opts.AllowPrivateNetworks).DialContext,
+		TLSHandshakeTimeout:   opts.Timeout,
+		ResponseHeaderTimeout: opts.Timeout,
+		MaxIdleConnsPerHost:   2,
+		IdleConnTimeout:       time.Minute,
+	}
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   opts.Timeout,
+		// A redirect is reported as a failure rather than followed, so payloads only reach the configured URL
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	return &Dispatcher{
+		webhooks:   webhooks,
+		deliveries: deliveries,
+		client:     client,
+		opts:       opts,
+		now:        time.Now,
+	}
+}
+
+// Run attempts due deliveries with the configured number of workers until ctx is cancelled
+func (d *Dispatcher) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < d.opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+// work attempts due deliveries one after the other, sleeping while none is due
+func (d *Dispatcher) work(ctx context.Context) {
+	for {
+		dispatched, err := d.DispatchNext(ctx)
+		if err != nil {
+			logger.GetLogger().Error("failed to dispatch webhook delivery", log.Error(err))
+		}
+		if dispatched && err == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// DispatchDue attempts every delivery due now once and returns how many were attempted
+func (d *Dispatcher) DispatchDue(ctx context.Context) (int, error) {
+	attempted := 0
+	for {
+		dispatched, err := d.DispatchNext(ctx)
+		if err != nil || !dispatched {
+			return attempted, err
+		}
+		attempted++
+	}
+}
+
+// DispatchNext claims the delivery due the longest and attempts it, reporting whether one was due
+func (d *Dispatcher) DispatchNext(ctx context.Context) (bool, error) {
+	// The lease outlasts the attempt, so the delivery is only claimed again if this dispatcher stopped
+	delivery, err := d.deliveries.ClaimDelivery(ctx, d.now(), 2*d.opts.Timeout)
+	if err != nil || delivery == nil {
+		return false, err
+	}
+	return true, d.attempt(ctx, delivery)
+}
+
+// attempt sends a delivery to its webhook and stores the outcome
+func (d *Dispatcher) attempt(ctx context.Context, delivery *models.WebhookDelivery) error {
+	webhook, err := d.webhooks.GetWebhook(ctx, delivery.WebhookID)
+	if errors.Is(err, repositories.ErrWebhookNotFound) {
+		// The webhook was deleted since the delivery was queued
+		delivery.Status = models.DeliveryDead
+		delivery.LastError = err.Error()
+		return d.deliveries.UpdateDelivery(ctx, delivery)
+	}
+	if err != nil {
+		return err
+	}
+
+	status, err := d.send(ctx, webhook, delivery)
+	now := d.now()
+	delivery.Attempts++
+	delivery.LastAttemptAt = &now
+	delivery.LastStatusCode = status
+
+	switch {
+	case err == nil:
+		delivery.Status = models.DeliveryDelivered
+		delivery.DeliveredAt = &now
+		delivery.LastError = ""
+	case delivery.Attempts >= d.opts.MaxAttempts:
+		delivery.Status = models.DeliveryDead
+		delivery.LastError = err.Error()
+		logger.GetLogger().Warn("webhook delivery dead-lettered",
+			log.String("webhook_id", webhook.ID),
+			log.String("delivery_id", delivery.ID),
+			log.Int("attempts", delivery.Attempts),
+			log.Error(err),
+		)
+	default:
+		delivery.NextAttemptAt = now.Add(d.backoff(delivery.Attempts))
+		delivery.LastError = err.Error()
+	}
+
+	return d.deliveries.UpdateDelivery(ctx, delivery)
+}
+
+// send posts the payload of a delivery to its webhook, succeeding on any 2xx response.
+// It returns the status code of the response, or zero if none was received.
+func (d *Dispatcher) send(ctx context.Context, webhook *models.Webhook, delivery *models.WebhookDelivery) (int, error) {
+	payload := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := d.now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set(WebhookIDHeader, webhook.ID)
+	req.Header.Set(EventHeader, delivery.EventType)
+	req.Header.Set(DeliveryHeader, delivery.ID)
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, Sign(webhook.Secret, timestamp, payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBody))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver answered %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff returns the wait before the attempt following the given number of attempts
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	wait := d.opts.BaseBackoff
+	for i := 1; i < attempts; i++ {
+		wait *= 2
+		if wait >= d.opts.MaxBackoff {
+			return d.opts.MaxBackoff
+		}
+	}
+	return wait
+}
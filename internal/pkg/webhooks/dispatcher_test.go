@@ -0,0 +1,362 @@
+package webhooks
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"urlshortener/internal/domain/models"
+	"urlshortener/internal/domain/repositories"
+)
+
+// fakeWebhookRepository keeps webhooks in memory
+type fakeWebhookRepository struct {
+	webhooks map[string]*models.Webhook
+}
+
+func newFakeWebhookRepository(webhooks ...*models.Webhook) *fakeWebhookRepository {
+	repo := &fakeWebhookRepository{webhooks: make(map[string]*models.Webhook)}
+	for _, webhook := range webhooks {
+		repo.webhooks[webhook.ID] = webhook
+	}
+	return repo
+}
+
+func (r *fakeWebhookRepository) CreateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	r.webhooks[webhook.ID] = webhook
+	return nil
+}
+
+func (r *fakeWebhookRepository) GetWebhook(ctx context.Context, id string) (*models.Webhook, error) {
+	webhook, ok := r.webhooks[id]
+	if !ok {
+		return nil, repositories.ErrWebhookNotFound
+	}
+	c := *webhook
+	return &c, nil
+}
+
+func (r *fakeWebhookRepository) ListWebhooks(ctx context.Context, owner string) ([]*models.Webhook, error) {
+	return nil, nil
+}
+
+func (r *fakeWebhookRepository) ListWebhooksForEvent(ctx context.Context, eventType string) ([]*models.Webhook, error) {
+	var webhooks []*models.Webhook
+	for _, webhook := range r.webhooks {
+		for _, event := range webhook.Events {
+			if event == eventType {
+				webhooks = append(webhooks, webhook)
+			}
+		}
+	}
+	sort.Slice(webhooks, func(i, j int) bool { return webhooks[i].ID < webhooks[j].ID })
+	return webhooks, nil
+}
+
+func (r *fakeWebhookRepository) UpdateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	r.webhooks[webhook.ID] = webhook
+	return nil
+}
+
+func (r *fakeWebhookRepository) DeleteWebhook(ctx context.Context, id string) error {
+	delete(r.webhooks, id)
+	return nil
+}
+
+// fakeDeliveryRepository keeps deliveries in memory, claiming them like the MongoDB queue
+type fakeDeliveryRepository struct {
+	mu         sync.Mutex
+	deliveries []*models.WebhookDelivery
+}
+
+func (r *fakeDeliveryRepository) EnqueueDeliveries(ctx context.Context, deliveries []*models.WebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, delivery := range deliveries {
+		duplicate := false
+		for _, queued := range r.deliveries {
+			duplicate = duplicate || (queued.WebhookID == delivery.WebhookID && queued.EventID == delivery.EventID)
+		}
+		if !duplicate {
+			delivery.ID = strconv.Itoa(len(r.deliveries) + 1)
+			r.deliveries = append(r.deliveries, delivery)
+		}
+	}
+	return nil
+}
+
+func (r *fakeDeliveryRepository) ClaimDelivery(ctx context.Context, now time.Time, lease time.Duration) (*models.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var due *models.WebhookDelivery
+	for _, delivery := range r.deliveries {
+		if delivery.Status != models.DeliveryPending || delivery.NextAttemptAt.After(now) {
+			continue
+		}
+		if delivery.LockedUntil != nil && delivery.LockedUntil.After(now) {
+			continue
+		}
+		if due == nil || delivery.NextAttemptAt.Before(due.NextAttemptAt) {
+			due = delivery
+		}
+	}
+	if due == nil {
+		return nil, nil
+	}
+	lockedUntil := now.Add(lease)
+	due.LockedUntil = &lockedUntil
+	c := *due
+	return &c, nil
+}
+
+func (r *fakeDeliveryRepository) UpdateDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, queued := range r.deliveries {
+		if queued.ID == delivery.ID {
+			c := *delivery
+			c.LockedUntil = nil
+			r.deliveries[i] = &c
+			return nil
+		}
+	}
+	return repositories.ErrDeliveryNotFound
+}
+
+func (r *fakeDeliveryRepository) GetDelivery(ctx context.Context, webhookID, id string) (*models.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, delivery := range r.deliveries {
+		if delivery.WebhookID == webhookID && delivery.ID == id {
+			c := *delivery
+			return &c, nil
+		}
+	}
+	return nil, repositories.ErrDeliveryNotFound
+}
+
+func (r *fakeDeliveryRepository) ListDeliveries(ctx context.Context, filter models.DeliveryFilter) ([]*models.WebhookDelivery, error) {
+	return nil, nil
+}
+
+func (r *fakeDeliveryRepository) ReplayDelivery(ctx context.Context, webhookID, id string, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, delivery := range r.deliveries {
+		if delivery.WebhookID == webhookID && delivery.ID == id {
+			delivery.Status = models.DeliveryPending
+			delivery.Attempts = 0
+			delivery.NextAttemptAt = now
+			return nil
+		}
+	}
+	return repositories.ErrDeliveryNotFound
+}
+
+func (r *fakeDeliveryRepository) ReplayDeadDeliveries(ctx context.Context, webhookID string, now time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (r *fakeDeliveryRepository) DeleteDeliveries(ctx context.Context, webhookID string) error {
+	return nil
+}
+
+// receiver records the requests sent to a local webhook endpoint, answering with the status codes given in turn
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   []string
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.requests = append(rc.requests, r)
+	rc.bodies = append(rc.bodies, string(body))
+	status := http.StatusNoContent
+	if len(rc.statuses) > 0 {
+		status, rc.statuses = rc.statuses[0], rc.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+// newTestDispatcher creates a dispatcher delivering to local receivers on a controlled clock
+func newTestDispatcher(webhooks repositories.WebhookRepository, deliveries repositories.WebhookDeliveryRepository, now *time.Time) *Dispatcher {
+	d := NewDispatcher(webhooks, deliveries, Options{
+		Timeout:              time.Second,
+		MaxAttempts:          3,
+		BaseBackoff:          time.Minute,
+		MaxBackoff:           90 * time.Second,
+		AllowPrivateNetworks: true,
+	})
+	d.now = func() time.Time { return *now }
+	return d
+}
+
+// TestDispatcher_Deliver tests that events are posted to the receivers subscribed to them with a valid signature
+func TestDispatcher_Deliver(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	rc := &receiver{}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+
+	webhooks := newFakeWebhookRepository(
+		&models.Webhook{ID: "wh1", URL: server.URL, Events: []string{models.EventLinkCreated}, Secret: "0123456789abcdef"},
+		&models.Webhook{ID: "wh2", URL: server.URL, Events: []string{models.EventLinkClicked}, Secret: "fedcba9876543210"},
+	)
+	deliveries := &fakeDeliveryRepository{}
+	notifier := NewNotifier(webhooks, deliveries)
+	notifier.now = func() time.Time { return now }
+
+	event := models.Event{ID: "evt1", Type: models.EventLinkCreated, OccurredAt: now, Data: &models.URL{ShortCode: "abc123"}}
+	assert.NoError(t, notifier.Notify(ctx, event))
+	// Queuing the same event again is ignored
+	assert.NoError(t, notifier.Notify(ctx, event))
+
+	attempted, err := newTestDispatcher(webhooks, deliveries, &now).DispatchDue(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, attempted)
+
+	assert.Len(t, rc.requests, 1)
+	req := rc.requests[0]
+	assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+	assert.Equal(t, "wh1", req.Header.Get(WebhookIDHeader))
+	assert.Equal(t, models.EventLinkCreated, req.Header.Get(EventHeader))
+	assert.Equal(t, "1", req.Header.Get(DeliveryHeader))
+	assert.Contains(t, rc.bodies[0], `"id":"evt1"`)
+	assert.Contains(t, rc.bodies[0], `"short_code":"abc123"`)
+
+	timestamp, err := strconv.ParseInt(req.Header.Get(TimestampHeader), 10, 64)
+	assert.NoError(t, err)
+	assert.Equal(t, now.Unix(), timestamp)
+	assert.True(t, Verify("0123456789abcdef", timestamp, []byte(rc.bodies[0]), req.Header.Get(SignatureHeader)))
+	assert.False(t, Verify("fedcba9876543210", timestamp, []byte(rc.bodies[0]), req.Header.Get(SignatureHeader)))
+
+	delivery, _ := deliveries.GetDelivery(ctx, "wh1", "1")
+	assert.Equal(t, models.DeliveryDelivered, delivery.Status)
+	assert.Equal(t, 1, delivery.Attempts)
+	assert.Equal(t, http.StatusNoContent, delivery.LastStatusCode)
+	assert.Equal(t, now, *delivery.DeliveredAt)
+}
+
+// TestDispatcher_RetryAndDeadLetter tests that failed deliveries back off exponentially,
+// are dead-lettered once out of attempts and can be replayed
+func TestDispatcher_RetryAndDeadLetter(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	rc := &receiver{statuses: []int{http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable}}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+
+	webhooks := newFakeWebhookRepository(&models.Webhook{ID: "wh1", URL: server.URL, Events: []string{models.EventLinkDeleted}, Secret: "0123456789abcdef"})
+	deliveries := &fakeDeliveryRepository{}
+	deliveries.EnqueueDeliveries(ctx, []*models.WebhookDelivery{
+		{WebhookID: "wh1", EventID: "evt1", EventType: models.EventLinkDeleted, Payload: `{"id":"evt1"}`, Status: models.DeliveryPending, NextAttemptAt: now},
+	})
+	dispatcher := newTestDispatcher(webhooks, deliveries, &now)
+
+	for i, wait := range []time.Duration{time.Minute, 90 * time.Second} {
+		attempted, err := dispatcher.DispatchDue(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, attempted, "attempt %d", i+1)
+
+		delivery, _ := deliveries.GetDelivery(ctx, "wh1", "1")
+		assert.Equal(t, models.DeliveryPending, delivery.Status)
+		assert.Equal(t, i+1, delivery.Attempts)
+		assert.Equal(t, now.Add(wait), delivery.NextAttemptAt)
+		assert.NotEmpty(t, delivery.LastError)
+
+		// Nothing is attempted before the backoff elapses
+		attempted, _ = dispatcher.DispatchDue(ctx)
+		assert.Equal(t, 0, attempted)
+		now = now.Add(wait)
+	}
+
+	attempted, err := dispatcher.DispatchDue(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, attempted)
+	delivery, _ := deliveries.GetDelivery(ctx, "wh1", "1")
+	assert.Equal(t, models.DeliveryDead, delivery.Status)
+	assert.Equal(t, 3, delivery.Attempts)
+	assert.Equal(t, http.StatusServiceUnavailable, delivery.LastStatusCode)
+
+	// A replayed dead letter is delivered with fresh attempts
+	assert.NoError(t, deliveries.ReplayDelivery(ctx, "wh1", "1", now))
+	attempted, err = dispatcher.DispatchDue(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, attempted)
+	delivery, _ = deliveries.GetDelivery(ctx, "wh1", "1")
+	assert.Equal(t, models.DeliveryDelivered, delivery.Status)
+	assert.Equal(t, 1, delivery.Attempts)
+	assert.Len(t, rc.requests, 4)
+}
+
+// TestDispatcher_Redirect tests that a receiver redirecting deliveries is treated as failing
+func TestDispatcher_Redirect(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	target := &receiver{}
+	targetServer := httptest.NewServer(target)
+	defer targetServer.Close()
+	redirecting := httptest.NewServer(http.RedirectHandler(targetServer.URL, http.StatusTemporaryRedirect))
+	defer redirecting.Close()
+
+	webhooks := newFakeWebhookRepository(&models.Webhook{ID: "wh1", URL: redirecting.URL, Secret: "0123456789abcdef"})
+	deliveries := &fakeDeliveryRepository{}
+	deliveries.EnqueueDeliveries(ctx, []*models.WebhookDelivery{
+		{WebhookID: "wh1", EventID: "evt1", Status: models.DeliveryPending, NextAttemptAt: now},
+	})
+
+	_, err := newTestDispatcher(webhooks, deliveries, &now).DispatchDue(ctx)
+	assert.NoError(t, err)
+
+	delivery, _ := deliveries.GetDelivery(ctx, "wh1", "1")
+	assert.Equal(t, models.DeliveryPending, delivery.Status)
+	assert.Equal(t, http.StatusTemporaryRedirect, delivery.LastStatusCode)
+	assert.Empty(t, target.requests)
+}
+
+// TestDispatcher_DeletedWebhook tests that deliveries of a deleted webhook are dead-lettered without being sent
+func TestDispatcher_DeletedWebhook(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	deliveries := &fakeDeliveryRepository{}
+	deliveries.EnqueueDeliveries(ctx, []*models.WebhookDelivery{
+		{WebhookID: "gone", EventID: "evt1", Status: models.DeliveryPending, NextAttemptAt: now},
+	})
+
+	attempted, err := newTestDispatcher(newFakeWebhookRepository(), deliveries, &now).DispatchDue(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, attempted)
+
+	delivery, _ := deliveries.GetDelivery(ctx, "gone", "1")
+	assert.Equal(t, models.DeliveryDead, delivery.Status)
+	assert.Equal(t, 0, delivery.Attempts)
+}
+
+func TestDispatcher_Backoff(t *testing.T) {
+	d := NewDispatcher(nil, nil, Options{})
+	for attempts, want := range map[int]time.Duration{
+		1:  30 * time.Second,
+		2:  time.Minute,
+		5:  8 * time.Minute,
+		10: 512 * 30 * time.Second,
+		11: DefaultMaxBackoff,
+		60: DefaultMaxBackoff,
+	} {
+		assert.Equal(t, want, d.backoff(attempts), fmt.Sprintf("after %d attempts", attempts))
+	}
+}
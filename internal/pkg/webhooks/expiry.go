@@ -0,0 +1,85 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	log "go.uber.org/zap"
+	"strconv"
+	"time"
+	"urlshortener/internal/domain/models"
+	"urlshortener/internal/domain/repositories"
+	"urlshortener/pkg/logger"
+)
+
+const (
+	// expiryInterval is how often the watcher looks for URLs whose active window ended
+	expiryInterval = time.Minute
+
+	// expiryLookback is how far back the first look reaches, so URLs ending while the service restarted are announced.
+	// Events already queued before the restart are deduplicated by their ID.
+	expiryLookback = time.Hour
+)
+
+// ExpiryWatcher announces link.expired when the active window of a URL ends.
+// URLs used up by their single visit are announced by the service as they are consumed.
+type ExpiryWatcher struct {
+	urls     repositories.URLRepository
+	notifier *Notifier
+	since    time.Time
+	now      func() time.Time
+}
+
+// NewExpiryWatcher creates a new instance of ExpiryWatcher queuing events with notifier
+func NewExpiryWatcher(urls repositories.URLRepository, notifier *Notifier) *ExpiryWatcher {
+	w := &ExpiryWatcher{urls: urls, notifier: notifier, now: time.Now}
+	w.since = w.now().Add(-expiryLookback)
+	return w
+}
+
+// Run announces the URLs that expired every minute until ctx is cancelled
+func (w *ExpiryWatcher) Run(ctx context.Context) {
+	for {
+		if _, err := w.Check(ctx); err != nil {
+			logger.GetLogger().Error("failed to announce expired urls", log.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(expiryInterval):
+		}
+	}
+}
+
+// Check announces every URL whose active window ended since the previous check and returns how many were announced.
+// On failure the period is checked again next time.
+func (w *ExpiryWatcher) Check(ctx context.Context) (int, error) {
+	now := w.now()
+	urls, err := w.urls.ListURLsEndedBetween(ctx, w.since, now)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, url := range urls {
+		event := models.Event{
+			ID:         expiryEventID(url),
+			Type:       models.EventLinkExpired,
+			OccurredAt: *url.ActiveUntil,
+			Data:       url,
+		}
+		if err := w.notifier.Notify(ctx, event); err != nil {
+			return i, err
+		}
+	}
+
+	w.since = now
+	return len(urls), nil
+}
+
+// expiryEventID derives the ID of the event announcing the end of the active window of url,
+// the same every time the window is seen so the event is queued once
+func expiryEventID(url *models.URL) string {
+	sum := sha256.Sum256([]byte(url.Domain + "/" + url.ShortCode + "@" + strconv.FormatInt(url.ActiveUntil.UnixNano(), 10)))
+	return hex.EncodeToString(sum[:12])
+}
@@ -0,0 +1,82 @@
+package webhooks
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"urlshortener/internal/domain/models"
+	"urlshortener/internal/domain/repositories"
+)
+
+// fakeURLRepository serves the URLs whose active window ended, leaving every other method to the interface
+type fakeURLRepository struct {
+	repositories.URLRepository
+	urls []*models.URL
+}
+
+func (r *fakeURLRepository) ListURLsEndedBetween(ctx context.Context, from, to time.Time) ([]*models.URL, error) {
+	var ended []*models.URL
+	for _, url := range r.urls {
+		if !url.ActiveUntil.Before(from) && url.ActiveUntil.Before(to) {
+			ended = append(ended, url)
+		}
+	}
+	return ended, nil
+}
+
+func TestExpiryWatcher_Check(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+
+	urls := &fakeURLRepository{urls: []*models.URL{
+		{Domain: "acme.link", ShortCode: "old", ActiveUntil: at(-2 * time.Hour)},
+		{Domain: "acme.link", ShortCode: "recent", ActiveUntil: at(-10 * time.Minute)},
+		{Domain: "acme.link", ShortCode: "soon", ActiveUntil: at(30 * time.Second)},
+	}}
+	webhooks := newFakeWebhookRepository(&models.Webhook{ID: "wh1", Events: []string{models.EventLinkExpired}})
+	deliveries := &fakeDeliveryRepository{}
+	notifier := NewNotifier(webhooks, deliveries)
+
+	watcher := NewExpiryWatcher(urls, notifier)
+	watcher.now = func() time.Time { return now }
+	watcher.since = now.Add(-expiryLookback)
+
+	// The first check reaches back over the lookback only
+	announced, err := watcher.Check(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, announced)
+
+	now = now.Add(time.Minute)
+	announced, err = watcher.Check(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, announced)
+	assert.Len(t, deliveries.deliveries, 2)
+	assert.Equal(t, models.EventLinkExpired, deliveries.deliveries[1].EventType)
+	assert.Contains(t, deliveries.deliveries[1].Payload, `"short_code":"soon"`)
+
+	// A restarted watcher announces the same expiries under the same IDs, so nothing is queued twice
+	again := NewExpiryWatcher(urls, notifier)
+	again.now = watcher.now
+	again.since = now.Add(-expiryLookback)
+	announced, err = again.Check(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, announced)
+	assert.Len(t, deliveries.deliveries, 2)
+}
+
+func TestSign(t *testing.T) {
+	payload := []byte(`{"id":"evt1"}`)
+	signature := Sign("0123456789abcdef", 1717243200, payload)
+
+	assert.Regexp(t, `^sha256=[0-9a-f]{64}$`, signature)
+	assert.True(t, Verify("0123456789abcdef", 1717243200, payload, signature))
+	assert.False(t, Verify("0123456789abcdef", 1717243201, payload, signature))
+	assert.False(t, Verify("0123456789abcdef", 1717243200, []byte(`{"id":"evt2"}`), signature))
+}
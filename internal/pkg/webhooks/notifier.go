@@ -0,0 +1,55 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+	"urlshortener/internal/domain/models"
+	"urlshortener/internal/domain/repositories"
+)
+
+// Notifier queues events for delivery to the webhooks subscribed to them
+type Notifier struct {
+	webhooks   repositories.WebhookRepository
+	deliveries repositories.WebhookDeliveryRepository
+	now        func() time.Time
+}
+
+// NewNotifier creates a new instance of Notifier
+func NewNotifier(webhooks repositories.WebhookRepository, deliveries repositories.WebhookDeliveryRepository) *Notifier {
+	return &Notifier{webhooks: webhooks, deliveries: deliveries, now: time.Now}
+}
+
+// Notify queues event for delivery to every webhook subscribed to its type.
+// Once it returns the deliveries are stored and survive restarts; an event already queued is ignored.
+// Webhooks receive URLs as API reads return them, without the destinations of password-protected or single-use URLs.
+func (n *Notifier) Notify(ctx context.Context, event models.Event) error {
+	webhooks, err := n.webhooks.ListWebhooksForEvent(ctx, event.Type)
+	if err != nil || len(webhooks) == 0 {
+		return err
+	}
+
+	if url, ok := event.Data.(*models.URL); ok {
+		event.Data = url.Redacted()
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	now := n.now()
+	deliveries := make([]*models.WebhookDelivery, len(webhooks))
+	for i, webhook := range webhooks {
+		deliveries[i] = &models.WebhookDelivery{
+			WebhookID:     webhook.ID,
+			EventID:       event.ID,
+			EventType:     event.Type,
+			Payload:       string(payload),
+			Status:        models.DeliveryPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+		}
+	}
+	return n.deliveries.EnqueueDeliveries(ctx, deliveries)
+}
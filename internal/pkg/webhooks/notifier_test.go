@@ -0,0 +1,30 @@
+package webhooks
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"urlshortener/internal/domain/models"
+)
+
+// TestNotifier_HidesProtectedDestination tests that webhooks are not told where a password-protected URL leads
+func TestNotifier_HidesProtectedDestination(t *testing.T) {
+	webhooks := newFakeWebhookRepository(&models.Webhook{ID: "wh1", Events: []string{models.EventLinkUpdated}})
+	deliveries := &fakeDeliveryRepository{}
+	notifier := NewNotifier(webhooks, deliveries)
+
+	protected := &models.URL{Domain: "acme.link", ShortCode: "secret", OriginalURL: "https://internal.example.com/docs", PasswordProtected: true}
+	assert.NoError(t, notifier.Notify(context.Background(), models.Event{ID: "evt1", Type: models.EventLinkUpdated, Data: protected}))
+	public := &models.URL{Domain: "acme.link", ShortCode: "public", OriginalURL: "https://example.com"}
+	assert.NoError(t, notifier.Notify(context.Background(), models.Event{ID: "evt2", Type: models.EventLinkUpdated, Data: public}))
+
+	if assert.Len(t, deliveries.deliveries, 2) {
+		assert.Contains(t, deliveries.deliveries[0].Payload, `"short_code":"secret"`)
+		assert.NotContains(t, deliveries.deliveries[0].Payload, "internal.example.com")
+		assert.Contains(t, deliveries.deliveries[1].Payload, `"original_url":"https://example.com"`)
+	}
+	// The event itself is left as is
+	assert.Equal(t, "https://internal.example.com/docs", protected.OriginalURL)
+}
@@ -0,0 +1,36 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+)
+
+// Headers sent with every delivery
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	TimestampHeader = "X-Webhook-Timestamp"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+	WebhookIDHeader = "X-Webhook-ID"
+)
+
+// signaturePrefix names the algorithm of a signature
+const signaturePrefix = "sha256="
+
+// Sign returns the signature of a payload sent at the given Unix timestamp: "sha256=" followed by
+// the hex-encoded HMAC-SHA256 of the timestamp, a dot and the payload, keyed with the webhook secret.
+// Covering the timestamp lets receivers reject replayed requests.
+func Sign(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is the signature of a payload sent at timestamp, comparing in constant time
+func Verify(secret string, timestamp int64, payload []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, payload)), []byte(signature))
+}
@@ -0,0 +1,74 @@
+package workerpool
+
+import (
+	"context"
+	"sync"
+)
+
+// Pool runs tasks in the background on a fixed number of workers.
+// Tasks wait in a bounded queue; when it is full new tasks are dropped rather than blocking the caller.
+type Pool struct {
+	tasks  chan func(ctx context.Context)
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// New starts a pool of workers sharing a queue of queueSize tasks
+func New(workers, queueSize int) *Pool {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Pool{
+		tasks:  make(chan func(ctx context.Context), queueSize),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+// Submit queues a task, reporting false if the queue is full or the pool is closed
+func (p *Pool) Submit(task func(ctx context.Context)) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return false
+	}
+
+	select {
+	case p.tasks <- task:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close stops accepting tasks, cancels the context of running ones and waits for the workers to finish.
+// Tasks still queued are run with the cancelled context so they can give up quickly.
+func (p *Pool) Close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	close(p.tasks)
+	p.mu.Unlock()
+
+	p.cancel()
+	p.wg.Wait()
+}
+
+// work runs queued tasks until the pool is closed
+func (p *Pool) work() {
+	defer p.wg.Done()
+	for task := range p.tasks {
+		task(p.ctx)
+	}
+}
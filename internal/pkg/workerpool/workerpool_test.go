@@ -0,0 +1,44 @@
+package workerpool
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestPoolRunsTasks tests that submitted tasks run before Close returns
+func TestPoolRunsTasks(t *testing.T) {
+	pool := New(3, 10)
+
+	var ran int32
+	for i := 0; i < 10; i++ {
+		assert.True(t, pool.Submit(func(ctx context.Context) {
+			atomic.AddInt32(&ran, 1)
+		}))
+	}
+	pool.Close()
+
+	assert.Equal(t, int32(10), atomic.LoadInt32(&ran))
+	assert.False(t, pool.Submit(func(ctx context.Context) {}))
+}
+
+// TestPoolDropsTasksWhenFull tests that Submit does not block once the queue is full
+func TestPoolDropsTasksWhenFull(t *testing.T) {
+	pool := New(1, 1)
+	defer pool.Close()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	assert.True(t, pool.Submit(func(ctx context.Context) {
+		close(started)
+		<-release
+	}))
+	<-started
+
+	// The worker is busy, so one task fits in the queue and the next is dropped
+	assert.True(t, pool.Submit(func(ctx context.Context) {}))
+	assert.False(t, pool.Submit(func(ctx context.Context) {}))
+	close(release)
+}
@@ -1,6 +1,8 @@
 package logger
 
 import (
+	"context"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -37,6 +39,24 @@ func GetLogger() *zap.Logger {
 	return log
 }
 
+// FromContext returns the logger with the IDs of the trace and span of ctx, if any,
+// so log lines can be found from a trace and the other way around
+func FromContext(ctx context.Context) *zap.Logger {
+	return GetLogger().With(TraceFields(ctx)...)
+}
+
+// TraceFields returns the fields naming the trace and span of ctx, or none if ctx is not part of a trace
+func TraceFields(ctx context.Context) []zap.Field {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.IsValid() {
+		return nil
+	}
+	return []zap.Field{
+		zap.String("trace_id", spanContext.TraceID().String()),
+		zap.String("span_id", spanContext.SpanID().String()),
+	}
+}
+
 // Sync flushes any buffered log entries
 func Sync() error {
 	if log != nil {